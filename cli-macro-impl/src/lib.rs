@@ -1028,7 +1028,7 @@ impl Operation {
         );
 
         let enum_item: syn::Variant = syn::parse2(quote!(
-                #[clap(alias = "get")]
+                #[clap(alias = "get", alias = "show")]
                 View(#struct_name)
         ))?;
 
@@ -0,0 +1,110 @@
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+
+/// What a batch conversion got through, saved as it goes so the batch can be picked up
+/// where it stopped with `--resume`.
+#[derive(Serialize, Deserialize, Clone, Debug, Default, PartialEq, Eq)]
+pub struct Manifest {
+    /// The command the batch was run with.
+    #[serde(default)]
+    pub command: String,
+    /// The inputs that were converted.
+    #[serde(default)]
+    pub completed: Vec<String>,
+    /// The inputs that failed the last time they were tried.
+    #[serde(default)]
+    pub failed: Vec<Failure>,
+}
+
+/// An input that failed to convert, and why.
+#[derive(Serialize, Deserialize, Clone, Debug, PartialEq, Eq)]
+pub struct Failure {
+    pub input: String,
+    pub error: String,
+}
+
+impl Manifest {
+    /// Load the manifest a previous batch saved.
+    pub fn load(path: &std::path::Path) -> Result<Manifest> {
+        let content =
+            std::fs::read_to_string(path).with_context(|| format!("failed to read manifest {}", path.display()))?;
+
+        serde_json::from_str(&content).with_context(|| format!("{} is not a batch manifest", path.display()))
+    }
+
+    /// Save the manifest, replacing the file at once so a batch that is stopped halfway
+    /// through leaves either the old manifest or the new one.
+    pub fn save(&self, path: &std::path::Path) -> Result<()> {
+        let tmp = path.with_extension("json.tmp");
+        std::fs::write(&tmp, serde_json::to_string_pretty(self)?)
+            .with_context(|| format!("failed to write file {}", tmp.display()))?;
+        std::fs::rename(&tmp, path).with_context(|| format!("failed to write file {}", path.display()))?;
+
+        Ok(())
+    }
+
+    /// Returns true if the input was converted already.
+    pub fn is_completed(&self, input: &std::path::Path) -> bool {
+        let input = input.display().to_string();
+        self.completed.iter().any(|c| *c == input)
+    }
+
+    /// Record that the input was converted.
+    pub fn complete(&mut self, input: &std::path::Path) {
+        let input = input.display().to_string();
+        self.failed.retain(|f| f.input != input);
+        if !self.completed.contains(&input) {
+            self.completed.push(input);
+        }
+    }
+
+    /// Record that the input failed to convert, replacing why it failed before.
+    pub fn fail(&mut self, input: &std::path::Path, error: &str) {
+        let input = input.display().to_string();
+        self.failed.retain(|f| f.input != input);
+        self.failed.push(Failure {
+            input,
+            error: error.to_string(),
+        });
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_manifest() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("manifest.json");
+        let a = std::path::Path::new("parts/a.step");
+        let b = std::path::Path::new("parts/b.step");
+
+        let mut manifest = Manifest::default();
+        manifest.complete(a);
+        manifest.fail(b, "timed out");
+        manifest.fail(b, "400 Bad Request");
+        manifest.save(&path).unwrap();
+
+        let mut manifest = Manifest::load(&path).unwrap();
+        assert!(manifest.is_completed(a));
+        assert!(!manifest.is_completed(b));
+        assert_eq!(
+            manifest.failed,
+            vec![Failure {
+                input: "parts/b.step".to_string(),
+                error: "400 Bad Request".to_string(),
+            }]
+        );
+
+        manifest.complete(b);
+        manifest.complete(a);
+        assert_eq!(manifest.completed, vec!["parts/a.step", "parts/b.step"]);
+        assert!(manifest.failed.is_empty());
+
+        std::fs::write(&path, "not json").unwrap();
+        assert!(Manifest::load(&path).is_err());
+    }
+}
@@ -0,0 +1,215 @@
+use anyhow::{anyhow, Context, Result};
+use serde::{de::DeserializeOwned, Deserialize, Serialize};
+
+/// How long we keep a cached response that isn't read or saved again, even one that
+/// never goes stale, so the cache doesn't grow forever.
+const KEEP_FOR: std::time::Duration = std::time::Duration::from_secs(30 * 24 * 60 * 60);
+
+/// A response saved on disk, so we can answer the same request again without the API.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+struct Entry<T> {
+    saved_at: chrono::DateTime<chrono::Utc>,
+    value: T,
+}
+
+/// Returns the key of a cached response from what identifies the request, see
+/// `Context::cache_scope` for who it was made as.
+pub fn key(parts: &[&str]) -> String {
+    let digest = ring::digest::digest(&ring::digest::SHA256, parts.join("\n").as_bytes());
+    data_encoding::HEXLOWER.encode(digest.as_ref())
+}
+
+fn path(dir: &std::path::Path, key: &str) -> std::path::PathBuf {
+    dir.join(format!("{}.json", key))
+}
+
+/// Returns the cached value for the key, if there is one younger than `max_age`. Without
+/// a `max_age` the value never goes stale, which is for responses that can't change.
+///
+/// A cache we can't read is the same as an empty one.
+pub fn get<T: DeserializeOwned>(dir: &std::path::Path, key: &str, max_age: Option<std::time::Duration>) -> Option<T> {
+    let contents = std::fs::read(path(dir, key)).ok()?;
+    let entry: Entry<T> = match serde_json::from_slice(&contents) {
+        Ok(entry) => entry,
+        Err(err) => {
+            log::debug!("ignoring cached response {}: {}", key, err);
+            return None;
+        }
+    };
+
+    if let Some(max_age) = max_age {
+        let age = chrono::Utc::now().signed_duration_since(entry.saved_at);
+        if age.to_std().unwrap_or_default() > max_age {
+            // It is no use to anyone anymore.
+            let _ = std::fs::remove_file(path(dir, key));
+            return None;
+        }
+    }
+
+    Some(entry.value)
+}
+
+/// Save a value in the cache under the key, removing the values that haven't been saved
+/// for a long time.
+pub fn put<T: Serialize>(dir: &std::path::Path, key: &str, value: &T) -> Result<()> {
+    create_dir(dir).with_context(|| format!("failed to create directory {}", dir.display()))?;
+    prune(dir, KEEP_FOR);
+
+    let entry = Entry {
+        saved_at: chrono::Utc::now(),
+        value,
+    };
+    let path = path(dir, key);
+    write(&path, &serde_json::to_vec(&entry)?).with_context(|| format!("failed to write file {}", path.display()))
+}
+
+/// Remove every cached value, a cache that was never made is already clear.
+pub fn clear(dir: &std::path::Path) -> Result<()> {
+    match std::fs::remove_dir_all(dir) {
+        Err(err) if err.kind() != std::io::ErrorKind::NotFound => {
+            Err(anyhow!("failed to remove directory {}: {}", dir.display(), err))
+        }
+        _ => Ok(()),
+    }
+}
+
+/// Create the cache directory so only we can look in it, the responses are our account's.
+#[cfg(unix)]
+fn create_dir(dir: &std::path::Path) -> std::io::Result<()> {
+    use std::os::unix::fs::DirBuilderExt;
+
+    std::fs::DirBuilder::new().recursive(true).mode(0o700).create(dir)
+}
+
+/// Create the cache directory so only we can look in it, the responses are our account's.
+#[cfg(not(unix))]
+fn create_dir(dir: &std::path::Path) -> std::io::Result<()> {
+    std::fs::create_dir_all(dir)
+}
+
+/// Write a cached response only we can read.
+#[cfg(unix)]
+fn write(path: &std::path::Path, contents: &[u8]) -> std::io::Result<()> {
+    use std::{io::Write, os::unix::fs::OpenOptionsExt};
+
+    std::fs::OpenOptions::new()
+        .write(true)
+        .create(true)
+        .truncate(true)
+        .mode(0o600)
+        .open(path)?
+        .write_all(contents)
+}
+
+/// Write a cached response only we can read.
+#[cfg(not(unix))]
+fn write(path: &std::path::Path, contents: &[u8]) -> std::io::Result<()> {
+    std::fs::write(path, contents)
+}
+
+/// Remove the cached values last saved longer than `keep_for` ago. It is only tidying up,
+/// so a file we can't remove is left for next time.
+fn prune(dir: &std::path::Path, keep_for: std::time::Duration) {
+    let entries = match std::fs::read_dir(dir) {
+        Ok(entries) => entries,
+        Err(_) => return,
+    };
+
+    for entry in entries.flatten() {
+        let path = entry.path();
+        if path.extension().map(|ext| ext != "json").unwrap_or(true) {
+            continue;
+        }
+
+        let saved = entry.metadata().and_then(|m| m.modified());
+        if let Ok(age) = saved.map(|saved| saved.elapsed().unwrap_or_default()) {
+            if age > keep_for {
+                log::debug!("removing old cached response {}", path.display());
+                let _ = std::fs::remove_file(&path);
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_cache() {
+        let dir = tempfile::tempdir().unwrap();
+        let dir = dir.path().join("cache");
+        let key = key(&["https://api.kittycad.io abc", "GET", "/user"]);
+
+        assert_eq!(get::<String>(&dir, &key, None), None);
+
+        put(&dir, &key, &"cached".to_string()).unwrap();
+        assert_eq!(get::<String>(&dir, &key, None), Some("cached".to_string()));
+        assert_eq!(
+            get::<String>(&dir, &key, Some(std::time::Duration::from_secs(60))),
+            Some("cached".to_string())
+        );
+        assert_eq!(get::<u32>(&dir, &key, None), None);
+
+        let stale = Entry {
+            saved_at: chrono::Utc::now() - chrono::Duration::minutes(10),
+            value: "stale".to_string(),
+        };
+        std::fs::write(path(&dir, &key), serde_json::to_vec(&stale).unwrap()).unwrap();
+        assert_eq!(
+            get::<String>(&dir, &key, Some(std::time::Duration::from_secs(300))),
+            None
+        );
+        assert_eq!(get::<String>(&dir, &key, None), None);
+    }
+
+    #[test]
+    fn test_prune() {
+        let dir = tempfile::tempdir().unwrap();
+        put(dir.path(), "old", &"old".to_string()).unwrap();
+        std::fs::write(dir.path().join("notes.txt"), "").unwrap();
+
+        std::thread::sleep(std::time::Duration::from_millis(50));
+        put(dir.path(), "new", &"new".to_string()).unwrap();
+        prune(dir.path(), std::time::Duration::from_millis(25));
+
+        assert_eq!(get::<String>(dir.path(), "old", None), None);
+        assert_eq!(get::<String>(dir.path(), "new", None), Some("new".to_string()));
+        assert!(dir.path().join("notes.txt").exists());
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_put_private() {
+        use std::os::unix::fs::PermissionsExt;
+
+        let dir = tempfile::tempdir().unwrap();
+        let dir = dir.path().join("cache");
+        put(&dir, "secret", &"secret".to_string()).unwrap();
+
+        let mode = |path: &std::path::Path| std::fs::metadata(path).unwrap().permissions().mode() & 0o777;
+        assert_eq!(mode(&dir), 0o700);
+        assert_eq!(mode(&path(&dir, "secret")), 0o600);
+    }
+
+    #[test]
+    fn test_clear() {
+        let dir = tempfile::tempdir().unwrap();
+        let dir = dir.path().join("cache");
+        clear(&dir).unwrap();
+
+        put(&dir, "key", &"value".to_string()).unwrap();
+        clear(&dir).unwrap();
+        assert_eq!(get::<String>(&dir, "key", None), None);
+        assert!(!dir.exists());
+    }
+
+    #[test]
+    fn test_key() {
+        assert_eq!(key(&["a", "b"]), key(&["a", "b"]));
+        assert_ne!(key(&["a", "b"]), key(&["a b"]));
+        assert_eq!(key(&["a"]).len(), 64);
+    }
+}
@@ -9,9 +9,21 @@ use anyhow::Result;
 /// This trait describes a command.
 #[async_trait::async_trait]
 pub trait Command {
+    /// Run the command, reading and writing the IO streams of the context.
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()>;
 }
 
+/// An error that makes `kittycad` exit with a specific code, so scripts can tell
+/// different failures apart.
+#[derive(Debug, thiserror::Error)]
+#[error("{message}")]
+pub struct ExitCodeError {
+    /// The code to exit with.
+    pub code: i32,
+    /// The message to print to stderr.
+    pub message: String,
+}
+
 /*pub trait CommandExamples {
     fn examples(&self) -> Vec<Example>;
 }*/
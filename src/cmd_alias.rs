@@ -1,4 +1,4 @@
-use std::io::Write;
+use std::{collections::BTreeMap, io::Write};
 
 use anyhow::{bail, Result};
 use clap::{Command, CommandFactory, Parser};
@@ -7,6 +7,9 @@ use clap::{Command, CommandFactory, Parser};
 ///
 /// Aliases can be used to make shortcuts for `kittycad` commands or to compose multiple commands.
 /// Run `kittycad help alias set` to learn more.
+///
+/// Teams can share a standard set of aliases by exporting them to a file kept alongside
+/// their repos, which everyone imports.
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdAlias {
@@ -19,6 +22,8 @@ enum SubCommand {
     Set(CmdAliasSet),
     Delete(CmdAliasDelete),
     List(CmdAliasList),
+    Export(CmdAliasExport),
+    Import(CmdAliasImport),
 }
 
 #[async_trait::async_trait]
@@ -28,6 +33,8 @@ impl crate::cmd::Command for CmdAlias {
             SubCommand::Delete(cmd) => cmd.run(ctx).await,
             SubCommand::Set(cmd) => cmd.run(ctx).await,
             SubCommand::List(cmd) => cmd.run(ctx).await,
+            SubCommand::Export(cmd) => cmd.run(ctx).await,
+            SubCommand::Import(cmd) => cmd.run(ctx).await,
         }
     }
 }
@@ -55,7 +62,7 @@ impl crate::cmd::Command for CmdAliasDelete {
             Ok(_) => {
                 let cs = ctx.io.color_scheme();
                 writeln!(
-                    ctx.io.out,
+                    ctx.io.err_out,
                     "{} Deleted alias {}; was {}",
                     cs.success_icon_with_color(ansi_term::Color::Red),
                     self.alias,
@@ -80,6 +87,19 @@ impl crate::cmd::Command for CmdAliasDelete {
 /// inserted appropriately. Otherwise, extra arguments will be appended to the expanded
 /// command.
 ///
+/// Named placeholders such as "$input" or "$output_format" are filled with the value of
+/// the flag of the same name given after the alias, "--input" or "--output-format". They
+/// make aliases for commands with many flags easier to read and use.
+///
+/// The expansion may start with another alias, which is expanded in turn. An alias that
+/// ends up expanding to itself is an error.
+///
+///     $ kittycad alias set conv 'file convert $input --output-format $format'
+///     $ kittycad conv --input my-part.step --format stl
+///
+///     $ kittycad alias set stl 'conv --format stl'
+///     $ kittycad stl --input my-part.step
+///
 /// Use "-" as expansion argument to read the expansion string from standard input. This
 /// is useful to avoid quoting issues when defining expansions.
 ///
@@ -107,6 +127,7 @@ impl crate::cmd::Command for CmdAliasSet {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
         let cs = ctx.io.color_scheme();
 
+        let aliases = current_aliases(ctx)?;
         let mut config_aliases = ctx.config.aliases()?;
 
         match get_expansion(self) {
@@ -117,20 +138,12 @@ impl crate::cmd::Command for CmdAliasSet {
                 }
                 is_shell = expansion.starts_with('!');
 
-                // Check if already exists.
-                if valid_command(&self.alias) {
-                    bail!("could not create alias: {} is already a kittycad command", self.alias);
-                }
-
-                if !is_shell && !valid_command(&expansion) {
-                    bail!(
-                        "could not create alias: {} does not correspond to a kittycad command",
-                        expansion
-                    );
+                if let Err(err) = check_alias(&self.alias, &expansion, &aliases) {
+                    bail!("could not create alias: {}", err);
                 }
 
                 writeln!(
-                    ctx.io.out,
+                    ctx.io.err_out,
                     "- Adding alias for {}: {}",
                     cs.bold(&self.alias),
                     cs.bold(&expansion)
@@ -150,7 +163,7 @@ impl crate::cmd::Command for CmdAliasSet {
 
                 match config_aliases.add(&self.alias, &expansion) {
                     Ok(_) => {
-                        writeln!(ctx.io.out, "{}", success_msg)?;
+                        writeln!(ctx.io.err_out, "{}", success_msg)?;
                     }
                     Err(e) => {
                         bail!("could not create alias: {}", e);
@@ -179,7 +192,7 @@ impl crate::cmd::Command for CmdAliasList {
         let config_aliases = ctx.config.aliases()?;
 
         if config_aliases.map.is_empty() {
-            writeln!(ctx.io.out, "no aliases configured")?;
+            writeln!(ctx.io.err_out, "no aliases configured")?;
             return Ok(());
         }
 
@@ -196,6 +209,197 @@ impl crate::cmd::Command for CmdAliasList {
     }
 }
 
+/// Export your aliases to a YAML file.
+///
+/// The file maps each alias to its expansion, import it with `kittycad alias import`.
+///
+///     # save your aliases for your team
+///     $ kittycad alias export kittycad-aliases.yml
+///
+///     # print them
+///     $ kittycad alias export
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdAliasExport {
+    /// The file to write the aliases to, or `-` for standard output.
+    #[clap(name = "file", default_value = "-")]
+    pub file: String,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdAliasExport {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let aliases = current_aliases(ctx)?;
+        let yaml = serde_yaml::to_string(&aliases)?;
+
+        if self.file == "-" {
+            write!(ctx.io.out, "{}", yaml)?;
+            return Ok(());
+        }
+
+        std::fs::write(&self.file, yaml)?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Exported {} aliases to {}",
+            cs.success_icon(),
+            aliases.len(),
+            self.file
+        )?;
+
+        Ok(())
+    }
+}
+
+/// Import aliases from a YAML file.
+///
+/// The file maps each alias to its expansion, like `kittycad alias export` writes it.
+/// Every alias is checked the way `kittycad alias set` checks it before any is added.
+///
+/// By default nothing is imported if an alias already exists with another expansion,
+/// pass `--clobber` to replace those or `--skip-existing` to keep yours.
+///
+///     # import your team's aliases
+///     $ kittycad alias import kittycad-aliases.yml
+///
+///     # import them, keeping the aliases you already have
+///     $ kittycad alias import kittycad-aliases.yml --skip-existing
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdAliasImport {
+    /// The file to read the aliases from, or `-` for standard input.
+    #[clap(name = "file", required = true)]
+    pub file: String,
+
+    /// Replace aliases that already exist with another expansion.
+    #[clap(long, conflicts_with = "skip_existing")]
+    pub clobber: bool,
+
+    /// Keep aliases that already exist with another expansion.
+    #[clap(long)]
+    pub skip_existing: bool,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdAliasImport {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let content = ctx.read_file(&self.file)?;
+        let imported: BTreeMap<String, String> = serde_yaml::from_slice(&content)
+            .map_err(|err| anyhow::anyhow!("invalid aliases file {}: {}", self.file, err))?;
+
+        let current = current_aliases(ctx)?;
+        let (add, skipped) = plan_import(&current, &imported, self.clobber, self.skip_existing)?;
+
+        let mut config_aliases = ctx.config.aliases()?;
+        for (alias, expansion) in &add {
+            config_aliases.add(alias, expansion)?;
+        }
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Imported {} aliases from {}",
+            cs.success_icon(),
+            add.len(),
+            self.file
+        )?;
+        if !skipped.is_empty() {
+            writeln!(
+                ctx.io.err_out,
+                "Kept your aliases {}, replace them with `--clobber`",
+                skipped.join(", ")
+            )?;
+        }
+
+        Ok(())
+    }
+}
+
+/// Returns your aliases and their expansions.
+fn current_aliases(ctx: &mut crate::context::Context) -> Result<BTreeMap<String, String>> {
+    let config_aliases = ctx.config.aliases()?;
+
+    Ok(config_aliases
+        .list()
+        .keys()
+        .map(|alias| (alias.to_string(), config_aliases.get(alias).0))
+        .collect())
+}
+
+/// Returns the aliases to add out of the imported ones and the ones skipped because you
+/// already have them with another expansion. Nothing is returned if any alias is invalid,
+/// or already exists and neither clobbering nor skipping them was asked for.
+fn plan_import(
+    current: &BTreeMap<String, String>,
+    imported: &BTreeMap<String, String>,
+    clobber: bool,
+    skip_existing: bool,
+) -> Result<(Vec<(String, String)>, Vec<String>)> {
+    let mut add = vec![];
+    let mut skipped = vec![];
+    let mut conflicts = vec![];
+    for (alias, expansion) in imported {
+        // Imported aliases can expand to each other as well as to yours.
+        let mut aliases = current.clone();
+        aliases.extend(imported.clone());
+        if let Err(err) = check_alias(alias, expansion, &aliases) {
+            bail!("invalid alias {}: {}", alias, err);
+        }
+
+        match current.get(alias) {
+            Some(existing) if existing == expansion => {}
+            Some(_) if skip_existing => skipped.push(alias.to_string()),
+            Some(_) if !clobber => conflicts.push(alias.to_string()),
+            _ => add.push((alias.to_string(), expansion.to_string())),
+        }
+    }
+
+    if !conflicts.is_empty() {
+        bail!(
+            "you already have the aliases {} with other expansions, replace them with `--clobber` or keep yours with `--skip-existing`",
+            conflicts.join(", ")
+        );
+    }
+
+    Ok((add, skipped))
+}
+
+/// Returns an error if the alias shadows a command or, unless it is a shell alias, its
+/// expansion isn't a `kittycad` command or another one of the aliases.
+fn check_alias(alias: &str, expansion: &str, aliases: &BTreeMap<String, String>) -> Result<()> {
+    if valid_command(alias) {
+        bail!("{} is already a kittycad command", alias);
+    }
+
+    if expansion.starts_with('!') {
+        return Ok(());
+    }
+
+    let first = shlex::split(expansion)
+        .and_then(|args| args.first().cloned())
+        .unwrap_or_default();
+    if first == alias {
+        bail!("{} can't expand to itself", alias);
+    }
+    if aliases.contains_key(&first) {
+        return Ok(());
+    }
+
+    // Named placeholders like `$format` only get a value when the alias is used, so
+    // don't hold it against the expansion that they aren't valid values yet.
+    let ignore: &[clap::ErrorKind] = if expansion.contains('$') {
+        &[clap::ErrorKind::InvalidValue, clap::ErrorKind::ValueValidation]
+    } else {
+        &[]
+    };
+    if !matches_command(expansion, ignore) {
+        bail!("{} does not correspond to a kittycad command", expansion);
+    }
+
+    Ok(())
+}
+
 fn get_expansion(cmd: &CmdAliasSet) -> Result<String> {
     if cmd.expansion == "-" {
         let mut expansion = String::new();
@@ -208,6 +412,12 @@ fn get_expansion(cmd: &CmdAliasSet) -> Result<String> {
 
 /// Check if a set of arguments is a valid `kittycad` command.
 pub fn valid_command(args: &str) -> bool {
+    matches_command(args, &[])
+}
+
+/// Check if a set of arguments is a `kittycad` command, letting errors of the kinds
+/// given through.
+fn matches_command(args: &str, ignore: &[clap::ErrorKind]) -> bool {
     let s = shlex::split(args);
     if s.is_none() {
         return false;
@@ -218,12 +428,21 @@ pub fn valid_command(args: &str) -> bool {
         return false;
     }
 
+    // Most aliases aren't commands, we can tell without building the whole app.
+    if !crate::command_tree::root()
+        .subcommands
+        .iter()
+        .any(|c| c.name == args[0] || c.aliases.contains(&args[0]))
+    {
+        return false;
+    }
+
     // Convert our opts into a clap app.
     let app: Command = crate::Opts::command();
 
     // Try to get matches.
     for subcmd in app.get_subcommands() {
-        if subcmd.get_name() != args[0] {
+        if subcmd.get_name() != args[0] && !subcmd.get_all_aliases().any(|alias| alias == args[0]) {
             continue;
         }
 
@@ -240,6 +459,7 @@ pub fn valid_command(args: &str) -> bool {
                     clap::ErrorKind::DisplayVersion => true,
                     clap::ErrorKind::MissingRequiredArgument => true,
                     clap::ErrorKind::DisplayHelpOnMissingArgumentOrSubcommand => true,
+                    kind if ignore.contains(&kind) => true,
                     _ => {
                         // If we get here, we have an invalid command.
                         false
@@ -260,6 +480,7 @@ mod test {
         name: String,
         cmd: crate::cmd_alias::SubCommand,
         want_out: String,
+        want_stderr: String,
         want_err: String,
     }
 
@@ -287,6 +508,11 @@ mod test {
                 cmd: "completion -s zsh".to_string(),
                 want: true,
             },
+            TestValidCommand {
+                name: "command alias".to_string(),
+                cmd: "aliases list".to_string(),
+                want: true,
+            },
             TestValidCommand {
                 name: "single arg invalid".to_string(),
                 cmd: "foo".to_string(),
@@ -309,11 +535,20 @@ mod test {
     #[tokio::test(flavor = "multi_thread", worker_threads = 1)]
     #[serial_test::serial]
     async fn test_cmd_alias() {
+        let dir = tempfile::tempdir().unwrap();
+        let team_aliases = dir.path().join("team-aliases.yml");
+        std::fs::write(&team_aliases, "cl: config list\ncs: config get\n").unwrap();
+        let team_aliases = team_aliases.to_str().unwrap();
+        let invalid_aliases = dir.path().join("invalid-aliases.yml");
+        std::fs::write(&invalid_aliases, "cg: config get\nconfig: alias set\n").unwrap();
+        let invalid_aliases = invalid_aliases.to_str().unwrap();
+
         let tests: Vec<TestAlias> = vec![
             TestAlias {
                 name: "list empty".to_string(),
                 cmd: crate::cmd_alias::SubCommand::List(crate::cmd_alias::CmdAliasList {}),
-                want_out: "no aliases configured\n".to_string(),
+                want_out: "".to_string(),
+                want_stderr: "no aliases configured\n".to_string(),
                 want_err: "".to_string(),
             },
             TestAlias {
@@ -323,7 +558,8 @@ mod test {
                     expansion: "config set".to_string(),
                     shell: false,
                 }),
-                want_out: "- Adding alias for cs: config set\n✔ Added alias.\n".to_string(),
+                want_out: "".to_string(),
+                want_stderr: "- Adding alias for cs: config set\n✔ Added alias.\n".to_string(),
                 want_err: "".to_string(),
             },
             TestAlias {
@@ -333,7 +569,8 @@ mod test {
                     expansion: "config get".to_string(),
                     shell: false,
                 }),
-                want_out: "- Adding alias for cs: config get\n✔ Changed alias cs from config set to config get\n"
+                want_out: "".to_string(),
+                want_stderr: "- Adding alias for cs: config get\n✔ Changed alias cs from config set to config get\n"
                     .to_string(),
                 want_err: "".to_string(),
             },
@@ -344,7 +581,8 @@ mod test {
                     expansion: "config list".to_string(),
                     shell: true,
                 }),
-                want_out: "- Adding alias for cp: !config list\n✔ Added alias.\n".to_string(),
+                want_out: "".to_string(),
+                want_stderr: "- Adding alias for cp: !config list\n✔ Added alias.\n".to_string(),
                 want_err: "".to_string(),
             },
             TestAlias {
@@ -354,7 +592,8 @@ mod test {
                     expansion: "config set $1 $2".to_string(),
                     shell: false,
                 }),
-                want_out:
+                want_out: "".to_string(),
+                want_stderr:
                     "- Adding alias for cs: config set $1 $2\n✔ Changed alias cs from config get to config set $1 $2"
                         .to_string(),
                 want_err: "".to_string(),
@@ -367,6 +606,7 @@ mod test {
                     shell: false,
                 }),
                 want_out: "".to_string(),
+                want_stderr: "".to_string(),
                 want_err: "could not create alias: config is already a kittycad command".to_string(),
             },
             TestAlias {
@@ -377,6 +617,7 @@ mod test {
                     shell: false,
                 }),
                 want_out: "".to_string(),
+                want_stderr: "".to_string(),
                 want_err: "could not create alias: completion is already a kittycad command".to_string(),
             },
             TestAlias {
@@ -387,12 +628,14 @@ mod test {
                     shell: false,
                 }),
                 want_out: "".to_string(),
+                want_stderr: "".to_string(),
                 want_err: "could not create alias: dne thing does not correspond to a kittycad command".to_string(),
             },
             TestAlias {
                 name: "list all".to_string(),
                 cmd: crate::cmd_alias::SubCommand::List(crate::cmd_alias::CmdAliasList {}),
                 want_out: "\"!config list\"\n".to_string(),
+                want_stderr: "".to_string(),
                 want_err: "".to_string(),
             },
             TestAlias {
@@ -400,7 +643,8 @@ mod test {
                 cmd: crate::cmd_alias::SubCommand::Delete(crate::cmd_alias::CmdAliasDelete {
                     alias: "cp".to_string(),
                 }),
-                want_out: "Deleted alias cp; was !config list".to_string(),
+                want_out: "".to_string(),
+                want_stderr: "Deleted alias cp; was !config list".to_string(),
                 want_err: "".to_string(),
             },
             TestAlias {
@@ -409,12 +653,61 @@ mod test {
                     alias: "thing".to_string(),
                 }),
                 want_out: "".to_string(),
+                want_stderr: "".to_string(),
                 want_err: "no such alias thing".to_string(),
             },
             TestAlias {
                 name: "list after delete".to_string(),
                 cmd: crate::cmd_alias::SubCommand::List(crate::cmd_alias::CmdAliasList {}),
                 want_out: "cs:  \"config set $1 $2\"\n".to_string(),
+                want_stderr: "".to_string(),
+                want_err: "".to_string(),
+            },
+            TestAlias {
+                name: "export".to_string(),
+                cmd: crate::cmd_alias::SubCommand::Export(crate::cmd_alias::CmdAliasExport { file: "-".to_string() }),
+                want_out: "cs: config set $1 $2\n".to_string(),
+                want_stderr: "".to_string(),
+                want_err: "".to_string(),
+            },
+            TestAlias {
+                name: "import with an existing alias".to_string(),
+                cmd: crate::cmd_alias::SubCommand::Import(crate::cmd_alias::CmdAliasImport {
+                    file: team_aliases.to_string(),
+                    clobber: false,
+                    skip_existing: false,
+                }),
+                want_out: "".to_string(),
+                want_stderr: "".to_string(),
+                want_err: "you already have the aliases cs with other expansions".to_string(),
+            },
+            TestAlias {
+                name: "import skipping existing aliases".to_string(),
+                cmd: crate::cmd_alias::SubCommand::Import(crate::cmd_alias::CmdAliasImport {
+                    file: team_aliases.to_string(),
+                    clobber: false,
+                    skip_existing: true,
+                }),
+                want_out: "".to_string(),
+                want_stderr: "✔ Imported 1 aliases from".to_string(),
+                want_err: "".to_string(),
+            },
+            TestAlias {
+                name: "import an invalid alias".to_string(),
+                cmd: crate::cmd_alias::SubCommand::Import(crate::cmd_alias::CmdAliasImport {
+                    file: invalid_aliases.to_string(),
+                    clobber: true,
+                    skip_existing: false,
+                }),
+                want_out: "".to_string(),
+                want_stderr: "".to_string(),
+                want_err: "invalid alias config: config is already a kittycad command".to_string(),
+            },
+            TestAlias {
+                name: "list after import".to_string(),
+                cmd: crate::cmd_alias::SubCommand::List(crate::cmd_alias::CmdAliasList {}),
+                want_out: "cl:  \"config list\"\n".to_string(),
+                want_stderr: "".to_string(),
                 want_err: "".to_string(),
             },
         ];
@@ -426,11 +719,7 @@ mod test {
             let (mut io, stdout_path, stderr_path) = crate::iostreams::IoStreams::test();
             io.set_stdout_tty(false);
             io.set_color_enabled(false);
-            let mut ctx = crate::context::Context {
-                config: &mut c,
-                io,
-                debug: false,
-            };
+            let mut ctx = crate::context::Context::with_io(&mut c, io);
 
             let cmd_alias = crate::cmd_alias::CmdAlias { subcmd: t.cmd };
 
@@ -447,10 +736,19 @@ mod test {
                 t.want_out
             );
 
+            // Messages for humans go to stderr, so stdout only ever has data in it.
+            assert!(
+                stderr.contains(&t.want_stderr),
+                "test {} ->\nstderr: {}\nwant: {}",
+                t.name,
+                stderr,
+                t.want_stderr
+            );
+
             match result {
                 Ok(()) => {
                     assert!(stdout.is_empty() == t.want_out.is_empty(), "test {}", t.name);
-                    assert!(stderr.is_empty(), "test {}", t.name);
+                    assert!(stderr.is_empty() == t.want_stderr.is_empty(), "test {}", t.name);
                 }
                 Err(err) => {
                     assert!(
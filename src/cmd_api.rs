@@ -34,6 +34,18 @@ use serde::{Deserialize, Serialize};
 ///
 /// In `--paginate` mode, all pages of results will sequentially be requested until
 /// there are no more pages of results.
+///
+/// By default the response is requested in the newest schema version the CLI
+/// understands. Use `--accept` to ask for a different media type, e.g.
+/// `--accept application/vnd.kittycad.v2+json`, or pin the version for a host with
+/// `kittycad config set -H <host> api_version v1`. Responses that are not JSON are
+/// written to standard output as-is.
+///
+/// Pass `--cache` with how long to keep the response, e.g. "5m", to save the response
+/// of a GET request on disk and answer the same request from it until then. This
+/// speeds up scripts that look up the same thing over and over. Pass `--no-cache` to
+/// always send the request, e.g. when `--cache` is one of your defaults for `api`.
+/// Cached responses are removed once they are a month old.
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdApi {
@@ -68,6 +80,73 @@ pub struct CmdApi {
     /// Add a HTTP request header in `key:value` format.
     #[clap(short = 'H', long)]
     pub header: Vec<String>,
+
+    /// The media type to ask for in the `Accept` header. An `Accept` header passed with
+    /// `--header` takes precedence.
+    #[clap(long)]
+    pub accept: Option<String>,
+
+    /// Cache the response for this long, e.g. "5m" or "1h". Only GET requests are cached.
+    #[clap(long, conflicts_with = "include", parse(try_from_str = crate::types::parse_duration))]
+    pub cache: Option<std::time::Duration>,
+
+    /// Always send the request, neither answering from nor saving to the cache.
+    #[clap(long)]
+    pub no_cache: bool,
+}
+
+/// A response of the `api` command saved with `--cache`.
+#[derive(Debug, Clone, Deserialize, Serialize)]
+#[serde(rename_all = "snake_case")]
+enum CachedResponse {
+    Json(serde_json::Value),
+    /// The body of a response that isn't JSON, base64 encoded.
+    Raw(String),
+}
+
+impl CachedResponse {
+    fn write(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        match self {
+            CachedResponse::Json(json) => ctx.io.write_output_json(json),
+            CachedResponse::Raw(body) => {
+                let body = data_encoding::BASE64
+                    .decode(body.as_bytes())
+                    .map_err(|err| anyhow!("invalid cached response: {}", err))?;
+                ctx.io.out.write_all(&body)?;
+                Ok(())
+            }
+        }
+    }
+}
+
+/// The media types the CLI can read responses in, newest schema version first.
+///
+/// We ask for all of them by default, so the API sends the newest version we both
+/// support. Add new versions to the front as the CLI learns them.
+const SUPPORTED_MEDIA_TYPES: &[&str] = &["application/json"];
+
+/// Returns the `Accept` header to send when the user didn't ask for a media type,
+/// preferring the media types in the order given.
+fn default_accept(media_types: &[&str]) -> String {
+    media_types
+        .iter()
+        .enumerate()
+        .map(|(i, media_type)| {
+            if i == 0 {
+                media_type.to_string()
+            } else {
+                format!("{};q={:.1}", media_type, (1.0 - 0.1 * i as f64).max(0.1))
+            }
+        })
+        .collect::<Vec<String>>()
+        .join(", ")
+}
+
+/// Returns true if the content type is JSON, including vendor types like
+/// `application/vnd.kittycad.v2+json`.
+fn is_json_content_type(content_type: &str) -> bool {
+    let media_type = content_type.split(';').next().unwrap_or("").trim().to_lowercase();
+    media_type == "application/json" || (media_type.starts_with("application/") && media_type.ends_with("+json"))
 }
 
 /// The JSON type for a paginated response.
@@ -84,6 +163,9 @@ impl crate::cmd::Command for CmdApi {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
         // Let's get the api client.
         let client = ctx.api_client("")?;
+        let max_body_size = ctx.max_body_size()?;
+        let retry_policy = ctx.retry_policy()?;
+        let http_log = ctx.http_log();
 
         // Make sure the endpoint starts with a slash.
         let mut endpoint = self.endpoint.to_string();
@@ -146,28 +228,68 @@ impl crate::cmd::Command for CmdApi {
             }
         }
 
+        // Parse the headers.
+        let mut headers = self.parse_headers()?;
+        if !headers.keys().any(|key| key.eq_ignore_ascii_case("accept")) {
+            let (host, _) = ctx.resolve_host("")?;
+            let accept = match (&self.accept, ctx.pinned_media_type(&host)) {
+                (Some(accept), _) => accept.to_string(),
+                (None, Some(pinned)) => pinned,
+                (None, None) => default_accept(SUPPORTED_MEDIA_TYPES),
+            };
+            headers.insert("Accept".to_string(), accept);
+        }
+
+        // Answer from the cache if we have a fresh enough response.
+        let cache_dir = std::path::PathBuf::from(crate::config_file::cache_dir()?);
+        let max_age = if self.no_cache { None } else { self.cache };
+        let cache_key = match max_age {
+            Some(_) if method != http::method::Method::GET => {
+                return Err(anyhow!("the `--cache` option is only supported for GET requests"));
+            }
+            Some(max_age) => {
+                let key = cache_key(&ctx.cache_scope("")?, &endpoint, self.paginate, &headers, &bytes);
+                if let Some(cached) = crate::cache::get::<CachedResponse>(&cache_dir, &key, Some(max_age)) {
+                    return cached.write(ctx);
+                }
+                Some(key)
+            }
+            None => None,
+        };
+        let save = |response: &CachedResponse| match &cache_key {
+            Some(key) => crate::cache::put(&cache_dir, key, response),
+            None => Ok(()),
+        };
+
         // Make the request.
+        let client = &client;
         let mut has_next_page = true;
         let mut result = serde_json::Value::Null;
         let mut page_results: Vec<serde_json::Value> = Vec::new();
         while has_next_page {
-            let body = if bytes.is_empty() {
-                None
-            } else {
-                Some(reqwest::Body::from(bytes.clone()))
-            };
-
-            let mut req = client.request_raw(method.clone(), &endpoint, body).await?;
+            // The request is rebuilt for every attempt, since the body can only be sent once.
+            let resp = crate::retry::send(&retry_policy, &http_log, &method, || {
+                let method = method.clone();
+                let endpoint = endpoint.clone();
+                let headers = headers.clone();
+                let body = if bytes.is_empty() {
+                    None
+                } else {
+                    Some(reqwest::Body::from(bytes.clone()))
+                };
+
+                async move {
+                    let mut req = client.request_raw(method, &endpoint, body).await?;
+
+                    // Let's add our headers.
+                    for (key, value) in headers {
+                        req = req.header(key, value);
+                    }
 
-            // Let's add our headers.
-            let headers = self.parse_headers()?;
-            if !headers.is_empty() {
-                for (key, value) in headers {
-                    req = req.header(key, value);
+                    Ok(req)
                 }
-            }
-
-            let resp = req.send().await?;
+            })
+            .await?;
 
             // Print the response headers if requested.
             if self.include {
@@ -187,8 +309,29 @@ impl crate::cmd::Command for CmdApi {
                 ));
             }
 
+            let content_type = resp
+                .headers()
+                .get(reqwest::header::CONTENT_TYPE)
+                .and_then(|v| v.to_str().ok())
+                .unwrap_or("application/json")
+                .to_string();
+            if !is_json_content_type(&content_type) {
+                if self.paginate {
+                    return Err(anyhow!(
+                        "the `--paginate` option is only supported for JSON responses, got {}",
+                        content_type
+                    ));
+                }
+
+                // Pass anything that isn't JSON straight through, e.g. images or text.
+                let body = crate::http_body::read_limited(resp, max_body_size).await?;
+                save(&CachedResponse::Raw(data_encoding::BASE64.encode(&body)))?;
+                ctx.io.out.write_all(&body)?;
+                return Ok(());
+            }
+
             if self.paginate {
-                let mut page: PaginatableResponse = resp.json().await?;
+                let mut page: PaginatableResponse = crate::http_body::read_json(resp, max_body_size).await?;
 
                 if !page.items.is_empty() {
                     page_results.append(&mut page.items);
@@ -204,7 +347,7 @@ impl crate::cmd::Command for CmdApi {
                 }
             } else {
                 // Read the response body.
-                result = resp.json().await?;
+                result = crate::http_body::read_json(resp, max_body_size).await?;
                 has_next_page = false;
             }
         }
@@ -213,7 +356,9 @@ impl crate::cmd::Command for CmdApi {
             result = serde_json::Value::Array(page_results);
         }
 
-        ctx.io.write_output_json(&result)?;
+        let response = CachedResponse::Json(result);
+        save(&response)?;
+        response.write(ctx)?;
 
         Ok(())
     }
@@ -322,6 +467,23 @@ fn print_headers(ctx: &mut crate::context::Context, headers: &reqwest::header::H
     Ok(())
 }
 
+/// Returns the cache key of a request, from everything that can change its response.
+fn cache_key(scope: &str, endpoint: &str, paginate: bool, headers: &HashMap<String, String>, body: &[u8]) -> String {
+    let mut headers: Vec<String> = headers
+        .iter()
+        .map(|(key, value)| format!("{}:{}", key.to_lowercase(), value))
+        .collect();
+    headers.sort();
+
+    crate::cache::key(&[
+        scope,
+        endpoint,
+        &paginate.to_string(),
+        &headers.join("\n"),
+        &String::from_utf8_lossy(body),
+    ])
+}
+
 fn add_query_string(endpoint: &str, query_string: &str) -> String {
     if endpoint.contains('?') {
         format!("{}&{}", endpoint, query_string)
@@ -336,6 +498,61 @@ mod test {
 
     use super::*;
 
+    #[test]
+    fn test_default_accept() {
+        assert_eq!(default_accept(&["application/json"]), "application/json");
+        assert_eq!(
+            default_accept(&["application/vnd.kittycad.v2+json", "application/json"]),
+            "application/vnd.kittycad.v2+json, application/json;q=0.9"
+        );
+    }
+
+    #[test]
+    fn test_no_cache() {
+        let cmd = CmdApi::try_parse_from(["api", "/user", "--cache", "5m", "--no-cache"]).unwrap();
+        assert_eq!(cmd.cache, Some(std::time::Duration::from_secs(300)));
+        assert!(cmd.no_cache);
+    }
+
+    #[test]
+    fn test_cache_key() {
+        let headers = HashMap::from([
+            ("Accept".to_string(), "application/json".to_string()),
+            ("X-Foo".to_string(), "bar".to_string()),
+        ]);
+        let key = cache_key("https://api.kittycad.io abc", "/user", false, &headers, b"");
+
+        let mut same = HashMap::new();
+        same.insert("x-foo".to_string(), "bar".to_string());
+        same.insert("accept".to_string(), "application/json".to_string());
+        assert_eq!(
+            cache_key("https://api.kittycad.io abc", "/user", false, &same, b""),
+            key
+        );
+
+        assert_ne!(
+            cache_key("https://api.kittycad.io def", "/user", false, &headers, b""),
+            key
+        );
+        assert_ne!(
+            cache_key("https://api.kittycad.io abc", "/user", true, &headers, b""),
+            key
+        );
+        assert_ne!(
+            cache_key("https://api.kittycad.io abc", "/users", false, &headers, b""),
+            key
+        );
+    }
+
+    #[test]
+    fn test_is_json_content_type() {
+        assert!(is_json_content_type("application/json"));
+        assert!(is_json_content_type("application/json; charset=utf-8"));
+        assert!(is_json_content_type("application/vnd.kittycad.v2+json"));
+        assert!(!is_json_content_type("image/png"));
+        assert!(!is_json_content_type("text/plain"));
+    }
+
     #[test]
     fn test_add_query_string() {
         let mut endpoint = "https://api.github.com/users/octocat/repos";
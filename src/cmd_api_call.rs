@@ -1,5 +1,8 @@
+use std::{collections::BTreeMap, io::Write};
+
 use anyhow::Result;
 use clap::Parser;
+use serde::{Deserialize, Serialize};
 
 /// Perform operations on CAD files.
 ///
@@ -14,14 +17,20 @@ pub struct CmdApiCall {
 
 #[derive(Parser, Debug, Clone)]
 enum SubCommand {
+    List(CmdApiCallList),
+    Stats(CmdApiCallStats),
     Status(CmdApiCallStatus),
+    Wait(CmdApiCallWait),
 }
 
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdApiCall {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
         match &self.subcmd {
+            SubCommand::List(cmd) => cmd.run(ctx).await,
+            SubCommand::Stats(cmd) => cmd.run(ctx).await,
             SubCommand::Status(cmd) => cmd.run(ctx).await,
+            SubCommand::Wait(cmd) => cmd.run(ctx).await,
         }
     }
 }
@@ -30,12 +39,60 @@ impl crate::cmd::Command for CmdApiCall {
 ///
 ///     # get the status of an async API call
 ///     $ kittycad api-call status <id>
+///
+///     # get the status as yaml
+///     $ kittycad api-call status <id> --format=yaml
+///
+///     # pick one of the API calls you started from this machine
+///     $ kittycad api-call status
+///
+///     # keep checking the status until the API call finishes
+///     $ kittycad api-call status <id> --watch
+///
+///     # ask the API even if the finished API call is cached
+///     $ kittycad api-call status <id> --no-cache
+///
+///     # on a flaky connection, keep what has been downloaded of a big conversion, and
+///     # if the download is cut short, run it again to pick it up where it left off
+///     $ kittycad api-call status <id> --resume
+///
+/// API calls that have completed or failed don't change anymore, so we cache them on
+/// disk. This also lets you look at them again when you are offline.
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdApiCallStatus {
-    /// The ID of the API call.
-    #[clap(name = "id", required = true)]
-    pub id: uuid::Uuid,
+    /// The ID of the API call. If it is not given in a terminal, you can pick one of the
+    /// API calls you started from this machine.
+    #[clap(name = "id", required = false)]
+    pub id: Option<uuid::Uuid>,
+
+    /// Never show a picker, require the ID instead. Useful for scripts.
+    #[clap(long)]
+    pub no_picker: bool,
+
+    /// Gzip the output of a file conversion as it is saved, adding a `.gz` extension.
+    #[clap(long)]
+    pub gzip_output: bool,
+
+    /// Keep checking the status until the API call has finished, showing it as it
+    /// changes.
+    #[clap(long, short)]
+    pub watch: bool,
+
+    /// How long to wait between checking the status with `--watch`.
+    #[clap(long, default_value = "2s", requires = "watch", parse(try_from_str = crate::types::parse_interval))]
+    pub interval: std::time::Duration,
+
+    /// Always ask the API for the status, rather than using a cached finished API call.
+    #[clap(long)]
+    pub no_cache: bool,
+
+    /// Keep what has been downloaded in `<id>.part` in the current directory, with its
+    /// ETag in `<id>.part.etag`, and pick up from there if an earlier download was cut
+    /// short. Meant for finished API calls with big outputs, if the response changed in
+    /// between it is downloaded again from the start.
+    #[clap(long, conflicts_with = "watch")]
+    pub resume: bool,
 
     /// Command output format.
     #[clap(long, short, arg_enum)]
@@ -45,35 +102,806 @@ pub struct CmdApiCallStatus {
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdApiCallStatus {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
-        let client = ctx.api_client("")?;
+        let id = match self.id {
+            Some(id) => id,
+            None if crate::picker::enabled(ctx, self.no_picker) => crate::picker::pick_from_history()?,
+            None => anyhow::bail!("the ID of the API call is required when not running interactively"),
+        };
 
-        let api_call = client.api_calls().get_async_operation(&self.id.to_string()).await?;
+        let path = std::env::current_dir()?;
+        let mut api_call = if self.watch {
+            watch_async_operation(ctx, &id, self.interval, !self.no_cache).await?
+        } else if self.resume {
+            let part = path.join(format!("{}.part", id));
+            get_async_operation_with_resume(ctx, &id, !self.no_cache, Some(&part)).await?
+        } else {
+            get_async_operation(ctx, &id, !self.no_cache).await?
+        };
 
         // If it is a file conversion and there is output, we need to save that output to a file
         // for them.
-        if let kittycad::types::AsyncApiCallOutput::FileConversion(fc) = &api_call {
-            if fc.status == kittycad::types::ApiCallStatus::Completed {
-                if let Some(output) = &fc.output {
-                    if !output.is_empty() {
-                        let path = std::env::current_dir()?;
-                        let path = path.join(format!("{}.{}", self.id, fc.output_format));
-                        std::fs::write(&path, &output.0)?;
-
-                        // Tell them where we saved the file.
-                        writeln!(ctx.io.out, "Saved file conversion output to {}", path.display())?;
-                        // Return early.
-                        return Ok(());
-                    } else {
-                        anyhow::bail!("no output was generated for the file conversion! (this is probably a bug in the API) you should report it to support@kittycad.io");
-                    }
+        save_conversion_output(ctx, &mut api_call, self.gzip_output, |format| {
+            path.join(format!("{}.{}", id, format))
+        })?;
+
+        // Print the output of the conversion.
+        write_async_operation(ctx, &self.format, &api_call)
+    }
+}
+
+/// Wait for an async API call to finish.
+///
+/// This polls the API call until it has completed or failed, which makes it useful
+/// for scripts. Use the global `--timeout` flag to bound how long to wait, without it
+/// the command gives up after 30 minutes and exits with 3.
+///
+/// The command exits with 0 if the API call completed, 2 if it failed, and one of the
+/// codes listed by `kittycad help exit-codes` for any other error.
+///
+///     # wait for an async API call to finish
+///     $ kittycad api-call wait <id>
+///
+///     # wait for a file conversion and save its output
+///     $ kittycad api-call wait <id> --output my-file.obj
+///
+///     # or write only the output to stdout, to pipe it to another command
+///     $ kittycad api-call wait <id> --output - | gzip > my-file.obj.gz
+///
+///     # poll every 10 seconds and give up after 5 minutes
+///     $ kittycad api-call wait <id> --interval 10s --timeout 5m
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdApiCallWait {
+    /// The ID of the API call.
+    #[clap(name = "id", required = true)]
+    pub id: uuid::Uuid,
+
+    /// How long to wait between checking the status of the API call.
+    #[clap(long, default_value = "2s", parse(try_from_str = crate::types::parse_interval))]
+    pub interval: std::time::Duration,
+
+    /// Where to save the output of a file conversion once it has completed, `-` to
+    /// write it to stdout.
+    #[clap(long, short, parse(from_os_str))]
+    pub output: Option<std::path::PathBuf>,
+
+    /// Gzip the saved output, adding a `.gz` extension.
+    #[clap(long, requires = "output")]
+    pub gzip_output: bool,
+
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdApiCallWait {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        if ctx.io.is_stderr_tty() {
+            writeln!(ctx.io.err_out, "Waiting for API call {} to finish...", self.id)?;
+        }
+
+        let mut api_call = wait_for(ctx, &self.id, self.interval).await?;
+
+        if let Some(output) = &self.output {
+            save_conversion_output(ctx, &mut api_call, self.gzip_output, |_| output.clone())?;
+        } else if let kittycad::types::AsyncApiCallOutput::FileConversion(fc) = &mut api_call {
+            // Otherwise what we print will be crazy big.
+            fc.output = None;
+        }
+
+        // Stdout only gets the output of the conversion when it is written there.
+        let to_stdout = self
+            .output
+            .as_deref()
+            .map(crate::output_file::is_stdout)
+            .unwrap_or(false);
+        if !to_stdout {
+            write_async_operation(ctx, &self.format, &api_call)?;
+        }
+
+        let (status, error) = async_operation_status(&api_call);
+        if status == kittycad::types::ApiCallStatus::Failed {
+            return Err(crate::cmd::ExitCodeError {
+                code: crate::exit_code::FAILED,
+                message: format!("API call {} failed: {}", self.id, error.unwrap_or_default()),
+            }
+            .into());
+        }
+
+        Ok(())
+    }
+}
+
+/// How long `wait_for` waits when there is no `--timeout`, so an API call that is stuck
+/// doesn't hang a script forever.
+const MAX_WAIT: std::time::Duration = std::time::Duration::from_secs(30 * 60);
+
+/// Poll an async API call until it has completed or failed, giving up with
+/// `exit_code::PENDING` after `MAX_WAIT` unless there is a `--timeout`.
+pub(crate) async fn wait_for(
+    ctx: &mut crate::context::Context<'_>,
+    id: &uuid::Uuid,
+    interval: std::time::Duration,
+) -> Result<kittycad::types::AsyncApiCallOutput> {
+    if ctx.timeout()?.is_some() {
+        return poll_async_operation(ctx, id, interval, true, |_, _| Ok(())).await;
+    }
+
+    match tokio::time::timeout(MAX_WAIT, poll_async_operation(ctx, id, interval, true, |_, _| Ok(()))).await {
+        Ok(result) => result,
+        Err(_) => Err(crate::cmd::ExitCodeError {
+            code: crate::exit_code::PENDING,
+            message: format!(
+                "API call {} hasn't finished after {} minutes, wait longer with `kittycad api-call wait {} --timeout <duration>`",
+                id,
+                MAX_WAIT.as_secs() / 60,
+                id
+            ),
+        }
+        .into()),
+    }
+}
+
+/// Poll an async API call until it has completed or failed, calling `on_poll` with it
+/// every time we get it.
+async fn poll_async_operation<F>(
+    ctx: &mut crate::context::Context<'_>,
+    id: &uuid::Uuid,
+    interval: std::time::Duration,
+    use_cache: bool,
+    mut on_poll: F,
+) -> Result<kittycad::types::AsyncApiCallOutput>
+where
+    F: FnMut(&mut crate::context::Context<'_>, &kittycad::types::AsyncApiCallOutput) -> Result<()>,
+{
+    loop {
+        let api_call = get_async_operation(ctx, id, use_cache).await?;
+        on_poll(ctx, &api_call)?;
+
+        let (status, _) = async_operation_status(&api_call);
+        if is_finished(&status) {
+            return Ok(api_call);
+        }
+
+        tokio::time::sleep(interval).await;
+    }
+}
+
+/// Get an async API call, retrying on transient errors.
+async fn get_async_operation(
+    ctx: &crate::context::Context<'_>,
+    id: &uuid::Uuid,
+    use_cache: bool,
+) -> Result<kittycad::types::AsyncApiCallOutput> {
+    get_async_operation_with_resume(ctx, id, use_cache, None).await
+}
+
+/// Like `get_async_operation`, but if a part file is given, download the API call into it
+/// so the download can be resumed rather than retried from the start.
+async fn get_async_operation_with_resume(
+    ctx: &crate::context::Context<'_>,
+    id: &uuid::Uuid,
+    use_cache: bool,
+    part: Option<&std::path::Path>,
+) -> Result<kittycad::types::AsyncApiCallOutput> {
+    let cache_dir = std::path::PathBuf::from(crate::config_file::cache_dir()?);
+    let cache_key = crate::cache::key(&[&ctx.cache_scope("")?, "async operation", &id.to_string()]);
+    if use_cache {
+        if let Some(api_call) = crate::cache::get(&cache_dir, &cache_key, None) {
+            return Ok(api_call);
+        }
+    }
+
+    let api_call = match part {
+        Some(part) => crate::download::resumable_json(ctx, &format!("/async/operations/{}", id), part).await?,
+        None => {
+            let client = ctx.api_client("")?;
+            let retry_policy = ctx.retry_policy()?;
+
+            let client = &client;
+            let id = id.to_string();
+            let id = &id;
+            let what = format!("GET /async/operations/{}", id);
+            crate::retry::call(&retry_policy, &ctx.http_log(), &what, || async move {
+                client.api_calls().get_async_operation(id).await
+            })
+            .await?
+        }
+    };
+
+    // Finished API calls don't change anymore, so they never go stale.
+    let (status, _) = async_operation_status(&api_call);
+    if is_finished(&status) {
+        crate::cache::put(&cache_dir, &cache_key, &api_call)?;
+    }
+
+    Ok(api_call)
+}
+
+/// Poll an async API call until it has finished, showing its status as it changes.
+///
+/// In a terminal the status is redrawn in place with how long we have been watching,
+/// otherwise, or when the output is accessible, a line is printed every time the status
+/// changes.
+async fn watch_async_operation(
+    ctx: &mut crate::context::Context<'_>,
+    id: &uuid::Uuid,
+    interval: std::time::Duration,
+    use_cache: bool,
+) -> Result<kittycad::types::AsyncApiCallOutput> {
+    let is_tty = ctx.io.is_stderr_tty() && !ctx.io.accessible();
+    let started = std::time::Instant::now();
+    let mut last_status = None;
+
+    poll_async_operation(ctx, id, interval, use_cache, |ctx, api_call| {
+        let (status, _) = async_operation_status(api_call);
+
+        if is_tty {
+            write!(
+                ctx.io.err_out,
+                "\r\x1b[2KAPI call {} is {} ({}s)",
+                id,
+                status,
+                started.elapsed().as_secs()
+            )?;
+            if is_finished(&status) {
+                writeln!(ctx.io.err_out)?;
+            }
+        } else if last_status.as_ref() != Some(&status) {
+            writeln!(ctx.io.err_out, "API call {} is {}", id, status)?;
+        }
+        ctx.io.err_out.flush()?;
+        last_status = Some(status);
+
+        Ok(())
+    })
+    .await
+}
+
+/// Returns the status of an async API call and its error, if any.
+fn async_operation_status(
+    api_call: &kittycad::types::AsyncApiCallOutput,
+) -> (kittycad::types::ApiCallStatus, Option<String>) {
+    match api_call {
+        kittycad::types::AsyncApiCallOutput::FileConversion(c) => (c.status.clone(), c.error.clone()),
+        kittycad::types::AsyncApiCallOutput::FileMass(c) => (c.status.clone(), c.error.clone()),
+        kittycad::types::AsyncApiCallOutput::FileVolume(c) => (c.status.clone(), c.error.clone()),
+        kittycad::types::AsyncApiCallOutput::FileDensity(c) => (c.status.clone(), c.error.clone()),
+    }
+}
+
+/// Returns true if an async API call with this status will not change anymore.
+pub(crate) fn is_finished(status: &kittycad::types::ApiCallStatus) -> bool {
+    matches!(
+        status,
+        kittycad::types::ApiCallStatus::Completed | kittycad::types::ApiCallStatus::Failed
+    )
+}
+
+/// If the API call is a completed file conversion, save its output to the path returned
+/// for its output format, or write it to stdout for `-`, gzipped if asked to, and strip it
+/// from the API call.
+fn save_conversion_output(
+    ctx: &mut crate::context::Context,
+    api_call: &mut kittycad::types::AsyncApiCallOutput,
+    gzip: bool,
+    path: impl FnOnce(&kittycad::types::FileOutputFormat) -> std::path::PathBuf,
+) -> Result<()> {
+    if let kittycad::types::AsyncApiCallOutput::FileConversion(fc) = api_call {
+        if fc.status == kittycad::types::ApiCallStatus::Completed {
+            if let Some(output) = &fc.output {
+                if output.is_empty() {
+                    anyhow::bail!("no output was generated for the file conversion! (this is probably a bug in the API) you should report it to support@kittycad.io");
+                }
+
+                let path = path(&fc.output_format);
+                if crate::output_file::is_stdout(&path) {
+                    crate::output_file::write_stdout(&mut ctx.io, &output.0, gzip)?;
+                } else {
+                    let path = crate::output_file::write(&path, &output.0, gzip)?;
+
+                    // Tell them where we saved the file, on stderr so stdout stays parseable.
+                    writeln!(ctx.io.err_out, "Saved file conversion output to {}", path.display())?;
                 }
             }
+
+            // Reset the output field of the file conversion.
+            // Otherwise what we print will be crazy big.
+            fc.output = None;
         }
+    }
 
-        // Print the output of the conversion.
-        // TODO: make this work as a table.
-        ctx.io.write_output(&crate::types::FormatOutput::Json, &api_call)?;
+    Ok(())
+}
+
+/// Print an async API call.
+fn write_async_operation(
+    ctx: &mut crate::context::Context,
+    format: &Option<crate::types::FormatOutput>,
+    api_call: &kittycad::types::AsyncApiCallOutput,
+) -> Result<()> {
+    // TODO: make this work as a table, until then we fall back to json.
+    let format = match ctx.format(format)? {
+        crate::types::FormatOutput::Table => crate::types::FormatOutput::Json,
+        format => format,
+    };
+    ctx.io.write_output(&format, api_call)
+}
+
+/// List your recent async API calls.
+///
+/// The most recent calls are listed first. Use `kittycad api-call status <id>` to get
+/// the details of one.
+///
+///     # list your 30 most recent async API calls
+///     $ kittycad api-call list
+///
+///     # list your async API calls that failed
+///     $ kittycad api-call list --status failed
+///
+///     # list your last 200 async API calls as json
+///     $ kittycad api-call list --limit 200 --format=json
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdApiCallList {
+    /// Only list API calls with this status: queued, uploaded, in-progress, completed or
+    /// failed.
+    #[clap(long, parse(try_from_str = parse_api_call_status))]
+    pub status: Option<kittycad::types::ApiCallStatus>,
+
+    /// Maximum number of API calls to list.
+    #[clap(long, short, default_value = "30")]
+    pub limit: usize,
+
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdApiCallList {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        if self.limit < 1 {
+            anyhow::bail!("--limit must be greater than 0");
+        }
+
+        // Let the API filter by status, so we don't page through every call to find a few.
+        let endpoint = match &self.status {
+            Some(status) => format!("/async/operations?status={}", api_call_status_name(status)),
+            None => "/async/operations".to_string(),
+        };
+        let operations: Vec<AsyncOperation> =
+            crate::pagination::list_pages(ctx, &endpoint, self.limit, |_| true).await?;
+
+        let rows: Vec<AsyncOperationRow> = operations.iter().map(AsyncOperationRow::from).collect();
+
+        let format = ctx.format(&self.format)?;
+        ctx.io.write_output_for_vec(&format, &rows)?;
 
         Ok(())
     }
 }
+
+/// Parse the status of an async API call, as given to `--status`.
+fn parse_api_call_status(s: &str) -> Result<kittycad::types::ApiCallStatus> {
+    match s.to_lowercase().replace(&['-', '_', ' '][..], "").as_str() {
+        "queued" => Ok(kittycad::types::ApiCallStatus::Queued),
+        "uploaded" => Ok(kittycad::types::ApiCallStatus::Uploaded),
+        "inprogress" => Ok(kittycad::types::ApiCallStatus::InProgress),
+        "completed" => Ok(kittycad::types::ApiCallStatus::Completed),
+        "failed" => Ok(kittycad::types::ApiCallStatus::Failed),
+        _ => anyhow::bail!(
+            "invalid status `{}`, expected queued, uploaded, in-progress, completed or failed",
+            s
+        ),
+    }
+}
+
+/// Returns the status of an async API call the way the API spells it, e.g. "In Progress".
+fn api_call_status_name(status: &kittycad::types::ApiCallStatus) -> String {
+    match serde_json::to_value(status) {
+        Ok(serde_json::Value::String(name)) => name,
+        _ => format!("{:?}", status),
+    }
+}
+
+/// An async API call, as listed by `/async/operations`.
+#[derive(Debug, Clone, Deserialize)]
+struct AsyncOperation {
+    id: uuid::Uuid,
+    /// The kind of API call, e.g. "FileConversion".
+    #[serde(rename = "type", default)]
+    kind: String,
+    status: kittycad::types::ApiCallStatus,
+    created_at: chrono::DateTime<chrono::Utc>,
+    completed_at: Option<chrono::DateTime<chrono::Utc>>,
+}
+
+/// A row in the output of `kittycad api-call list`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, tabled::Tabled)]
+struct AsyncOperationRow {
+    id: String,
+    #[serde(rename = "type")]
+    #[tabled(rename = "type")]
+    kind: String,
+    status: String,
+    created_at: String,
+    completed_at: String,
+}
+
+impl From<&AsyncOperation> for AsyncOperationRow {
+    fn from(operation: &AsyncOperation) -> AsyncOperationRow {
+        AsyncOperationRow {
+            id: operation.id.to_string(),
+            kind: operation.kind.to_string(),
+            status: api_call_status_name(&operation.status),
+            created_at: operation.created_at.to_rfc3339(),
+            completed_at: operation.completed_at.map(|t| t.to_rfc3339()).unwrap_or_default(),
+        }
+    }
+}
+
+/// Show statistics about your recent API calls.
+///
+/// This aggregates your most recent API calls into counts by status and endpoint,
+/// duration percentiles and your busiest days.
+///
+///     # show stats for your last 100 API calls
+///     $ kittycad api-call stats
+///
+///     # show stats for your last 1000 API calls as json
+///     $ kittycad api-call stats --limit 1000 --format=json
+///
+///     # show a chart of your API calls per day
+///     $ kittycad api-call stats --chart
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdApiCallStats {
+    /// The number of recent API calls to aggregate.
+    #[clap(long, short, default_value = "100")]
+    pub limit: usize,
+
+    /// Print a chart of API calls per day instead of the stats.
+    #[clap(long, conflicts_with = "format")]
+    pub chart: bool,
+
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdApiCallStats {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        if self.limit < 1 {
+            anyhow::bail!("--limit must be greater than 0");
+        }
+
+        let calls: Vec<ApiCall> = crate::pagination::list_pages(ctx, "/user/api-calls", self.limit, |_| true).await?;
+        let stats = ApiCallStats::from_calls(&calls);
+
+        if self.chart {
+            if stats.per_day.is_empty() {
+                writeln!(ctx.io.err_out, "no API calls found")?;
+                return Ok(());
+            }
+
+            let counts: Vec<usize> = stats.per_day.values().cloned().collect();
+            writeln!(
+                ctx.io.out,
+                "{} {} {}",
+                stats.per_day.keys().next().unwrap(),
+                sparkline(&counts),
+                stats.per_day.keys().last().unwrap()
+            )?;
+            writeln!(ctx.io.out, "max {} calls per day", counts.iter().max().unwrap())?;
+            return Ok(());
+        }
+
+        match ctx.format(&self.format)? {
+            crate::types::FormatOutput::Json => ctx.io.write_output_json(&serde_json::to_value(&stats)?)?,
+            crate::types::FormatOutput::Yaml => ctx.io.write_output_yaml(&stats)?,
+            crate::types::FormatOutput::Table => {
+                let cs = ctx.io.color_scheme();
+
+                let mut tw = tabwriter::TabWriter::new(vec![]);
+                writeln!(tw, "{}\t{}", cs.bold("Total calls:"), stats.total)?;
+                writeln!(
+                    tw,
+                    "{}\t{}",
+                    cs.bold("Duration p50:"),
+                    format_duration_ms(stats.duration_p50_ms)
+                )?;
+                writeln!(
+                    tw,
+                    "{}\t{}",
+                    cs.bold("Duration p95:"),
+                    format_duration_ms(stats.duration_p95_ms)
+                )?;
+
+                writeln!(tw, "\n{}\t{}", cs.bold("STATUS"), cs.bold("COUNT"))?;
+                for (status, count) in &stats.by_status {
+                    writeln!(tw, "{}\t{}", status, count)?;
+                }
+
+                writeln!(tw, "\n{}\t{}", cs.bold("ENDPOINT"), cs.bold("COUNT"))?;
+                for (endpoint, count) in &stats.by_endpoint {
+                    writeln!(tw, "{}\t{}", endpoint, count)?;
+                }
+
+                writeln!(tw, "\n{}\t{}", cs.bold("BUSIEST DAYS"), cs.bold("COUNT"))?;
+                for day in &stats.busiest_days {
+                    writeln!(tw, "{}\t{}", day.date, day.count)?;
+                }
+                tw.flush()?;
+
+                let table = String::from_utf8(tw.into_inner()?)?;
+                write!(ctx.io.out, "{}", table)?;
+            }
+        }
+
+        Ok(())
+    }
+}
+
+/// The fields of an API call we need for listing and stats.
+#[derive(Debug, Clone, Deserialize)]
+struct ApiCall {
+    id: uuid::Uuid,
+    created_at: chrono::DateTime<chrono::Utc>,
+    completed_at: Option<chrono::DateTime<chrono::Utc>>,
+    #[serde(default)]
+    method: String,
+    #[serde(default)]
+    endpoint: String,
+    status_code: Option<i32>,
+    /// The duration of the API call in nanoseconds.
+    duration: Option<i64>,
+}
+
+impl ApiCall {
+    /// Returns the method and path that was called, e.g. "POST /file/volume".
+    fn endpoint(&self) -> String {
+        format!("{} {}", self.method, self.endpoint).trim().to_string()
+    }
+
+    /// Returns the status code of the call, or "pending" if it hasn't finished.
+    fn status(&self) -> String {
+        match self.status_code {
+            Some(code) => code.to_string(),
+            None => "pending".to_string(),
+        }
+    }
+}
+
+/// The number of API calls on a given day.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+struct DayCount {
+    date: chrono::NaiveDate,
+    count: usize,
+}
+
+/// Aggregated statistics about a set of API calls.
+#[derive(Debug, Default, Clone, PartialEq, Serialize)]
+struct ApiCallStats {
+    total: usize,
+    by_status: BTreeMap<String, usize>,
+    by_endpoint: BTreeMap<String, usize>,
+    duration_p50_ms: Option<f64>,
+    duration_p95_ms: Option<f64>,
+    per_day: BTreeMap<chrono::NaiveDate, usize>,
+    busiest_days: Vec<DayCount>,
+}
+
+impl ApiCallStats {
+    fn from_calls(calls: &[ApiCall]) -> ApiCallStats {
+        let mut stats = ApiCallStats {
+            total: calls.len(),
+            ..Default::default()
+        };
+
+        let mut durations: Vec<f64> = Vec::new();
+        for call in calls {
+            *stats.by_status.entry(call.status()).or_default() += 1;
+            *stats.by_endpoint.entry(call.endpoint()).or_default() += 1;
+
+            *stats.per_day.entry(call.created_at.date().naive_utc()).or_default() += 1;
+
+            if let Some(duration) = call.duration {
+                durations.push(duration as f64 / 1_000_000.0);
+            }
+        }
+
+        // Fill in the days without any calls, so charts have the right shape.
+        if let (Some(first), Some(last)) = (
+            stats.per_day.keys().next().cloned(),
+            stats.per_day.keys().last().cloned(),
+        ) {
+            let mut day = first;
+            while day <= last {
+                stats.per_day.entry(day).or_default();
+                day = day.succ();
+            }
+        }
+
+        durations.sort_by(|a, b| a.partial_cmp(b).unwrap());
+        stats.duration_p50_ms = percentile(&durations, 50.0);
+        stats.duration_p95_ms = percentile(&durations, 95.0);
+
+        let mut days: Vec<DayCount> = stats
+            .per_day
+            .iter()
+            .filter(|(_, count)| **count > 0)
+            .map(|(date, count)| DayCount {
+                date: *date,
+                count: *count,
+            })
+            .collect();
+        days.sort_by(|a, b| b.count.cmp(&a.count).then(a.date.cmp(&b.date)));
+        days.truncate(5);
+        stats.busiest_days = days;
+
+        stats
+    }
+}
+
+/// Returns the nearest-rank percentile of sorted values.
+fn percentile(sorted: &[f64], p: f64) -> Option<f64> {
+    if sorted.is_empty() {
+        return None;
+    }
+
+    let rank = ((p / 100.0) * sorted.len() as f64).ceil() as usize;
+    Some(sorted[rank.clamp(1, sorted.len()) - 1])
+}
+
+fn format_duration_ms(ms: Option<f64>) -> String {
+    match ms {
+        Some(ms) if ms >= 1000.0 => format!("{:.1}s", ms / 1000.0),
+        Some(ms) => format!("{:.0}ms", ms),
+        None => "-".to_string(),
+    }
+}
+
+/// Render values as a single line of block characters.
+fn sparkline(values: &[usize]) -> String {
+    const BLOCKS: [char; 8] = ['▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'];
+
+    let max = values.iter().cloned().max().unwrap_or(0);
+    values
+        .iter()
+        .map(|v| {
+            if max == 0 {
+                BLOCKS[0]
+            } else {
+                BLOCKS[v * (BLOCKS.len() - 1) / max]
+            }
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    fn call(created_at: &str, endpoint: &str, status_code: Option<i32>, duration_ms: Option<i64>) -> ApiCall {
+        ApiCall {
+            id: uuid::Uuid::nil(),
+            created_at: created_at.parse().unwrap(),
+            completed_at: None,
+            method: "POST".to_string(),
+            endpoint: endpoint.to_string(),
+            status_code,
+            duration: duration_ms.map(|ms| ms * 1_000_000),
+        }
+    }
+
+    #[test]
+    fn test_api_call_stats() {
+        let calls = vec![
+            call("2022-07-01T10:00:00Z", "/file/volume", Some(200), Some(100)),
+            call("2022-07-01T11:00:00Z", "/file/volume", Some(200), Some(200)),
+            call("2022-07-03T10:00:00Z", "/file/mass", Some(400), Some(300)),
+            call("2022-07-03T12:00:00Z", "/file/mass", None, None),
+            call("2022-07-03T13:00:00Z", "/file/mass", Some(200), Some(4000)),
+        ];
+
+        let stats = ApiCallStats::from_calls(&calls);
+
+        assert_eq!(stats.total, 5);
+        assert_eq!(
+            stats.by_status,
+            BTreeMap::from([
+                ("200".to_string(), 3),
+                ("400".to_string(), 1),
+                ("pending".to_string(), 1)
+            ])
+        );
+        assert_eq!(
+            stats.by_endpoint,
+            BTreeMap::from([("POST /file/mass".to_string(), 3), ("POST /file/volume".to_string(), 2)])
+        );
+        assert_eq!(stats.duration_p50_ms, Some(200.0));
+        assert_eq!(stats.duration_p95_ms, Some(4000.0));
+        assert_eq!(stats.per_day.values().cloned().collect::<Vec<usize>>(), vec![2, 0, 3]);
+        assert_eq!(
+            stats.busiest_days,
+            vec![
+                DayCount {
+                    date: chrono::NaiveDate::from_ymd(2022, 7, 3),
+                    count: 3
+                },
+                DayCount {
+                    date: chrono::NaiveDate::from_ymd(2022, 7, 1),
+                    count: 2
+                },
+            ]
+        );
+
+        assert_eq!(ApiCallStats::from_calls(&[]), ApiCallStats::default());
+    }
+
+    #[test]
+    fn test_async_operation_row() {
+        let operation: AsyncOperation = serde_json::from_value(serde_json::json!({
+            "id": "00000000-0000-0000-0000-000000000000",
+            "type": "FileConversion",
+            "status": "In Progress",
+            "created_at": "2022-07-01T10:00:00Z",
+            "completed_at": null,
+            "user_id": "me",
+        }))
+        .unwrap();
+        assert_eq!(
+            AsyncOperationRow::from(&operation),
+            AsyncOperationRow {
+                id: "00000000-0000-0000-0000-000000000000".to_string(),
+                kind: "FileConversion".to_string(),
+                status: "In Progress".to_string(),
+                created_at: "2022-07-01T10:00:00+00:00".to_string(),
+                completed_at: "".to_string(),
+            }
+        );
+    }
+
+    #[test]
+    fn test_parse_api_call_status() {
+        assert_eq!(
+            parse_api_call_status("in-progress").unwrap(),
+            kittycad::types::ApiCallStatus::InProgress
+        );
+        assert_eq!(
+            parse_api_call_status("Failed").unwrap(),
+            kittycad::types::ApiCallStatus::Failed
+        );
+        assert_eq!(
+            parse_api_call_status("400").unwrap_err().to_string(),
+            "invalid status `400`, expected queued, uploaded, in-progress, completed or failed"
+        );
+    }
+
+    #[test]
+    fn test_is_finished() {
+        assert!(is_finished(&kittycad::types::ApiCallStatus::Completed));
+        assert!(is_finished(&kittycad::types::ApiCallStatus::Failed));
+        assert!(!is_finished(&kittycad::types::ApiCallStatus::Queued));
+        assert!(!is_finished(&kittycad::types::ApiCallStatus::InProgress));
+    }
+
+    #[test]
+    fn test_sparkline() {
+        assert_eq!(sparkline(&[]), "");
+        assert_eq!(sparkline(&[0, 0]), "▁▁");
+        assert_eq!(sparkline(&[0, 7, 14]), "▁▄█");
+    }
+
+    #[test]
+    fn test_format_duration_ms() {
+        assert_eq!(format_duration_ms(None), "-");
+        assert_eq!(format_duration_ms(Some(12.3)), "12ms");
+        assert_eq!(format_duration_ms(Some(2300.0)), "2.3s");
+    }
+}
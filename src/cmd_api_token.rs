@@ -0,0 +1,323 @@
+use std::io::Write;
+
+use anyhow::Result;
+use clap::Parser;
+use serde::Serialize;
+
+/// Manage your API tokens.
+///
+/// Use these commands to rotate your credentials without visiting the website.
+///
+///     # list your API tokens
+///     $ kittycad api-token list
+///
+///     # create a new API token
+///     $ kittycad api-token create
+///
+///     # revoke an API token without prompting
+///     $ kittycad api-token delete <id> --yes
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdApiToken {
+    #[clap(subcommand)]
+    subcmd: SubCommand,
+}
+
+#[derive(Parser, Debug, Clone)]
+enum SubCommand {
+    Create(CmdApiTokenCreate),
+    #[clap(alias = "revoke")]
+    Delete(CmdApiTokenDelete),
+    List(CmdApiTokenList),
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdApiToken {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        match &self.subcmd {
+            SubCommand::Create(cmd) => cmd.run(ctx).await,
+            SubCommand::Delete(cmd) => cmd.run(ctx).await,
+            SubCommand::List(cmd) => cmd.run(ctx).await,
+        }
+    }
+}
+
+/// List your API tokens.
+///
+/// Tokens are masked, the full token is only ever shown when it is created.
+///
+///     # list your API tokens
+///     $ kittycad api-token list
+///
+///     # list your API tokens as json
+///     $ kittycad api-token list --format=json
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdApiTokenList {
+    /// The maximum number of API tokens to list.
+    #[clap(long, short, default_value = "30")]
+    pub limit: usize,
+
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdApiTokenList {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        if self.limit < 1 {
+            anyhow::bail!("--limit must be greater than 0");
+        }
+
+        let tokens = list_tokens(ctx, self.limit, |_| true).await?;
+        let rows: Vec<ApiTokenRow> = tokens.iter().map(ApiTokenRow::from).collect();
+
+        let format = ctx.format(&self.format)?;
+        ctx.io.write_output_for_vec(&format, &rows)?;
+
+        Ok(())
+    }
+}
+
+/// Create a new API token.
+///
+/// The token is printed once, make sure you save it somewhere safe since it cannot
+/// be shown again.
+///
+///     # create a new API token
+///     $ kittycad api-token create
+///
+///     # create a new API token and print all its details as json
+///     $ kittycad api-token create --format=json
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdApiTokenCreate {
+    /// Command output format. By default only the token is printed.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdApiTokenCreate {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let client = ctx.api_client("")?;
+
+        // Creating a token is not idempotent, so we never retry it.
+        let token = ctx
+            .http_log()
+            .call("POST /user/api-tokens", client.api_tokens().create_for_user())
+            .await?;
+
+        match &self.format {
+            Some(format) => ctx.io.write_output(format, &token)?,
+            None => writeln!(ctx.io.out, "{}", token.token)?,
+        }
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Created API token {}, save it now since it will not be shown again",
+            cs.success_icon(),
+            token.id.as_deref().unwrap_or_default()
+        )?;
+
+        Ok(())
+    }
+}
+
+/// Revoke an API token.
+///
+/// The token can be given by its ID, as shown by `kittycad api-token list`, or by the
+/// token itself.
+///
+///     # revoke an API token
+///     $ kittycad api-token delete <id>
+///
+///     # revoke an API token without prompting
+///     $ kittycad api-token delete <id> --yes
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdApiTokenDelete {
+    /// The ID of the API token, or the token itself.
+    #[clap(name = "id", required = true)]
+    pub id: String,
+
+    /// Revoke the token without prompting for confirmation.
+    #[clap(long, short)]
+    pub yes: bool,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdApiTokenDelete {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        if !ctx.io.can_prompt() && !self.yes {
+            anyhow::bail!(crate::i18n::tr("--yes required when not running interactively"));
+        }
+
+        let tokens = list_tokens(ctx, 1, |t| {
+            t.id.as_deref() == Some(self.id.as_str()) || t.token.to_string() == self.id
+        })
+        .await?;
+        let token = match tokens.first() {
+            Some(token) => token,
+            None => anyhow::bail!("no API token found with ID `{}`", self.id),
+        };
+
+        if !self.yes {
+            match dialoguer::Confirm::new()
+                .with_prompt(format!(
+                    "Are you sure you want to revoke API token {} ({})?",
+                    token.id.as_deref().unwrap_or_default(),
+                    mask_token(&token.token.to_string())
+                ))
+                .interact()
+            {
+                Ok(true) => {}
+                Ok(false) => {
+                    return Ok(());
+                }
+                Err(err) => {
+                    return Err(anyhow::anyhow!("prompt failed: {}", err));
+                }
+            }
+        }
+
+        let client = ctx.api_client("")?;
+        let retry_policy = ctx.retry_policy()?;
+
+        let client = &client;
+        let secret = token.token.to_string();
+        let secret = &secret;
+        // The path has the token in it, so we don't print it.
+        crate::retry::call(
+            &retry_policy,
+            &ctx.http_log(),
+            "DELETE /user/api-tokens/{token}",
+            || async move { client.api_tokens().delete_for_user(secret).await },
+        )
+        .await?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Revoked API token {}",
+            cs.success_icon_with_color(ansi_term::Color::Red),
+            token.id.as_deref().unwrap_or_default()
+        )?;
+
+        Ok(())
+    }
+}
+
+/// Fetch up to `limit` of your most recent API tokens that match `keep`, following the
+/// pages as needed.
+async fn list_tokens<F>(
+    ctx: &crate::context::Context<'_>,
+    limit: usize,
+    keep: F,
+) -> Result<Vec<kittycad::types::ApiToken>>
+where
+    F: Fn(&kittycad::types::ApiToken) -> bool,
+{
+    let client = ctx.api_client("")?;
+    let retry_policy = ctx.retry_policy()?;
+
+    let client = &client;
+    let mut tokens: Vec<kittycad::types::ApiToken> = Vec::new();
+    let mut page_token: Option<String> = None;
+    loop {
+        let page_limit = (limit - tokens.len()).min(100) as u32;
+        let page = crate::retry::call(&retry_policy, &ctx.http_log(), "GET /user/api-tokens", || {
+            let page_token = page_token.clone();
+            async move {
+                client
+                    .api_tokens()
+                    .list_for_user(
+                        Some(page_limit),
+                        page_token,
+                        Some(kittycad::types::CreatedAtSortMode::CreatedAtDescending),
+                    )
+                    .await
+            }
+        })
+        .await?;
+        tokens.extend(page.items.into_iter().filter(|token| keep(token)));
+
+        match page.next_page {
+            Some(next_page) if !next_page.is_empty() && tokens.len() < limit => page_token = Some(next_page),
+            _ => break,
+        }
+    }
+
+    tokens.truncate(limit);
+
+    Ok(tokens)
+}
+
+/// A row in the output of `kittycad api-token list`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, tabled::Tabled)]
+struct ApiTokenRow {
+    id: String,
+    token: String,
+    is_valid: bool,
+    created_at: String,
+}
+
+impl From<&kittycad::types::ApiToken> for ApiTokenRow {
+    fn from(token: &kittycad::types::ApiToken) -> ApiTokenRow {
+        ApiTokenRow {
+            id: token.id.clone().unwrap_or_default(),
+            token: mask_token(&token.token.to_string()),
+            is_valid: token.is_valid,
+            created_at: token.created_at.to_rfc3339(),
+        }
+    }
+}
+
+/// Hide all but the first few characters of a token, so it can be recognized without
+/// being leaked.
+fn mask_token(token: &str) -> String {
+    let prefix: String = token.chars().take(8).collect();
+    if prefix.len() == token.len() {
+        return "*".repeat(token.len());
+    }
+
+    format!("{}********", prefix)
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_mask_token() {
+        assert_eq!(mask_token("c4d9e2f0-1234-4cde-9abc-0123456789ab"), "c4d9e2f0********");
+        assert_eq!(mask_token("short"), "*****");
+        assert_eq!(mask_token(""), "");
+    }
+
+    #[test]
+    fn test_api_token_row() {
+        let token: kittycad::types::ApiToken = serde_json::from_value(serde_json::json!({
+            "id": "tok-1",
+            "token": "c4d9e2f0-1234-4cde-9abc-0123456789ab",
+            "is_valid": true,
+            "created_at": "2022-07-01T10:00:00Z",
+            "updated_at": "2022-07-01T10:00:00Z",
+        }))
+        .unwrap();
+
+        assert_eq!(
+            ApiTokenRow::from(&token),
+            ApiTokenRow {
+                id: "tok-1".to_string(),
+                token: "c4d9e2f0********".to_string(),
+                is_valid: true,
+                created_at: "2022-07-01T10:00:00+00:00".to_string(),
+            }
+        );
+    }
+}
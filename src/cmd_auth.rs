@@ -19,6 +19,7 @@ enum SubCommand {
     Login(CmdAuthLogin),
     Logout(CmdAuthLogout),
     Status(CmdAuthStatus),
+    Switch(CmdAuthSwitch),
 }
 
 #[async_trait::async_trait]
@@ -28,6 +29,7 @@ impl crate::cmd::Command for CmdAuth {
             SubCommand::Login(cmd) => cmd.run(ctx).await,
             SubCommand::Logout(cmd) => cmd.run(ctx).await,
             SubCommand::Status(cmd) => cmd.run(ctx).await,
+            SubCommand::Switch(cmd) => cmd.run(ctx).await,
         }
     }
 }
@@ -95,6 +97,12 @@ pub fn parse_host(input: &str) -> Result<url::Url> {
 ///
 ///     # authenticate with an insecure KittyCAD instance (not recommended)
 ///     $ kittycad auth login --host http://kittycad.internal
+///
+///     # log in with a second account, keeping the first for `kittycad auth switch`
+///     $ kittycad auth login --account work
+///
+///     # in CI, check the token of a service account without storing it anywhere
+///     $ kittycad auth login --as-service-account --token-file /run/secrets/token --no-store
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdAuthLogin {
@@ -111,12 +119,29 @@ pub struct CmdAuthLogin {
     /// Open a browser to authenticate.
     #[clap(short, long)]
     pub web: bool,
+    /// Log in as another account with this name, keeping the account you are logged
+    /// in with. Switch between them with `kittycad auth switch`.
+    #[clap(long)]
+    pub account: Option<String>,
+    /// Log in with the token of a service account, for CI. Nothing is prompted for and
+    /// the token must be given with `--with-token` or `--token-file`.
+    #[clap(long, conflicts_with = "web")]
+    pub as_service_account: bool,
+    /// Only check the token and print who it belongs to, without storing anything.
+    #[clap(long, conflicts_with = "account")]
+    pub no_store: bool,
 }
 
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdAuthLogin {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
-        if !ctx.io.can_prompt() && !self.with_token {
+        if self.as_service_account && !self.with_token && ctx.token.is_none() {
+            return Err(anyhow!(
+                "--as-service-account needs a token, pass it with --with-token or --token-file"
+            ));
+        }
+
+        if !ctx.io.can_prompt() && !self.with_token && ctx.token.is_none() {
             return Err(anyhow!("--with-token required when not running interactively"));
         }
 
@@ -125,6 +150,13 @@ impl crate::cmd::Command for CmdAuthLogin {
         if self.with_token {
             // Read from stdin.
             ctx.io.stdin.read_to_string(&mut token)?;
+        } else if let Some(token_file) = &ctx.token {
+            // Passed with `--token-file`.
+            token = token_file.to_string();
+        }
+
+        if self.as_service_account && token.is_empty() {
+            return Err(anyhow!("no token given for the service account"));
         }
 
         let mut interactive = false;
@@ -140,6 +172,34 @@ impl crate::cmd::Command for CmdAuthLogin {
             default_host.as_str()
         };
 
+        crate::policy::check_host(&*ctx.config, host)?;
+
+        let cs = ctx.io.color_scheme();
+
+        if self.no_store {
+            if token.is_empty() {
+                return Err(anyhow!(
+                    "--no-store needs a token, pass it with --with-token or --token-file"
+                ));
+            }
+
+            // Check the token without putting it in the config, which may be kept in the
+            // keyring as soon as it is set.
+            ctx.token = Some(token);
+            let client = ctx.api_client(host)?;
+            let session = ctx.http_log().call("GET /user", client.users().get_self()).await?;
+            let identity = session_identity(&session)?;
+
+            writeln!(
+                ctx.io.err_out,
+                "{} Token for {} is valid, nothing was stored",
+                cs.success_icon(),
+                cs.bold(&show_identity(ctx, &identity))
+            )?;
+
+            return Ok(());
+        }
+
         if let Err(err) = ctx.config.check_writable(host, "token") {
             if let Some(crate::config_from_env::ReadOnlyEnvVarError::Variable(var)) = err.downcast_ref() {
                 writeln!(
@@ -157,8 +217,6 @@ impl crate::cmd::Command for CmdAuthLogin {
             return Err(err);
         }
 
-        let cs = ctx.io.color_scheme();
-
         // Do the login flow if we didn't get a token from stdin.
         if token.is_empty() {
             // We don't want to capture the error here just in case we have no host config
@@ -168,7 +226,7 @@ impl crate::cmd::Command for CmdAuthLogin {
             } else {
                 String::new()
             };
-            if !existing_token.is_empty() && interactive {
+            if !existing_token.is_empty() && interactive && self.account.is_none() {
                 match dialoguer::Confirm::new()
                     .with_prompt(format!(
                         "You're already logged into {}. Do you want to re-authenticate?",
@@ -226,8 +284,8 @@ impl crate::cmd::Command for CmdAuthLogin {
                 .set_device_authorization_url(device_auth_url);
                 writeln!(
                     ctx.io.err_out,
-                    "Tip: you can generate an API Token here {}account",
-                    host
+                    "Tip: you can generate an API Token here {}",
+                    cs.hyperlink(&format!("{}account", host))
                 )?;
 
                 let details: oauth2::devicecode::StandardDeviceAuthorizationResponse = auth_client
@@ -237,19 +295,19 @@ impl crate::cmd::Command for CmdAuthLogin {
 
                 if let Some(uri) = details.verification_uri_complete() {
                     writeln!(
-                        ctx.io.out,
+                        ctx.io.err_out,
                         "Opening {} in your browser.\n\
                      Please verify user code: {}\n",
-                        **details.verification_uri(),
+                        cs.hyperlink(details.verification_uri()),
                         details.user_code().secret()
                     )?;
                     ctx.browser(host, uri.secret())?;
                 } else {
                     writeln!(
-                        ctx.io.out,
+                        ctx.io.err_out,
                         "Open this URL in your browser:\n{}\n\
                      And enter the code: {}\n",
-                        **details.verification_uri(),
+                        cs.hyperlink(details.verification_uri()),
                         details.user_code().secret()
                     )?;
                 }
@@ -264,8 +322,8 @@ impl crate::cmd::Command for CmdAuthLogin {
             } else {
                 writeln!(
                     ctx.io.err_out,
-                    "Tip: you can generate an API Token here {}account",
-                    host
+                    "Tip: you can generate an API Token here {}",
+                    cs.hyperlink(&format!("{}account", host))
                 )?;
 
                 match dialoguer::Input::<String>::new()
@@ -280,24 +338,45 @@ impl crate::cmd::Command for CmdAuthLogin {
             };
         }
 
-        // Set the token in the config file.
+        // Keep the account we are logged in with, if we are adding another one.
+        if let Some(account) = &self.account {
+            if ctx.config.accounts(host)?.contains(account) {
+                // Logging in to an account we kept, so replace it.
+                ctx.config.switch_account(host, account)?;
+            } else if active_account(ctx, host) != *account {
+                ctx.config.stash_account(host)?;
+            }
+            ctx.config.set(host, "account", account)?;
+        }
+
+        // Set the token in the config file, and use it rather than the one from
+        // `--token-file` to check it.
         ctx.config.set(host, "token", &token)?;
+        ctx.token = None;
 
         let client = ctx.api_client(host)?;
+        let retry_policy = ctx.retry_policy()?;
 
         // Get the session for the token.
-        let session = client.users().get_self().await?;
+        let client = &client;
+        let session = crate::retry::call(&retry_policy, &ctx.http_log(), "GET /user", || async move {
+            client.users().get_self().await
+        })
+        .await?;
 
         // Set the user.
-        let email = session
-            .email
-            .ok_or_else(|| anyhow::anyhow!("user does not have an email"))?;
+        let email = session_identity(&session)?;
         ctx.config.set(host, "user", &email)?;
 
         // Save the config.
         ctx.config.write()?;
 
-        writeln!(ctx.io.out, "{} Logged in as {}", cs.success_icon(), cs.bold(&email))?;
+        writeln!(
+            ctx.io.err_out,
+            "{} Logged in as {}",
+            cs.success_icon(),
+            cs.bold(&show_identity(ctx, &email))
+        )?;
 
         Ok(())
     }
@@ -385,13 +464,19 @@ impl crate::cmd::Command for CmdAuthLogout {
         }
 
         let client = ctx.api_client(&hostname)?;
+        let retry_policy = ctx.retry_policy()?;
 
         // Get the current user.
-        let session = client.users().get_self().await?;
+        let client = &client;
+        let session = crate::retry::call(&retry_policy, &ctx.http_log(), "GET /user", || async move {
+            client.users().get_self().await
+        })
+        .await?;
 
         let email = session
             .email
             .ok_or_else(|| anyhow::anyhow!("user does not have an email"))?;
+        let email = show_identity(ctx, &email);
 
         let cs = ctx.io.color_scheme();
 
@@ -422,7 +507,7 @@ impl crate::cmd::Command for CmdAuthLogout {
 
         let cs = ctx.io.color_scheme();
         writeln!(
-            ctx.io.out,
+            ctx.io.err_out,
             "{} Logged out of {} as {}",
             cs.success_icon(),
             hostname,
@@ -460,7 +545,7 @@ impl crate::cmd::Command for CmdAuthStatus {
 
         if hostnames.is_empty() {
             writeln!(
-                ctx.io.out,
+                ctx.io.err_out,
                 "You are not logged into any KittyCAD hosts. Run `{}` to authenticate.",
                 cs.bold("kittycad auth login")
             )?;
@@ -480,10 +565,16 @@ impl crate::cmd::Command for CmdAuthStatus {
             let (token, token_source) = ctx.config.get_with_source(hostname, "token")?;
 
             let client = ctx.api_client(hostname)?;
+            let retry_policy = ctx.retry_policy()?;
 
             let mut host_status: Vec<String> = vec![];
 
-            match client.users().get_self().await {
+            let client = &client;
+            match crate::retry::call(&retry_policy, &ctx.http_log(), "GET /user", || async move {
+                client.users().get_self().await
+            })
+            .await
+            {
                 Ok(session) => {
                     let email = session
                         .email
@@ -493,14 +584,24 @@ impl crate::cmd::Command for CmdAuthStatus {
                         "{} Logged in to {} as {} ({})",
                         cs.success_icon(),
                         hostname,
-                        cs.bold(&email),
-                        token_source
+                        cs.bold(&show_identity(ctx, &email)),
+                        show_identity(ctx, &token_source)
                     ));
                     let mut token_display = "*******************".to_string();
                     if self.show_token {
                         token_display = token.to_string();
                     }
                     host_status.push(format!("{} Token: {}", cs.success_icon(), token_display));
+
+                    let accounts = ctx.config.accounts(hostname)?;
+                    if !accounts.is_empty() {
+                        let accounts: Vec<String> = accounts.iter().map(|a| show_identity(ctx, a)).collect();
+                        host_status.push(format!(
+                            "{} Other accounts: {} (switch with `kittycad auth switch`)",
+                            cs.success_icon(),
+                            accounts.join(", ")
+                        ));
+                    }
                 }
                 Err(err) => {
                     host_status.push(format!("{} {}: api call failed: {}", cs.failure_icon(), hostname, err));
@@ -524,9 +625,9 @@ impl crate::cmd::Command for CmdAuthStatus {
         for hostname in hostnames {
             match status_info.get(&hostname) {
                 Some(status) => {
-                    writeln!(ctx.io.out, "{}", cs.bold(&hostname))?;
+                    writeln!(ctx.io.err_out, "{}", cs.bold(&hostname))?;
                     for line in status {
-                        writeln!(ctx.io.out, "{}", line)?;
+                        writeln!(ctx.io.err_out, "{}", line)?;
                     }
                 }
                 None => {
@@ -543,6 +644,99 @@ impl crate::cmd::Command for CmdAuthStatus {
     }
 }
 
+/// Switch the account you are logged in with.
+///
+/// Log in with more than one account for a host with `kittycad auth login --account`.
+///
+///     # switch to your work account
+///     $ kittycad auth switch --user work
+///
+///     # pick the account to switch to
+///     $ kittycad auth switch
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdAuthSwitch {
+    /// The account to switch to, its name or the email you log in with.
+    #[clap(short, long)]
+    pub user: Option<String>,
+
+    /// The host of the KittyCAD instance to switch accounts for.
+    #[clap(short = 'H', long, env = "KITTYCAD_HOST", parse(try_from_str = parse_host))]
+    pub host: Option<url::Url>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdAuthSwitch {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let hostname = match &self.host {
+            Some(host) => host.to_string(),
+            None => ctx.config.default_host()?,
+        };
+
+        if let Err(err) = ctx.config.check_writable(&hostname, "token") {
+            return Err(anyhow!("can't switch accounts: {}", err));
+        }
+
+        let accounts = ctx.config.accounts(&hostname)?;
+        if accounts.is_empty() {
+            return Err(anyhow!(
+                "you have only one account for {}, log in with another one with `kittycad auth login --account <name>`",
+                hostname
+            ));
+        }
+
+        let account = match &self.user {
+            Some(user) => user.to_string(),
+            None if ctx.io.can_prompt() => {
+                accounts[crate::picker::pick("Which account do you want to switch to?", &accounts)?].to_string()
+            }
+            None => return Err(anyhow!("--user required when not running interactively")),
+        };
+
+        ctx.config.switch_account(&hostname, &account)?;
+        ctx.config.write()?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Switched to {} on {}",
+            cs.success_icon(),
+            cs.bold(&show_identity(ctx, &account)),
+            hostname
+        )?;
+
+        Ok(())
+    }
+}
+
+/// Returns the name of the account you are logged in with for a host, the email you log
+/// in with unless you named it.
+fn active_account(ctx: &crate::context::Context, hostname: &str) -> String {
+    ctx.config
+        .get(hostname, "account")
+        .or_else(|_| ctx.config.get(hostname, "user"))
+        .unwrap_or_default()
+}
+
+/// Returns who a token belongs to: the email of its user, or the user ID for a service
+/// account without one.
+fn session_identity(session: &kittycad::types::User) -> Result<String> {
+    if let Some(email) = session.email.as_ref().filter(|email| !email.is_empty()) {
+        return Ok(email.to_string());
+    }
+
+    match serde_json::to_value(session)?["id"].as_str() {
+        Some(id) if !id.is_empty() => Ok(id.to_string()),
+        _ => Err(anyhow!("user does not have an email")),
+    }
+}
+
+/// Returns who you are logged in as, or where your token comes from, as we print it:
+/// hidden when the `privacy` setting is `strict`.
+pub(crate) fn show_identity(ctx: &crate::context::Context, value: &str) -> String {
+    ctx.io.redact(value)
+}
+
 #[cfg(test)]
 mod test {
     use pretty_assertions::assert_eq;
@@ -554,6 +748,7 @@ mod test {
         cmd: crate::cmd_auth::SubCommand,
         stdin: String,
         want_out: String,
+        want_stderr: String,
         want_err: String,
     }
 
@@ -574,6 +769,7 @@ mod test {
                 }),
                 stdin: "".to_string(),
                 want_out: "".to_string(),
+                want_stderr: "".to_string(),
                 want_err: "Try authenticating with".to_string(),
             },
             TestItem {
@@ -582,20 +778,43 @@ mod test {
                     host: Some(test_host.clone()),
                     with_token: false,
                     web: false,
+                    account: None,
+                    as_service_account: false,
+                    no_store: false,
                 }),
                 stdin: test_token.to_string(),
                 want_out: "".to_string(),
+                want_stderr: "".to_string(),
                 want_err: "--with-token required when not running interactively".to_string(),
             },
+            TestItem {
+                name: "login --as-service-account without a token".to_string(),
+                cmd: crate::cmd_auth::SubCommand::Login(crate::cmd_auth::CmdAuthLogin {
+                    host: Some(test_host.clone()),
+                    with_token: false,
+                    web: false,
+                    account: None,
+                    as_service_account: true,
+                    no_store: true,
+                }),
+                stdin: "".to_string(),
+                want_out: "".to_string(),
+                want_stderr: "".to_string(),
+                want_err: "--as-service-account needs a token, pass it with --with-token or --token-file".to_string(),
+            },
             TestItem {
                 name: "login --with-token=true".to_string(),
                 cmd: crate::cmd_auth::SubCommand::Login(crate::cmd_auth::CmdAuthLogin {
                     host: Some(test_host.clone()),
                     with_token: true,
                     web: false,
+                    account: None,
+                    as_service_account: false,
+                    no_store: false,
                 }),
                 stdin: test_token.to_string(),
-                want_out: "✔ Logged in as ".to_string(),
+                want_out: "".to_string(),
+                want_stderr: "✔ Logged in as ".to_string(),
                 want_err: "".to_string(),
             },
             TestItem {
@@ -605,7 +824,8 @@ mod test {
                     host: Some(test_host.clone()),
                 }),
                 stdin: "".to_string(),
-                want_out: format!("{}\n✔ Logged in to {} as", test_host, test_host),
+                want_out: "".to_string(),
+                want_stderr: format!("{}\n✔ Logged in to {} as", test_host, test_host),
                 want_err: "".to_string(),
             },
             TestItem {
@@ -613,6 +833,7 @@ mod test {
                 cmd: crate::cmd_auth::SubCommand::Logout(crate::cmd_auth::CmdAuthLogout { host: None }),
                 stdin: "".to_string(),
                 want_out: "".to_string(),
+                want_stderr: "".to_string(),
                 want_err: "--host required when not running interactively".to_string(),
             },
             TestItem {
@@ -621,7 +842,8 @@ mod test {
                     host: Some(test_host.clone()),
                 }),
                 stdin: "".to_string(),
-                want_out: format!("✔ Logged out of {}", test_host),
+                want_out: "".to_string(),
+                want_stderr: format!("✔ Logged out of {}", test_host),
                 want_err: "".to_string(),
             },
         ];
@@ -639,21 +861,20 @@ mod test {
             io.set_color_enabled(false);
             // TODO: we should figure out how to test the prompts.
             io.set_never_prompt(true);
-            let mut ctx = crate::context::Context {
-                config: &mut c,
-                io,
-                debug: false,
-            };
+            let mut ctx = crate::context::Context::with_io(&mut c, io);
 
             let cmd_auth = crate::cmd_auth::CmdAuth { subcmd: t.cmd };
             match cmd_auth.run(&mut ctx).await {
                 Ok(()) => {
                     let stdout = std::fs::read_to_string(stdout_path).unwrap();
                     let stderr = std::fs::read_to_string(stderr_path).unwrap();
-                    assert!(stderr.is_empty(), "test {}: {}", t.name, stderr);
                     if !stdout.contains(&t.want_out) {
                         assert_eq!(stdout, t.want_out, "test {}: stdout mismatch", t.name);
                     }
+                    // Messages for humans go to stderr, so stdout only ever has data in it.
+                    if !stderr.contains(&t.want_stderr) {
+                        assert_eq!(stderr, t.want_stderr, "test {}: stderr mismatch", t.name);
+                    }
                 }
                 Err(err) => {
                     let stdout = std::fs::read_to_string(stdout_path).unwrap();
@@ -0,0 +1,527 @@
+use std::io::{Read, Write};
+
+use anyhow::{anyhow, bail, Context, Result};
+use clap::Parser;
+use serde::{Deserialize, Serialize};
+
+/// Back up and restore the state of `kittycad`.
+///
+/// A backup is a gzipped tarball of your configuration, hosts, aliases, command
+/// defaults and the history of the operations you started from this machine. Use it
+/// before reinstalling your OS, or to move to another machine.
+///
+/// Authentication tokens and your signing key are left out unless you pass
+/// `--include-secrets`. Tokens kept in the system keyring are never backed up, log
+/// in again with `kittycad auth login` after restoring.
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdBackup {
+    #[clap(subcommand)]
+    subcmd: SubCommand,
+}
+
+#[derive(Parser, Debug, Clone)]
+enum SubCommand {
+    Create(CmdBackupCreate),
+    Restore(CmdBackupRestore),
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdBackup {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        match &self.subcmd {
+            SubCommand::Create(cmd) => cmd.run(ctx).await,
+            SubCommand::Restore(cmd) => cmd.run(ctx).await,
+        }
+    }
+}
+
+/// The file in a backup that says what it is.
+const MANIFEST: &str = "backup.json";
+
+/// What a backup holds.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+struct Manifest {
+    /// The version of `kittycad` that made the backup.
+    version: String,
+    created_at: chrono::DateTime<chrono::Utc>,
+    include_secrets: bool,
+    files: Vec<String>,
+}
+
+/// A file of the state of `kittycad`, with its name in a backup.
+#[derive(Debug, Clone)]
+struct StateFile {
+    name: &'static str,
+    path: String,
+    /// Whether the whole file is a secret, only backed up with `--include-secrets`.
+    secret: bool,
+}
+
+/// Returns the files we back up.
+fn state_files() -> Result<Vec<StateFile>> {
+    Ok(vec![
+        StateFile {
+            name: "config.toml",
+            path: crate::config_file::config_file()?,
+            secret: false,
+        },
+        StateFile {
+            name: "hosts.toml",
+            path: crate::config_file::hosts_file()?,
+            secret: false,
+        },
+        StateFile {
+            name: "history.toml",
+            path: crate::config_file::history_file()?,
+            secret: false,
+        },
+        StateFile {
+            name: "signing.key",
+            path: crate::config_file::signing_key_file()?,
+            secret: true,
+        },
+    ])
+}
+
+/// Back up the state of `kittycad` to a file.
+///
+/// Tokens kept in the system keyring are never backed up, even with `--include-secrets`.
+///
+///     # back up to kittycad-backup-<date>.tar.gz
+///     $ kittycad backup create
+///
+///     # back up everything, including your tokens
+///     $ kittycad backup create my-backup.tar.gz --include-secrets
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdBackupCreate {
+    /// The file to write the backup to, by default `kittycad-backup-<date>.tar.gz` in
+    /// the current directory.
+    #[clap(name = "file")]
+    pub file: Option<String>,
+
+    /// Include authentication tokens and your signing key. Tokens kept in the system
+    /// keyring are left out anyway.
+    #[clap(long)]
+    pub include_secrets: bool,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdBackupCreate {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let file = match &self.file {
+            Some(file) => file.to_string(),
+            None => format!("kittycad-backup-{}.tar.gz", chrono::Utc::now().format("%Y%m%dT%H%M%S")),
+        };
+        if std::path::Path::new(&file).exists() {
+            bail!("{} already exists", file);
+        }
+
+        let mut archive = Vec::new();
+        let manifest = create_backup(&state_files()?, self.include_secrets, &mut archive)?;
+        write_file(&file, &archive, self.include_secrets)?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Backed up {} to {}",
+            cs.success_icon(),
+            manifest.files.join(", "),
+            file
+        )?;
+        if !self.include_secrets {
+            writeln!(
+                ctx.io.err_out,
+                "Tokens and your signing key were left out, pass --include-secrets to back them up"
+            )?;
+        }
+
+        Ok(())
+    }
+}
+
+/// Restore the state of `kittycad` from a backup.
+///
+/// The files in the backup replace the ones you have. Each file that is replaced is
+/// backed up next to it first, with the time in its name, so you can go back. The tokens
+/// you have are kept for the hosts and accounts the backup has no tokens for, so a backup
+/// made without `--include-secrets` doesn't log you out.
+///
+///     $ kittycad backup restore kittycad-backup-20220701T120000.tar.gz
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdBackupRestore {
+    /// The backup to restore. Pass `-` to read from stdin.
+    #[clap(name = "file", required = true)]
+    pub file: String,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdBackupRestore {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let archive = ctx.read_file(&self.file)?;
+        let restored = restore_backup(&state_files()?, &archive[..])
+            .map_err(|err| anyhow!("failed to restore {}: {}", self.file, err))?;
+
+        let cs = ctx.io.color_scheme();
+        for (path, backup) in &restored {
+            match backup {
+                Some(backup) => writeln!(
+                    ctx.io.err_out,
+                    "{} Restored {}, the old one is in {}",
+                    cs.success_icon(),
+                    path,
+                    backup
+                )?,
+                None => writeln!(ctx.io.err_out, "{} Restored {}", cs.success_icon(), path)?,
+            }
+        }
+
+        Ok(())
+    }
+}
+
+/// Write a gzipped tarball of the state files that exist to the writer, and return
+/// what it holds. Tokens are taken out of the hosts unless secrets are included.
+fn create_backup<W: Write>(files: &[StateFile], include_secrets: bool, mut writer: W) -> Result<Manifest> {
+    let mut manifest = Manifest {
+        version: clap::crate_version!().to_string(),
+        created_at: chrono::Utc::now(),
+        include_secrets,
+        files: vec![],
+    };
+    let mut entries = Vec::new();
+    for file in files {
+        if file.secret && !include_secrets {
+            continue;
+        }
+
+        let contents = match std::fs::read(&file.path) {
+            Ok(contents) => contents,
+            Err(err) if err.kind() == std::io::ErrorKind::NotFound => continue,
+            Err(err) => return Err(err).with_context(|| format!("failed to read {}", file.path)),
+        };
+        let contents = if file.name == "hosts.toml" && !include_secrets {
+            remove_tokens(&String::from_utf8_lossy(&contents))?.into_bytes()
+        } else {
+            contents
+        };
+
+        manifest.files.push(file.name.to_string());
+        entries.push((file.name, contents));
+    }
+
+    let mut tarball = Vec::new();
+    append(&mut tarball, MANIFEST, &serde_json::to_vec_pretty(&manifest)?)?;
+    for (name, contents) in entries {
+        append(&mut tarball, name, &contents)?;
+    }
+    crate::tarball::finish(&mut tarball);
+    writer.write_all(&crate::gzip::compress(&tarball))?;
+
+    Ok(manifest)
+}
+
+fn append(tarball: &mut Vec<u8>, name: &str, contents: &[u8]) -> Result<()> {
+    crate::tarball::append(tarball, name, contents, 0o600, chrono::Utc::now().timestamp())
+        .with_context(|| format!("failed to add {} to the backup", name))
+}
+
+/// Returns the hosts file without the tokens of the hosts, or of the accounts stashed
+/// under them.
+fn remove_tokens(hosts: &str) -> Result<String> {
+    let mut doc = hosts.parse::<toml_edit::Document>()?;
+    let names: Vec<String> = doc.iter().map(|(name, _)| name.to_string()).collect();
+    for name in names {
+        if let Some(host) = doc[name.as_str()].as_table_like_mut() {
+            host.remove("token");
+
+            if let Some(accounts) = host.get_mut("accounts").and_then(|a| a.as_table_like_mut()) {
+                for (_, account) in accounts.iter_mut() {
+                    if let Some(account) = account.as_table_like_mut() {
+                        account.remove("token");
+                    }
+                }
+            }
+        }
+    }
+
+    Ok(doc.to_string())
+}
+
+/// Returns the restored hosts file with the tokens of the hosts file it replaces, for the
+/// hosts and accounts in both that have none in the restored one.
+fn merge_tokens(restored: &str, existing: &str) -> Result<String> {
+    let mut doc = restored.parse::<toml_edit::Document>()?;
+    let existing = existing.parse::<toml_edit::Document>()?;
+    for (name, old) in existing.iter() {
+        let (old, new) = match (
+            old.as_table_like(),
+            doc.get_mut(name).and_then(|h| h.as_table_like_mut()),
+        ) {
+            (Some(old), Some(new)) => (old, new),
+            _ => continue,
+        };
+        merge_token(old, new);
+
+        let old_accounts = old.get("accounts").and_then(|a| a.as_table_like());
+        let new_accounts = new.get_mut("accounts").and_then(|a| a.as_table_like_mut());
+        if let (Some(old_accounts), Some(new_accounts)) = (old_accounts, new_accounts) {
+            for (account, old) in old_accounts.iter() {
+                let new = new_accounts.get_mut(account).and_then(|a| a.as_table_like_mut());
+                if let (Some(old), Some(new)) = (old.as_table_like(), new) {
+                    merge_token(old, new);
+                }
+            }
+        }
+    }
+
+    Ok(doc.to_string())
+}
+
+fn merge_token(from: &dyn toml_edit::TableLike, to: &mut dyn toml_edit::TableLike) {
+    if let Some(token) = from.get("token") {
+        if !to.contains_key("token") {
+            to.insert("token", token.clone());
+        }
+    }
+}
+
+/// Restore the state files in a backup, and return the paths restored with where the
+/// files they replaced were backed up to.
+///
+/// The whole backup is read and checked before any file is written.
+fn restore_backup<R: Read>(files: &[StateFile], mut reader: R) -> Result<Vec<(String, Option<String>)>> {
+    let mut archive = Vec::new();
+    reader.read_to_end(&mut archive)?;
+
+    let mut manifest: Option<Manifest> = None;
+    let mut entries = Vec::new();
+    for (name, contents) in crate::tarball::files(&crate::gzip::decompress(&archive)?)? {
+        if name == MANIFEST {
+            manifest = Some(serde_json::from_slice(&contents)?);
+            continue;
+        }
+        match files.iter().find(|file| file.name == name) {
+            Some(file) => entries.push((file, contents)),
+            None => bail!("unexpected file {} in the backup", name),
+        }
+    }
+    if manifest.is_none() {
+        bail!("it is not a kittycad backup, it has no {}", MANIFEST);
+    }
+
+    let mut restored = Vec::new();
+    for (file, contents) in entries {
+        let contents = match std::fs::read_to_string(&file.path) {
+            Ok(existing) if file.name == "hosts.toml" => {
+                merge_tokens(&String::from_utf8_lossy(&contents), &existing)?.into_bytes()
+            }
+            _ => contents,
+        };
+
+        let backup = crate::config_file::backup_config_file(&file.path)?;
+        write_file(&file.path, &contents, file.secret || file.name == "hosts.toml")?;
+        restored.push((file.path.to_string(), backup));
+    }
+
+    Ok(restored)
+}
+
+/// Write a file, only we can read it if it is a secret.
+fn write_file(path: &str, contents: &[u8], secret: bool) -> Result<()> {
+    if let Some(parent) = std::path::Path::new(path).parent() {
+        if !parent.as_os_str().is_empty() {
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("failed to create directory {}", parent.display()))?;
+        }
+    }
+
+    if !secret {
+        return std::fs::write(path, contents).with_context(|| format!("failed to write file {}", path));
+    }
+
+    // A secret is written to a new file, so it is only ever readable by us.
+    match std::fs::remove_file(path) {
+        Err(err) if err.kind() != std::io::ErrorKind::NotFound => {
+            Err(err).with_context(|| format!("failed to replace file {}", path))
+        }
+        _ => crate::signing::write_secret(path, contents),
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    fn files(dir: &std::path::Path) -> Vec<StateFile> {
+        let path = |name: &str| dir.join(name).to_str().unwrap().to_string();
+        vec![
+            StateFile {
+                name: "config.toml",
+                path: path("config/config.toml"),
+                secret: false,
+            },
+            StateFile {
+                name: "hosts.toml",
+                path: path("config/hosts.toml"),
+                secret: false,
+            },
+            StateFile {
+                name: "history.toml",
+                path: path("state/history.toml"),
+                secret: false,
+            },
+            StateFile {
+                name: "signing.key",
+                path: path("config/signing.key"),
+                secret: true,
+            },
+        ]
+    }
+
+    const HOSTS: &str = r#"["api.kittycad.io"]
+token = "my-secret-token"
+user = "me"
+"#;
+
+    #[test]
+    fn test_backup() {
+        let from = tempfile::tempdir().unwrap();
+        let from_files = files(from.path());
+        std::fs::create_dir_all(from.path().join("config")).unwrap();
+        std::fs::write(&from_files[0].path, "editor = \"vim\"\n").unwrap();
+        std::fs::write(&from_files[1].path, HOSTS).unwrap();
+        std::fs::write(&from_files[3].path, "my-signing-key").unwrap();
+
+        let mut archive = Vec::new();
+        let manifest = create_backup(&from_files, false, &mut archive).unwrap();
+        assert_eq!(manifest.files, vec!["config.toml", "hosts.toml"]);
+        assert!(!manifest.include_secrets);
+
+        let to = tempfile::tempdir().unwrap();
+        let to_files = files(to.path());
+        std::fs::create_dir_all(to.path().join("config")).unwrap();
+        std::fs::write(&to_files[0].path, "editor = \"nano\"\n").unwrap();
+
+        let restored = restore_backup(&to_files, &archive[..]).unwrap();
+        assert_eq!(restored.len(), 2);
+        assert_eq!(restored[0].0, to_files[0].path);
+        assert!(restored[0].1.is_some());
+        assert_eq!(restored[1].1, None);
+        assert_eq!(
+            std::fs::read_to_string(&to_files[0].path).unwrap(),
+            "editor = \"vim\"\n"
+        );
+        assert_eq!(
+            std::fs::read_to_string(&to_files[1].path).unwrap(),
+            "[\"api.kittycad.io\"]\nuser = \"me\"\n"
+        );
+        assert!(!std::path::Path::new(&to_files[3].path).exists());
+
+        // Restoring it again keeps the tokens we have.
+        std::fs::write(&to_files[1].path, HOSTS).unwrap();
+        restore_backup(&to_files, &archive[..]).unwrap();
+        assert_eq!(
+            std::fs::read_to_string(&to_files[1].path).unwrap(),
+            "[\"api.kittycad.io\"]\nuser = \"me\"\ntoken = \"my-secret-token\"\n"
+        );
+
+        let mut archive = Vec::new();
+        let manifest = create_backup(&from_files, true, &mut archive).unwrap();
+        assert_eq!(manifest.files, vec!["config.toml", "hosts.toml", "signing.key"]);
+        restore_backup(&to_files, &archive[..]).unwrap();
+        assert_eq!(std::fs::read_to_string(&to_files[1].path).unwrap(), HOSTS);
+        assert_eq!(std::fs::read_to_string(&to_files[3].path).unwrap(), "my-signing-key");
+    }
+
+    #[test]
+    fn test_remove_tokens() {
+        let hosts = r#"["api.kittycad.io"]
+token = "my-secret-token"
+user = "me"
+
+["api.kittycad.io".accounts.work]
+token = "my-work-token"
+user = "me@work"
+"#;
+
+        assert_eq!(
+            remove_tokens(hosts).unwrap(),
+            r#"["api.kittycad.io"]
+user = "me"
+
+["api.kittycad.io".accounts.work]
+user = "me@work"
+"#
+        );
+    }
+
+    #[test]
+    fn test_merge_tokens() {
+        let restored = r#"["api.kittycad.io"]
+user = "me"
+
+["api.kittycad.io".accounts.work]
+token = "my-restored-token"
+user = "me@work"
+
+["api.kittycad.io".accounts.home]
+user = "me@home"
+"#;
+        let existing = r#"["api.kittycad.io"]
+token = "my-secret-token"
+user = "me"
+
+["api.kittycad.io".accounts.work]
+token = "my-work-token"
+user = "me@work"
+
+["api.kittycad.io".accounts.home]
+token = "my-home-token"
+user = "me@home"
+
+["other.example.com"]
+token = "my-other-token"
+"#;
+
+        assert_eq!(
+            merge_tokens(restored, existing).unwrap(),
+            r#"["api.kittycad.io"]
+user = "me"
+token = "my-secret-token"
+
+["api.kittycad.io".accounts.work]
+token = "my-restored-token"
+user = "me@work"
+
+["api.kittycad.io".accounts.home]
+user = "me@home"
+token = "my-home-token"
+"#
+        );
+    }
+
+    #[test]
+    fn test_restore_bad_backup() {
+        let dir = tempfile::tempdir().unwrap();
+
+        let mut tarball = Vec::new();
+        append(&mut tarball, "passwd", b"nope").unwrap();
+        crate::tarball::finish(&mut tarball);
+        let archive = crate::gzip::compress(&tarball);
+        let err = restore_backup(&files(dir.path()), &archive[..]).unwrap_err();
+        assert_eq!(err.to_string(), "unexpected file passwd in the backup");
+
+        let mut tarball = Vec::new();
+        append(&mut tarball, "config.toml", b"editor = \"vim\"\n").unwrap();
+        crate::tarball::finish(&mut tarball);
+        let archive = crate::gzip::compress(&tarball);
+        let err = restore_backup(&files(dir.path()), &archive[..]).unwrap_err();
+        assert_eq!(err.to_string(), "it is not a kittycad backup, it has no backup.json");
+        assert!(!dir.path().join("config/config.toml").exists());
+    }
+}
@@ -0,0 +1,313 @@
+use anyhow::Result;
+use clap::Parser;
+use serde::Serialize;
+
+/// View your KittyCAD billing information.
+///
+///     # show your balance
+///     $ kittycad billing info
+///
+///     # list your invoices as json
+///     $ kittycad billing invoices --format=json
+///
+///     # list your payment methods
+///     $ kittycad billing payment-methods
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdBilling {
+    #[clap(subcommand)]
+    subcmd: SubCommand,
+}
+
+#[derive(Parser, Debug, Clone)]
+enum SubCommand {
+    #[clap(alias = "balance")]
+    Info(CmdBillingInfo),
+    Invoices(CmdBillingInvoices),
+    PaymentMethods(CmdBillingPaymentMethods),
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdBilling {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        match &self.subcmd {
+            SubCommand::Info(cmd) => cmd.run(ctx).await,
+            SubCommand::Invoices(cmd) => cmd.run(ctx).await,
+            SubCommand::PaymentMethods(cmd) => cmd.run(ctx).await,
+        }
+    }
+}
+
+/// Show your balance and remaining credits.
+///
+///     # show your balance
+///     $ kittycad billing info
+///
+///     # show your balance as json
+///     $ kittycad billing info --format=json
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdBillingInfo {
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdBillingInfo {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let balance = balance(ctx, "", None).await?;
+
+        let format = ctx.format(&self.format)?;
+        ctx.io.write_output(&format, &BalanceRow::from(&balance))?;
+
+        Ok(())
+    }
+}
+
+/// List your invoices.
+///
+///     # list your invoices
+///     $ kittycad billing invoices
+///
+///     # list your invoices as json
+///     $ kittycad billing invoices --format=json
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdBillingInvoices {
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdBillingInvoices {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let client = ctx.api_client("")?;
+        let retry_policy = ctx.retry_policy()?;
+
+        let client = &client;
+        let invoices = crate::retry::call(
+            &retry_policy,
+            &ctx.http_log(),
+            "GET /user/payment/invoices",
+            || async move { client.payments().list_invoices_for_user().await },
+        )
+        .await?;
+        let rows: Vec<InvoiceRow> = invoices.iter().map(InvoiceRow::from).collect();
+
+        let format = ctx.format(&self.format)?;
+        ctx.io.write_output_for_vec(&format, &rows)?;
+
+        Ok(())
+    }
+}
+
+/// List the payment methods on your account.
+///
+///     # list your payment methods
+///     $ kittycad billing payment-methods
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdBillingPaymentMethods {
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdBillingPaymentMethods {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let client = ctx.api_client("")?;
+        let retry_policy = ctx.retry_policy()?;
+
+        let client = &client;
+        let methods = crate::retry::call(
+            &retry_policy,
+            &ctx.http_log(),
+            "GET /user/payment/methods",
+            || async move { client.payments().list_methods_for_user().await },
+        )
+        .await?;
+        let rows: Vec<PaymentMethodRow> = methods.iter().map(PaymentMethodRow::from).collect();
+
+        let format = ctx.format(&self.format)?;
+        ctx.io.write_output_for_vec(&format, &rows)?;
+
+        Ok(())
+    }
+}
+
+/// Returns the balance of the account on the host, the default host if it is empty.
+///
+/// With a `max_age`, a balance fetched since is good enough. That is for the checks that
+/// run before other commands, which shouldn't wait on the billing API every time.
+pub(crate) async fn balance(
+    ctx: &crate::context::Context<'_>,
+    host: &str,
+    max_age: Option<std::time::Duration>,
+) -> Result<kittycad::types::CustomerBalance> {
+    let cache_dir = std::path::PathBuf::from(crate::config_file::cache_dir()?);
+    let cache_key = crate::cache::key(&[&ctx.cache_scope(host)?, "balance"]);
+    if let Some(max_age) = max_age {
+        if let Some(balance) = crate::cache::get(&cache_dir, &cache_key, Some(max_age)) {
+            return Ok(balance);
+        }
+    }
+
+    let client = ctx.api_client(host)?;
+    let retry_policy = ctx.retry_policy()?;
+
+    let client = &client;
+    let balance = crate::retry::call(
+        &retry_policy,
+        &ctx.http_log(),
+        "GET /user/payment/balance",
+        || async move { client.payments().get_balance_for_user().await },
+    )
+    .await?;
+    crate::cache::put(&cache_dir, &cache_key, &balance)?;
+
+    Ok(balance)
+}
+
+/// Returns what you can still spend: your monthly and prepaid credits, and prepaid cash.
+pub(crate) fn remaining(balance: &kittycad::types::CustomerBalance) -> f64 {
+    balance.monthly_credits_remaining + balance.pre_pay_credits_remaining + balance.pre_pay_cash_remaining
+}
+
+/// The output of `kittycad billing info`, amounts are in US dollars.
+#[derive(Debug, Clone, PartialEq, Serialize, tabled::Tabled)]
+struct BalanceRow {
+    #[tabled(display_with = "display_money")]
+    total_due: f64,
+    #[tabled(display_with = "display_money")]
+    monthly_credits_remaining: f64,
+    #[tabled(display_with = "display_money")]
+    pre_pay_credits_remaining: f64,
+    #[tabled(display_with = "display_money")]
+    pre_pay_cash_remaining: f64,
+    updated_at: chrono::DateTime<chrono::Utc>,
+}
+
+impl From<&kittycad::types::CustomerBalance> for BalanceRow {
+    fn from(balance: &kittycad::types::CustomerBalance) -> BalanceRow {
+        BalanceRow {
+            total_due: balance.total_due,
+            monthly_credits_remaining: balance.monthly_credits_remaining,
+            pre_pay_credits_remaining: balance.pre_pay_credits_remaining,
+            pre_pay_cash_remaining: balance.pre_pay_cash_remaining,
+            updated_at: balance.updated_at,
+        }
+    }
+}
+
+/// A row in the output of `kittycad billing invoices`, amounts are in US dollars.
+#[derive(Debug, Clone, PartialEq, Serialize, tabled::Tabled)]
+struct InvoiceRow {
+    number: String,
+    status: String,
+    #[tabled(display_with = "display_money")]
+    total: f64,
+    #[tabled(display_with = "display_money")]
+    amount_due: f64,
+    created_at: String,
+    pdf: String,
+}
+
+impl From<&kittycad::types::Invoice> for InvoiceRow {
+    fn from(invoice: &kittycad::types::Invoice) -> InvoiceRow {
+        InvoiceRow {
+            number: invoice.number.clone().unwrap_or_default(),
+            status: invoice.status.as_ref().map(|s| s.to_string()).unwrap_or_default(),
+            total: invoice.total.unwrap_or_default(),
+            amount_due: invoice.amount_due.unwrap_or_default(),
+            created_at: invoice.created_at.to_rfc3339(),
+            pdf: invoice.pdf.as_ref().map(|p| p.to_string()).unwrap_or_default(),
+        }
+    }
+}
+
+/// A row in the output of `kittycad billing payment-methods`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, tabled::Tabled)]
+struct PaymentMethodRow {
+    id: String,
+    #[serde(rename = "type")]
+    #[tabled(rename = "type")]
+    kind: String,
+    card: String,
+    expires: String,
+    created_at: String,
+}
+
+impl From<&kittycad::types::PaymentMethod> for PaymentMethodRow {
+    fn from(method: &kittycad::types::PaymentMethod) -> PaymentMethodRow {
+        let card = method.card.as_ref();
+        let brand = card.and_then(|c| c.brand.clone()).unwrap_or_default();
+        let last4 = card.and_then(|c| c.last4.clone()).unwrap_or_default();
+        let exp_month = card.and_then(|c| c.exp_month).unwrap_or_default();
+        let exp_year = card.and_then(|c| c.exp_year).unwrap_or_default();
+        PaymentMethodRow {
+            id: method.id.clone().unwrap_or_default(),
+            kind: method.type_.to_string(),
+            card: if last4.is_empty() {
+                String::new()
+            } else {
+                format!("{} ending in {}", brand, last4)
+            },
+            expires: if exp_year == 0 {
+                String::new()
+            } else {
+                format!("{:02}/{}", exp_month, exp_year)
+            },
+            created_at: method.created_at.to_rfc3339(),
+        }
+    }
+}
+
+pub(crate) fn display_money(amount: &f64) -> String {
+    if *amount < 0.0 {
+        format!("-${:.2}", -amount)
+    } else {
+        format!("${:.2}", amount)
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_display_money() {
+        assert_eq!(display_money(&0.0), "$0.00");
+        assert_eq!(display_money(&12.5), "$12.50");
+        assert_eq!(display_money(&-3.456), "-$3.46");
+    }
+
+    #[test]
+    fn test_payment_method_row() {
+        let method: kittycad::types::PaymentMethod = serde_json::from_str(
+            r#"{
+                "id": "pm_123",
+                "type": "card",
+                "card": {"brand": "visa", "last4": "4242", "exp_month": 4, "exp_year": 2025},
+                "billing_info": {},
+                "created_at": "2022-07-01T10:00:00Z"
+            }"#,
+        )
+        .unwrap();
+
+        assert_eq!(
+            PaymentMethodRow::from(&method),
+            PaymentMethodRow {
+                id: "pm_123".to_string(),
+                kind: "card".to_string(),
+                card: "visa ending in 4242".to_string(),
+                expires: "04/2025".to_string(),
+                created_at: "2022-07-01T10:00:00+00:00".to_string(),
+            }
+        );
+    }
+}
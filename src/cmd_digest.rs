@@ -0,0 +1,242 @@
+use std::{collections::BTreeMap, io::Write};
+
+use anyhow::Result;
+use clap::Parser;
+use serde::{Deserialize, Serialize};
+
+/// Summarize your recent activity.
+///
+/// This combines the operations started from this machine with your API calls, to
+/// show what you ran, how much data you sent, what failed and what it cost. The
+/// default output is plain text you can paste into a standup.
+///
+///     # summarize the last week
+///     $ kittycad digest
+///
+///     # summarize the last 30 days
+///     $ kittycad digest --since 30d
+///
+///     # summarize the last week as json
+///     $ kittycad digest --format=json
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdDigest {
+    /// How far back to look, e.g. "7d" or "12h".
+    #[clap(long, default_value = "7d", parse(try_from_str = crate::types::parse_duration))]
+    pub since: std::time::Duration,
+
+    /// The most API calls to look at. By default every call since `--since` is counted.
+    #[clap(long, short)]
+    pub limit: Option<usize>,
+
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdDigest {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        if self.limit == Some(0) {
+            anyhow::bail!("--limit must be greater than 0");
+        }
+
+        let until = chrono::Utc::now();
+        let since = until - chrono::Duration::from_std(self.since)?;
+
+        let operations = crate::history::load(&crate::config_file::history_file()?)?;
+        // The calls come most recent first, so we are done at the first one before the period.
+        let limit = self.limit.unwrap_or(usize::MAX);
+        let calls: Vec<ApiCall> = crate::pagination::list_pages_until(
+            ctx,
+            "/user/api-calls",
+            limit,
+            |_| true,
+            |call: &ApiCall| call.created_at < since,
+        )
+        .await?;
+        if calls.len() == limit {
+            let cs = ctx.io.color_scheme();
+            writeln!(
+                ctx.io.err_out,
+                "{} Only the last {} API calls are counted, raise --limit to count them all",
+                cs.warning_icon(),
+                limit
+            )?;
+        }
+
+        let digest = Digest::new(since, until, &operations, &calls);
+
+        match ctx.format(&self.format)? {
+            crate::types::FormatOutput::Json => ctx.io.write_output_json(&serde_json::to_value(&digest)?)?,
+            crate::types::FormatOutput::Yaml => ctx.io.write_output_yaml(&digest)?,
+            crate::types::FormatOutput::Table => write!(ctx.io.out, "{}", digest)?,
+        }
+
+        Ok(())
+    }
+}
+
+/// The parts of an API call we summarize.
+#[derive(Debug, Clone, Deserialize)]
+struct ApiCall {
+    created_at: chrono::DateTime<chrono::Utc>,
+    status_code: Option<i32>,
+    /// The price of the API call in US dollars.
+    price: Option<f64>,
+}
+
+/// A summary of the activity in a period.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+struct Digest {
+    since: chrono::DateTime<chrono::Utc>,
+    until: chrono::DateTime<chrono::Utc>,
+    /// The operations started from this machine, by operation, e.g. "file convert".
+    operations: BTreeMap<String, usize>,
+    /// The size of the inputs of those operations in bytes.
+    bytes_processed: usize,
+    api_calls: usize,
+    failed_api_calls: usize,
+    /// The cost of the API calls in US dollars.
+    credits_used: f64,
+}
+
+impl Digest {
+    fn new(
+        since: chrono::DateTime<chrono::Utc>,
+        until: chrono::DateTime<chrono::Utc>,
+        operations: &[crate::history::HistoryEntry],
+        calls: &[ApiCall],
+    ) -> Digest {
+        let mut digest = Digest {
+            since,
+            until,
+            operations: BTreeMap::new(),
+            bytes_processed: 0,
+            api_calls: 0,
+            failed_api_calls: 0,
+            credits_used: 0.0,
+        };
+
+        for entry in operations
+            .iter()
+            .filter(|e| e.created_at >= since && e.created_at <= until)
+        {
+            *digest.operations.entry(entry.operation.clone()).or_default() += 1;
+            digest.bytes_processed += entry.input_size;
+        }
+
+        for call in calls.iter().filter(|c| c.created_at >= since && c.created_at <= until) {
+            digest.api_calls += 1;
+            if call.status_code.unwrap_or_default() >= 400 {
+                digest.failed_api_calls += 1;
+            }
+            digest.credits_used += call.price.unwrap_or_default();
+        }
+
+        digest
+    }
+}
+
+impl std::fmt::Display for Digest {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        writeln!(
+            f,
+            "KittyCAD activity from {} to {}",
+            self.since.format("%Y-%m-%d"),
+            self.until.format("%Y-%m-%d")
+        )?;
+
+        if self.operations.is_empty() {
+            writeln!(f, "- no operations run from this machine")?;
+        }
+        for (operation, count) in &self.operations {
+            writeln!(f, "- {} x `kittycad {}`", count, operation)?;
+        }
+        if self.bytes_processed > 0 {
+            writeln!(
+                f,
+                "- {} of input processed",
+                crate::types::format_bytes(self.bytes_processed as u64)
+            )?;
+        }
+
+        writeln!(
+            f,
+            "- {} API call{}, {} failed",
+            self.api_calls,
+            if self.api_calls == 1 { "" } else { "s" },
+            self.failed_api_calls
+        )?;
+        writeln!(f, "- ${:.2} of credits used", self.credits_used)
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    fn entry(operation: &str, input_size: usize, created_at: &str) -> crate::history::HistoryEntry {
+        crate::history::HistoryEntry {
+            id: uuid::Uuid::new_v4().to_string(),
+            operation: operation.to_string(),
+            input: "my-file.step".to_string(),
+            input_size,
+            status: "Completed".to_string(),
+            args: vec![],
+            created_at: created_at.parse().unwrap(),
+        }
+    }
+
+    fn call(status_code: Option<i32>, price: Option<f64>, created_at: &str) -> ApiCall {
+        ApiCall {
+            created_at: created_at.parse().unwrap(),
+            status_code,
+            price,
+        }
+    }
+
+    #[test]
+    fn test_digest() {
+        let operations = vec![
+            entry("file convert", 1024 * 1024, "2022-07-07T10:00:00Z"),
+            entry("file convert", 512 * 1024, "2022-07-05T10:00:00Z"),
+            entry("file volume", 1024, "2022-07-03T10:00:00Z"),
+            entry("file convert", 1024, "2022-06-20T10:00:00Z"),
+        ];
+        let calls = vec![
+            call(Some(200), Some(0.5), "2022-07-07T10:00:00Z"),
+            call(Some(400), Some(0.25), "2022-07-05T10:00:00Z"),
+            call(None, None, "2022-07-03T10:00:00Z"),
+            call(Some(200), Some(10.0), "2022-06-20T10:00:00Z"),
+        ];
+
+        let digest = Digest::new(
+            "2022-07-01T00:00:00Z".parse().unwrap(),
+            "2022-07-08T00:00:00Z".parse().unwrap(),
+            &operations,
+            &calls,
+        );
+
+        assert_eq!(
+            digest.operations,
+            BTreeMap::from([("file convert".to_string(), 2), ("file volume".to_string(), 1)])
+        );
+        assert_eq!(digest.bytes_processed, 1024 * 1024 + 512 * 1024 + 1024);
+        assert_eq!(digest.api_calls, 3);
+        assert_eq!(digest.failed_api_calls, 1);
+
+        assert_eq!(
+            digest.to_string(),
+            r#"KittyCAD activity from 2022-07-01 to 2022-07-08
+- 2 x `kittycad file convert`
+- 1 x `kittycad file volume`
+- 1.5 MiB of input processed
+- 3 API calls, 1 failed
+- $0.75 of credits used
+"#
+        );
+    }
+}
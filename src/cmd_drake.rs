@@ -1,16 +1,231 @@
+use std::io::Write;
+
 use anyhow::Result;
 use clap::Parser;
 
+/// The number of recent conversions the dashboard shows.
+const RECENT_CONVERSIONS: usize = 5;
+
+/// Drake when something is wrong.
+const DRAKE_NAH: &str = r#"
+      _____
+     / -  - \     ||
+    |   __   |   =||=    nah
+     \______/     ||
+"#;
+
+/// Drake when everything is fine.
+const DRAKE_YEAH: &str = r#"
+      _____
+     / ^  ^ \
+    |  \__/  |   ===>    yeah
+     \______/
+"#;
+
+/// Spins in the footer of the dashboard so you can tell it is alive.
+const SPINNER: &[&str] = &["|", "/", "-", "\\"];
+
 /// Open a drake meme in your web browser.
 ///
+/// With `--dashboard`, show who you are logged in as, your recent conversions and
+/// whether the API is up instead. In a terminal the dashboard is redrawn until you
+/// hit Ctrl-C. Drake approves when everything is up.
+///
 ///     $ kittycad drake
+///
+///     # watch the dashboard
+///     $ kittycad drake --dashboard
+///
+///     # redraw the dashboard every minute
+///     $ kittycad drake --dashboard --interval 1m
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
-pub struct CmdDrake {}
+pub struct CmdDrake {
+    /// Show the dashboard instead of the meme.
+    #[clap(long)]
+    pub dashboard: bool,
+
+    /// How long to wait between redraws of the dashboard.
+    #[clap(long, default_value = "5s", requires = "dashboard", parse(try_from_str = crate::types::parse_duration))]
+    pub interval: std::time::Duration,
+}
 
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdDrake {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
-        ctx.browser("", "https://dl.kittycad.io/drake.jpeg")
+        if !self.dashboard {
+            return ctx.browser("", "https://dl.kittycad.io/drake.jpeg");
+        }
+
+        let is_tty = ctx.io.is_stdout_tty();
+        let mut tick = 0;
+        loop {
+            let dashboard = Dashboard::load(ctx).await?;
+            let cs = ctx.io.color_scheme();
+            if is_tty {
+                // Clear the screen and draw from the top.
+                write!(ctx.io.out, "\x1b[H\x1b[2J")?;
+            }
+            write!(ctx.io.out, "{}", dashboard.render(&cs, chrono::Utc::now()))?;
+            if !is_tty {
+                return Ok(());
+            }
+
+            write!(
+                ctx.io.out,
+                "\n{}",
+                cs.gray(&format!(
+                    "Redrawn every {}s, hit Ctrl-C to quit {}",
+                    self.interval.as_secs(),
+                    SPINNER[tick % SPINNER.len()]
+                ))
+            )?;
+            ctx.io.out.flush()?;
+
+            tick += 1;
+            tokio::time::sleep(self.interval).await;
+        }
+    }
+}
+
+/// What the dashboard shows.
+struct Dashboard {
+    /// The hosts you have set up, with who you are logged in to each as, if you are.
+    accounts: Vec<(String, Option<String>)>,
+    /// The conversions started from this machine, newest first.
+    conversions: Vec<crate::history::HistoryEntry>,
+    /// The checks of the default host, or why they couldn't be run.
+    status: std::result::Result<crate::cmd_status::Status, String>,
+}
+
+impl Dashboard {
+    async fn load(ctx: &mut crate::context::Context<'_>) -> Result<Dashboard> {
+        let mut accounts = Vec::new();
+        for host in ctx.config.hosts()? {
+            let token = ctx.config.get(&host, "token").unwrap_or_default();
+            let user = if token.is_empty() {
+                None
+            } else {
+                let user = ctx.config.get(&host, "user").unwrap_or_default();
+                Some(ctx.io.redact(&user))
+            };
+            accounts.push((host, user));
+        }
+
+        let mut conversions: Vec<crate::history::HistoryEntry> =
+            crate::history::load(&crate::config_file::history_file()?)?
+                .into_iter()
+                .filter(|entry| entry.operation == "file convert")
+                .collect();
+        conversions.sort_by(|a, b| b.created_at.cmp(&a.created_at));
+        conversions.truncate(RECENT_CONVERSIONS);
+
+        let status = crate::cmd_status::check(ctx, "").await.map_err(|err| err.to_string());
+
+        Ok(Dashboard {
+            accounts,
+            conversions,
+            status,
+        })
+    }
+
+    fn is_up(&self) -> bool {
+        matches!(&self.status, Ok(status) if status.is_up())
+    }
+
+    fn render(&self, cs: &crate::colors::ColorScheme, now: chrono::DateTime<chrono::Utc>) -> String {
+        let mut s = if self.is_up() {
+            cs.green(DRAKE_YEAH)
+        } else {
+            cs.red(DRAKE_NAH)
+        };
+
+        s.push_str(&format!("\n{}\n", cs.bold("Auth")));
+        if self.accounts.is_empty() {
+            s.push_str("  not logged in, run `kittycad auth login`\n");
+        }
+        for (host, user) in &self.accounts {
+            match user {
+                Some(user) if !user.is_empty() => {
+                    s.push_str(&format!("  {} {} as {}\n", cs.success_icon(), host, user))
+                }
+                Some(_) => s.push_str(&format!("  {} {}\n", cs.success_icon(), host)),
+                None => s.push_str(&format!("  {} {} not logged in\n", cs.failure_icon(), host)),
+            }
+        }
+
+        s.push_str(&format!("\n{}\n", cs.bold("Recent conversions")));
+        if self.conversions.is_empty() {
+            s.push_str("  none yet, try `kittycad file convert`\n");
+        }
+        for entry in &self.conversions {
+            let ago = chrono_humanize::HumanTime::from(entry.created_at - now);
+            s.push_str(&format!(
+                "  {}  {}  {}\n",
+                cs.gray(&ago.to_string()),
+                entry.status,
+                entry.input
+            ));
+        }
+
+        s.push_str(&format!("\n{}\n", cs.bold("API")));
+        match &self.status {
+            Ok(status) => {
+                for line in status.summary(cs).lines() {
+                    s.push_str(&format!("  {}\n", line));
+                }
+            }
+            Err(err) => s.push_str(&format!("  {} {}\n", cs.failure_icon(), err)),
+        }
+
+        s
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_render() {
+        let cs = crate::colors::ColorScheme::new(false, false, false);
+        let now: chrono::DateTime<chrono::Utc> = "2022-07-07T12:00:00Z".parse().unwrap();
+
+        let dashboard = Dashboard {
+            accounts: vec![
+                ("api.kittycad.io".to_string(), Some("me@example.com".to_string())),
+                ("kittycad.internal".to_string(), None),
+            ],
+            conversions: vec![crate::history::HistoryEntry {
+                id: "abc".to_string(),
+                operation: "file convert".to_string(),
+                input: "my-part.step".to_string(),
+                input_size: 1024,
+                status: "Completed".to_string(),
+                args: vec![],
+                created_at: "2022-07-07T11:58:00Z".parse().unwrap(),
+            }],
+            status: Err("no host is set up".to_string()),
+        };
+        assert!(!dashboard.is_up());
+        assert_eq!(
+            dashboard.render(&cs, now),
+            format!(
+                r#"{}
+Auth
+  ✔ api.kittycad.io as me@example.com
+  ✘ kittycad.internal not logged in
+
+Recent conversions
+  2 minutes ago  Completed  my-part.step
+
+API
+  ✘ no host is set up
+"#,
+                DRAKE_NAH
+            )
+        );
     }
 }
@@ -1,7 +1,7 @@
-use std::str::FromStr;
+use std::{io::Write, str::FromStr};
 
-use anyhow::Result;
-use clap::Parser;
+use anyhow::{Context, Result};
+use clap::{Parser, ValueEnum};
 
 /// Perform operations on CAD files.
 ///
@@ -20,6 +20,10 @@ enum SubCommand {
     Volume(CmdFileVolume),
     Mass(CmdFileMass),
     Density(CmdFileDensity),
+    Validate(CmdFileValidate),
+    Info(CmdFileInfo),
+    Sign(CmdFileSign),
+    Verify(CmdFileVerify),
 }
 
 #[async_trait::async_trait]
@@ -30,6 +34,10 @@ impl crate::cmd::Command for CmdFile {
             SubCommand::Volume(cmd) => cmd.run(ctx).await,
             SubCommand::Mass(cmd) => cmd.run(ctx).await,
             SubCommand::Density(cmd) => cmd.run(ctx).await,
+            SubCommand::Validate(cmd) => cmd.run(ctx).await,
+            SubCommand::Info(cmd) => cmd.run(ctx).await,
+            SubCommand::Sign(cmd) => cmd.run(ctx).await,
+            SubCommand::Verify(cmd) => cmd.run(ctx).await,
         }
     }
 }
@@ -46,29 +54,162 @@ impl crate::cmd::Command for CmdFile {
 ///     # convert obj to step
 ///     $ kittycad file convert my-obj.obj thing.step
 ///
-///     # pass a file to convert from stdin
-///     # when converting from stdin, the original file type is required
+///     # pass a file to convert from stdin, its type is told from its contents
+///     $ cat my-obj.obj | kittycad file convert - thing.step
+///
+///     # or given with --src-format when it can't be
 ///     $ cat my-obj.obj | kittycad file convert - thing.step --src-format=obj
+///
+///     # pass an option the CLI does not have a flag for yet through to the API
+///     $ kittycad file convert my-file.step my-file.obj --param some_option=value
+///
+///     # convert an obj modelled in inches to an stl in millimeters
+///     $ kittycad file convert my-file.obj my-file.stl --src-unit in --output-unit mm
+///
+///     # save a binary stl with z pointing up
+///     $ kittycad file convert my-file.step my-file.stl --option stl.storage=binary \
+///         --option stl.coords=z-up
+///
+///     # gzip the output, this saves it to my-file.obj.gz
+///     $ kittycad file convert my-file.step my-file.obj --gzip-output
+///
+///     # save the output next to the others, this saves it to out/my-file.obj
+///     $ kittycad file convert my-file.step --output-dir out --output-format obj
+///
+///     # name the output yourself, this saves it to out/stdin-stl.stl
+///     $ cat my-file.step | kittycad file convert - --src-format step --output-format stl \
+///         --output-dir out --output-template '{name}-{format}.{ext}'
+///
+///     # write only the output to stdout, to pipe it to another command
+///     $ cat my-file.step | kittycad file convert - --to obj | gzip > my-file.obj.gz
+///
+///     # sign the output so it can be verified with `kittycad file verify`
+///     $ kittycad file convert my-file.step my-file.stl --sign
+///
+///     # convert parts/gear.stl.step to out/gear.stl and parts/arm.obj.step to out/arm.obj
+///     $ kittycad file convert 'parts/*.step' --output-dir out --output-template '{name}'
+///
+///     # convert every step file under parts, quote the pattern so the shell leaves it alone
+///     $ kittycad file convert 'parts/**/*.step' --output-dir out --output-format obj \
+///         --exclude '**/old/**'
+///
+///     # keep track of a long batch, and if it stops, pick it up where it left off
+///     $ kittycad file convert 'parts/**/*.step' --output-dir out --output-format obj \
+///         --manifest parts.json
+///     $ kittycad file convert 'parts/**/*.step' --output-dir out --output-format obj \
+///         --resume parts.json
+///
+///     # upload and download at most 2 MiB per second
+///     $ kittycad file convert my-file.step my-file.obj --limit-rate 2M
+///
+///     # don't wait for a conversion the API queued, exit with 3 and wait for it later
+///     $ kittycad file convert my-file.step my-file.obj --no-wait
+///
+///     # if the conversion fails, save what went wrong to send to support
+///     $ kittycad file convert my-file.step my-file.obj --keep-input-on-failure
+///
+///     # pick the file, format and output location interactively
+///     $ kittycad file convert --interactive
+///
+/// Running the command without any arguments in a terminal also starts the
+/// interactive wizard.
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdFileConvert {
     /// The path to the input file to convert.
     /// If you pass `-` as the path, the file will be read from stdin.
-    #[clap(name = "input", parse(from_os_str), required = true)]
-    pub input: std::path::PathBuf,
+    /// A pattern like `parts/**/*.step` converts every file it matches into
+    /// `--output-dir`, except the files listed in the `.gitignore` or `.kittycadignore`
+    /// of the current directory.
+    #[clap(name = "input", parse(from_os_str), required = false)]
+    pub input: Option<std::path::PathBuf>,
+
+    /// Leave out the files matching this pattern when the input is a pattern, can be
+    /// given more than once.
+    #[clap(long, requires = "input")]
+    pub exclude: Vec<String>,
+
+    /// Record the files converted and the ones that failed in this JSON file as the
+    /// batch goes, when the input is a pattern.
+    #[clap(long, parse(from_os_str), requires = "input")]
+    pub manifest: Option<std::path::PathBuf>,
+
+    /// Skip the files a previous batch recorded as converted in this manifest, and
+    /// keep recording in it. Run it from the same directory as the first time.
+    #[clap(long, parse(from_os_str), requires = "input", conflicts_with = "manifest")]
+    pub resume: Option<std::path::PathBuf>,
 
     /// The path to an output file. The command will
-    /// save the output of the conversion to the given path.
-    #[clap(name = "output", parse(from_os_str), required = true)]
-    pub output: std::path::PathBuf,
+    /// save the output of the conversion to the given path, or with `-`, write only
+    /// the output to stdout. Binary output isn't written to a terminal.
+    #[clap(name = "output", parse(from_os_str), required = false)]
+    pub output: Option<std::path::PathBuf>,
+
+    /// The directory to save the output in when no output path is given, it is
+    /// created if it doesn't exist. The file is named with `--output-template`. With an
+    /// input pattern, the directories under the start of the pattern are kept.
+    #[clap(long, parse(from_os_str), conflicts_with = "output")]
+    pub output_dir: Option<std::path::PathBuf>,
 
-    /// A valid source file format.
-    #[clap(short = 's', long = "src-format", arg_enum)]
+    /// The name of the output file when no output path is given, `{name}.{ext}`
+    /// by default. `{name}` is the input file name without its extension, or
+    /// `stdin`, `{format}` is the output format and `{ext}` its file extension.
+    /// Without `--output-format`, the format is taken from the extension of the
+    /// name the template gives for each file.
+    #[clap(long, conflicts_with = "output")]
+    pub output_template: Option<String>,
+
+    /// Gzip the output file as it is written, adding a `.gz` extension.
+    #[clap(long)]
+    pub gzip_output: bool,
+
+    /// Sign the output file with your signing key, see `kittycad file sign`.
+    #[clap(long)]
+    pub sign: bool,
+
+    /// If the conversion fails, save the request, the error, the timing and the start
+    /// of the input file to the state directory so you can attach it when contacting
+    /// support.
+    #[clap(long)]
+    pub keep_input_on_failure: bool,
+
+    /// Don't wait for a conversion the API hasn't finished yet, exit with 3 instead.
+    /// Wait for it later with `kittycad api-call wait <id>`.
+    #[clap(long)]
+    pub no_wait: bool,
+
+    /// Walk through picking the input file, output format and output location.
+    #[clap(long, short, conflicts_with_all = &["input", "output", "output_dir", "output_template"])]
+    pub interactive: bool,
+
+    /// A valid source file format, told from the extension or contents of the file if
+    /// not given.
+    #[clap(short = 's', long = "src-format", alias = "from", arg_enum)]
     src_format: Option<kittycad::types::FileSourceFormat>,
     /// A valid output file format.
-    #[clap(short = 't', long = "output-format", arg_enum)]
+    #[clap(short = 't', long = "output-format", alias = "to", arg_enum)]
     output_format: Option<kittycad::types::FileOutputFormat>,
 
+    /// The unit the input file is in, for formats like OBJ and STL that don't
+    /// say. This is sent as the `src_unit` parameter.
+    #[clap(long, arg_enum)]
+    pub src_unit: Option<crate::types::LengthUnit>,
+
+    /// The unit to scale the output to. This is sent as the `output_unit`
+    /// parameter.
+    #[clap(long, arg_enum)]
+    pub output_unit: Option<crate::types::LengthUnit>,
+
+    /// Set an option of the output format, like `stl.storage=binary` for a binary
+    /// STL, can be given more than once. The format must be the output format.
+    #[clap(long = "option", value_name = "FORMAT.KEY=VALUE", possible_values = OUTPUT_OPTIONS)]
+    pub option: Vec<String>,
+
+    /// Pass an additional conversion parameter in key=value format.
+    /// These are sent as-is and validated by the API.
+    #[clap(long = "param")]
+    pub param: Vec<String>,
+
     /// Command output format.
     #[clap(long, short, arg_enum)]
     pub format: Option<crate::types::FormatOutput>,
@@ -77,36 +218,143 @@ pub struct CmdFileConvert {
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdFileConvert {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
-        // Parse the source format.
-        let src_format = if let Some(src_format) = &self.src_format {
-            src_format.clone()
-        } else {
-            get_source_format_from_extension(&get_extension(self.input.clone()))?
+        if let Some(input) = &self.input {
+            if is_pattern(input) {
+                return self.run_pattern(ctx, input).await;
+            }
+        }
+        if self.manifest.is_some() || self.resume.is_some() {
+            anyhow::bail!("the `--manifest` and `--resume` flags only work when the input is a pattern");
+        }
+
+        let has_output =
+            self.output.is_some() || self.output_dir.is_some() || self.output_template.is_some() || self.to_stdout();
+        let input_path = match &self.input {
+            Some(input) if has_output && !self.interactive => input,
+            _ => {
+                if !ctx.io.can_prompt() {
+                    anyhow::bail!("the input and output paths are required when not running interactively");
+                }
+
+                let cmd = self.prompt(ctx)?;
+                return cmd.run(ctx).await;
+            }
         };
 
+        let to_stdout = self.to_stdout();
+        if to_stdout && self.sign {
+            anyhow::bail!("the `--sign` flag needs an output file, it can't sign what is written to stdout");
+        }
+
         // Parse the output format.
         let output_format = if let Some(output_format) = &self.output_format {
             output_format.clone()
+        } else if to_stdout {
+            anyhow::bail!("the `--output-format` flag is required when writing to stdout");
+        } else if let Some(output) = &self.output {
+            get_output_format_from_extension(&get_extension(output.clone()))?
+        } else if let Some(template) = &self.output_template {
+            // The template gives the extension, so each file can have its own format.
+            let name = render_output_template(template, input_path, None)?;
+            get_output_format_from_extension(&get_extension(std::path::PathBuf::from(name)))?
         } else {
-            get_output_format_from_extension(&get_extension(self.output.clone()))?
+            anyhow::bail!("the `--output-format` flag is required when there is no output path");
         };
 
+        let output_path = self.output_path(input_path, &output_format)?;
+
+        let params = self.params(&output_format)?;
+        let limit_rate = ctx.limit_rate()?;
+
         // Get the contents of the input file.
-        let input = ctx.read_file(self.input.to_str().unwrap_or(""))?;
+        let (src_format, input) = read_input(ctx, input_path, &self.src_format)?;
+        let input_size = input.len();
+        let input_head = if self.keep_input_on_failure {
+            crate::failure_bundle::input_head(&input)
+        } else {
+            vec![]
+        };
 
         // Do the conversion.
-        let client = ctx.api_client("")?;
+        let started_at = chrono::Utc::now();
+        let start = std::time::Instant::now();
+        let result = self
+            .create_conversion(ctx, &src_format, &output_format, &params, limit_rate, input)
+            .await;
 
-        // Create the file conversion.
-        let mut file_conversion = client
-            .file()
-            .create_conversion(output_format, src_format, &input.into())
-            .await?;
+        if self.keep_input_on_failure {
+            let failure = match &result {
+                Ok(c) if c.status == kittycad::types::ApiCallStatus::Failed => {
+                    Some((Some(c.id.to_string()), c.error.clone().unwrap_or_default()))
+                }
+                Ok(_) => None,
+                Err(err) => Some((None, err.to_string())),
+            };
+
+            if let Some((api_call_id, error)) = failure {
+                let bundle = crate::failure_bundle::FailureBundle {
+                    command: "file convert".to_string(),
+                    cli_version: clap::crate_version!().to_string(),
+                    method: http::Method::POST.to_string(),
+                    endpoint: format!("/file/conversion/{}/{}", src_format, output_format),
+                    params: params.clone(),
+                    input: input_path.display().to_string(),
+                    input_size,
+                    started_at,
+                    duration_secs: start.elapsed().as_secs_f64(),
+                    api_call_id,
+                    error,
+                };
+                // Failing to save the bundle shouldn't hide the error we're saving it for.
+                match crate::config_file::failures_dir()
+                    .and_then(|dir| crate::failure_bundle::save(std::path::Path::new(&dir), &bundle, &input_head))
+                {
+                    Ok(path) => writeln!(
+                        ctx.io.err_out,
+                        "Saved what went wrong to {}, attach it when you contact support@kittycad.io",
+                        path.display()
+                    )?,
+                    Err(err) => writeln!(ctx.io.err_out, "failed to save what went wrong: {}", err)?,
+                }
+            }
+        }
+
+        let mut file_conversion = result?;
+
+        // Remember the conversion so it can be picked in `kittycad api-call status` later.
+        crate::history::remember(
+            &file_conversion.id.to_string(),
+            "file convert",
+            input_path,
+            input_size,
+            &file_conversion.status.to_string(),
+        );
+
+        // The API queues conversions it can't finish right away, wait for those unless
+        // asked not to.
+        if !crate::cmd_api_call::is_finished(&file_conversion.status) {
+            return self.wait(ctx, file_conversion, &output_path).await;
+        }
 
         // If they specified an output file, save the output to that file.
         if file_conversion.status == kittycad::types::ApiCallStatus::Completed {
             if let Some(output) = file_conversion.output {
-                std::fs::write(&self.output, output)?;
+                if let Some(dir) = &self.output_dir {
+                    std::fs::create_dir_all(dir)
+                        .with_context(|| format!("failed to create directory {}", dir.display()))?;
+                }
+
+                if to_stdout {
+                    crate::output_file::write_stdout(&mut ctx.io, &output.0, self.gzip_output)?;
+                } else {
+                    let path = crate::output_file::write(&output_path, &output.0, self.gzip_output)?;
+                    if self.output.is_none() || path != output_path {
+                        writeln!(ctx.io.err_out, "Saved file conversion output to {}", path.display())?;
+                    }
+                    if self.sign {
+                        sign_file(ctx, &path)?;
+                    }
+                }
             } else {
                 anyhow::bail!("no output was generated! (this is probably a bug in the API) you should report it to support@kittycad.io");
             }
@@ -116,14 +364,590 @@ impl crate::cmd::Command for CmdFileConvert {
         // Otherwise what we print will be crazy big.
         file_conversion.output = None;
 
-        // Print the output of the conversion.
-        let format = ctx.format(&self.format)?;
-        ctx.io.write_output(&format, &file_conversion)?;
+        // Print the output of the conversion, unless stdout is for the converted file.
+        if !to_stdout {
+            let format = ctx.format(&self.format)?;
+            ctx.io.write_output(&format, &file_conversion)?;
+        }
+
+        if file_conversion.status == kittycad::types::ApiCallStatus::Failed {
+            return Err(crate::cmd::ExitCodeError {
+                code: crate::exit_code::FAILED,
+                message: format!(
+                    "File conversion {} failed: {}",
+                    file_conversion.id,
+                    file_conversion.error.unwrap_or_default()
+                ),
+            }
+            .into());
+        }
 
         Ok(())
     }
 }
 
+/// Files smaller than this are sent without showing the progress, it would only flash by.
+const PROGRESS_MIN_SIZE: u64 = 1024 * 1024;
+
+/// How long to wait between checking on a conversion the API queued.
+const WAIT_INTERVAL: std::time::Duration = std::time::Duration::from_secs(2);
+
+impl CmdFileConvert {
+    /// Wait for a conversion the API hasn't finished yet and save its output, or with
+    /// `--no-wait`, print it and exit with the pending code.
+    async fn wait(
+        &self,
+        ctx: &mut crate::context::Context<'_>,
+        mut file_conversion: kittycad::types::FileConversion,
+        output_path: &std::path::Path,
+    ) -> Result<()> {
+        let id = file_conversion.id.to_string();
+        if self.no_wait {
+            file_conversion.output = None;
+            if !self.to_stdout() {
+                let format = ctx.format(&self.format)?;
+                ctx.io.write_output(&format, &file_conversion)?;
+            }
+
+            return Err(crate::cmd::ExitCodeError {
+                code: crate::exit_code::PENDING,
+                message: format!(
+                    "File conversion {} is {}, wait for it with `kittycad api-call wait {} --output {}`",
+                    id,
+                    file_conversion.status,
+                    id,
+                    shlex::quote(&output_path.display().to_string())
+                ),
+            }
+            .into());
+        }
+
+        if let Some(dir) = &self.output_dir {
+            std::fs::create_dir_all(dir).with_context(|| format!("failed to create directory {}", dir.display()))?;
+        }
+
+        let cmd = crate::cmd_api_call::CmdApiCallWait {
+            id: id.parse()?,
+            interval: WAIT_INTERVAL,
+            output: Some(output_path.to_path_buf()),
+            gzip_output: self.gzip_output,
+            format: self.format.clone(),
+        };
+        cmd.run(ctx).await?;
+
+        if self.sign {
+            let path = if self.gzip_output {
+                crate::output_file::gzip_path(output_path)
+            } else {
+                output_path.to_path_buf()
+            };
+            sign_file(ctx, &path)?;
+        }
+
+        Ok(())
+    }
+
+    /// Create the file conversion.
+    async fn create_conversion(
+        &self,
+        ctx: &crate::context::Context<'_>,
+        src_format: &kittycad::types::FileSourceFormat,
+        output_format: &kittycad::types::FileOutputFormat,
+        params: &[(String, String)],
+        limit_rate: Option<u64>,
+        input: Vec<u8>,
+    ) -> Result<kittycad::types::FileConversion> {
+        let client = ctx.api_client("")?;
+        let show_progress = ctx.io.progress_indicator_enabled() && input.len() as u64 >= PROGRESS_MIN_SIZE;
+
+        if params.is_empty() && limit_rate.is_none() && !show_progress {
+            let retry_policy = ctx.retry_policy()?;
+            let client = &client;
+            let body = &bytes::Bytes::from(input);
+            let what = format!("POST /file/conversion/{}/{}", src_format, output_format);
+            crate::retry::call_once(&retry_policy, &ctx.http_log(), &what, || async move {
+                client
+                    .file()
+                    .create_conversion(output_format.clone(), src_format.clone(), body)
+                    .await
+            })
+            .await
+        } else {
+            // The typed client doesn't know about extra params and can't throttle the
+            // transfer or tell us how it is going, so send the request ourselves.
+            let mut query = url::form_urlencoded::Serializer::new(String::new());
+            for (key, value) in params {
+                query.append_pair(key, value);
+            }
+            let endpoint = format!("/file/conversion/{}/{}?{}", src_format, output_format, query.finish());
+
+            let size = input.len() as u64;
+            let upload_progress = show_progress.then(|| ctx.io.progress("Uploading", size));
+            let body = crate::http_body::body(input, limit_rate, upload_progress);
+            let req = client
+                .request_raw(http::Method::POST, &endpoint, Some(body))
+                .await?
+                .header(reqwest::header::CONTENT_LENGTH, size);
+            let resp = crate::http_log::send(&ctx.http_log(), req).await?;
+
+            if !resp.status().is_success() {
+                let status = resp.status();
+                return Err(crate::cmd::ExitCodeError {
+                    code: crate::exit_code::for_status(status),
+                    message: format!(
+                        "{} {}: {}",
+                        status,
+                        status.canonical_reason().unwrap_or(""),
+                        resp.text().await.unwrap_or_default()
+                    ),
+                }
+                .into());
+            }
+
+            crate::http_body::read_json_at_rate::<kittycad::types::FileConversion>(
+                resp,
+                ctx.max_body_size()?,
+                limit_rate,
+                show_progress.then(|| ctx.io.progress("Downloading", 0)),
+            )
+            .await
+        }
+    }
+}
+
+impl CmdFileConvert {
+    /// Convert every file matching the input pattern, carrying on past failures.
+    async fn run_pattern(&self, ctx: &mut crate::context::Context<'_>, pattern: &std::path::Path) -> Result<()> {
+        if self.output.is_some() {
+            anyhow::bail!("an output path can't be used with an input pattern, use `--output-dir` instead");
+        }
+        if self.output_dir.is_none() && self.output_template.is_none() {
+            anyhow::bail!("the `--output-dir` flag is required when the input is a pattern");
+        }
+
+        let ignored = crate::ignore_files::Ignored::load(&std::env::current_dir()?)?;
+        let inputs = expand_pattern(&pattern.display().to_string(), &self.exclude, &ignored)?;
+        if inputs.is_empty() {
+            anyhow::bail!("no files match `{}`", pattern.display());
+        }
+
+        let template = self.output_template.as_deref().unwrap_or(DEFAULT_OUTPUT_TEMPLATE);
+        let output_dirs = pattern_output_dirs(
+            pattern,
+            &inputs,
+            &self.output_dir.clone().unwrap_or_default(),
+            template,
+            self.output_format.as_ref(),
+        )?;
+
+        let manifest_path = self.resume.as_ref().or(self.manifest.as_ref());
+        let mut manifest = match &self.resume {
+            Some(path) => crate::batch_manifest::Manifest::load(path)?,
+            None => crate::batch_manifest::Manifest::default(),
+        };
+        manifest.command = self.command_line();
+
+        let cs = ctx.io.color_scheme();
+        let mut failed = 0;
+        let mut skipped = 0;
+        for (input, output_dir) in inputs.iter().zip(output_dirs) {
+            if manifest.is_completed(input) {
+                skipped += 1;
+                continue;
+            }
+
+            let cmd = CmdFileConvert {
+                input: Some(input.clone()),
+                output_dir: Some(output_dir),
+                exclude: vec![],
+                manifest: None,
+                resume: None,
+                ..self.clone()
+            };
+            match cmd.run(ctx).await {
+                Ok(()) => manifest.complete(input),
+                Err(err) => {
+                    failed += 1;
+                    writeln!(ctx.io.err_out, "{} {}: {}", cs.failure_icon(), input.display(), err)?;
+                    manifest.fail(input, &err.to_string());
+                }
+            }
+
+            // Save after every file, so a batch that is stopped loses at most one.
+            if let Some(path) = manifest_path {
+                manifest.save(path)?;
+            }
+        }
+
+        if let Some(resume) = &self.resume {
+            if skipped > 0 {
+                writeln!(
+                    ctx.io.err_out,
+                    "Skipped {} files converted before according to {}",
+                    skipped,
+                    resume.display()
+                )?;
+            }
+        }
+
+        if failed > 0 {
+            match manifest_path {
+                Some(path) => anyhow::bail!(
+                    "{} of {} conversions failed, run again with `--resume {}` to retry them",
+                    failed,
+                    inputs.len() - skipped,
+                    path.display()
+                ),
+                None => anyhow::bail!("{} of {} conversions failed", failed, inputs.len() - skipped),
+            }
+        }
+
+        Ok(())
+    }
+
+    /// Returns true if the output goes to stdout rather than a file, with `-` as the
+    /// output path, or when reading from stdin with nothing but an output format, e.g.
+    /// `kittycad file convert - --output-format obj`.
+    fn to_stdout(&self) -> bool {
+        match &self.output {
+            Some(output) => crate::output_file::is_stdout(output),
+            None => {
+                self.input.as_deref().and_then(|input| input.to_str()) == Some("-")
+                    && self.output_dir.is_none()
+                    && self.output_template.is_none()
+                    && self.output_format.is_some()
+            }
+        }
+    }
+
+    /// Returns where to save the output, either the output path or a file in the output
+    /// directory named with the output template.
+    fn output_path(
+        &self,
+        input: &std::path::Path,
+        output_format: &kittycad::types::FileOutputFormat,
+    ) -> Result<std::path::PathBuf> {
+        if let Some(output) = &self.output {
+            return Ok(output.clone());
+        }
+        if self.to_stdout() {
+            return Ok(std::path::PathBuf::from(crate::output_file::STDOUT));
+        }
+
+        let template = self.output_template.as_deref().unwrap_or(DEFAULT_OUTPUT_TEMPLATE);
+        let name = render_output_template(template, input, Some(output_format))?;
+
+        Ok(self.output_dir.clone().unwrap_or_default().join(name))
+    }
+
+    /// Walk the user through picking an input file, output format and output location,
+    /// then return the equivalent non-interactive command. Only what wasn't given on the
+    /// command line is asked for.
+    fn prompt(&self, ctx: &mut crate::context::Context) -> Result<CmdFileConvert> {
+        let input = match &self.input {
+            Some(input) => input.clone(),
+            None => {
+                let files = list_cad_files(&std::env::current_dir()?)?;
+                if files.is_empty() {
+                    anyhow::bail!(
+                        "no CAD files found in the current directory, pass the input and output paths instead"
+                    );
+                }
+
+                let items: Vec<String> = files.iter().map(|f| f.display().to_string()).collect();
+                files[crate::picker::pick("Which file do you want to convert?", &items)?].clone()
+            }
+        };
+
+        if self.output.is_some() || self.output_dir.is_some() || self.output_template.is_some() {
+            return self.prompted(ctx, input, self.output.clone());
+        }
+
+        let output_format = match &self.output_format {
+            Some(output_format) => output_format.clone(),
+            None => {
+                let formats = kittycad::types::FileOutputFormat::value_variants();
+                match dialoguer::Select::with_theme(&dialoguer::theme::ColorfulTheme::default())
+                    .with_prompt("What format do you want to convert it to?")
+                    .items(formats)
+                    .default(0)
+                    .interact()
+                {
+                    Ok(index) => formats[index].clone(),
+                    Err(err) => {
+                        return Err(anyhow::anyhow!("prompt failed: {}", err));
+                    }
+                }
+            }
+        };
+
+        let output = match dialoguer::Input::<String>::new()
+            .with_prompt("Where do you want to save the output?")
+            .with_initial_text(input.with_extension(output_format.to_string()).display().to_string())
+            .interact_text()
+        {
+            Ok(output) => std::path::PathBuf::from(output.trim()),
+            Err(err) => {
+                return Err(anyhow::anyhow!("prompt failed: {}", err));
+            }
+        };
+
+        self.prompted(ctx, input, Some(output))
+    }
+
+    /// Returns the command with the input and output the user was prompted for, and
+    /// shows how to run it without the prompts.
+    fn prompted(
+        &self,
+        ctx: &mut crate::context::Context,
+        input: std::path::PathBuf,
+        output: Option<std::path::PathBuf>,
+    ) -> Result<CmdFileConvert> {
+        let cmd = CmdFileConvert {
+            input: Some(input),
+            output,
+            interactive: false,
+            ..self.clone()
+        };
+
+        writeln!(
+            ctx.io.err_out,
+            "Next time you can run this without the prompts:\n  {}",
+            cmd.command_line()
+        )?;
+
+        Ok(cmd)
+    }
+
+    /// Returns the parameters to send with the conversion, the units, the output
+    /// options and the ones passed with `--param`.
+    fn params(&self, output_format: &kittycad::types::FileOutputFormat) -> Result<Vec<(String, String)>> {
+        let mut params = Vec::new();
+        if let Some(src_unit) = &self.src_unit {
+            params.push(("src_unit".to_string(), src_unit.to_string()));
+        }
+        if let Some(output_unit) = &self.output_unit {
+            params.push(("output_unit".to_string(), output_unit.to_string()));
+        }
+        params.extend(parse_output_options(&self.option, output_format)?);
+        params.extend(parse_params(&self.param)?);
+
+        Ok(params)
+    }
+
+    /// Returns the command line that runs this conversion.
+    fn command_line(&self) -> String {
+        let mut args = vec!["kittycad".to_string(), "file".to_string(), "convert".to_string()];
+        for path in [&self.input, &self.output].into_iter().flatten() {
+            args.push(shlex::quote(&path.display().to_string()).to_string());
+        }
+        if let Some(src_format) = &self.src_format {
+            args.push(format!("--src-format={}", src_format));
+        }
+        if let Some(output_format) = &self.output_format {
+            args.push(format!("--output-format={}", output_format));
+        }
+        if let Some(src_unit) = &self.src_unit {
+            args.push(format!("--src-unit={}", src_unit));
+        }
+        if let Some(output_unit) = &self.output_unit {
+            args.push(format!("--output-unit={}", output_unit));
+        }
+        for option in &self.option {
+            args.push(format!("--option={}", option));
+        }
+        for param in &self.param {
+            args.push(format!("--param={}", shlex::quote(param)));
+        }
+        if let Some(output_dir) = &self.output_dir {
+            args.push(format!(
+                "--output-dir={}",
+                shlex::quote(&output_dir.display().to_string())
+            ));
+        }
+        if let Some(output_template) = &self.output_template {
+            args.push(format!("--output-template={}", shlex::quote(output_template)));
+        }
+        if self.gzip_output {
+            args.push("--gzip-output".to_string());
+        }
+        for exclude in &self.exclude {
+            args.push(format!("--exclude={}", shlex::quote(exclude)));
+        }
+        if let Some(manifest) = &self.manifest {
+            args.push(format!("--manifest={}", shlex::quote(&manifest.display().to_string())));
+        }
+        if let Some(resume) = &self.resume {
+            args.push(format!("--resume={}", shlex::quote(&resume.display().to_string())));
+        }
+        if self.sign {
+            args.push("--sign".to_string());
+        }
+        if self.keep_input_on_failure {
+            args.push("--keep-input-on-failure".to_string());
+        }
+        if self.no_wait {
+            args.push("--no-wait".to_string());
+        }
+
+        args.join(" ")
+    }
+}
+
+/// The name of the output file when only `--output-dir` is given.
+const DEFAULT_OUTPUT_TEMPLATE: &str = "{name}.{ext}";
+
+/// Fill in the placeholders of an `--output-template`. Without an output format, the
+/// template can't use `{format}` or `{ext}`.
+fn render_output_template(
+    template: &str,
+    input: &std::path::Path,
+    output_format: Option<&kittycad::types::FileOutputFormat>,
+) -> Result<String> {
+    let name = if input.to_str() == Some("-") {
+        "stdin".to_string()
+    } else {
+        input.file_stem().unwrap_or_default().to_string_lossy().to_string()
+    };
+    let format = output_format.map(|f| f.to_string());
+    let ext = format.as_deref().map(|format| match format {
+        // Binary FBX files have the same extension as text ones.
+        "fbxb" => "fbx".to_string(),
+        _ => format.to_string(),
+    });
+
+    let mut unknown = None;
+    let mut needs_format = None;
+    let re = regex::Regex::new(r"\{([^{}]*)\}")?;
+    let rendered = re.replace_all(template, |caps: &regex::Captures| {
+        let value = match &caps[1] {
+            "name" => Some(name.clone()),
+            "format" => format.clone(),
+            "ext" => ext.clone(),
+            other => {
+                unknown.get_or_insert_with(|| other.to_string());
+                return String::new();
+            }
+        };
+        value.unwrap_or_else(|| {
+            needs_format.get_or_insert_with(|| caps[1].to_string());
+            String::new()
+        })
+    });
+
+    if let Some(placeholder) = unknown {
+        anyhow::bail!(
+            "unknown placeholder `{{{}}}` in output template, expected `{{name}}`, `{{format}}` or `{{ext}}`",
+            placeholder
+        );
+    }
+    if let Some(placeholder) = needs_format {
+        anyhow::bail!(
+            "the `--output-format` flag is required for `{{{}}}` in the output template",
+            placeholder
+        );
+    }
+    if rendered.is_empty() {
+        anyhow::bail!("the output template `{}` gives an empty file name", template);
+    }
+
+    Ok(rendered.to_string())
+}
+
+/// Returns true if the input is a pattern rather than a path, a file with a name that
+/// looks like a pattern is still a path.
+fn is_pattern(input: &std::path::Path) -> bool {
+    input
+        .display()
+        .to_string()
+        .contains(|c| c == '*' || c == '?' || c == '[')
+        && !input.exists()
+}
+
+/// Returns the files matching a pattern like `parts/**/*.step`, leaving out the ones that
+/// match any of the exclude patterns or are ignored, sorted by path.
+///
+/// We expand the pattern ourselves so it works the same in every shell, including
+/// Windows ones that don't expand patterns at all.
+fn expand_pattern(
+    pattern: &str,
+    exclude: &[String],
+    ignored: &crate::ignore_files::Ignored,
+) -> Result<Vec<std::path::PathBuf>> {
+    let exclude = exclude
+        .iter()
+        .map(|e| crate::glob::Pattern::new(e))
+        .collect::<Result<Vec<_>>>()?;
+
+    let mut files = Vec::new();
+    for path in crate::glob::glob(pattern)? {
+        if path.is_file() && !exclude.iter().any(|e| e.matches_path(&path)) && !ignored.is_ignored(&path) {
+            files.push(path);
+        }
+    }
+
+    Ok(files)
+}
+
+/// Returns the output directory of each file matching a pattern, keeping the directories
+/// under the start of the pattern so files with the same name in different directories
+/// don't overwrite each other. It is an error if two files would still have the same output.
+fn pattern_output_dirs(
+    pattern: &std::path::Path,
+    inputs: &[std::path::PathBuf],
+    output_dir: &std::path::Path,
+    template: &str,
+    output_format: Option<&kittycad::types::FileOutputFormat>,
+) -> Result<Vec<std::path::PathBuf>> {
+    let base = crate::glob::Pattern::new(&pattern.display().to_string())?.base();
+
+    let mut dirs = Vec::new();
+    let mut outputs: std::collections::HashMap<std::path::PathBuf, &std::path::Path> = Default::default();
+    for input in inputs {
+        let relative = input
+            .parent()
+            .and_then(|parent| parent.strip_prefix(&base).ok())
+            .unwrap_or_else(|| std::path::Path::new(""));
+        let dir = output_dir.join(relative);
+
+        // Without an output format yet, every file gets the same extension from the
+        // template, so the name is enough to tell them apart.
+        let name = render_output_template(template, input, output_format)
+            .unwrap_or_else(|_| input.file_stem().unwrap_or_default().to_string_lossy().to_string());
+        if let Some(other) = outputs.insert(dir.join(name), input) {
+            anyhow::bail!(
+                "`{}` and `{}` would both be converted to the same output file, use `--output-template` to name them apart",
+                other.display(),
+                input.display()
+            );
+        }
+
+        dirs.push(dir);
+    }
+
+    Ok(dirs)
+}
+
+/// Returns the files in the directory with an extension we can convert from, sorted by name.
+/// Files its ignore files list are left out.
+fn list_cad_files(dir: &std::path::Path) -> Result<Vec<std::path::PathBuf>> {
+    let ignored = crate::ignore_files::Ignored::load(dir)?;
+
+    let mut files = Vec::new();
+    for entry in std::fs::read_dir(dir)? {
+        let path = entry?.path();
+        if path.is_file()
+            && get_source_format_from_extension(&get_extension(path.clone())).is_ok()
+            && !ignored.is_ignored(&path)
+        {
+            files.push(path.strip_prefix(dir).unwrap_or(&path).to_path_buf());
+        }
+    }
+    files.sort();
+
+    Ok(files)
+}
+
 /// Get the volume of an object in a CAD file.
 ///
 /// If the input file is larger than a certain size it will be
@@ -133,8 +957,11 @@ impl crate::cmd::Command for CmdFileConvert {
 ///     # get the volume of a file
 ///     $ kittycad file volume my-file.step
 ///
-///     # pass a file from stdin, the original file type is required
-///     $ cat my-obj.obj | kittycad file volume - --src-format=obj
+///     # pass a file from stdin, its type is told from its contents
+///     $ cat my-obj.obj | kittycad file volume -
+///
+///     # print the result as JSON
+///     $ kittycad file volume my-file.step --format=json
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdFileVolume {
@@ -143,8 +970,9 @@ pub struct CmdFileVolume {
     #[clap(name = "input", parse(from_os_str), required = true)]
     pub input: std::path::PathBuf,
 
-    /// A valid source file format.
-    #[clap(short = 's', long = "src-format", arg_enum)]
+    /// A valid source file format, told from the extension or contents of the file if
+    /// not given.
+    #[clap(short = 's', long = "src-format", alias = "from", arg_enum)]
     src_format: Option<kittycad::types::FileSourceFormat>,
 
     /// Output format.
@@ -155,20 +983,28 @@ pub struct CmdFileVolume {
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdFileVolume {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
-        // Parse the source format.
-        let src_format = if let Some(src_format) = &self.src_format {
-            src_format.clone()
-        } else {
-            get_source_format_from_extension(&get_extension(self.input.clone()))?
-        };
-
         // Get the contents of the input file.
-        let input = ctx.read_file(self.input.to_str().unwrap_or(""))?;
+        let (src_format, input) = read_input(ctx, &self.input, &self.src_format)?;
+        let input_size = input.len();
 
         // Do the operation.
         let client = ctx.api_client("")?;
+        let retry_policy = ctx.retry_policy()?;
 
-        let file_volume = client.file().create_volume(src_format, &input.into()).await?;
+        let client = &client;
+        let src_format = &src_format;
+        let body = &bytes::Bytes::from(input);
+        let file_volume = crate::retry::call_once(&retry_policy, &ctx.http_log(), "POST /file/volume", || async move {
+            client.file().create_volume(src_format.clone(), body).await
+        })
+        .await?;
+        crate::history::remember(
+            &file_volume.id.to_string(),
+            "file volume",
+            &self.input,
+            input_size,
+            &file_volume.status.to_string(),
+        );
 
         // Print the output of the conversion.
         let format = ctx.format(&self.format)?;
@@ -187,8 +1023,11 @@ impl crate::cmd::Command for CmdFileVolume {
 ///     # get the mass of a file
 ///     $ kittycad file mass my-file.step
 ///
-///     # pass a file from stdin, the original file type is required
-///     $ cat my-obj.obj | kittycad file mass - --src-format=obj
+///     # pass a file from stdin, its type is told from its contents
+///     $ cat my-obj.obj | kittycad file mass -
+///
+///     # print the result as JSON
+///     $ kittycad file mass my-file.step --format=json
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdFileMass {
@@ -197,8 +1036,9 @@ pub struct CmdFileMass {
     #[clap(name = "input", parse(from_os_str), required = true)]
     pub input: std::path::PathBuf,
 
-    /// A valid source file format.
-    #[clap(short = 's', long = "src-format", arg_enum)]
+    /// A valid source file format, told from the extension or contents of the file if
+    /// not given.
+    #[clap(short = 's', long = "src-format", alias = "from", arg_enum)]
     src_format: Option<kittycad::types::FileSourceFormat>,
 
     /// Material density.
@@ -217,23 +1057,31 @@ impl crate::cmd::Command for CmdFileMass {
             anyhow::bail!("`--material-density` must not be 0.0");
         }
 
-        // Parse the source format.
-        let src_format = if let Some(src_format) = &self.src_format {
-            src_format.clone()
-        } else {
-            get_source_format_from_extension(&get_extension(self.input.clone()))?
-        };
-
         // Get the contents of the input file.
-        let input = ctx.read_file(self.input.to_str().unwrap_or(""))?;
+        let (src_format, input) = read_input(ctx, &self.input, &self.src_format)?;
+        let input_size = input.len();
 
         // Do the operation.
         let client = ctx.api_client("")?;
+        let retry_policy = ctx.retry_policy()?;
 
-        let file_mass = client
-            .file()
-            .create_mass(self.material_density.into(), src_format, &input.into())
-            .await?;
+        let client = &client;
+        let src_format = &src_format;
+        let body = &bytes::Bytes::from(input);
+        let file_mass = crate::retry::call_once(&retry_policy, &ctx.http_log(), "POST /file/mass", || async move {
+            client
+                .file()
+                .create_mass(self.material_density.into(), src_format.clone(), body)
+                .await
+        })
+        .await?;
+        crate::history::remember(
+            &file_mass.id.to_string(),
+            "file mass",
+            &self.input,
+            input_size,
+            &file_mass.status.to_string(),
+        );
 
         // Print the output of the conversion.
         let format = ctx.format(&self.format)?;
@@ -252,8 +1100,11 @@ impl crate::cmd::Command for CmdFileMass {
 ///     # get the density of a file
 ///     $ kittycad file density my-file.step
 ///
-///     # pass a file from stdin, the original file type is required
-///     $ cat my-obj.obj | kittycad file density - --src-format=obj
+///     # pass a file from stdin, its type is told from its contents
+///     $ cat my-obj.obj | kittycad file density -
+///
+///     # print the result as JSON
+///     $ kittycad file density my-file.step --format=json
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdFileDensity {
@@ -262,8 +1113,9 @@ pub struct CmdFileDensity {
     #[clap(name = "input", parse(from_os_str), required = true)]
     pub input: std::path::PathBuf,
 
-    /// A valid source file format.
-    #[clap(short = 's', long = "src-format")]
+    /// A valid source file format, told from the extension or contents of the file if
+    /// not given.
+    #[clap(short = 's', long = "src-format", alias = "from", arg_enum)]
     src_format: Option<kittycad::types::FileSourceFormat>,
 
     /// Material mass.
@@ -282,23 +1134,32 @@ impl crate::cmd::Command for CmdFileDensity {
             anyhow::bail!("`--material-mass` must not be 0.0");
         }
 
-        // Parse the source format.
-        let src_format = if let Some(src_format) = &self.src_format {
-            src_format.clone()
-        } else {
-            get_source_format_from_extension(&get_extension(self.input.clone()))?
-        };
-
         // Get the contents of the input file.
-        let input = ctx.read_file(self.input.to_str().unwrap_or(""))?;
+        let (src_format, input) = read_input(ctx, &self.input, &self.src_format)?;
+        let input_size = input.len();
 
         // Do the operation.
         let client = ctx.api_client("")?;
+        let retry_policy = ctx.retry_policy()?;
 
-        let file_density = client
-            .file()
-            .create_density(self.material_mass.into(), src_format, &input.into())
+        let client = &client;
+        let src_format = &src_format;
+        let body = &bytes::Bytes::from(input);
+        let file_density =
+            crate::retry::call_once(&retry_policy, &ctx.http_log(), "POST /file/density", || async move {
+                client
+                    .file()
+                    .create_density(self.material_mass.into(), src_format.clone(), body)
+                    .await
+            })
             .await?;
+        crate::history::remember(
+            &file_density.id.to_string(),
+            "file density",
+            &self.input,
+            input_size,
+            &file_density.status.to_string(),
+        );
 
         // Print the output of the conversion.
         let format = ctx.format(&self.format)?;
@@ -308,6 +1169,398 @@ impl crate::cmd::Command for CmdFileDensity {
     }
 }
 
+/// Check that the API can read a CAD file, e.g. in CI before converting it.
+///
+/// The file is uploaded and the API works out its volume, which means reading all of
+/// its geometry. The command exits with 2 if the file isn't valid, including when the
+/// API rejects it outright, and one of the codes listed by `kittycad help exit-codes`
+/// for any other error. A file the API queues is waited for, for up to 30 minutes
+/// unless there is a `--timeout`.
+///
+///     # check a file before committing it
+///     $ kittycad file validate my-file.step
+///
+///     # pass a file from stdin, its type is told from its contents
+///     $ cat my-obj.obj | kittycad file validate -
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdFileValidate {
+    /// The path to the input file.
+    /// If you pass `-` as the path, the file will be read from stdin.
+    #[clap(name = "input", parse(from_os_str), required = true)]
+    pub input: std::path::PathBuf,
+
+    /// A valid source file format, told from the extension or contents of the file if
+    /// not given.
+    #[clap(short = 's', long = "src-format", alias = "from", arg_enum)]
+    src_format: Option<kittycad::types::FileSourceFormat>,
+
+    /// Output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdFileValidate {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        // Get the contents of the input file.
+        let (src_format, input) = read_input(ctx, &self.input, &self.src_format)?;
+        let input_size = input.len();
+
+        let client = ctx.api_client("")?;
+        let retry_policy = ctx.retry_policy()?;
+
+        let client = &client;
+        let body = &bytes::Bytes::from(input);
+        let created = crate::retry::call_once(&retry_policy, &ctx.http_log(), "POST /file/volume", || {
+            let src_format = src_format.clone();
+            async move { client.file().create_volume(src_format, body).await }
+        })
+        .await;
+        let mut file_volume = match created {
+            Ok(file_volume) => file_volume,
+            // The API rejects some files it can't read as soon as they are uploaded.
+            Err(err) if is_rejected_upload(&err) => {
+                let validation = FileValidation {
+                    input: self.input.display().to_string(),
+                    src_format: src_format.to_string(),
+                    valid: false,
+                    volume: None,
+                    error: err.to_string(),
+                    api_call_id: String::new(),
+                };
+                return write_validation(ctx, &self.format, &validation);
+            }
+            Err(err) => return Err(err),
+        };
+        crate::history::remember(
+            &file_volume.id.to_string(),
+            "file validate",
+            &self.input,
+            input_size,
+            &file_volume.status.to_string(),
+        );
+
+        // The API queues big files, wait for those.
+        if !crate::cmd_api_call::is_finished(&file_volume.status) {
+            match crate::cmd_api_call::wait_for(ctx, &file_volume.id.to_string().parse()?, WAIT_INTERVAL).await? {
+                kittycad::types::AsyncApiCallOutput::FileVolume(v) => file_volume = v,
+                _ => anyhow::bail!("API call {} is not a file volume", file_volume.id),
+            }
+        }
+
+        let validation = FileValidation {
+            input: self.input.display().to_string(),
+            src_format: src_format.to_string(),
+            valid: file_volume.status == kittycad::types::ApiCallStatus::Completed,
+            volume: file_volume.volume,
+            error: file_volume.error.clone().unwrap_or_default(),
+            api_call_id: file_volume.id.to_string(),
+        };
+
+        write_validation(ctx, &self.format, &validation)
+    }
+}
+
+/// Returns true if the API refused an uploaded file as a bad request, rather than for
+/// who we are or how often we ask.
+fn is_rejected_upload(err: &anyhow::Error) -> bool {
+    match err
+        .downcast_ref::<kittycad::types::error::Error>()
+        .and_then(|err| err.status())
+    {
+        Some(status) => {
+            status.is_client_error()
+                && !matches!(
+                    status,
+                    http::StatusCode::UNAUTHORIZED | http::StatusCode::FORBIDDEN | http::StatusCode::TOO_MANY_REQUESTS
+                )
+        }
+        None => false,
+    }
+}
+
+/// Print the result of `kittycad file validate`, failing with `exit_code::FAILED` if the
+/// file isn't valid.
+fn write_validation(
+    ctx: &mut crate::context::Context,
+    format: &Option<crate::types::FormatOutput>,
+    validation: &FileValidation,
+) -> Result<()> {
+    let format = ctx.format(format)?;
+    ctx.io.write_output(&format, validation)?;
+
+    if !validation.valid {
+        return Err(crate::cmd::ExitCodeError {
+            code: crate::exit_code::FAILED,
+            message: format!(
+                "{} is not a valid {} file: {}",
+                validation.input, validation.src_format, validation.error
+            ),
+        }
+        .into());
+    }
+
+    Ok(())
+}
+
+/// The output of `kittycad file validate`.
+#[derive(Debug, Clone, PartialEq, serde::Serialize, tabled::Tabled)]
+struct FileValidation {
+    input: String,
+    src_format: String,
+    /// Whether the API could read all of the geometry.
+    valid: bool,
+    #[tabled(display_with = "display_volume")]
+    volume: Option<f64>,
+    error: String,
+    api_call_id: String,
+}
+
+fn display_volume(volume: &Option<f64>) -> String {
+    volume.map(|volume| volume.to_string()).unwrap_or_default()
+}
+
+/// Show what a CAD file is, without sending it to the API.
+///
+/// The format is told from the contents of the file, not its extension. The units and
+/// counts are read from the file when the format has them: solids for STEP, triangles
+/// for STL, vertices and faces for OBJ and PLY. The units are only a hint, they are
+/// what the file says, not what the geometry was modelled in.
+///
+/// Knows STEP, STL, OBJ, COLLADA, FBX, DXF, DWG, PLY and glTF files. For DWG, FBX and
+/// binary glTF only the format and size are shown.
+///
+///     $ kittycad file info my-file.step
+///
+///     # pass a file from stdin
+///     $ cat my-file.stl | kittycad file info - --format json
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdFileInfo {
+    /// The path to the input file.
+    /// If you pass `-` as the path, the file will be read from stdin.
+    #[clap(name = "input", parse(from_os_str), required = true)]
+    pub input: std::path::PathBuf,
+
+    /// Output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdFileInfo {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let input = ctx.read_file(self.input.to_str().unwrap_or(""))?;
+        let info = crate::file_info::inspect(&self.input.display().to_string(), &input)?;
+
+        let format = ctx.format(&self.format)?;
+        ctx.io.write_output(&format, &info)?;
+
+        Ok(())
+    }
+}
+
+/// Sign files with your signing key.
+///
+/// The signature of a file is saved next to it with a `.sig` extension. Anyone with
+/// your public key can then check the file is exactly what you signed with
+/// `kittycad file verify`.
+///
+/// Your signing key is created the first time you sign something and kept in the
+/// configuration directory, its public key is printed every time you sign.
+///
+///     # sign a file, this saves the signature to my-file.stl.sig
+///     $ kittycad file sign my-file.stl
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdFileSign {
+    /// The paths of the files to sign.
+    #[clap(name = "path", parse(from_os_str), required = true)]
+    pub paths: Vec<std::path::PathBuf>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdFileSign {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        for path in &self.paths {
+            sign_file(ctx, path)?;
+        }
+
+        Ok(())
+    }
+}
+
+/// Verify the signatures of files.
+///
+/// This checks the signature saved next to each file by `kittycad file sign`, or
+/// `kittycad file convert --sign`, matches the file.
+///
+///     # verify a file you signed
+///     $ kittycad file verify my-file.stl
+///
+///     # verify a file someone else signed
+///     $ kittycad file verify my-file.stl --public-key <their public key>
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdFileVerify {
+    /// The paths of the files to verify.
+    #[clap(name = "path", parse(from_os_str), required = true)]
+    pub paths: Vec<std::path::PathBuf>,
+
+    /// The public key the files were signed with, your own by default.
+    #[clap(long)]
+    pub public_key: Option<String>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdFileVerify {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let public_key = match &self.public_key {
+            Some(public_key) => public_key.to_string(),
+            None => {
+                let key_file = crate::config_file::signing_key_file()?;
+                if !std::path::Path::new(&key_file).exists() {
+                    anyhow::bail!(
+                        "you don't have a signing key yet, pass the public key the files were signed with in `--public-key`"
+                    );
+                }
+                let (key, _) = crate::signing::load_or_create_key(&key_file)?;
+                crate::signing::public_key(&key)
+            }
+        };
+
+        let cs = ctx.io.color_scheme();
+        let mut failed = 0;
+        for path in &self.paths {
+            let sig_path = crate::signing::signature_path(path);
+            let result = std::fs::read(path)
+                .with_context(|| format!("failed to read file {}", path.display()))
+                .and_then(|data| {
+                    let signature = std::fs::read_to_string(&sig_path)
+                        .with_context(|| format!("failed to read signature {}", sig_path.display()))?;
+                    crate::signing::verify(&public_key, &data, &signature)
+                });
+
+            match result {
+                Ok(()) => writeln!(ctx.io.out, "{} {} is signed", cs.success_icon(), path.display())?,
+                Err(err) => {
+                    failed += 1;
+                    writeln!(ctx.io.err_out, "{} {}: {}", cs.failure_icon(), path.display(), err)?;
+                }
+            }
+        }
+
+        if failed > 0 {
+            anyhow::bail!(
+                "{} of {} file{} failed verification",
+                failed,
+                self.paths.len(),
+                if self.paths.len() == 1 { "" } else { "s" }
+            );
+        }
+
+        Ok(())
+    }
+}
+
+/// Sign a file with the user's signing key and save the signature next to it.
+fn sign_file(ctx: &mut crate::context::Context, path: &std::path::Path) -> Result<()> {
+    let (key, created) = crate::signing::load_or_create_key(&crate::config_file::signing_key_file()?)?;
+    if created {
+        writeln!(
+            ctx.io.err_out,
+            "Created a signing key, its public key is {}",
+            crate::signing::public_key(&key)
+        )?;
+    }
+
+    let data = std::fs::read(path).with_context(|| format!("failed to read file {}", path.display()))?;
+    let sig_path = crate::signing::signature_path(path);
+    std::fs::write(&sig_path, crate::signing::sign(&key, &data))
+        .with_context(|| format!("failed to write file {}", sig_path.display()))?;
+
+    let cs = ctx.io.color_scheme();
+    writeln!(
+        ctx.io.err_out,
+        "{} Signed {} with key {}",
+        cs.success_icon(),
+        path.display(),
+        crate::signing::public_key(&key)
+    )?;
+
+    Ok(())
+}
+
+/// The options of the output formats the API knows, as `<format>.<key>=<value>`.
+/// They are the possible values of `--option`, so the shell can complete them.
+const OUTPUT_OPTIONS: &[&str] = &[
+    "obj.coords=y-up",
+    "obj.coords=z-up",
+    "step.schema=ap203",
+    "step.schema=ap214",
+    "step.schema=ap242",
+    "stl.coords=y-up",
+    "stl.coords=z-up",
+    "stl.storage=ascii",
+    "stl.storage=binary",
+];
+
+/// Parse the `--option` flags into the parameters to send with the conversion, the
+/// key without its format. Each option must be for the output format, and set once.
+fn parse_output_options(
+    options: &[String],
+    output_format: &kittycad::types::FileOutputFormat,
+) -> Result<Vec<(String, String)>> {
+    let mut parsed: Vec<(String, String)> = Vec::new();
+
+    for option in options {
+        if !OUTPUT_OPTIONS.contains(&option.as_str()) {
+            anyhow::bail!(
+                "invalid --option `{}`, expected one of: {}",
+                option,
+                OUTPUT_OPTIONS.join(", ")
+            );
+        }
+
+        let (key, value) = option.split_once('=').unwrap_or_default();
+        let (format, key) = key.split_once('.').unwrap_or_default();
+        if format != output_format.to_string() {
+            anyhow::bail!(
+                "--option `{}` is for {} output, but the output format is {}",
+                option,
+                format,
+                output_format
+            );
+        }
+        if parsed.iter().any(|(k, _)| k == key) {
+            anyhow::bail!("--option `{}.{}` is set more than once", format, key);
+        }
+
+        parsed.push((key.to_string(), value.to_string()));
+    }
+
+    Ok(parsed)
+}
+
+/// Parse parameters given in key=value format.
+fn parse_params(params: &[String]) -> Result<Vec<(String, String)>> {
+    let mut parsed = Vec::new();
+
+    for p in params {
+        let mut parts = p.splitn(2, '=');
+        let key = parts.next().unwrap_or_default();
+        let value = match parts.next() {
+            Some(value) if !key.is_empty() => value,
+            _ => anyhow::bail!("invalid --param `{}`, expected key=value", p),
+        };
+
+        parsed.push((key.to_string(), value.to_string()));
+    }
+
+    Ok(parsed)
+}
+
 /// Get the extension for a path buffer.
 fn get_extension(path: std::path::PathBuf) -> String {
     path.into_boxed_path()
@@ -318,6 +1571,44 @@ fn get_extension(path: std::path::PathBuf) -> String {
         .to_string()
 }
 
+/// Read the input file and get its source format: from the `--src-format` flag, the
+/// extension, or failing those, the contents of the file.
+fn read_input(
+    ctx: &mut crate::context::Context,
+    input: &std::path::Path,
+    src_format: &Option<kittycad::types::FileSourceFormat>,
+) -> Result<(kittycad::types::FileSourceFormat, Vec<u8>)> {
+    let is_stdin = input.to_str() == Some("-");
+    let from_flag_or_ext = match src_format {
+        Some(src_format) => Ok(src_format.clone()),
+        None if is_stdin => Err(anyhow::anyhow!(
+            "can't tell the format of the file from stdin, set it with the `--src-format` flag"
+        )),
+        None => get_source_format_from_extension(&get_extension(input.to_path_buf())),
+    };
+
+    // A bad extension on a file that doesn't exist is reported as the bad extension.
+    let data = match ctx.read_file(input.to_str().unwrap_or("")) {
+        Ok(data) => data,
+        Err(err) => return Err(from_flag_or_ext.err().unwrap_or(err)),
+    };
+
+    match from_flag_or_ext {
+        Ok(src_format) => Ok((src_format, data)),
+        Err(err) => match crate::file_info::source_format(&data) {
+            Some(src_format) => Ok((src_format, data)),
+            None => match crate::file_info::sniff(&data) {
+                Some(format) => anyhow::bail!(
+                    "{} looks like a {} file, which the API can't read",
+                    input.display(),
+                    format
+                ),
+                None => Err(err),
+            },
+        },
+    }
+}
+
 /// Get the source format from the extension.
 fn get_source_format_from_extension(ext: &str) -> Result<kittycad::types::FileSourceFormat> {
     match kittycad::types::FileSourceFormat::from_str(ext) {
@@ -358,6 +1649,301 @@ mod test {
 
     use crate::cmd::Command;
 
+    #[test]
+    fn test_list_cad_files() {
+        let dir = tempfile::tempdir().unwrap();
+        for name in ["b.obj", "a.step", "notes.txt", "c.stp", "e.tmp.obj"] {
+            std::fs::write(dir.path().join(name), "").unwrap();
+        }
+        std::fs::write(dir.path().join(".kittycadignore"), "*.tmp.obj\n").unwrap();
+        std::fs::create_dir(dir.path().join("d.obj")).unwrap();
+
+        assert_eq!(
+            crate::cmd_file::list_cad_files(dir.path()).unwrap(),
+            vec![
+                std::path::PathBuf::from("a.step"),
+                std::path::PathBuf::from("b.obj"),
+                std::path::PathBuf::from("c.stp"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_expand_pattern() {
+        let dir = tempfile::tempdir().unwrap();
+        for name in ["a.step", "b/c.step", "b/old/d.step", "b/e.obj"] {
+            let path = dir.path().join(name);
+            std::fs::create_dir_all(path.parent().unwrap()).unwrap();
+            std::fs::write(path, "").unwrap();
+        }
+
+        let ignored = crate::ignore_files::Ignored::load(dir.path()).unwrap();
+        let pattern = format!("{}/**/*.step", dir.path().display());
+        assert_eq!(
+            crate::cmd_file::expand_pattern(&pattern, &[], &ignored).unwrap(),
+            vec![
+                dir.path().join("a.step"),
+                dir.path().join("b/c.step"),
+                dir.path().join("b/old/d.step"),
+            ]
+        );
+        assert_eq!(
+            crate::cmd_file::expand_pattern(&pattern, &["**/old/**".to_string()], &ignored).unwrap(),
+            vec![dir.path().join("a.step"), dir.path().join("b/c.step")]
+        );
+
+        std::fs::write(dir.path().join(".gitignore"), "b/\n").unwrap();
+        let ignored = crate::ignore_files::Ignored::load(dir.path()).unwrap();
+        assert_eq!(
+            crate::cmd_file::expand_pattern(&pattern, &[], &ignored).unwrap(),
+            vec![dir.path().join("a.step")]
+        );
+
+        assert!(crate::cmd_file::is_pattern(std::path::Path::new("parts/*.step")));
+        assert!(!crate::cmd_file::is_pattern(&dir.path().join("a.step")));
+    }
+
+    #[test]
+    fn test_convert_command_line() {
+        let cmd = crate::cmd_file::CmdFileConvert {
+            input: Some(std::path::PathBuf::from("my part.step")),
+            output: Some(std::path::PathBuf::from("out.obj")),
+            output_dir: None,
+            exclude: vec![],
+            manifest: None,
+            resume: None,
+            output_template: None,
+            gzip_output: false,
+            sign: false,
+            keep_input_on_failure: false,
+            no_wait: false,
+            interactive: false,
+            output_format: None,
+            src_format: None,
+            src_unit: None,
+            output_unit: None,
+            option: vec![],
+            param: vec!["a=b".to_string()],
+            format: None,
+        };
+
+        assert_eq!(
+            cmd.command_line(),
+            "kittycad file convert 'my part.step' out.obj --param=a=b"
+        );
+
+        let cmd = crate::cmd_file::CmdFileConvert {
+            src_unit: Some(crate::types::LengthUnit::In),
+            output_unit: Some(crate::types::LengthUnit::Mm),
+            ..cmd
+        };
+        assert_eq!(
+            cmd.command_line(),
+            "kittycad file convert 'my part.step' out.obj --src-unit=in --output-unit=mm --param=a=b"
+        );
+
+        let cmd = crate::cmd_file::CmdFileConvert {
+            input: Some(std::path::PathBuf::from("parts/*.step")),
+            output: None,
+            output_dir: Some(std::path::PathBuf::from("out")),
+            resume: Some(std::path::PathBuf::from("parts.json")),
+            ..cmd
+        };
+        assert_eq!(
+            cmd.command_line(),
+            "kittycad file convert 'parts/*.step' --src-unit=in --output-unit=mm --param=a=b --output-dir=out --resume=parts.json"
+        );
+        assert_eq!(
+            cmd.params(&kittycad::types::FileOutputFormat::Obj).unwrap(),
+            vec![
+                ("src_unit".to_string(), "in".to_string()),
+                ("output_unit".to_string(), "mm".to_string()),
+                ("a".to_string(), "b".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_pattern_output_dirs() {
+        let inputs = vec![
+            std::path::PathBuf::from("parts/gear.step"),
+            std::path::PathBuf::from("parts/left/arm.step"),
+            std::path::PathBuf::from("parts/right/arm.step"),
+        ];
+        let pattern = std::path::Path::new("parts/**/*.step");
+        let obj = kittycad::types::FileOutputFormat::Obj;
+
+        assert_eq!(
+            crate::cmd_file::pattern_output_dirs(
+                pattern,
+                &inputs,
+                std::path::Path::new("out"),
+                "{name}.{ext}",
+                Some(&obj)
+            )
+            .unwrap(),
+            vec![
+                std::path::PathBuf::from("out"),
+                std::path::PathBuf::from("out/left"),
+                std::path::PathBuf::from("out/right"),
+            ]
+        );
+
+        let inputs = vec![
+            std::path::PathBuf::from("parts/arm.step"),
+            std::path::PathBuf::from("parts/arm.stp"),
+        ];
+        assert_eq!(
+            crate::cmd_file::pattern_output_dirs(pattern, &inputs, std::path::Path::new("out"), "{name}.{ext}", None)
+                .unwrap_err()
+                .to_string(),
+            "`parts/arm.step` and `parts/arm.stp` would both be converted to the same output file, use `--output-template` to name them apart"
+        );
+    }
+
+    #[test]
+    fn test_render_output_template() {
+        let input = std::path::Path::new("parts/my-part.step");
+
+        assert_eq!(
+            crate::cmd_file::render_output_template(
+                crate::cmd_file::DEFAULT_OUTPUT_TEMPLATE,
+                input,
+                Some(&kittycad::types::FileOutputFormat::Obj)
+            )
+            .unwrap(),
+            "my-part.obj"
+        );
+        assert_eq!(
+            crate::cmd_file::render_output_template(
+                "{name}-{format}.{ext}",
+                std::path::Path::new("-"),
+                Some(&kittycad::types::FileOutputFormat::Fbxb)
+            )
+            .unwrap(),
+            "stdin-fbxb.fbx"
+        );
+
+        let err = crate::cmd_file::render_output_template(
+            "{nope}.{ext}",
+            input,
+            Some(&kittycad::types::FileOutputFormat::Obj),
+        )
+        .unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "unknown placeholder `{nope}` in output template, expected `{name}`, `{format}` or `{ext}`"
+        );
+
+        assert_eq!(
+            crate::cmd_file::render_output_template("{name}", std::path::Path::new("parts/gear.stl.step"), None)
+                .unwrap(),
+            "gear.stl"
+        );
+        let err =
+            crate::cmd_file::render_output_template(crate::cmd_file::DEFAULT_OUTPUT_TEMPLATE, input, None).unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "the `--output-format` flag is required for `{ext}` in the output template"
+        );
+    }
+
+    #[test]
+    fn test_convert_output_path() {
+        let cmd = crate::cmd_file::CmdFileConvert {
+            input: Some(std::path::PathBuf::from("my-part.step")),
+            output: None,
+            output_dir: Some(std::path::PathBuf::from("out")),
+            exclude: vec![],
+            manifest: None,
+            resume: None,
+            output_template: None,
+            gzip_output: false,
+            sign: false,
+            keep_input_on_failure: false,
+            no_wait: false,
+            interactive: false,
+            output_format: None,
+            src_format: None,
+            src_unit: None,
+            output_unit: None,
+            option: vec![],
+            param: vec![],
+            format: None,
+        };
+
+        assert_eq!(
+            cmd.output_path(
+                std::path::Path::new("my-part.step"),
+                &kittycad::types::FileOutputFormat::Stl
+            )
+            .unwrap(),
+            std::path::PathBuf::from("out/my-part.stl")
+        );
+
+        // Reading from stdin with only an output format writes to stdout.
+        let cmd = crate::cmd_file::CmdFileConvert {
+            input: Some(std::path::PathBuf::from("-")),
+            output_dir: None,
+            output_format: Some(kittycad::types::FileOutputFormat::Obj),
+            ..cmd
+        };
+        assert!(cmd.to_stdout());
+        assert_eq!(
+            cmd.output_path(std::path::Path::new("-"), &kittycad::types::FileOutputFormat::Obj)
+                .unwrap(),
+            std::path::PathBuf::from("-")
+        );
+    }
+
+    #[test]
+    fn test_parse_params() {
+        let params = crate::cmd_file::parse_params(&["a=b".to_string(), "c=d=e".to_string()]).unwrap();
+        assert_eq!(
+            params,
+            vec![("a".to_string(), "b".to_string()), ("c".to_string(), "d=e".to_string())]
+        );
+
+        let err = crate::cmd_file::parse_params(&["nope".to_string()]).unwrap_err();
+        assert_eq!(err.to_string(), "invalid --param `nope`, expected key=value");
+
+        let err = crate::cmd_file::parse_params(&["=value".to_string()]).unwrap_err();
+        assert_eq!(err.to_string(), "invalid --param `=value`, expected key=value");
+    }
+
+    #[test]
+    fn test_parse_output_options() {
+        let stl = kittycad::types::FileOutputFormat::Stl;
+        let options = crate::cmd_file::parse_output_options(
+            &["stl.storage=binary".to_string(), "stl.coords=z-up".to_string()],
+            &stl,
+        )
+        .unwrap();
+        assert_eq!(
+            options,
+            vec![
+                ("storage".to_string(), "binary".to_string()),
+                ("coords".to_string(), "z-up".to_string())
+            ]
+        );
+
+        let err = crate::cmd_file::parse_output_options(&["stl.storage=zip".to_string()], &stl).unwrap_err();
+        assert!(err.to_string().starts_with("invalid --option `stl.storage=zip`"));
+
+        let err = crate::cmd_file::parse_output_options(&["step.schema=ap214".to_string()], &stl).unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "--option `step.schema=ap214` is for step output, but the output format is stl"
+        );
+
+        let err = crate::cmd_file::parse_output_options(
+            &["stl.storage=ascii".to_string(), "stl.storage=binary".to_string()],
+            &stl,
+        )
+        .unwrap_err();
+        assert_eq!(err.to_string(), "--option `stl.storage` is set more than once");
+    }
+
     pub struct TestItem {
         name: String,
         cmd: crate::cmd_file::SubCommand,
@@ -371,12 +1957,53 @@ mod test {
     async fn test_cmd_file() {
         let tests: Vec<TestItem> = vec![
             TestItem {
+                    name: "convert without paths when not interactive".to_string(),
+                    cmd: crate::cmd_file::SubCommand::Convert(crate::cmd_file::CmdFileConvert {
+                        input: None,
+                        output: None,
+                        output_dir: None,
+                        exclude: vec![],
+                        manifest: None,
+                        resume: None,
+                        output_template: None,
+                        gzip_output: false,
+                        sign: false,
+                        keep_input_on_failure: false,
+                        no_wait: false,
+                        interactive: false,
+                        output_format: None,
+                        src_format: None,
+                        src_unit: None,
+                        output_unit: None,
+                        option: vec![],
+                        param: vec![],
+                        format: None,
+                    }),
+                    stdin: "".to_string(),
+                    want_out: "".to_string(),
+                    want_err: "the input and output paths are required when not running interactively".to_string(),
+                },
+                TestItem {
                     name: "convert input with bad ext".to_string(),
                     cmd: crate::cmd_file::SubCommand::Convert(crate::cmd_file::CmdFileConvert {
-                        input: std::path::PathBuf::from("test/bad_ext.bad_ext"),
-                        output: std::path::PathBuf::from("test/out.obj"),
+                        input: Some(std::path::PathBuf::from("test/bad_ext.bad_ext")),
+                        output: Some(std::path::PathBuf::from("test/out.obj")),
+                        output_dir: None,
+                        exclude: vec![],
+                        manifest: None,
+                        resume: None,
+                        output_template: None,
+                        gzip_output: false,
+                        sign: false,
+                        keep_input_on_failure: false,
+                        no_wait: false,
+                        interactive: false,
                         output_format: None,
                         src_format: None,
+                        src_unit: None,
+                        output_unit: None,
+                        option: vec![],
+                        param: vec![],
                         format: None,
                     }),
                     stdin: "".to_string(),
@@ -386,29 +2013,128 @@ mod test {
                 TestItem {
                     name: "convert output with bad ext".to_string(),
                     cmd: crate::cmd_file::SubCommand::Convert(crate::cmd_file::CmdFileConvert {
-                        input: std::path::PathBuf::from("assets/in_obj.obj"),
-                        output: std::path::PathBuf::from("test/out.bad"),
+                        input: Some(std::path::PathBuf::from("assets/in_obj.obj")),
+                        output: Some(std::path::PathBuf::from("test/out.bad")),
+                        output_dir: None,
+                        exclude: vec![],
+                        manifest: None,
+                        resume: None,
+                        output_template: None,
+                        gzip_output: false,
+                        sign: false,
+                        keep_input_on_failure: false,
+                        no_wait: false,
+                        interactive: false,
                         output_format: None,
                         src_format: None,
+                        src_unit: None,
+                        output_unit: None,
+                        option: vec![],
+                        param: vec![],
                         format: None,
                     }),
                     stdin: "".to_string(),
                     want_out: "".to_string(),
                     want_err: "unknown output format for file extension: bad. Try setting the `--output-format` flag explicitly or use a valid format.".to_string(),
                 },
+                TestItem {
+                    name: "convert to stdout without an output format".to_string(),
+                    cmd: crate::cmd_file::SubCommand::Convert(crate::cmd_file::CmdFileConvert {
+                        input: Some(std::path::PathBuf::from("assets/in_obj.obj")),
+                        output: Some(std::path::PathBuf::from("-")),
+                        output_dir: None,
+                        exclude: vec![],
+                        manifest: None,
+                        resume: None,
+                        output_template: None,
+                        gzip_output: false,
+                        sign: false,
+                        keep_input_on_failure: false,
+                        no_wait: false,
+                        interactive: false,
+                        output_format: None,
+                        src_format: None,
+                        src_unit: None,
+                        output_unit: None,
+                        option: vec![],
+                        param: vec![],
+                        format: None,
+                    }),
+                    stdin: "".to_string(),
+                    want_out: "".to_string(),
+                    want_err: "the `--output-format` flag is required when writing to stdout".to_string(),
+                },
                 TestItem {
                     name: "convert: input file does not exist".to_string(),
                     cmd: crate::cmd_file::SubCommand::Convert(crate::cmd_file::CmdFileConvert {
-                        input: std::path::PathBuf::from("test/bad_ext.stp"),
-                        output: std::path::PathBuf::from("test/out.obj"),
+                        input: Some(std::path::PathBuf::from("test/bad_ext.stp")),
+                        output: Some(std::path::PathBuf::from("test/out.obj")),
+                        output_dir: None,
+                        exclude: vec![],
+                        manifest: None,
+                        resume: None,
+                        output_template: None,
+                        gzip_output: false,
+                        sign: false,
+                        keep_input_on_failure: false,
+                        no_wait: false,
+                        interactive: false,
                         output_format: None,
                         src_format: None,
+                        src_unit: None,
+                        output_unit: None,
+                        option: vec![],
+                        param: vec![],
                         format: None,
                     }),
                     stdin: "".to_string(),
                     want_out: "".to_string(),
                     want_err: "File 'test/bad_ext.stp' does not exist.".to_string(),
                 },
+                TestItem {
+                    name: "validate with bad ext".to_string(),
+                    cmd: crate::cmd_file::SubCommand::Validate(crate::cmd_file::CmdFileValidate {
+                        input: std::path::PathBuf::from("test/bad_ext.bad_ext"),
+                        src_format: None,
+                        format: None,
+                    }),
+                    stdin: "".to_string(),
+                    want_out: "".to_string(),
+                    want_err: "unknown source format for file extension: bad_ext. Try setting the `--src-format` flag explicitly or use a valid format.".to_string(),
+                },
+                TestItem {
+                    name: "info from stdin".to_string(),
+                    cmd: crate::cmd_file::SubCommand::Info(crate::cmd_file::CmdFileInfo {
+                        input: std::path::PathBuf::from("-"),
+                        format: Some(crate::types::FormatOutput::Yaml),
+                    }),
+                    stdin: "solid cube\n  facet normal 0 0 1\n  endfacet\nendsolid cube\n".to_string(),
+                    want_out: "format: stl".to_string(),
+                    want_err: "".to_string(),
+                },
+                TestItem {
+                    name: "volume from stdin that isn't a CAD file".to_string(),
+                    cmd: crate::cmd_file::SubCommand::Volume(crate::cmd_file::CmdFileVolume {
+                        input: std::path::PathBuf::from("-"),
+                        src_format: None,
+                        format: None,
+                    }),
+                    stdin: "hello".to_string(),
+                    want_out: "".to_string(),
+                    want_err: "can't tell the format of the file from stdin, set it with the `--src-format` flag"
+                        .to_string(),
+                },
+                TestItem {
+                    name: "validate from stdin in a format the API can't read".to_string(),
+                    cmd: crate::cmd_file::SubCommand::Validate(crate::cmd_file::CmdFileValidate {
+                        input: std::path::PathBuf::from("-"),
+                        src_format: None,
+                        format: None,
+                    }),
+                    stdin: "ply\nformat ascii 1.0\nelement vertex 8\nend_header\n".to_string(),
+                    want_out: "".to_string(),
+                    want_err: "- looks like a ply file, which the API can't read".to_string(),
+                },
                 TestItem {
                     name: "volume with bad ext".to_string(),
                     cmd: crate::cmd_file::SubCommand::Volume(crate::cmd_file::CmdFileVolume {
@@ -446,11 +2172,7 @@ mod test {
             io.set_color_enabled(false);
             // TODO: we should figure out how to test the prompts.
             io.set_never_prompt(true);
-            let mut ctx = crate::context::Context {
-                config: &mut c,
-                io,
-                debug: false,
-            };
+            let mut ctx = crate::context::Context::with_io(&mut c, io);
 
             let cmd_file = crate::cmd_file::CmdFile { subcmd: t.cmd };
             match cmd_file.run(&mut ctx).await {
@@ -3,7 +3,8 @@ use std::{fs, io::Write};
 use anyhow::{Context, Result};
 use clap::{Command, CommandFactory, Parser};
 
-/// Generate various documentation files for the `kittycad` command line.
+/// Generate various documentation files for the `kittycad` command line, or scaffold
+/// new commands when working on it.
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdGenerate {
@@ -15,6 +16,7 @@ pub struct CmdGenerate {
 enum SubCommand {
     Markdown(CmdGenerateMarkdown),
     ManPages(CmdGenerateManPages),
+    Command(CmdGenerateCommand),
 }
 
 #[async_trait::async_trait]
@@ -23,23 +25,37 @@ impl crate::cmd::Command for CmdGenerate {
         match &self.subcmd {
             SubCommand::Markdown(cmd) => cmd.run(ctx).await,
             SubCommand::ManPages(cmd) => cmd.run(ctx).await,
+            SubCommand::Command(cmd) => cmd.run(ctx).await,
         }
     }
 }
 
 /// Generate markdown documentation.
+///
+/// With `--include-aliases`, your aliases are documented next to the built-in
+/// commands, so a team can publish the docs of the tooling it shares.
+///
+///     $ kittycad generate markdown --dir docs --include-aliases
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdGenerateMarkdown {
     /// Path directory where you want to output the generated files.
     #[clap(short = 'D', long, default_value = "")]
     pub dir: String,
+
+    /// Document your aliases too.
+    #[clap(long)]
+    pub include_aliases: bool,
 }
 
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdGenerateMarkdown {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let aliases = if self.include_aliases { alias_docs(ctx)? } else { vec![] };
         let mut app: Command = crate::Opts::command();
+        for alias in &aliases {
+            app = app.subcommand(alias.command());
+        }
         app._build_all();
 
         // Make sure the output directory exists.
@@ -64,7 +80,7 @@ impl CmdGenerateMarkdown {
 
         let filename = format!("{}.md", p);
         let title = p.replace('_', " ");
-        writeln!(ctx.io.out, "Generating markdown for `{}` -> {}", title, filename)?;
+        writeln!(ctx.io.err_out, "Generating markdown for `{}` -> {}", title, filename)?;
 
         // Generate the markdown.
         let m = crate::docs_markdown::app_to_markdown(app, &title)?;
@@ -101,18 +117,30 @@ layout: manual
 }
 
 /// Generate manual pages.
+///
+/// With `--include-aliases`, your aliases get manual pages too.
+///
+///     $ kittycad generate man-pages --dir man --include-aliases
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdGenerateManPages {
     /// Path directory where you want to output the generated files.
     #[clap(short = 'D', long, default_value = "")]
     pub dir: String,
+
+    /// Document your aliases too.
+    #[clap(long)]
+    pub include_aliases: bool,
 }
 
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdGenerateManPages {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let aliases = if self.include_aliases { alias_docs(ctx)? } else { vec![] };
         let mut app: Command = crate::Opts::command();
+        for alias in &aliases {
+            app = app.subcommand(alias.command());
+        }
         app._build_all();
 
         // Make sure the output directory exists.
@@ -144,7 +172,7 @@ impl CmdGenerateManPages {
 
         let filename = format!("{}.1", p);
         let title = p.replace('-', " ");
-        writeln!(ctx.io.out, "Generating man page for `{}` -> {}", title, filename)?;
+        writeln!(ctx.io.err_out, "Generating man page for `{}` -> {}", title, filename)?;
 
         if self.dir.is_empty() {
             crate::docs_man::generate_manpage(app, &mut ctx.io.out, &title, root);
@@ -164,8 +192,118 @@ impl CmdGenerateManPages {
     }
 }
 
+/// An alias, documented like a command.
+#[derive(Debug, Clone, PartialEq)]
+struct AliasDoc {
+    name: String,
+    about: String,
+    long_about: String,
+}
+
+impl AliasDoc {
+    fn new(name: &str, expansion: &str) -> AliasDoc {
+        let (about, usage) = match expansion.strip_prefix('!') {
+            Some(command) => (
+                format!("Alias for the shell command `{}`.", command),
+                "Any arguments are passed on to the shell command.",
+            ),
+            None => (
+                format!("Alias for `kittycad {}`.", expansion),
+                "`$1`, `$2` and so on are replaced with the arguments in order, the rest are added to the end.",
+            ),
+        };
+
+        AliasDoc {
+            name: name.to_string(),
+            long_about: format!(
+                "{}\n\n{}\n\nThis alias is set with `kittycad alias set`, it is not part of kittycad itself.",
+                about, usage
+            ),
+            about,
+        }
+    }
+
+    fn command(&self) -> Command<'_> {
+        Command::new(self.name.as_str())
+            .about(self.about.as_str())
+            .long_about(self.long_about.as_str())
+    }
+}
+
+/// Returns the aliases to document, by name.
+fn alias_docs(ctx: &mut crate::context::Context) -> Result<Vec<AliasDoc>> {
+    let mut aliases: Vec<(String, String)> = ctx.config.aliases()?.list().into_iter().collect();
+    aliases.sort();
+
+    Ok(aliases
+        .iter()
+        .map(|(name, expansion)| AliasDoc::new(name, expansion))
+        .collect())
+}
+
+/// Scaffold a new command for an API operation.
+///
+/// This is for working on the `kittycad` command line itself. It writes a command
+/// module with the arguments, run function, docs and a test that the arguments parse,
+/// and prints what to add to `src/main.rs`. Run it from the root of the repository.
+///
+///     # scaffold `kittycad api-token get`
+///     $ kittycad generate command api-token-get --operation get_api_token_for_user
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdGenerateCommand {
+    /// The name of the new command.
+    #[clap(name = "name", required = true)]
+    pub name: String,
+
+    /// The ID of the API operation the command calls.
+    #[clap(long, required = true)]
+    pub operation: String,
+
+    /// The path to the OpenAPI spec.
+    #[clap(long, default_value = "spec.json")]
+    pub spec: String,
+
+    /// Path directory where you want to output the generated file.
+    #[clap(short = 'D', long, default_value = "src")]
+    pub dir: String,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdGenerateCommand {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let spec = fs::read_to_string(&self.spec).with_context(|| format!("failed to read {}", self.spec))?;
+        let spec: serde_json::Value = serde_json::from_str(&spec)?;
+        let op = crate::scaffold::find_operation(&spec, &self.operation)?;
+
+        let p = std::path::Path::new(&self.dir).join(crate::scaffold::file_name(&self.name));
+        if p.exists() {
+            anyhow::bail!("{} already exists", p.display());
+        }
+        fs::write(&p, crate::scaffold::command_module(&self.name, &op))
+            .with_context(|| format!("failed to write file {}", p.display()))?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Generated {} for `{} {}`",
+            cs.success_icon(),
+            p.display(),
+            op.method,
+            op.path
+        )?;
+        writeln!(
+            ctx.io.err_out,
+            "\nNext, register the command in src/main.rs:\n\n{}",
+            crate::scaffold::registration(&self.name)
+        )?;
+
+        Ok(())
+    }
+}
+
 #[cfg(test)]
-fn test_app() -> clap::Command<'static> {
+pub(crate) fn test_app() -> clap::Command<'static> {
     // Define our app.
     clap::Command::new("git")
         .about("A fictional versioning CLI")
@@ -219,13 +357,12 @@ mod test {
         let mut c = crate::config_from_env::EnvConfig::inherit_env(&mut config);
 
         let (io, stdout_path, stderr_path) = crate::iostreams::IoStreams::test();
-        let mut ctx = crate::context::Context {
-            config: &mut c,
-            io,
-            debug: false,
-        };
+        let mut ctx = crate::context::Context::with_io(&mut c, io);
 
-        let cmd = crate::cmd_generate::CmdGenerateMarkdown { dir: "".to_string() };
+        let cmd = crate::cmd_generate::CmdGenerateMarkdown {
+            dir: "".to_string(),
+            include_aliases: false,
+        };
 
         cmd.run(&mut ctx).await.unwrap();
 
@@ -244,13 +381,12 @@ mod test {
         let mut c = crate::config_from_env::EnvConfig::inherit_env(&mut config);
 
         let (io, stdout_path, stderr_path) = crate::iostreams::IoStreams::test();
-        let mut ctx = crate::context::Context {
-            config: &mut c,
-            io,
-            debug: false,
-        };
+        let mut ctx = crate::context::Context::with_io(&mut c, io);
 
-        let cmd = crate::cmd_generate::CmdGenerateMarkdown { dir: "".to_string() };
+        let cmd = crate::cmd_generate::CmdGenerateMarkdown {
+            dir: "".to_string(),
+            include_aliases: false,
+        };
 
         let app = crate::cmd_generate::test_app();
 
@@ -428,13 +564,13 @@ sub subcommand
         let mut c = crate::config_from_env::EnvConfig::inherit_env(&mut config);
 
         let (io, stdout_path, stderr_path) = crate::iostreams::IoStreams::test();
-        let mut ctx = crate::context::Context {
-            config: &mut c,
-            io,
-            debug: true,
-        };
+        let mut ctx = crate::context::Context::with_io(&mut c, io);
+        ctx.debug = true;
 
-        let cmd = crate::cmd_generate::CmdGenerateManPages { dir: "".to_string() };
+        let cmd = crate::cmd_generate::CmdGenerateManPages {
+            dir: "".to_string(),
+            include_aliases: false,
+        };
 
         cmd.run(&mut ctx).await.unwrap();
 
@@ -452,13 +588,13 @@ sub subcommand
         let mut c = crate::config_from_env::EnvConfig::inherit_env(&mut config);
 
         let (io, stdout_path, stderr_path) = crate::iostreams::IoStreams::test();
-        let mut ctx = crate::context::Context {
-            config: &mut c,
-            io,
-            debug: true,
-        };
+        let mut ctx = crate::context::Context::with_io(&mut c, io);
+        ctx.debug = true;
 
-        let cmd = crate::cmd_generate::CmdGenerateManPages { dir: "".to_string() };
+        let cmd = crate::cmd_generate::CmdGenerateManPages {
+            dir: "".to_string(),
+            include_aliases: false,
+        };
 
         // Define our app.
         let app = crate::cmd_generate::test_app();
@@ -655,4 +791,18 @@ Print version information
         assert_eq!(stdout, expected);
         assert_eq!(stderr, "");
     }
+
+    #[test]
+    fn test_alias_doc() {
+        let doc = super::AliasDoc::new("co", "file convert --output-format=stl");
+        assert_eq!(doc.about, "Alias for `kittycad file convert --output-format=stl`.");
+        assert!(doc.long_about.contains("`$1`, `$2`"));
+
+        let doc = super::AliasDoc::new("today", "!kittycad history list | grep today");
+        assert_eq!(
+            doc.about,
+            "Alias for the shell command `kittycad history list | grep today`."
+        );
+        assert_eq!(doc.command().get_name(), "today");
+    }
 }
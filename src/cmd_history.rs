@@ -0,0 +1,230 @@
+use std::io::Write;
+
+use anyhow::Result;
+use clap::Parser;
+
+/// Manage the local history of API calls started from this machine.
+///
+/// The history is what `kittycad api-call status` lets you pick from when you don't
+/// pass an ID. API calls can be referred to by their ID or their position in the list,
+/// 1 being the newest.
+///
+///     # list your history
+///     $ kittycad history list
+///
+///     # show the newest API call
+///     $ kittycad history show 1
+///
+///     # run the command that started the newest API call again
+///     $ kittycad history rerun 1
+///
+///     # remove an API call from your history
+///     $ kittycad history purge <id>
+///
+///     # remove everything older than 30 days
+///     $ kittycad history purge --older-than 30d
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdHistory {
+    #[clap(subcommand)]
+    subcmd: SubCommand,
+}
+
+#[derive(Parser, Debug, Clone)]
+enum SubCommand {
+    List(CmdHistoryList),
+    Show(CmdHistoryShow),
+    Rerun(CmdHistoryRerun),
+    Purge(CmdHistoryPurge),
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdHistory {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        match &self.subcmd {
+            SubCommand::List(cmd) => cmd.run(ctx).await,
+            SubCommand::Show(cmd) => cmd.run(ctx).await,
+            SubCommand::Rerun(cmd) => cmd.run(ctx).await,
+            SubCommand::Purge(cmd) => cmd.run(ctx).await,
+        }
+    }
+}
+
+/// List the API calls started from this machine, newest first.
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdHistoryList {
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdHistoryList {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let operations = crate::history::load(&crate::config_file::history_file()?)?;
+
+        let format = ctx.format(&self.format)?;
+        ctx.io.write_output_for_vec(&format, &operations)?;
+
+        Ok(())
+    }
+}
+
+/// Show an API call started from this machine.
+///
+/// This is what was recorded when it was started, use `kittycad api-call status` for
+/// its current status.
+///
+///     # show the newest API call
+///     $ kittycad history show 1
+///
+///     # show an API call by its ID
+///     $ kittycad history show <id>
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdHistoryShow {
+    /// The ID of the API call, or its position in the history with 1 being the newest.
+    #[clap(name = "id", required = true)]
+    pub id: String,
+
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdHistoryShow {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let operations = crate::history::load(&crate::config_file::history_file()?)?;
+        let entry = find(&operations, &self.id)?;
+
+        let format = ctx.format(&self.format)?;
+        ctx.io.write_output(&format, entry)?;
+
+        Ok(())
+    }
+}
+
+/// Run the command that started an API call again.
+///
+/// The command is run with the same arguments, so relative paths are relative to the
+/// directory you run this from.
+///
+///     # run the command that started the newest API call again
+///     $ kittycad history rerun 1
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdHistoryRerun {
+    /// The ID of the API call, or its position in the history with 1 being the newest.
+    #[clap(name = "id", required = true)]
+    pub id: String,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdHistoryRerun {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let operations = crate::history::load(&crate::config_file::history_file()?)?;
+        let entry = find(&operations, &self.id)?;
+
+        if entry.args.is_empty() {
+            anyhow::bail!(
+                "the command that started API call `{}` was not recorded, it was started by an older version",
+                entry.id
+            );
+        }
+        if entry.input == "-" {
+            anyhow::bail!(
+                "API call `{}` was started with its input on stdin, run `kittycad {}` yourself instead",
+                entry.id,
+                entry.args.join(" ")
+            );
+        }
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Running `kittycad {}`",
+            cs.gray(">"),
+            entry.args.join(" ")
+        )?;
+
+        let status = std::process::Command::new(std::env::current_exe()?)
+            .args(&entry.args)
+            .status()?;
+        if !status.success() {
+            anyhow::bail!("`kittycad {}` failed with {}", entry.args.join(" "), status);
+        }
+
+        Ok(())
+    }
+}
+
+/// Returns the API call with the given ID or position in the history.
+fn find<'a>(
+    operations: &'a [crate::history::HistoryEntry],
+    id_or_position: &str,
+) -> Result<&'a crate::history::HistoryEntry> {
+    crate::history::find(operations, id_or_position)
+        .ok_or_else(|| anyhow::anyhow!("no API call `{}` in your history", id_or_position))
+}
+
+/// Remove API calls from the local history.
+///
+/// This only forgets about the API call on this machine, the API call itself and any
+/// output you saved are left alone. The cached API responses are removed too, since they
+/// may hold the API calls you purged.
+///
+///     # remove an API call from your history
+///     $ kittycad history purge <id>
+///
+///     # remove everything older than 30 days
+///     $ kittycad history purge --older-than 30d
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdHistoryPurge {
+    /// The ID of the API call to remove.
+    #[clap(name = "id", required_unless_present = "older_than", conflicts_with = "older_than")]
+    pub id: Option<String>,
+
+    /// Remove every API call older than this, e.g. "30d" or "12h".
+    #[clap(long, parse(try_from_str = crate::types::parse_duration))]
+    pub older_than: Option<std::time::Duration>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdHistoryPurge {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let filepath = crate::config_file::history_file()?;
+
+        let removed = match (&self.id, &self.older_than) {
+            (Some(id), _) => {
+                let removed = crate::history::purge(&filepath, |entry| &entry.id == id)?;
+                if removed.is_empty() {
+                    anyhow::bail!("no API call with ID `{}` in your history", id);
+                }
+                removed
+            }
+            (None, Some(older_than)) => {
+                let cutoff = chrono::Duration::from_std(*older_than)
+                    .ok()
+                    .and_then(|age| chrono::Utc::now().checked_sub_signed(age))
+                    .ok_or_else(|| anyhow::anyhow!("`--older-than` is too long ago"))?;
+                crate::history::purge(&filepath, |entry| entry.created_at < cutoff)?
+            }
+            (None, None) => anyhow::bail!("either an ID or `--older-than` is required"),
+        };
+        crate::cache::clear(std::path::Path::new(&crate::config_file::cache_dir()?))?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Removed {} API call{} from your history",
+            cs.success_icon_with_color(ansi_term::Color::Red),
+            removed.len(),
+            if removed.len() == 1 { "" } else { "s" }
+        )?;
+
+        Ok(())
+    }
+}
@@ -0,0 +1,302 @@
+use anyhow::{anyhow, Result};
+use clap::Parser;
+use serde::Serialize;
+
+/// Manage the KittyCAD hosts you use.
+///
+/// A host is a KittyCAD API server, `api.kittycad.io` or one you run yourself. Commands
+/// talk to the default host unless given another one with `--host` or `KITTYCAD_HOST`.
+/// Log in to a host with `kittycad auth login`.
+///
+///     # see your hosts, where their tokens come from and which one is the default
+///     $ kittycad host list
+///
+///     # add your own server and use it by default
+///     $ kittycad host add kittycad.internal --default
+///     $ kittycad auth login -H kittycad.internal
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdHost {
+    #[clap(subcommand)]
+    subcmd: SubCommand,
+}
+
+#[derive(Parser, Debug, Clone)]
+enum SubCommand {
+    List(CmdHostList),
+    Add(CmdHostAdd),
+    Remove(CmdHostRemove),
+    SetDefault(CmdHostSetDefault),
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdHost {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        match &self.subcmd {
+            SubCommand::List(cmd) => cmd.run(ctx).await,
+            SubCommand::Add(cmd) => cmd.run(ctx).await,
+            SubCommand::Remove(cmd) => cmd.run(ctx).await,
+            SubCommand::SetDefault(cmd) => cmd.run(ctx).await,
+        }
+    }
+}
+
+/// A row of the output of `kittycad host list`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, tabled::Tabled)]
+struct HostRow {
+    host: String,
+    default: bool,
+    user: String,
+    /// Where the token comes from, e.g. the hosts file or the keyring.
+    token: String,
+}
+
+/// List your hosts.
+///
+/// Shows which one is the default, who you are logged in as and where the token comes
+/// from, the hosts file, the keyring or `KITTYCAD_TOKEN`.
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdHostList {
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdHostList {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let default_host = ctx
+            .config
+            .default_host()
+            .ok()
+            .and_then(|host| crate::cmd_auth::parse_host(&host).ok())
+            .map(|host| host.to_string())
+            .unwrap_or_default();
+
+        let mut rows = vec![];
+        for host in ctx.config.hosts()? {
+            let token = match ctx.config.get_with_source(&host, "token") {
+                Ok((token, source)) if !token.is_empty() => crate::cmd_auth::show_identity(ctx, &source),
+                _ => "none".to_string(),
+            };
+            let user = match ctx.config.get(&host, "user") {
+                Ok(user) => crate::cmd_auth::show_identity(ctx, &user),
+                Err(_) => "".to_string(),
+            };
+
+            rows.push(HostRow {
+                default: host == default_host,
+                host,
+                user,
+                token,
+            });
+        }
+
+        let format = ctx.format(&self.format)?;
+        ctx.io.write_output_for_vec(&format, &rows)
+    }
+}
+
+/// Add a host without logging in to it.
+///
+/// Useful to set up a server you run yourself before you have a token for it, or to
+/// make it the default right away.
+///
+///     $ kittycad host add kittycad.internal --default
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdHostAdd {
+    /// The host to add, e.g. `kittycad.internal` or `http://localhost:8080`.
+    #[clap(name = "host", required = true, parse(try_from_str = crate::cmd_auth::parse_host))]
+    pub host: url::Url,
+
+    /// Make it the default host.
+    #[clap(long)]
+    pub default: bool,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdHostAdd {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let host = self.host.to_string();
+        ctx.config.add_host(&host)?;
+        if self.default {
+            set_default(ctx.config, &host)?;
+        }
+        ctx.config.write()?;
+
+        let cs = ctx.io.color_scheme();
+        let msg = if self.default {
+            "{} Added host {} as the default, log in to it with `kittycad auth login -H {}`"
+        } else {
+            "{} Added host {}, log in to it with `kittycad auth login -H {}`"
+        };
+        writeln!(
+            ctx.io.err_out,
+            "{}",
+            crate::i18n::trf(msg, &[&cs.success_icon(), &cs.bold(&host), &host])
+        )?;
+
+        Ok(())
+    }
+}
+
+/// Remove a host, logging out of it.
+///
+/// Its tokens are deleted, including the ones of accounts put aside with
+/// `kittycad auth switch`.
+///
+///     $ kittycad host remove kittycad.internal
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdHostRemove {
+    /// The host to remove.
+    #[clap(name = "host", required = true, parse(try_from_str = crate::cmd_auth::parse_host))]
+    pub host: url::Url,
+
+    /// Remove the host without prompting for confirmation.
+    #[clap(long, short)]
+    pub yes: bool,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdHostRemove {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let host = self.host.to_string();
+        check_host(ctx.config, &host)?;
+
+        if !ctx.io.can_prompt() && !self.yes {
+            return Err(anyhow!(crate::i18n::tr(
+                "--yes required when not running interactively"
+            )));
+        }
+
+        if !self.yes {
+            match dialoguer::Confirm::new()
+                .with_prompt(crate::i18n::trf(
+                    "Are you sure you want to remove {} and its tokens?",
+                    &[&host],
+                ))
+                .interact()
+            {
+                Ok(true) => {}
+                Ok(false) => {
+                    return Ok(());
+                }
+                Err(err) => {
+                    return Err(anyhow!("prompt failed: {}", err));
+                }
+            }
+        }
+
+        ctx.config.unset_host(&host)?;
+        ctx.config.write()?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{}",
+            crate::i18n::trf(
+                "{} Removed host {}",
+                &[&cs.success_icon_with_color(ansi_term::Color::Red), &host]
+            )
+        )?;
+
+        Ok(())
+    }
+}
+
+/// Set the host commands talk to unless given another one.
+///
+/// `KITTYCAD_HOST` still wins over it when it is set.
+///
+///     $ kittycad host set-default kittycad.internal
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdHostSetDefault {
+    /// The host to use by default.
+    #[clap(name = "host", required = true, parse(try_from_str = crate::cmd_auth::parse_host))]
+    pub host: url::Url,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdHostSetDefault {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let host = self.host.to_string();
+        set_default(ctx.config, &host)?;
+        ctx.config.write()?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{}",
+            crate::i18n::trf("{} {} is the default host", &[&cs.success_icon(), &host])
+        )?;
+        if let Ok(env_host) = std::env::var("KITTYCAD_HOST") {
+            writeln!(
+                ctx.io.err_out,
+                "{}",
+                crate::i18n::trf(
+                    "{} KITTYCAD_HOST is set to {}, which wins over the default host",
+                    &[&cs.warning_icon(), &env_host]
+                )
+            )?;
+        }
+
+        Ok(())
+    }
+}
+
+/// Returns an error if the host isn't one of ours.
+fn check_host(config: &dyn crate::config::Config, host: &str) -> Result<()> {
+    if !config.hosts()?.iter().any(|h| h == host) {
+        return Err(anyhow!(crate::i18n::trf(
+            "no host {}, see `kittycad host list`",
+            &[&host]
+        )));
+    }
+
+    Ok(())
+}
+
+/// Make the host the default one, and no other.
+fn set_default(config: &mut dyn crate::config::Config, host: &str) -> Result<()> {
+    check_host(config, host)?;
+
+    for other in config.hosts()? {
+        if other != host {
+            config.unset(&other, "default")?;
+        }
+    }
+
+    config.set(host, "default", "true")
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use crate::config::Config;
+
+    #[test]
+    fn test_set_default() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        config.add_host("https://api.kittycad.io/").unwrap();
+        config.add_host("https://kittycad.internal/").unwrap();
+
+        super::set_default(&mut config, "https://api.kittycad.io/").unwrap();
+        assert_eq!(config.default_host().unwrap(), "https://api.kittycad.io/");
+
+        // The first host would still win if it were left as a default.
+        super::set_default(&mut config, "https://kittycad.internal/").unwrap();
+        assert_eq!(config.default_host().unwrap(), "https://kittycad.internal/");
+
+        assert_eq!(
+            super::set_default(&mut config, "https://nope.example.com/")
+                .unwrap_err()
+                .to_string(),
+            "no host https://nope.example.com/, see `kittycad host list`"
+        );
+    }
+}
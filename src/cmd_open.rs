@@ -1,21 +1,38 @@
 use anyhow::Result;
-use clap::Parser;
+use clap::{Parser, ValueEnum};
 use parse_display::{Display, FromStr};
 
 /// Shortcut to open the KittyCAD documentation or Account in your browser.
 ///
-/// If no arguments are given, the default is to open the KittyCAD documentation.
+/// If no arguments are given in a terminal, you can pick the link to open.
+/// Otherwise the default is to open the KittyCAD documentation.
+///
+/// You can add your own links with `kittycad config set links.<name> <url>`, the
+/// shortcuts below win over links with the same name.
 ///
 ///     # open the KittyCAD docs in your browser
 ///     $ kittycad open docs
 ///
 ///     # open your KittyCAD account in your browser
 ///     $ kittycad open account
+///
+///     # pick the link to open
+///     $ kittycad open
+///
+///     # add a link to your dashboard and open it
+///     $ kittycad config set links.dashboard https://grafana.example.com/d/kittycad
+///     $ kittycad open dashboard
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdOpen {
-    #[clap(name = "shortcut", default_value_t, arg_enum)]
-    shortcut: OpenShortcut,
+    /// The shortcut to open: docs, api-ref, cli-ref, account, discord, store, blog, repo,
+    /// changelog, or the name of a link you added.
+    #[clap(name = "shortcut")]
+    shortcut: Option<String>,
+
+    /// Never show a picker, open the documentation if no shortcut is given.
+    #[clap(long)]
+    no_picker: bool,
 }
 
 /// The type of shortcut to open.
@@ -67,11 +84,70 @@ impl OpenShortcut {
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdOpen {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
-        ctx.browser("", &self.shortcut.get_url())
+        let links = links(&*ctx.config)?;
+
+        let url = match &self.shortcut {
+            Some(name) => match links.iter().find(|(n, _)| n == name) {
+                Some((_, url)) => url.to_string(),
+                None => {
+                    let names: Vec<&str> = links.iter().map(|(n, _)| n.as_str()).collect();
+                    anyhow::bail!("unknown shortcut `{}`, expected one of: {}", name, names.join(", "));
+                }
+            },
+            None if crate::picker::enabled(ctx, self.no_picker) => {
+                let items: Vec<String> = links.iter().map(|(name, url)| format!("{}  {}", name, url)).collect();
+                links[crate::picker::pick("What do you want to open?", &items)?]
+                    .1
+                    .to_string()
+            }
+            None => OpenShortcut::default().get_url(),
+        };
+
+        ctx.browser("", &url)
+    }
+}
+
+/// Returns the shortcuts and the links the user added, by name.
+fn links(config: &dyn crate::config::Config) -> Result<Vec<(String, String)>> {
+    let mut links: Vec<(String, String)> = OpenShortcut::value_variants()
+        .iter()
+        .map(|s| (s.to_string(), s.get_url()))
+        .collect();
+
+    for (name, url) in config.links()? {
+        if !links.iter().any(|(n, _)| n == &name) {
+            links.push((name, url));
+        }
     }
+
+    Ok(links)
 }
 
 /// Returns the URL to the changelog for the given version.
 pub fn changelog_url(version: &str) -> String {
     format!("https://github.com/KittyCAD/cli/releases/tag/v{}", version)
 }
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use crate::config::Config;
+
+    #[test]
+    fn test_links() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        config
+            .set("", "links.dashboard", "https://grafana.example.com")
+            .unwrap();
+        config.set("", "links.docs", "https://example.com/docs").unwrap();
+
+        let links = super::links(&config).unwrap();
+        assert_eq!(links[0], ("docs".to_string(), "https://docs.kittycad.io".to_string()));
+        assert_eq!(
+            links.last().unwrap(),
+            &("dashboard".to_string(), "https://grafana.example.com".to_string())
+        );
+        assert_eq!(links.iter().filter(|(name, _)| name == "docs").count(), 1);
+    }
+}
@@ -0,0 +1,278 @@
+use anyhow::{anyhow, Result};
+use clap::Parser;
+use serde::Serialize;
+
+/// Manage presets, named sets of flags for a command.
+///
+/// A preset is a YAML file with the command it is for and its flags, named like the
+/// `defaults.<command>.*` settings. Use one with the global `--preset` flag, flags given
+/// on the command line win over it. Teams can publish presets with the settings to use
+/// and everyone imports them with one command.
+///
+///     # import the team's preset, checking its hash
+///     $ kittycad preset import https://example.com/presets/print-shop.yml \
+///         --sha256 3f0c...
+///
+///     # convert with it
+///     $ kittycad file convert my-part.step --output-dir out --preset print-shop
+///
+/// A preset looks like this:
+///
+///     description: Binary STL in millimeters, for the print shop
+///     command: file convert
+///     flags:
+///       output_format: stl
+///       output_unit: mm
+///       option: stl.storage=binary
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdPreset {
+    #[clap(subcommand)]
+    subcmd: SubCommand,
+}
+
+#[derive(Parser, Debug, Clone)]
+enum SubCommand {
+    Import(CmdPresetImport),
+    List(CmdPresetList),
+    View(CmdPresetView),
+    Delete(CmdPresetDelete),
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdPreset {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        match &self.subcmd {
+            SubCommand::Import(cmd) => cmd.run(ctx).await,
+            SubCommand::List(cmd) => cmd.run(ctx).await,
+            SubCommand::View(cmd) => cmd.run(ctx).await,
+            SubCommand::Delete(cmd) => cmd.run(ctx).await,
+        }
+    }
+}
+
+/// Import a preset from an HTTPS URL or a gist.
+///
+/// The preset is checked before it is saved: its SHA256 hash must match `--sha256`, or it
+/// must be signed with the key given with `--public-key`, the signature being published
+/// next to it with a `.sig` extension. Sign a preset with `kittycad file sign`.
+///
+///     # import a preset, checking its hash
+///     $ kittycad preset import https://example.com/presets/print-shop.yml --sha256 3f0c...
+///
+///     # import a preset signed by your team
+///     $ kittycad preset import https://example.com/presets/print-shop.yml \
+///         --public-key MCowBQYDK2VwAyEA...
+///
+///     # import the preset in a gist under another name
+///     $ kittycad preset import https://gist.github.com/someone/0123abcd --name print-shop \
+///         --sha256 3f0c...
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdPresetImport {
+    /// The HTTPS URL of the preset, or of a gist with the preset.
+    #[clap(name = "url", required = true)]
+    pub url: String,
+
+    /// The name to save the preset as, instead of its `name` or the name of its file.
+    #[clap(long)]
+    pub name: Option<String>,
+
+    /// The SHA256 hash the preset must have.
+    #[clap(long)]
+    pub sha256: Option<String>,
+
+    /// The public key the preset must be signed with.
+    #[clap(long)]
+    pub public_key: Option<String>,
+
+    /// Import the preset without checking it, only for sources you trust.
+    #[clap(long, conflicts_with_all = &["sha256", "public_key"])]
+    pub no_verify: bool,
+
+    /// Replace a preset with the same name.
+    #[clap(long)]
+    pub force: bool,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdPresetImport {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        if self.sha256.is_none() && self.public_key.is_none() && !self.no_verify {
+            return Err(anyhow!(
+                "pass `--sha256` or `--public-key` to check the preset, or `--no-verify` if you trust where it comes from"
+            ));
+        }
+
+        let url = crate::preset::download_url(&self.url)?;
+        let client = ctx.download_client()?;
+        let max_body_size = ctx.max_body_size()?;
+        let content = crate::update_verify::fetch(&client, &url, max_body_size)
+            .await?
+            .ok_or_else(|| anyhow!("no preset at {}", url))?;
+
+        let signature = match &self.public_key {
+            Some(_) => Some(
+                crate::update_verify::fetch(&client, &format!("{}.sig", url), max_body_size)
+                    .await?
+                    .ok_or_else(|| anyhow!("no signature is published at {}.sig", url))?,
+            ),
+            None => None,
+        };
+        let sha256 = crate::preset::verify(
+            content.as_bytes(),
+            self.sha256.as_deref(),
+            self.public_key.as_deref().zip(signature.as_deref()),
+        )?;
+
+        let mut preset = crate::preset::parse(&content)?;
+        let name = match (&self.name, preset.name.is_empty()) {
+            (Some(name), _) => name.to_string(),
+            (None, false) => preset.name.to_string(),
+            (None, true) => crate::preset::name_from_url(&self.url)
+                .ok_or_else(|| anyhow!("the preset has no name, give it one with `--name`"))?,
+        };
+        crate::preset::validate_name(&name)?;
+
+        let dir = std::path::PathBuf::from(crate::config_file::presets_dir()?);
+        if !self.force && crate::preset::path(&dir, &name).exists() {
+            return Err(anyhow!(
+                "a preset named `{}` already exists, replace it with `--force` or pick another name with `--name`",
+                name
+            ));
+        }
+
+        preset.name = name.to_string();
+        preset.source = Some(self.url.to_string());
+        preset.sha256 = Some(sha256);
+        crate::preset::save(&dir, &name, &preset)?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Imported preset {} for `kittycad {}`, use it with `--preset {}`",
+            cs.success_icon(),
+            cs.bold(&name),
+            preset.command,
+            name
+        )?;
+        if let Some(public_key) = &self.public_key {
+            writeln!(ctx.io.err_out, "{} Signed with {}", cs.success_icon(), public_key)?;
+        }
+
+        Ok(())
+    }
+}
+
+/// A row of the output of `kittycad preset list`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, tabled::Tabled)]
+struct PresetRow {
+    name: String,
+    command: String,
+    description: String,
+}
+
+/// List your presets.
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdPresetList {
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdPresetList {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let presets = crate::preset::list(std::path::Path::new(&crate::config_file::presets_dir()?))?;
+        if presets.is_empty() {
+            writeln!(
+                ctx.io.err_out,
+                "no presets, import one with `kittycad preset import <url>`"
+            )?;
+            return Ok(());
+        }
+
+        let rows: Vec<PresetRow> = presets
+            .into_iter()
+            .map(|(name, preset)| PresetRow {
+                name,
+                command: preset.command,
+                description: preset.description,
+            })
+            .collect();
+
+        let format = ctx.format(&self.format)?;
+        ctx.io.write_output_for_vec(&format, &rows)
+    }
+}
+
+/// Show a preset.
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdPresetView {
+    /// The name of the preset.
+    #[clap(name = "name", required = true)]
+    pub name: String,
+
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdPresetView {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let preset = crate::preset::load(std::path::Path::new(&crate::config_file::presets_dir()?), &self.name)?;
+
+        match ctx.format(&self.format)? {
+            crate::types::FormatOutput::Json => ctx.io.write_output_json(&serde_json::to_value(&preset)?)?,
+            crate::types::FormatOutput::Yaml => ctx.io.write_output_yaml(&preset)?,
+            crate::types::FormatOutput::Table => {
+                let cs = ctx.io.color_scheme();
+                writeln!(ctx.io.out, "{} for `kittycad {}`", cs.bold(&self.name), preset.command)?;
+                if !preset.description.is_empty() {
+                    writeln!(ctx.io.out, "{}", preset.description)?;
+                }
+                writeln!(ctx.io.out)?;
+                for (flag, value) in &preset.flags {
+                    writeln!(ctx.io.out, "  --{}={}", flag.replace('_', "-"), value)?;
+                }
+                if let Some(source) = &preset.source {
+                    writeln!(ctx.io.out, "\n{}", cs.gray(&format!("Imported from {}", source)))?;
+                }
+            }
+        }
+
+        Ok(())
+    }
+}
+
+/// Delete a preset.
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdPresetDelete {
+    /// The name of the preset.
+    #[clap(name = "name", required = true)]
+    pub name: String,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdPresetDelete {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let dir = std::path::PathBuf::from(crate::config_file::presets_dir()?);
+        // Make sure it is a preset before we delete anything.
+        crate::preset::load(&dir, &self.name)?;
+        std::fs::remove_file(crate::preset::path(&dir, &self.name))?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Deleted preset {}",
+            cs.success_icon_with_color(ansi_term::Color::Red),
+            self.name
+        )?;
+
+        Ok(())
+    }
+}
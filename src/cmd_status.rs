@@ -0,0 +1,457 @@
+use std::time::{Duration, Instant};
+
+use anyhow::Result;
+use clap::Parser;
+use serde::Serialize;
+
+/// How long we wait for each check when no `--timeout` is set.
+const DEFAULT_TIMEOUT: Duration = Duration::from_secs(10);
+
+/// The most queued async operations we count, we show "100+" past that.
+const QUEUE_PAGE_SIZE: usize = 100;
+
+/// Check whether the KittyCAD API is up.
+///
+/// This pings the API and looks at the queue of async operations, like file
+/// conversions, timing each check. It also shows how much credit you have left,
+/// warning if it is below your `quota_warning`. Run it before kicking off a long batch job to
+/// know whether the API is having trouble. The command fails if any check does.
+///
+/// Only KittyCAD employees can look at the queue, for everyone else that check
+/// is skipped.
+///
+/// The version of the API the host answers in is printed too, if it says. A host
+/// pinned to a version with `api_version` is asked for that one.
+///
+///     # check the default host
+///     $ kittycad status
+///
+///     # check another host
+///     $ kittycad status --host kittycad.internal
+///
+///     # check from a script
+///     $ kittycad status --format=json
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdStatus {
+    /// The host to check, by default the default host.
+    #[clap(short = 'H', long, default_value = "")]
+    pub host: String,
+
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdStatus {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let (host, _) = ctx.resolve_host(&self.host)?;
+        let handle = ctx
+            .io
+            .start_process_indicator_with_label(&format!(" Checking {}", host));
+        let status = check(ctx, &self.host).await;
+        if let Some(handle) = handle {
+            handle.stop();
+        }
+        let status = status?;
+
+        match ctx.format(&self.format)? {
+            crate::types::FormatOutput::Json => ctx.io.write_output_json(&serde_json::to_value(&status)?)?,
+            crate::types::FormatOutput::Yaml => ctx.io.write_output_yaml(&status)?,
+            crate::types::FormatOutput::Table => {
+                let cs = ctx.io.color_scheme();
+                write!(ctx.io.out, "{}", status.summary(&cs))?;
+            }
+        }
+
+        if !status.is_up() {
+            anyhow::bail!("the KittyCAD API at {} is having trouble", status.host);
+        }
+
+        Ok(())
+    }
+}
+
+/// Run the checks of a host, the default host if it is empty.
+pub(crate) async fn check(ctx: &mut crate::context::Context<'_>, host: &str) -> Result<Status> {
+    let (hostname, baseurl) = ctx.resolve_host(host)?;
+    crate::policy::check_host(&*ctx.config, &hostname)?;
+    crate::policy::check_host(&*ctx.config, &baseurl)?;
+    let timeout = ctx.timeout()?.unwrap_or(DEFAULT_TIMEOUT);
+
+    let http_log = ctx.http_log();
+
+    let (pong, api_version) = ping(
+        &*ctx.config,
+        &http_log,
+        &baseurl,
+        timeout,
+        ctx.pinned_media_type(&hostname),
+    )
+    .await;
+    let mut checks = vec![pong];
+    checks.push(match ctx.api_client(host) {
+        Ok(client) => queue(&client, &http_log, timeout).await,
+        Err(err) => Check::skipped("async operations", &err.to_string()),
+    });
+    checks.push(credit(ctx, host).await);
+
+    Ok(Status {
+        host: hostname,
+        api_version,
+        checks,
+    })
+}
+
+/// The state of a part of the API.
+#[derive(Debug, Clone, Copy, PartialEq, Serialize)]
+#[serde(rename_all = "lowercase")]
+enum State {
+    Up,
+    Down,
+    /// We couldn't check it, e.g. because we aren't allowed to.
+    Skipped,
+}
+
+/// The result of checking a part of the API.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+struct Check {
+    name: String,
+    state: State,
+    /// How long the API took to answer, if it did.
+    latency_ms: Option<u64>,
+    /// What the API said, or why the check failed or was skipped.
+    detail: String,
+}
+
+impl Check {
+    fn down(name: &str) -> Check {
+        Check {
+            name: name.to_string(),
+            state: State::Down,
+            latency_ms: None,
+            detail: String::new(),
+        }
+    }
+
+    fn skipped(name: &str, detail: &str) -> Check {
+        Check {
+            name: name.to_string(),
+            state: State::Skipped,
+            latency_ms: None,
+            detail: detail.to_string(),
+        }
+    }
+}
+
+/// The results of all the checks of a host.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub(crate) struct Status {
+    host: String,
+    /// The version of the API the host answered in, if it said, see `api_version` in
+    /// `kittycad config`.
+    api_version: Option<String>,
+    checks: Vec<Check>,
+}
+
+impl Status {
+    pub(crate) fn is_up(&self) -> bool {
+        self.checks.iter().all(|check| check.state != State::Down)
+    }
+
+    /// Returns a line per check, green for the ones that are up and red for the ones
+    /// that are down.
+    pub(crate) fn summary(&self, cs: &crate::colors::ColorScheme) -> String {
+        let width = self
+            .checks
+            .iter()
+            .map(|check| check.name.len())
+            .max()
+            .unwrap_or_default();
+
+        let mut summary = String::new();
+        for check in &self.checks {
+            let (icon, name) = match check.state {
+                State::Up => (
+                    cs.success_icon(),
+                    cs.green(&format!("{:width$}", check.name, width = width)),
+                ),
+                State::Down => (
+                    cs.failure_icon(),
+                    cs.red(&format!("{:width$}", check.name, width = width)),
+                ),
+                State::Skipped => (
+                    cs.warning_icon(),
+                    cs.yellow(&format!("{:width$}", check.name, width = width)),
+                ),
+            };
+            let latency = match check.latency_ms {
+                Some(ms) => cs.gray(&format!(" ({}ms)", ms)),
+                None => String::new(),
+            };
+            summary.push_str(&format!("{} {}  {}{}\n", icon, name, check.detail, latency));
+        }
+
+        if let Some(api_version) = &self.api_version {
+            summary.push_str(&format!("API version {}\n", api_version));
+        }
+
+        if self.is_up() {
+            summary.push_str(&format!("{} is up\n", self.host));
+        } else {
+            summary.push_str(&format!("{} is having trouble\n", cs.red(&self.host)));
+        }
+
+        summary
+    }
+}
+
+/// Returns the time since the start in milliseconds.
+fn elapsed_ms(start: Instant) -> u64 {
+    start.elapsed().as_millis() as u64
+}
+
+/// Returns the version of the API a response is in from its content type, e.g. `v1` for
+/// `application/vnd.kittycad.v1+json`.
+fn api_version(content_type: &str) -> Option<String> {
+    let media_type = content_type.split(';').next().unwrap_or_default().trim();
+    media_type
+        .strip_prefix("application/vnd.kittycad.")
+        .and_then(|rest| rest.strip_suffix("+json"))
+        .map(|version| version.to_string())
+}
+
+/// Check that the API answers a ping, we don't need to be logged in for this.
+///
+/// This also returns the version of the API it answered in, asking for the one the host
+/// is pinned to if it is.
+async fn ping(
+    config: &dyn crate::config::Config,
+    http_log: &crate::http_log::HttpLog,
+    baseurl: &str,
+    timeout: Duration,
+    accept: Option<String>,
+) -> (Check, Option<String>) {
+    let mut check = Check::down("api");
+
+    let builder = crate::context::tls(config, reqwest::Client::builder().timeout(timeout));
+    let client = match builder.and_then(|builder| Ok(builder.build()?)) {
+        Ok(client) => client,
+        Err(err) => {
+            check.detail = err.to_string();
+            return (check, None);
+        }
+    };
+
+    let mut req = client.get(format!("{}/ping", baseurl));
+    if let Some(accept) = accept {
+        req = req.header(reqwest::header::ACCEPT, accept);
+    }
+
+    let start = Instant::now();
+    let mut version = None;
+    match crate::http_log::send(http_log, req).await {
+        Ok(resp) => {
+            check.latency_ms = Some(elapsed_ms(start));
+            version = resp
+                .headers()
+                .get(reqwest::header::CONTENT_TYPE)
+                .and_then(|value| value.to_str().ok())
+                .and_then(api_version);
+            let status = resp.status();
+            match resp.json::<serde_json::Value>().await {
+                Ok(pong) if status.is_success() => {
+                    check.state = State::Up;
+                    check.detail = pong["message"].as_str().unwrap_or_default().to_string();
+                }
+                _ => check.detail = format!("{} {}", status, status.canonical_reason().unwrap_or("")),
+            }
+        }
+        Err(err) => check.detail = err.to_string(),
+    }
+
+    (check, version)
+}
+
+/// Check that the API can list the queued async operations, and count them.
+async fn queue(client: &kittycad::Client, http_log: &crate::http_log::HttpLog, timeout: Duration) -> Check {
+    let name = "async operations";
+    let mut check = Check::down(name);
+
+    let uri = format!("/async/operations?status=Queued&limit={}", QUEUE_PAGE_SIZE);
+    let req = match client.request_raw(http::Method::GET, &uri, None).await {
+        Ok(req) => req,
+        Err(err) => {
+            check.detail = err.to_string();
+            return check;
+        }
+    };
+
+    let start = Instant::now();
+    let resp = match tokio::time::timeout(timeout, crate::http_log::send(http_log, req)).await {
+        Ok(Ok(resp)) => resp,
+        Ok(Err(err)) => {
+            check.detail = err.to_string();
+            return check;
+        }
+        Err(_) => {
+            check.detail = format!("no answer after {}s", timeout.as_secs());
+            return check;
+        }
+    };
+    check.latency_ms = Some(elapsed_ms(start));
+
+    let status = resp.status();
+    if status == http::StatusCode::UNAUTHORIZED || status == http::StatusCode::FORBIDDEN {
+        return Check::skipped(name, "only KittyCAD employees can see the queue");
+    }
+    if !status.is_success() {
+        check.detail = format!("{} {}", status, status.canonical_reason().unwrap_or(""));
+        return check;
+    }
+
+    match resp.json::<serde_json::Value>().await {
+        Ok(page) => {
+            check.state = State::Up;
+            check.detail = queued(&page);
+        }
+        Err(err) => check.detail = err.to_string(),
+    }
+
+    check
+}
+
+/// Look up how much credit is left, this never fails the status since running low is
+/// not the API having trouble.
+async fn credit(ctx: &crate::context::Context<'_>, host: &str) -> Check {
+    let name = "credit";
+    let start = Instant::now();
+    let balance = match crate::cmd_billing::balance(ctx, host, None).await {
+        Ok(balance) => balance,
+        Err(err) => return Check::skipped(name, &err.to_string()),
+    };
+
+    let remaining = crate::cmd_billing::remaining(&balance);
+    let mut detail = format!("{} left", crate::cmd_billing::display_money(&remaining));
+    if let Ok(Some(threshold)) = crate::quota::threshold(&*ctx.config) {
+        if remaining < threshold {
+            detail.push_str(&format!(
+                ", below your quota_warning of {}",
+                crate::cmd_billing::display_money(&threshold)
+            ));
+        }
+    }
+
+    Check {
+        name: name.to_string(),
+        state: State::Up,
+        latency_ms: Some(elapsed_ms(start)),
+        detail,
+    }
+}
+
+/// Returns how many operations a page of queued operations says are queued.
+fn queued(page: &serde_json::Value) -> String {
+    let count = page["items"].as_array().map(|items| items.len()).unwrap_or_default();
+    let more = page["next_page"]
+        .as_str()
+        .map(|next| !next.is_empty())
+        .unwrap_or_default();
+
+    if more {
+        format!("{}+ queued", count)
+    } else {
+        format!("{} queued", count)
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    fn check(name: &str, state: State, latency_ms: Option<u64>, detail: &str) -> Check {
+        Check {
+            name: name.to_string(),
+            state,
+            latency_ms,
+            detail: detail.to_string(),
+        }
+    }
+
+    #[test]
+    fn test_summary() {
+        let cs = crate::colors::ColorScheme::new(false, false, false);
+
+        let status = Status {
+            host: "api.kittycad.io".to_string(),
+            api_version: Some("v1".to_string()),
+            checks: vec![
+                check("api", State::Up, Some(84), "pong"),
+                check(
+                    "async operations",
+                    State::Skipped,
+                    None,
+                    "only KittyCAD employees can see the queue",
+                ),
+            ],
+        };
+        assert!(status.is_up());
+        assert_eq!(
+            status.summary(&cs),
+            r#"✔ api               pong (84ms)
+! async operations  only KittyCAD employees can see the queue
+API version v1
+api.kittycad.io is up
+"#
+        );
+
+        let status = Status {
+            host: "api.kittycad.io".to_string(),
+            api_version: None,
+            checks: vec![
+                check("api", State::Down, Some(1200), "503 Service Unavailable"),
+                check("async operations", State::Up, Some(90), "3 queued"),
+            ],
+        };
+        assert!(!status.is_up());
+        assert_eq!(
+            status.summary(&cs),
+            r#"✘ api               503 Service Unavailable (1200ms)
+✔ async operations  3 queued (90ms)
+api.kittycad.io is having trouble
+"#
+        );
+    }
+
+    #[test]
+    fn test_api_version() {
+        assert_eq!(
+            api_version("application/vnd.kittycad.v1+json; charset=utf-8"),
+            Some("v1".to_string())
+        );
+        assert_eq!(api_version("application/json"), None);
+    }
+
+    #[test]
+    fn test_queued() {
+        assert_eq!(queued(&serde_json::json!({"items": [], "next_page": null})), "0 queued");
+        assert_eq!(
+            queued(&serde_json::json!({"items": [{}, {}], "next_page": "abc"})),
+            "2+ queued"
+        );
+    }
+
+    #[tokio::test(flavor = "multi_thread")]
+    async fn test_ping_down() {
+        let config = crate::config::new_blank_config().unwrap();
+        let http_log = crate::http_log::HttpLog::new(0, crate::iostreams::SharedWriter::new(std::io::sink()));
+        let (check, version) = ping(&config, &http_log, "http://127.0.0.1:1", Duration::from_secs(2), None).await;
+        assert_eq!(version, None);
+        assert_eq!(check.name, "api");
+        assert_eq!(check.state, State::Down);
+        assert_eq!(check.latency_ms, None);
+    }
+}
@@ -0,0 +1,197 @@
+use anyhow::Result;
+use clap::Parser;
+use serde::Serialize;
+
+/// Manage the usage metrics `kittycad` records, off unless you turn them on.
+///
+/// With telemetry enabled, every run of a command is counted on this machine: which
+/// command it was, how long it took and, if it failed, the kind of error, e.g.
+/// `network` or `auth`. Nothing else is recorded, not the arguments of the command,
+/// its output, file names, error messages, hosts, tokens or who you are logged in as.
+/// This helps the KittyCAD team decide what to work on in the CLI.
+///
+///     # see what is recorded
+///     $ kittycad telemetry status
+///
+///     # opt in
+///     $ kittycad telemetry enable
+///
+///     # opt out, this also deletes what was recorded
+///     $ kittycad telemetry disable
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdTelemetry {
+    #[clap(subcommand)]
+    subcmd: SubCommand,
+}
+
+#[derive(Parser, Debug, Clone)]
+enum SubCommand {
+    Status(CmdTelemetryStatus),
+    Enable(CmdTelemetryEnable),
+    Disable(CmdTelemetryDisable),
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdTelemetry {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        match &self.subcmd {
+            SubCommand::Status(cmd) => cmd.run(ctx).await,
+            SubCommand::Enable(cmd) => cmd.run(ctx).await,
+            SubCommand::Disable(cmd) => cmd.run(ctx).await,
+        }
+    }
+}
+
+/// Show whether telemetry is enabled and what it recorded.
+///
+///     # show what is recorded
+///     $ kittycad telemetry status
+///
+///     # show exactly what is recorded
+///     $ kittycad telemetry status --format=json
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdTelemetryStatus {
+    /// Command output format.
+    #[clap(long, short, arg_enum)]
+    pub format: Option<crate::types::FormatOutput>,
+}
+
+/// A row of the output of `kittycad telemetry status`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, tabled::Tabled)]
+struct CommandRow {
+    command: String,
+    runs: u64,
+    errors: String,
+    average_ms: u64,
+}
+
+impl CommandRow {
+    fn new(command: &str, metrics: &crate::telemetry::CommandMetrics) -> CommandRow {
+        CommandRow {
+            command: command.to_string(),
+            runs: metrics.runs,
+            errors: metrics
+                .errors
+                .iter()
+                .map(|(category, count)| format!("{} {}", count, category))
+                .collect::<Vec<String>>()
+                .join(", "),
+            average_ms: metrics.total_ms / metrics.runs.max(1),
+        }
+    }
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdTelemetryStatus {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let filepath = crate::config_file::telemetry_file()?;
+        let metrics = crate::telemetry::load(&filepath)?;
+
+        match ctx.format(&self.format)? {
+            crate::types::FormatOutput::Json => return ctx.io.write_output_json(&serde_json::to_value(&metrics)?),
+            crate::types::FormatOutput::Yaml => return ctx.io.write_output_yaml(&metrics),
+            crate::types::FormatOutput::Table => {}
+        }
+
+        let cs = ctx.io.color_scheme();
+        if crate::telemetry::is_enabled(&*ctx.config) {
+            writeln!(
+                ctx.io.err_out,
+                "{} Telemetry is enabled, recording to {}",
+                cs.success_icon(),
+                filepath
+            )?;
+        } else {
+            writeln!(
+                ctx.io.err_out,
+                "Telemetry is disabled, turn it on with `kittycad telemetry enable`"
+            )?;
+        }
+
+        let rows: Vec<CommandRow> = metrics
+            .commands
+            .iter()
+            .map(|(command, metrics)| CommandRow::new(command, metrics))
+            .collect();
+        if !rows.is_empty() {
+            ctx.io.write_output_table_for_vec(rows)?;
+        }
+
+        Ok(())
+    }
+}
+
+/// Turn on recording usage metrics.
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdTelemetryEnable {}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdTelemetryEnable {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        ctx.config.set("", "telemetry", "enabled")?;
+        ctx.config.write()?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Telemetry enabled, thanks! See what is recorded with `kittycad telemetry status`",
+            cs.success_icon()
+        )?;
+
+        Ok(())
+    }
+}
+
+/// Turn off recording usage metrics and delete what was recorded.
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdTelemetryDisable {}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdTelemetryDisable {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        ctx.config.set("", "telemetry", "disabled")?;
+        ctx.config.write()?;
+        crate::telemetry::clear(&crate::config_file::telemetry_file()?)?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} Telemetry disabled and what was recorded deleted",
+            cs.success_icon()
+        )?;
+
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_command_row() {
+        let metrics = crate::telemetry::CommandMetrics {
+            runs: 4,
+            errors: [("auth".to_string(), 1), ("network".to_string(), 2)]
+                .into_iter()
+                .collect(),
+            total_ms: 6000,
+        };
+
+        assert_eq!(
+            CommandRow::new("file_convert", &metrics),
+            CommandRow {
+                command: "file_convert".to_string(),
+                runs: 4,
+                errors: "1 auth, 2 network".to_string(),
+                average_ms: 1500,
+            }
+        );
+    }
+}
@@ -5,6 +5,16 @@ use clap::Parser;
 ///
 /// This function will return an error if the current binary is under Homebrew or if
 /// the running version is already the latest version.
+///
+/// It updates to the latest release in your `update_channel`, stable by default:
+///
+///     # also update to release candidates
+///     $ kittycad config set update_channel prerelease
+///     $ kittycad update
+///
+/// The new binary is checked against the checksum published with it before it
+/// replaces the running one. If `release_public_key` is set, its signature is
+/// checked too, see `kittycad version verify`.
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdUpdate {}
@@ -17,7 +27,9 @@ impl crate::cmd::Command for CmdUpdate {
         }
 
         // Get the latest release.
-        let latest_release = crate::update::get_latest_release_info().await?;
+        let client = ctx.download_client()?;
+        let latest_release =
+            crate::update::get_latest_release_info(&client, crate::update::update_channel(&*ctx.config)).await?;
         let current_version = clap::crate_version!();
 
         if !crate::update::version_greater_then(&latest_release.version, current_version)? {
@@ -32,19 +44,29 @@ impl crate::cmd::Command for CmdUpdate {
         let cs = ctx.io.color_scheme();
 
         writeln!(
-            ctx.io.out,
+            ctx.io.err_out,
             "Updating from v{} to {}...",
             current_version, latest_release.version
         )?;
 
         // Download the latest release.
-        let temp_latest_binary_path = crate::update::download_binary_to_temp_file(&latest_release.version).await?;
+        let public_key = crate::update_verify::public_key(&*ctx.config);
+        let (temp_latest_binary_path, verification) = crate::update::download_binary_to_temp_file(
+            &client,
+            &latest_release.version,
+            ctx.limit_rate()?,
+            public_key.as_deref(),
+        )
+        .await?;
+        if let Some(public_key) = &verification.signed_by {
+            writeln!(ctx.io.err_out, "{} Signed with {}", cs.success_icon(), public_key)?;
+        }
 
         // Rename the file to that of the current running exe.
         std::fs::rename(temp_latest_binary_path, current_binary_path)?;
 
         writeln!(
-            ctx.io.out,
+            ctx.io.err_out,
             "{} Updated to v{}!",
             cs.success_icon(),
             latest_release.version
@@ -5,6 +5,21 @@ use clap::Parser;
 use cli_macro::crud_gen;
 
 /// Edit and view your user.
+///
+/// Running `kittycad user edit` without any flags in an interactive terminal
+/// prompts for each field, starting from its current value.
+///
+///     # show your account
+///     $ kittycad user show
+///
+///     # export your account as json
+///     $ kittycad user show --format json
+///
+///     # update your company
+///     $ kittycad user edit --company "KittyCAD"
+///
+///     # update your account interactively
+///     $ kittycad user edit
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdUser {
@@ -22,6 +37,9 @@ enum SubCommand {}
 impl crate::cmd::Command for CmdUser {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
         match &self.subcmd {
+            SubCommand::Edit(cmd) if is_empty_edit(cmd) && ctx.io.can_prompt() => {
+                prompt_edit(ctx).await?.run(ctx).await
+            }
             SubCommand::Edit(cmd) => cmd.run(ctx).await,
             SubCommand::View(cmd) => cmd.run(ctx).await,
             SubCommand::Delete(cmd) => cmd.run(ctx).await,
@@ -29,6 +47,72 @@ impl crate::cmd::Command for CmdUser {
     }
 }
 
+/// Returns true if no fields were given to edit.
+fn is_empty_edit(cmd: &CmdUserEdit) -> bool {
+    cmd.new_company.is_none()
+        && cmd.new_discord.is_none()
+        && cmd.new_first_name.is_none()
+        && cmd.new_github.is_none()
+        && cmd.new_last_name.is_none()
+        && cmd.new_phone.is_none()
+}
+
+/// Prompt for each field of the user, with the current value filled in, and return an edit
+/// of only the fields that changed.
+async fn prompt_edit(ctx: &crate::context::Context<'_>) -> Result<CmdUserEdit> {
+    let client = ctx.api_client("")?;
+    let retry_policy = ctx.retry_policy()?;
+
+    let client = &client;
+    let user = crate::retry::call(&retry_policy, &ctx.http_log(), "GET /user", || async move {
+        client.users().get_self().await
+    })
+    .await?;
+
+    let company = prompt_field("Company", &user.company.unwrap_or_default())?;
+    let first_name = prompt_field("First name", &user.first_name.unwrap_or_default())?;
+    let last_name = prompt_field("Last name", &user.last_name.unwrap_or_default())?;
+    let discord = prompt_field("Discord handle", &user.discord.unwrap_or_default())?;
+    let github = prompt_field("GitHub handle", &user.github.unwrap_or_default())?;
+    let new_phone = match prompt_field("Phone number", &user.phone.to_string())? {
+        Some(phone) => phone
+            .parse()
+            .map_err(|err| anyhow::anyhow!("invalid phone number `{}`: {}", phone, err))?,
+        None => Default::default(),
+    };
+
+    Ok(CmdUserEdit {
+        new_company: company,
+        new_discord: discord,
+        new_phone,
+        new_last_name: last_name,
+        new_first_name: first_name,
+        new_github: github,
+    })
+}
+
+/// Prompt for a single field, returning the new value only if it changed.
+fn prompt_field(prompt: &str, current: &str) -> Result<Option<String>> {
+    let input = match dialoguer::Input::<String>::new()
+        .with_prompt(prompt)
+        .with_initial_text(current)
+        .allow_empty(true)
+        .interact_text()
+    {
+        Ok(input) => input,
+        Err(err) => {
+            return Err(anyhow::anyhow!("prompt failed: {}", err));
+        }
+    };
+
+    let input = input.trim();
+    if input == current {
+        Ok(None)
+    } else {
+        Ok(Some(input.to_string()))
+    }
+}
+
 #[cfg(test)]
 mod test {
     use pretty_assertions::assert_eq;
@@ -114,11 +198,7 @@ mod test {
             // This ensures it also works in GitHub actions/any CI.
             io.set_color_enabled(false);
             io.set_never_prompt(true);
-            let mut ctx = crate::context::Context {
-                config: &mut c,
-                io,
-                debug: false,
-            };
+            let mut ctx = crate::context::Context::with_io(&mut c, io);
 
             let cmd_user = crate::cmd_user::CmdUser { subcmd: t.cmd };
             match cmd_user.run(&mut ctx).await {
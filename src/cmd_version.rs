@@ -2,17 +2,34 @@ use anyhow::Result;
 use clap::Parser;
 
 /// Prints the version of the program.
+///
+///     $ kittycad version
+///
+///     # check this binary is the one that was released
+///     $ kittycad version verify
 #[derive(Parser, Debug, Clone)]
 #[clap(verbatim_doc_comment)]
 pub struct CmdVersion {
     #[doc = "Open the version in the browser."]
     #[clap(short, long)]
     pub web: bool,
+
+    #[clap(subcommand)]
+    subcmd: Option<SubCommand>,
+}
+
+#[derive(Parser, Debug, Clone)]
+enum SubCommand {
+    Verify(CmdVersionVerify),
 }
 
 #[async_trait::async_trait]
 impl crate::cmd::Command for CmdVersion {
     async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        if let Some(SubCommand::Verify(cmd)) = &self.subcmd {
+            return cmd.run(ctx).await;
+        }
+
         let version = clap::crate_version!();
         let git_hash = git_rev::try_revision_string!();
         let url = changelog_url(version);
@@ -37,3 +54,78 @@ impl crate::cmd::Command for CmdVersion {
 pub fn changelog_url(version: &str) -> String {
     format!("https://github.com/KittyCAD/cli/releases/tag/v{}", version)
 }
+
+/// Check a kittycad binary is the one that was released.
+///
+/// This downloads the checksum published with the release and compares it with
+/// the binary, the running one by default. If `release_public_key` is set, the
+/// signature published with the release must have been made with that key too,
+/// e.g. a key your organization signs the releases it approved with.
+///
+/// Binaries built from source or installed with a package manager don't match
+/// the released ones.
+///
+///     # check the running binary
+///     $ kittycad version verify
+///
+///     # check a binary you downloaded before installing it
+///     $ kittycad version verify ./kittycad --version 0.1.10
+///
+///     # require releases to be signed with your key
+///     $ kittycad config set release_public_key <public key>
+#[derive(Parser, Debug, Clone)]
+#[clap(verbatim_doc_comment)]
+pub struct CmdVersionVerify {
+    /// The binary to check, by default the running one.
+    #[clap(name = "path", parse(from_os_str))]
+    pub path: Option<std::path::PathBuf>,
+
+    /// The release the binary should be, by default the version of the running binary.
+    #[clap(long)]
+    pub version: Option<String>,
+}
+
+#[async_trait::async_trait]
+impl crate::cmd::Command for CmdVersionVerify {
+    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {
+        let path = match &self.path {
+            Some(path) => path.clone(),
+            None => std::env::current_exe()?,
+        };
+        let version = self.version.as_deref().unwrap_or(clap::crate_version!());
+        let url = crate::update::get_exe_download_url(version);
+        let public_key = crate::update_verify::public_key(&*ctx.config);
+
+        let client = ctx.download_client()?;
+        let verification = crate::update_verify::verify_download(&client, &path, &url, public_key.as_deref())
+            .await
+            .map_err(|err| {
+                anyhow::anyhow!(
+                    "{} is not the released v{}: {}",
+                    path.display(),
+                    version.trim_start_matches('v'),
+                    err
+                )
+            })?;
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.out,
+            "{} {} matches the published checksum of v{} ({})",
+            cs.success_icon(),
+            path.display(),
+            version.trim_start_matches('v'),
+            verification.sha256
+        )?;
+        match &verification.signed_by {
+            Some(public_key) => writeln!(ctx.io.out, "{} Signed with {}", cs.success_icon(), public_key)?,
+            None => writeln!(
+                ctx.io.out,
+                "{} The signature was not checked, set `release_public_key` to require one",
+                cs.warning_icon()
+            )?,
+        }
+
+        Ok(())
+    }
+}
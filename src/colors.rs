@@ -25,11 +25,47 @@ pub fn is_256_color_supported() -> bool {
     is_true_color_supported() || term.contains("256") || color_term.contains("256")
 }
 
+/// Returns true if the terminal is known to support OSC 8 hyperlinks.
+pub fn is_hyperlink_supported() -> bool {
+    if get_env_var("TERM") == "dumb" {
+        return false;
+    }
+
+    let term_program = get_env_var("TERM_PROGRAM");
+    let vte_version = get_env_var("VTE_VERSION").parse::<u32>().unwrap_or_default();
+
+    ["iTerm.app", "WezTerm", "vscode", "Hyper"].contains(&term_program.as_str())
+        || vte_version >= 5000
+        || !get_env_var("WT_SESSION").is_empty()
+        || !get_env_var("KITTY_WINDOW_ID").is_empty()
+        || !get_env_var("KONSOLE_VERSION").is_empty()
+        || !get_env_var("DOMTERM").is_empty()
+}
+
+/// Returns true if we should print hyperlinks, for the `hyperlinks` setting: "enabled",
+/// "disabled" or "auto", where we only print them to terminals that support them.
+pub fn hyperlinks_enabled(setting: &str, is_tty: bool) -> bool {
+    match setting {
+        "enabled" => true,
+        "disabled" => false,
+        _ => is_tty && is_hyperlink_supported(),
+    }
+}
+
+/// Returns true if output should be plain for screen readers, for the `accessible_output`
+/// setting, "enabled" or "disabled". `KITTYCAD_ACCESSIBLE` set to anything but "0" turns
+/// it on too.
+pub fn accessible_output(setting: &str) -> bool {
+    let env = get_env_var("KITTYCAD_ACCESSIBLE");
+    setting == "enabled" || (!env.is_empty() && env != "0")
+}
+
 #[allow(dead_code)]
 pub struct ColorScheme {
     enabled: bool,
     is_256_enabled: bool,
     has_true_color: bool,
+    hyperlinks: bool,
 }
 
 impl ColorScheme {
@@ -38,7 +74,23 @@ impl ColorScheme {
             enabled,
             is_256_enabled,
             has_true_color,
+            hyperlinks: false,
+        }
+    }
+
+    /// Print URLs as clickable links.
+    pub fn with_hyperlinks(mut self, hyperlinks: bool) -> Self {
+        self.hyperlinks = hyperlinks;
+        self
+    }
+
+    /// Returns the URL as a clickable OSC 8 hyperlink, if the terminal supports them.
+    pub fn hyperlink(&self, url: &str) -> String {
+        if !self.hyperlinks {
+            return url.to_string();
         }
+
+        format!("\x1b]8;;{}\x1b\\{}\x1b]8;;\x1b\\", url, url)
     }
 
     pub fn bold(&self, t: &str) -> String {
@@ -186,6 +238,25 @@ mod test {
         }
     }
 
+    #[test]
+    fn test_hyperlink() {
+        let cs = ColorScheme::new(false, false, false);
+        assert_eq!(cs.hyperlink("https://kittycad.io"), "https://kittycad.io");
+
+        let cs = cs.with_hyperlinks(true);
+        assert_eq!(
+            cs.hyperlink("https://kittycad.io"),
+            "\x1b]8;;https://kittycad.io\x1b\\https://kittycad.io\x1b]8;;\x1b\\"
+        );
+    }
+
+    #[test]
+    fn test_hyperlinks_enabled() {
+        assert!(hyperlinks_enabled("enabled", false));
+        assert!(!hyperlinks_enabled("disabled", true));
+        assert!(!hyperlinks_enabled("auto", false));
+    }
+
     pub struct TestItem {
         name: String,
         no_color_env: String,
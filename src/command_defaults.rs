@@ -0,0 +1,196 @@
+/// Returns the setting name of a flag, its long name with underscores, e.g. `output_format`
+/// for `--output-format`.
+fn setting_name(arg: &clap::Arg) -> Option<String> {
+    arg.get_long().map(|long| long.replace('-', "_"))
+}
+
+/// Returns true if the command has a flag the setting can be a default for, e.g.
+/// `output_format` for `file_convert`.
+pub fn is_flag(command: &str, setting: &str) -> bool {
+    match crate::command_tree::root().find(command) {
+        Some(cmd) => cmd.flag(setting).is_some(),
+        None => false,
+    }
+}
+
+/// Returns the arguments with the user's defaults for the command added, e.g. the value
+/// of `defaults.file_convert.output_format` as `--output-format`.
+///
+/// The flags of the preset passed with `--preset`, if any, win over the defaults. Flags
+/// given on the command line win over both, and we leave out defaults that conflict with
+/// them.
+pub fn apply(
+    app: &clap::Command,
+    matches: &clap::ArgMatches,
+    args: &[String],
+    config: &dyn crate::config::Config,
+    preset: Option<&crate::preset::Preset>,
+) -> Vec<String> {
+    let mut app = app;
+    let mut matches = matches;
+    let mut path = vec![];
+    while let Some((name, sub_matches)) = matches.subcommand() {
+        app = match app.find_subcommand(name) {
+            Some(sub) => sub,
+            None => return args.to_vec(),
+        };
+        path.push(name.replace('-', "_"));
+        matches = sub_matches;
+    }
+    if path.is_empty() {
+        return args.to_vec();
+    }
+    let command = path.join("_");
+
+    let given: Vec<&clap::Arg> = app
+        .get_arguments()
+        .filter(|arg| matches.value_source(arg.get_id()) == Some(clap::ValueSource::CommandLine))
+        .collect();
+
+    let mut defaults = vec![];
+    for arg in app.get_arguments() {
+        let (long, setting) = match (arg.get_long(), setting_name(arg)) {
+            (Some(long), Some(setting)) => (long, setting),
+            _ => continue,
+        };
+
+        if given.iter().any(|g| g.get_id() == arg.get_id()) {
+            continue;
+        }
+
+        let conflicts = given.iter().any(|g| {
+            app.get_arg_conflicts_with(arg).iter().any(|c| c.get_id() == g.get_id())
+                || app.get_arg_conflicts_with(g).iter().any(|c| c.get_id() == arg.get_id())
+        });
+        if conflicts {
+            continue;
+        }
+
+        let value = match preset.and_then(|p| p.flags.get(&setting)) {
+            Some(value) => value.to_string(),
+            None => match config.get("", &crate::config::command_key(&command, &setting)) {
+                Ok(value) if !value.is_empty() => value,
+                _ => continue,
+            },
+        };
+
+        if arg.is_takes_value_set() {
+            defaults.push(format!("--{}={}", long, value));
+        } else if value == "true" {
+            defaults.push(format!("--{}", long));
+        }
+    }
+
+    // Keep anything after a `--` as is.
+    let mut args = args.to_vec();
+    let at = args.iter().position(|arg| arg == "--").unwrap_or(args.len());
+    args.splice(at..at, defaults);
+
+    args
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+    use crate::config::Config;
+
+    fn test_app() -> clap::Command<'static> {
+        clap::Command::new("kittycad").subcommand(
+            clap::Command::new("file").subcommand(
+                clap::Command::new("convert")
+                    .arg(clap::Arg::new("input"))
+                    .arg(clap::Arg::new("output"))
+                    .arg(
+                        clap::Arg::new("output_format")
+                            .long("output-format")
+                            .short('t')
+                            .takes_value(true),
+                    )
+                    .arg(
+                        clap::Arg::new("output_dir")
+                            .long("output-dir")
+                            .takes_value(true)
+                            .conflicts_with("output"),
+                    )
+                    .arg(clap::Arg::new("gzip_output").long("gzip-output")),
+            ),
+        )
+    }
+
+    fn args(s: &str) -> Vec<String> {
+        s.split_whitespace().map(|s| s.to_string()).collect()
+    }
+
+    #[test]
+    fn test_apply() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        config.set("", "defaults.file_convert.output_format", "obj").unwrap();
+        config.set("", "defaults.file_convert.output_dir", "out").unwrap();
+        config.set("", "defaults.file_convert.gzip_output", "true").unwrap();
+
+        let tests = vec![
+            (
+                "kittycad file convert a.step",
+                "kittycad file convert a.step --output-format=obj --output-dir=out --gzip-output",
+            ),
+            (
+                "kittycad file convert a.step -t stl",
+                "kittycad file convert a.step -t stl --output-dir=out --gzip-output",
+            ),
+            (
+                "kittycad file convert a.step b.obj",
+                "kittycad file convert a.step b.obj --output-format=obj --gzip-output",
+            ),
+            ("kittycad file", "kittycad file"),
+        ];
+
+        let app = test_app();
+        for (given, want) in tests {
+            let matches = app.clone().try_get_matches_from(args(given)).unwrap();
+            assert_eq!(
+                apply(&app, &matches, &args(given), &config, None),
+                args(want),
+                "{}",
+                given
+            );
+        }
+    }
+
+    #[test]
+    fn test_apply_preset() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        config.set("", "defaults.file_convert.output_format", "obj").unwrap();
+        config.set("", "defaults.file_convert.output_dir", "out").unwrap();
+
+        let preset = crate::preset::Preset {
+            command: "file convert".to_string(),
+            flags: [("output_format".to_string(), "stl".to_string())].into_iter().collect(),
+            ..Default::default()
+        };
+
+        let app = test_app();
+        let given = "kittycad file convert a.step";
+        let matches = app.clone().try_get_matches_from(args(given)).unwrap();
+        assert_eq!(
+            apply(&app, &matches, &args(given), &config, Some(&preset)),
+            args("kittycad file convert a.step --output-format=stl --output-dir=out")
+        );
+
+        let given = "kittycad file convert a.step -t step";
+        let matches = app.clone().try_get_matches_from(args(given)).unwrap();
+        assert_eq!(
+            apply(&app, &matches, &args(given), &config, Some(&preset)),
+            args("kittycad file convert a.step -t step --output-dir=out")
+        );
+    }
+
+    #[test]
+    fn test_is_flag() {
+        assert!(is_flag("file_convert", "output_format"));
+        assert!(is_flag("api_call_status", "format"));
+        assert!(!is_flag("file_convert", "nope"));
+        assert!(!is_flag("file_nope", "output_format"));
+    }
+}
@@ -0,0 +1,165 @@
+use clap::CommandFactory;
+
+/// A command as the docs, config checks and tests see it: its name, what it does, its
+/// flags and subcommands, without any of what is needed to run it.
+///
+/// Building the clap app for `kittycad` is slow, it has every command of the API, so we
+/// describe it once per process and look things up here instead.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct CommandDescriptor {
+    /// The name of the command, e.g. `status` for `kittycad api-call status`.
+    pub name: String,
+    /// The other names the command can be run as, e.g. `aliases` for `alias`.
+    pub aliases: Vec<String>,
+    /// The subcommands joined with underscores, e.g. `api_call_status`, empty for the root.
+    pub path: String,
+    /// What the command does, the summary of its docs.
+    pub about: String,
+    /// Whether the command is hidden from the help and docs.
+    pub hidden: bool,
+    pub flags: Vec<FlagDescriptor>,
+    pub subcommands: Vec<CommandDescriptor>,
+}
+
+/// A flag of a command.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct FlagDescriptor {
+    /// The long name of the flag, without the dashes, e.g. `output-format`.
+    pub long: String,
+    pub short: Option<char>,
+    /// Whether the flag takes a value, false for a switch.
+    pub takes_value: bool,
+    pub help: String,
+}
+
+impl FlagDescriptor {
+    /// Returns the setting name of the flag, its long name with underscores, e.g.
+    /// `output_format` for `--output-format`.
+    pub fn setting_name(&self) -> String {
+        self.long.replace('-', "_")
+    }
+}
+
+impl CommandDescriptor {
+    /// Describe a clap command and its subcommands.
+    pub fn new(app: &clap::Command) -> CommandDescriptor {
+        describe(app, app.get_name().replace('-', "_"))
+    }
+
+    /// Returns the subcommand for a command path, e.g. `api_call_status` for
+    /// `kittycad api-call status`.
+    pub fn find(&self, path: &str) -> Option<&CommandDescriptor> {
+        for sub in &self.subcommands {
+            let name = sub.name.replace('-', "_");
+            if path == name {
+                return Some(sub);
+            }
+
+            if let Some(rest) = path.strip_prefix(&format!("{}_", name)) {
+                if let Some(found) = sub.find(rest) {
+                    return Some(found);
+                }
+            }
+        }
+
+        None
+    }
+
+    /// Returns the flag with the setting name, e.g. `output_format`.
+    pub fn flag(&self, setting: &str) -> Option<&FlagDescriptor> {
+        self.flags.iter().find(|flag| flag.setting_name() == setting)
+    }
+
+    /// Returns the command and all of its subcommands, depth first.
+    pub fn walk(&self) -> Vec<&CommandDescriptor> {
+        let mut commands = vec![self];
+        for sub in &self.subcommands {
+            commands.extend(sub.walk());
+        }
+
+        commands
+    }
+}
+
+/// Returns the description of `kittycad` and its commands, the root has an empty path.
+pub fn root() -> &'static CommandDescriptor {
+    static ROOT: std::sync::OnceLock<CommandDescriptor> = std::sync::OnceLock::new();
+
+    ROOT.get_or_init(|| describe(&crate::Opts::command(), "".to_string()))
+}
+
+fn describe(app: &clap::Command, path: String) -> CommandDescriptor {
+    CommandDescriptor {
+        name: app.get_name().to_string(),
+        aliases: app.get_all_aliases().map(|alias| alias.to_string()).collect(),
+        about: app.get_about().unwrap_or_default().to_string(),
+        hidden: app.is_hide_set(),
+        flags: app
+            .get_arguments()
+            .filter_map(|arg| {
+                arg.get_long().map(|long| FlagDescriptor {
+                    long: long.to_string(),
+                    short: arg.get_short(),
+                    takes_value: arg.is_takes_value_set(),
+                    help: arg.get_help().unwrap_or_default().to_string(),
+                })
+            })
+            .collect(),
+        subcommands: app
+            .get_subcommands()
+            .map(|sub| {
+                let name = sub.get_name().replace('-', "_");
+                if path.is_empty() {
+                    describe(sub, name)
+                } else {
+                    describe(sub, format!("{}_{}", path, name))
+                }
+            })
+            .collect(),
+        path,
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_find() {
+        let status = root().find("api_call_status").unwrap();
+        assert_eq!(status.name, "status");
+        assert_eq!(status.path, "api_call_status");
+        assert!(status.flag("format").unwrap().takes_value);
+
+        let convert = root().find("file_convert").unwrap();
+        assert_eq!(convert.flag("output_format").unwrap().long, "output-format");
+        assert_eq!(convert.flag("nope"), None);
+
+        assert_eq!(root().find("file_nope"), None);
+        assert_eq!(root().find("alias").unwrap().aliases, vec!["aliases"]);
+    }
+
+    #[test]
+    fn test_new() {
+        let app = crate::cmd_generate::test_app();
+        let git = CommandDescriptor::new(&app);
+        assert_eq!(git.path, "git");
+        assert_eq!(
+            git.walk().iter().map(|c| c.path.as_str()).collect::<Vec<_>>(),
+            vec![
+                "git",
+                "git_clone",
+                "git_push",
+                "git_add",
+                "git_add_new",
+                "git_add_new_foo"
+            ]
+        );
+        assert_eq!(
+            git.find("add_new").unwrap().flag("type").unwrap().help,
+            "The type of thing to add."
+        );
+    }
+}
@@ -11,11 +11,32 @@ pub trait Config {
     fn get_with_source(&self, hostname: &str, key: &str) -> Result<(String, String)>;
     /// Sets a value in the configuration by its key.
     fn set(&mut self, hostname: &str, key: &str, value: &str) -> Result<()>;
+    /// Removes a value from the configuration by its key. Configuration options go back
+    /// to their default value.
+    fn unset(&mut self, hostname: &str, key: &str) -> Result<()>;
+    /// Resets the configuration to the defaults, keeping the hosts.
+    fn reset(&mut self) -> Result<()>;
 
     /// Remove a host.
     fn unset_host(&mut self, key: &str) -> Result<()>;
+    /// Add a host without a token, it is not an error if it exists.
+    fn add_host(&mut self, hostname: &str) -> Result<()>;
+    /// Returns the accounts for a host besides the one in use.
+    fn accounts(&self, hostname: &str) -> Result<Vec<String>>;
+    /// Put the account in use for a host aside, so another one can log in.
+    fn stash_account(&mut self, hostname: &str) -> Result<()>;
+    /// Use another account for a host, putting the one in use aside.
+    fn switch_account(&mut self, hostname: &str, account: &str) -> Result<()>;
+    /// Get the user and token of an account put aside for a host.
+    fn get_account(&self, hostname: &str, account: &str) -> Result<(String, String)>;
+    /// Put an account aside for a host, e.g. one imported from another machine.
+    fn add_account(&mut self, hostname: &str, account: &str, user: &str, token: &str) -> Result<()>;
     /// Get the hosts.
     fn hosts(&self) -> Result<Vec<String>>;
+    /// Get the links added for `kittycad open`, by name.
+    fn links(&self) -> Result<Vec<(String, String)>>;
+    /// Get the per-command settings, `defaults.*`, by key.
+    fn command_defaults(&self) -> Result<Vec<(String, String)>>;
 
     /// Get the default host.
     fn default_host(&self) -> Result<String>;
@@ -91,10 +112,185 @@ pub fn config_options() -> Vec<ConfigOption> {
             default_value: crate::types::FormatOutput::default().to_string(),
             allowed_values: crate::types::FormatOutput::variants(),
         },
+        ConfigOption {
+            key: "credential_store".to_string(),
+            description: "where to store authentication tokens".to_string(),
+            comment: "Where kittycad should store authentication tokens, in the hosts file or the system keyring."
+                .to_string(),
+            default_value: crate::config_credentials::CredentialStoreKind::default().to_string(),
+            allowed_values: crate::config_credentials::CredentialStoreKind::variants(),
+        },
+        ConfigOption {
+            key: "max_body_size".to_string(),
+            description: "the maximum size in bytes of a raw API response to read".to_string(),
+            comment: "The maximum size in bytes of a raw API response kittycad will read, e.g. in `kittycad api`. If blank, defaults to 32 MiB."
+                .to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "retries".to_string(),
+            description: "the number of times to retry failed API requests".to_string(),
+            comment: "How many times kittycad should retry API requests that failed because of rate limits, server or network errors. If blank, defaults to 2.".to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "timeout".to_string(),
+            description: "how long a command may run before it is aborted".to_string(),
+            comment: "How long a command may run before kittycad aborts it, e.g. \"30s\" or \"2m\". If blank, commands never time out.".to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "limit_rate".to_string(),
+            description: "the maximum rate to upload and download files at".to_string(),
+            comment: "The maximum number of bytes per second kittycad should upload and download files at, e.g. \"500k\" or \"2M\". If blank, there is no limit.".to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "max_idle_connections".to_string(),
+            description: "the number of idle connections to keep open to each host".to_string(),
+            comment: "How many idle connections to each host kittycad should keep open to reuse. If blank, defaults to 16.".to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "idle_timeout".to_string(),
+            description: "how long to keep idle connections open".to_string(),
+            comment: "How long kittycad should keep an idle connection open to reuse, e.g. \"30s\" or \"2m\". If blank, defaults to 90s.".to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "http2".to_string(),
+            description: "whether to talk to the API over HTTP/2".to_string(),
+            comment: "Whether kittycad should talk to the API over HTTP/2. If \"auto\", only when the server offers it.".to_string(),
+            default_value: "auto".to_string(),
+            allowed_values: vec!["auto".to_string(), "enabled".to_string(), "disabled".to_string()],
+        },
+        ConfigOption {
+            key: "http_proxy".to_string(),
+            description: "the proxy to send requests through".to_string(),
+            comment: "The proxy kittycad should send requests through, e.g. \"http://proxy.example.com:3128\". If blank, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are respected.".to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "ca_bundle".to_string(),
+            description: "a file of extra certificate authorities to trust".to_string(),
+            comment: "The path to a PEM file of certificate authorities kittycad should trust on top of the usual ones, e.g. the one of a proxy that intercepts TLS.".to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "insecure_skip_verify".to_string(),
+            description: "do not verify the certificates of the servers we talk to".to_string(),
+            comment: "Set to \"true\" to not verify the certificates of the servers kittycad talks to. Anyone on the network can then read your token, prefer ca_bundle.".to_string(),
+            default_value: "false".to_string(),
+            allowed_values: vec!["false".to_string(), "true".to_string()],
+        },
+        ConfigOption {
+            key: "allowed_hosts".to_string(),
+            description: "the only hosts kittycad may send requests to".to_string(),
+            comment: "A comma separated list of the only hosts kittycad may send requests to, e.g. \"api.kittycad.io\". If blank, any host is allowed.".to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "hyperlinks".to_string(),
+            description: "whether to print URLs as clickable links".to_string(),
+            comment: "Whether kittycad should print URLs as clickable links. If \"auto\", only in terminals that support them.".to_string(),
+            default_value: "auto".to_string(),
+            allowed_values: vec!["auto".to_string(), "enabled".to_string(), "disabled".to_string()],
+        },
+        ConfigOption {
+            key: "accessible_output".to_string(),
+            description: "plain output for screen readers".to_string(),
+            comment: "Set to \"enabled\" for plain output that screen readers can follow: no color, and plain progress lines instead of spinners and progress bars.".to_string(),
+            default_value: "disabled".to_string(),
+            allowed_values: vec!["disabled".to_string(), "enabled".to_string()],
+        },
+        ConfigOption {
+            key: "privacy".to_string(),
+            description: "hide your identity in command output".to_string(),
+            comment: "Set to \"strict\" to show hashes instead of your email, user ID and where your token comes from in command output, e.g. while screen sharing.".to_string(),
+            default_value: "normal".to_string(),
+            allowed_values: vec!["normal".to_string(), "strict".to_string()],
+        },
+        ConfigOption {
+            key: "release_public_key".to_string(),
+            description: "the public key releases must be signed with".to_string(),
+            comment: "The public key the releases kittycad updates to must be signed with. If blank, only their checksum is checked.".to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "update_channel".to_string(),
+            description: "which releases to update to".to_string(),
+            comment: "Which releases kittycad should tell you about and update to. \"prerelease\" includes release candidates and \"nightly\" nightly builds too.".to_string(),
+            default_value: "stable".to_string(),
+            allowed_values: crate::update::UpdateChannel::variants(),
+        },
+        ConfigOption {
+            key: "quota_warning".to_string(),
+            description: "warn when your credit is below this amount".to_string(),
+            comment: "The amount of credit in US dollars below which kittycad warns before commands that spend it, e.g. \"5.00\". If blank, there is no warning.".to_string(),
+            default_value: "".to_string(),
+            allowed_values: vec![],
+        },
+        ConfigOption {
+            key: "telemetry".to_string(),
+            description: "record anonymized usage metrics".to_string(),
+            comment: "Whether kittycad counts which commands you run and the kinds of errors they fail with, on this machine. See `kittycad telemetry`.".to_string(),
+            default_value: "disabled".to_string(),
+            allowed_values: vec!["enabled".to_string(), "disabled".to_string()],
+        },
     ]
 }
 
+/// The settings that can be set per command, besides a default for any of its flags,
+/// e.g. `defaults.api_call_status.fields`.
+const COMMAND_SETTINGS: &[&str] = &["fields"];
+
+/// Returns the key of a per-command setting. The command is its subcommands joined
+/// with underscores, e.g. `api_call_status` for `kittycad api-call status`.
+pub fn command_key(command: &str, setting: &str) -> String {
+    format!("defaults.{}.{}", command, setting)
+}
+
+fn is_command_key(key: &str) -> bool {
+    let parts: Vec<&str> = key.split('.').collect();
+    parts.len() == 3
+        && parts[0] == "defaults"
+        && !parts[1].is_empty()
+        && (COMMAND_SETTINGS.contains(&parts[2]) || crate::command_defaults::is_flag(parts[1], parts[2]))
+}
+
+/// Returns the media type that asks for a version of the API, e.g.
+/// `application/vnd.kittycad.v1+json` for `v1`.
+pub fn api_media_type(version: &str) -> String {
+    format!("application/vnd.kittycad.{}+json", version)
+}
+
+/// Returns the key of a link for `kittycad open`, e.g. `links.dashboard`.
+pub fn link_key(name: &str) -> String {
+    format!("links.{}", name)
+}
+
+fn is_link_key(key: &str) -> bool {
+    match key.strip_prefix("links.") {
+        Some(name) => !name.is_empty() && !name.contains('.'),
+        None => false,
+    }
+}
+
 pub fn validate_key(key: &str) -> Result<()> {
+    if is_command_key(key) || is_link_key(key) {
+        return Ok(());
+    }
+
     for config_key in config_options() {
         if key == config_key.key {
             return Ok(());
@@ -111,6 +307,20 @@ pub enum InvalidValueError {
 }
 
 pub fn validate_value(key: &str, value: &str) -> Result<()> {
+    if key == "api_version" {
+        return match value.strip_prefix('v').map(|n| n.parse::<u32>()) {
+            Some(Ok(_)) => Ok(()),
+            _ => Err(anyhow!("invalid API version `{}`, expected e.g. v1", value)),
+        };
+    }
+
+    if is_link_key(key) {
+        return match url::Url::parse(value) {
+            Ok(url) if url.scheme() == "http" || url.scheme() == "https" => Ok(()),
+            _ => Err(anyhow!("invalid link `{}`, expected an http or https URL", value)),
+        };
+    }
+
     let mut valid_values: Vec<String> = vec![];
 
     // Set the valid values for the key.
@@ -220,6 +430,96 @@ browser = "chrome""#;
         assert_eq!(hosts[1], "kittycad.computer".to_string());
     }
 
+    #[test]
+    fn test_file_config_unset() {
+        let mut c = new_blank_config().unwrap();
+        c.set("", "browser", "firefox").unwrap();
+        c.set("", "prompt", "disabled").unwrap();
+        c.set("", "defaults.api_call_status.fields", "id").unwrap();
+        c.set("example.com", "browser", "chrome").unwrap();
+        c.set("example.com", "user", "me@example.com").unwrap();
+
+        c.unset("", "browser").unwrap();
+        c.unset("", "prompt").unwrap();
+        c.unset("", "defaults.api_call_status.fields").unwrap();
+        c.unset("example.com", "browser").unwrap();
+
+        assert_eq!(c.get("", "browser").unwrap(), "");
+        assert_eq!(c.get("", "prompt").unwrap(), "enabled");
+        assert!(c.get("", "defaults.api_call_status.fields").is_err());
+        assert!(c.get("example.com", "browser").is_err());
+        assert_eq!(c.get("example.com", "user").unwrap(), "me@example.com");
+
+        assert!(c.unset("nope.com", "browser").is_err());
+    }
+
+    #[test]
+    fn test_file_config_links() {
+        let mut c = new_blank_config().unwrap();
+        assert_eq!(c.links().unwrap(), vec![]);
+
+        c.set("", &link_key("dashboard"), "https://grafana.example.com")
+            .unwrap();
+        c.set("", &link_key("wiki"), "https://wiki.example.com").unwrap();
+        assert_eq!(
+            c.links().unwrap(),
+            vec![
+                ("dashboard".to_string(), "https://grafana.example.com".to_string()),
+                ("wiki".to_string(), "https://wiki.example.com".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_file_config_accounts() {
+        let mut c = new_blank_config().unwrap();
+        c.set("example.com", "token", "personal-token").unwrap();
+        c.set("example.com", "user", "me@home.com").unwrap();
+        assert_eq!(c.accounts("example.com").unwrap(), Vec::<String>::new());
+
+        // Log in with a second account.
+        c.stash_account("example.com").unwrap();
+        c.set("example.com", "token", "work-token").unwrap();
+        c.set("example.com", "user", "me@work.com").unwrap();
+        c.set("example.com", "account", "work").unwrap();
+        assert_eq!(c.accounts("example.com").unwrap(), vec!["me@home.com"]);
+
+        c.switch_account("example.com", "me@home.com").unwrap();
+        assert_eq!(c.get("example.com", "token").unwrap(), "personal-token");
+        assert_eq!(c.get("example.com", "user").unwrap(), "me@home.com");
+        assert_eq!(c.accounts("example.com").unwrap(), vec!["work"]);
+
+        c.switch_account("example.com", "work").unwrap();
+        assert_eq!(c.get("example.com", "token").unwrap(), "work-token");
+        assert_eq!(c.get("example.com", "user").unwrap(), "me@work.com");
+
+        assert_eq!(
+            c.switch_account("example.com", "nope").unwrap_err().to_string(),
+            "no account `nope` for example.com, the accounts are: me@home.com"
+        );
+    }
+
+    #[test]
+    fn test_file_config_reset() {
+        let mut c = new_blank_config().unwrap();
+        c.set("", "browser", "firefox").unwrap();
+        c.set("example.com", "user", "me@example.com").unwrap();
+
+        c.reset().unwrap();
+
+        assert_eq!(c.get("", "browser").unwrap(), "");
+        assert_eq!(c.get("example.com", "user").unwrap(), "me@example.com");
+        assert_eq!(
+            c.config_to_string().unwrap(),
+            new_blank_config().unwrap().config_to_string().unwrap()
+        );
+
+        // Tokens in the keyring stay there.
+        c.set("", "credential_store", "keyring").unwrap();
+        c.reset().unwrap();
+        assert_eq!(c.get("", "credential_store").unwrap(), "keyring");
+    }
+
     #[test]
     fn test_default_config() {
         let c = new_blank_config().unwrap();
@@ -240,7 +540,72 @@ browser = ""
 
 # What formatting kittycad should use when printing text.
 # Supported values: table, json, yaml
-format = "table""#;
+format = "table"
+
+# Where kittycad should store authentication tokens, in the hosts file or the system keyring.
+# Supported values: file, keyring
+credential_store = "file"
+
+# The maximum size in bytes of a raw API response kittycad will read, e.g. in `kittycad api`. If blank, defaults to 32 MiB.
+max_body_size = ""
+
+# How many times kittycad should retry API requests that failed because of rate limits, server or network errors. If blank, defaults to 2.
+retries = ""
+
+# How long a command may run before kittycad aborts it, e.g. "30s" or "2m". If blank, commands never time out.
+timeout = ""
+
+# The maximum number of bytes per second kittycad should upload and download files at, e.g. "500k" or "2M". If blank, there is no limit.
+limit_rate = ""
+
+# How many idle connections to each host kittycad should keep open to reuse. If blank, defaults to 16.
+max_idle_connections = ""
+
+# How long kittycad should keep an idle connection open to reuse, e.g. "30s" or "2m". If blank, defaults to 90s.
+idle_timeout = ""
+
+# Whether kittycad should talk to the API over HTTP/2. If "auto", only when the server offers it.
+# Supported values: auto, enabled, disabled
+http2 = "auto"
+
+# The proxy kittycad should send requests through, e.g. "http://proxy.example.com:3128". If blank, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are respected.
+http_proxy = ""
+
+# The path to a PEM file of certificate authorities kittycad should trust on top of the usual ones, e.g. the one of a proxy that intercepts TLS.
+ca_bundle = ""
+
+# Set to "true" to not verify the certificates of the servers kittycad talks to. Anyone on the network can then read your token, prefer ca_bundle.
+# Supported values: false, true
+insecure_skip_verify = "false"
+
+# A comma separated list of the only hosts kittycad may send requests to, e.g. "api.kittycad.io". If blank, any host is allowed.
+allowed_hosts = ""
+
+# Whether kittycad should print URLs as clickable links. If "auto", only in terminals that support them.
+# Supported values: auto, enabled, disabled
+hyperlinks = "auto"
+
+# Set to "enabled" for plain output that screen readers can follow: no color, and plain progress lines instead of spinners and progress bars.
+# Supported values: disabled, enabled
+accessible_output = "disabled"
+
+# Set to "strict" to show hashes instead of your email, user ID and where your token comes from in command output, e.g. while screen sharing.
+# Supported values: normal, strict
+privacy = "normal"
+
+# The public key the releases kittycad updates to must be signed with. If blank, only their checksum is checked.
+release_public_key = ""
+
+# Which releases kittycad should tell you about and update to. "prerelease" includes release candidates and "nightly" nightly builds too.
+# Supported values: stable, prerelease, nightly
+update_channel = "stable"
+
+# The amount of credit in US dollars below which kittycad warns before commands that spend it, e.g. "5.00". If blank, there is no warning.
+quota_warning = ""
+
+# Whether kittycad counts which commands you run and the kinds of errors they fail with, on this machine. See `kittycad telemetry`.
+# Supported values: enabled, disabled
+telemetry = "disabled""#;
         assert_eq!(doc_config, expected);
 
         let doc_hosts = c.hosts_to_string().unwrap();
@@ -295,7 +660,7 @@ token = "MY_TOKEN""#,
         // Getting the default host should return an error.
         assert_eq!(c.default_host().is_err(), true);
         if let Err(e) = c.default_host() {
-            assert_eq!(e.to_string(), "No host has been set as default. Try setting a default with `kittycad config set -H <host> default true`. Options for hosts are: example.org, thing.com");
+            assert_eq!(e.to_string(), "No host has been set as default. Try setting a default with `kittycad host set-default <host>`. Options for hosts are: example.org, thing.com");
         }
 
         c.set("example.org", "default", "true").unwrap();
@@ -312,6 +677,20 @@ default = true"#;
         assert_eq!(c.hosts_to_string().unwrap(), expected);
     }
 
+    #[test]
+    fn test_add_host() {
+        let mut c = new_blank_config().unwrap();
+        c.set("example.org", "token", "EXAMPLE_TOKEN").unwrap();
+
+        c.add_host("kittycad.internal").unwrap();
+        assert_eq!(c.hosts().unwrap(), vec!["example.org", "kittycad.internal"]);
+        assert!(c.get("kittycad.internal", "token").is_err());
+
+        // Adding it again keeps what it has.
+        c.add_host("example.org").unwrap();
+        assert_eq!(c.get("example.org", "token").unwrap(), "EXAMPLE_TOKEN");
+    }
+
     #[test]
     fn test_validate_key() {
         let result = validate_key("invalid").unwrap_err();
@@ -322,6 +701,21 @@ default = true"#;
 
         let result = validate_key("browser");
         assert!(result.is_ok());
+
+        let result = validate_key("defaults.api_call_status.fields");
+        assert!(result.is_ok());
+
+        let result = validate_key("defaults.file_convert.output_format");
+        assert!(result.is_ok());
+
+        let result = validate_key("defaults.api_call_status.nope").unwrap_err();
+        assert_eq!(result.to_string(), "invalid key: defaults.api_call_status.nope");
+
+        let result = validate_key("links.dashboard");
+        assert!(result.is_ok());
+
+        let result = validate_key("links.").unwrap_err();
+        assert_eq!(result.to_string(), "invalid key: links.");
     }
 
     #[test]
@@ -340,6 +734,19 @@ default = true"#;
 
         let result = validate_value("prompt", "enabled");
         assert!(result.is_ok());
+
+        let result = validate_value("links.dashboard", "https://grafana.example.com/d/kittycad");
+        assert!(result.is_ok());
+
+        let result = validate_value("links.dashboard", "grafana").unwrap_err();
+        assert_eq!(
+            result.to_string(),
+            "invalid link `grafana`, expected an http or https URL"
+        );
+
+        assert!(validate_value("api_version", "v1").is_ok());
+        let result = validate_value("api_version", "1").unwrap_err();
+        assert_eq!(result.to_string(), "invalid API version `1`, expected e.g. v1");
     }
 
     pub struct TestItem {
@@ -473,6 +880,64 @@ default = true"#;
                 want_is_shell: false,
                 want_err: "".to_string(),
             },
+            TestItem {
+                name: "named placeholders".to_string(),
+                args: vec![
+                    "kittycad".to_string(),
+                    "conv".to_string(),
+                    "--format=stl".to_string(),
+                    "--input".to_string(),
+                    "my part.step".to_string(),
+                    "--output-unit".to_string(),
+                    "mm".to_string(),
+                ],
+                want_expanded: vec![
+                    "kittycad".to_string(),
+                    "file".to_string(),
+                    "convert".to_string(),
+                    "my part.step".to_string(),
+                    "--output-format".to_string(),
+                    "stl".to_string(),
+                    "--output-unit".to_string(),
+                    "mm".to_string(),
+                ],
+                want_is_shell: false,
+                want_err: "".to_string(),
+            },
+            TestItem {
+                name: "missing named placeholders".to_string(),
+                args: vec!["kittycad".to_string(), "conv".to_string()],
+                want_expanded: vec![],
+                want_is_shell: false,
+                want_err: "missing --input, --format for alias: file convert $input --output-format $format"
+                    .to_string(),
+            },
+            TestItem {
+                name: "alias of an alias".to_string(),
+                args: vec![
+                    "kittycad".to_string(),
+                    "stl".to_string(),
+                    "--input".to_string(),
+                    "a.step".to_string(),
+                ],
+                want_expanded: vec![
+                    "kittycad".to_string(),
+                    "file".to_string(),
+                    "convert".to_string(),
+                    "a.step".to_string(),
+                    "--output-format".to_string(),
+                    "stl".to_string(),
+                ],
+                want_is_shell: false,
+                want_err: "".to_string(),
+            },
+            TestItem {
+                name: "alias cycle".to_string(),
+                args: vec!["kittycad".to_string(), "ping".to_string()],
+                want_expanded: vec![],
+                want_is_shell: false,
+                want_err: "alias ping expands to itself: ping -> pong -> ping".to_string(),
+            },
         ];
 
         let mut config = crate::config::new_blank_config().unwrap();
@@ -483,6 +948,12 @@ default = true"#;
         aliases.add("cs", "config set").unwrap();
         aliases.add("ca", "config set $1 $2").unwrap();
         aliases.add("ci", "config set $1 $1").unwrap();
+        aliases
+            .add("conv", "file convert $input --output-format $format")
+            .unwrap();
+        aliases.add("stl", "conv --format stl").unwrap();
+        aliases.add("ping", "pong").unwrap();
+        aliases.add("pong", "ping").unwrap();
 
         for t in tests {
             let result = c.expand_alias(t.args);
@@ -105,6 +105,71 @@ browser = ""
 # Supported values: table, json, yaml
 format = "table"
 
+# Where kittycad should store authentication tokens, in the hosts file or the system keyring.
+# Supported values: file, keyring
+credential_store = "file"
+
+# The maximum size in bytes of a raw API response kittycad will read, e.g. in `kittycad api`. If blank, defaults to 32 MiB.
+max_body_size = ""
+
+# How many times kittycad should retry API requests that failed because of rate limits, server or network errors. If blank, defaults to 2.
+retries = ""
+
+# How long a command may run before kittycad aborts it, e.g. "30s" or "2m". If blank, commands never time out.
+timeout = ""
+
+# The maximum number of bytes per second kittycad should upload and download files at, e.g. "500k" or "2M". If blank, there is no limit.
+limit_rate = ""
+
+# How many idle connections to each host kittycad should keep open to reuse. If blank, defaults to 16.
+max_idle_connections = ""
+
+# How long kittycad should keep an idle connection open to reuse, e.g. "30s" or "2m". If blank, defaults to 90s.
+idle_timeout = ""
+
+# Whether kittycad should talk to the API over HTTP/2. If "auto", only when the server offers it.
+# Supported values: auto, enabled, disabled
+http2 = "auto"
+
+# The proxy kittycad should send requests through, e.g. "http://proxy.example.com:3128". If blank, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are respected.
+http_proxy = ""
+
+# The path to a PEM file of certificate authorities kittycad should trust on top of the usual ones, e.g. the one of a proxy that intercepts TLS.
+ca_bundle = ""
+
+# Set to "true" to not verify the certificates of the servers kittycad talks to. Anyone on the network can then read your token, prefer ca_bundle.
+# Supported values: false, true
+insecure_skip_verify = "false"
+
+# A comma separated list of the only hosts kittycad may send requests to, e.g. "api.kittycad.io". If blank, any host is allowed.
+allowed_hosts = ""
+
+# Whether kittycad should print URLs as clickable links. If "auto", only in terminals that support them.
+# Supported values: auto, enabled, disabled
+hyperlinks = "auto"
+
+# Set to "enabled" for plain output that screen readers can follow: no color, and plain progress lines instead of spinners and progress bars.
+# Supported values: disabled, enabled
+accessible_output = "disabled"
+
+# Set to "strict" to show hashes instead of your email, user ID and where your token comes from in command output, e.g. while screen sharing.
+# Supported values: normal, strict
+privacy = "normal"
+
+# The public key the releases kittycad updates to must be signed with. If blank, only their checksum is checked.
+release_public_key = ""
+
+# Which releases kittycad should tell you about and update to. "prerelease" includes release candidates and "nightly" nightly builds too.
+# Supported values: stable, prerelease, nightly
+update_channel = "stable"
+
+# The amount of credit in US dollars below which kittycad warns before commands that spend it, e.g. "5.00". If blank, there is no warning.
+quota_warning = ""
+
+# Whether kittycad counts which commands you run and the kinds of errors they fail with, on this machine. See `kittycad telemetry`.
+# Supported values: enabled, disabled
+telemetry = "disabled"
+
 [aliases]
 alias1 = "value1 thing foo"
 alias2 = "value2 single""#;
@@ -0,0 +1,352 @@
+use std::str::FromStr;
+
+use anyhow::{anyhow, Result};
+use parse_display::{Display, FromStr};
+
+/// The service name we store credentials under in the system keyring.
+const KEYRING_SERVICE: &str = "kittycad";
+
+/// Where the API tokens for each host are stored.
+#[derive(Debug, Clone, PartialEq, Eq, FromStr, Display)]
+#[display(style = "kebab-case")]
+pub enum CredentialStoreKind {
+    /// Store the tokens in plaintext in the hosts file.
+    File,
+    /// Store the tokens in the system keyring (macOS Keychain, Windows Credential Manager,
+    /// libsecret).
+    Keyring,
+}
+
+impl Default for CredentialStoreKind {
+    fn default() -> CredentialStoreKind {
+        CredentialStoreKind::File
+    }
+}
+
+impl CredentialStoreKind {
+    pub fn variants() -> Vec<String> {
+        vec!["file".to_string(), "keyring".to_string()]
+    }
+
+    /// Returns the credential store backend for this kind, if it is not stored inline
+    /// in the hosts file.
+    pub fn store(&self) -> Option<Box<dyn CredentialStore>> {
+        match self {
+            CredentialStoreKind::File => None,
+            // Tests must not touch the keyring of whoever runs them.
+            #[cfg(test)]
+            CredentialStoreKind::Keyring => Some(Box::new(test::MemoryCredentialStore {})),
+            #[cfg(not(test))]
+            CredentialStoreKind::Keyring => Some(Box::new(KeyringCredentialStore {})),
+        }
+    }
+}
+
+/// This trait describes a backend that can hold the token for a host outside of the
+/// hosts file.
+pub trait CredentialStore {
+    /// Returns the token for the host, or none if it is not stored.
+    fn get(&self, hostname: &str) -> Result<Option<String>>;
+    /// Stores the token for the host.
+    fn set(&self, hostname: &str, token: &str) -> Result<()>;
+    /// Removes the token for the host, it is not an error if it does not exist.
+    fn delete(&self, hostname: &str) -> Result<()>;
+    /// A human readable description of where the token lives, used as the config source.
+    fn source(&self) -> String;
+}
+
+/// Stores tokens in the operating system's keyring.
+#[cfg_attr(test, allow(dead_code))]
+pub struct KeyringCredentialStore {}
+
+impl CredentialStore for KeyringCredentialStore {
+    fn get(&self, hostname: &str) -> Result<Option<String>> {
+        crate::keyring::get(KEYRING_SERVICE, hostname)
+            .map_err(|err| anyhow!("failed to read token for {} from keyring: {}", hostname, err))
+    }
+
+    fn set(&self, hostname: &str, token: &str) -> Result<()> {
+        crate::keyring::set(KEYRING_SERVICE, hostname, token)
+            .map_err(|err| anyhow!("failed to write token for {} to keyring: {}", hostname, err))
+    }
+
+    fn delete(&self, hostname: &str) -> Result<()> {
+        crate::keyring::delete(KEYRING_SERVICE, hostname)
+            .map_err(|err| anyhow!("failed to delete token for {} from keyring: {}", hostname, err))
+    }
+
+    fn source(&self) -> String {
+        "keyring".to_string()
+    }
+}
+
+/// The tokens for every host, and for the accounts put aside for it.
+struct Tokens {
+    hosts: Vec<(String, String)>,
+    accounts: Vec<(String, String, String, String)>,
+}
+
+impl Tokens {
+    /// The keys the tokens are stored under in a credential store.
+    fn keys(&self) -> Vec<String> {
+        let hosts = self.hosts.iter().map(|(host, _)| host.to_string());
+        let accounts = self
+            .accounts
+            .iter()
+            .map(|(host, account, _, _)| crate::config_from_file::account_store_key(host, account));
+        hosts.chain(accounts).collect()
+    }
+}
+
+/// Tokens that were moved to another credential store, and are still in the one they
+/// were moved out of.
+#[derive(Default)]
+#[must_use = "the tokens stay in the old credential store until `finish` is called"]
+pub struct Migration {
+    store: Option<Box<dyn CredentialStore>>,
+    keys: Vec<String>,
+}
+
+impl Migration {
+    /// Remove the tokens from the store they were moved out of. Call this once the
+    /// configuration that points at the new store is written, so a failure in between
+    /// can't lose them.
+    pub fn finish(self) -> Result<()> {
+        if let Some(store) = self.store {
+            for key in self.keys {
+                store.delete(&key)?;
+            }
+        }
+
+        Ok(())
+    }
+}
+
+/// Move the tokens for every host, and for the accounts put aside for it, from the
+/// currently configured credential store to the given one, and switch the configuration
+/// over to it.
+///
+/// Tokens that come from the environment are left alone, since they were never stored.
+/// If moving any of the tokens fails, the configuration is put back the way it was.
+pub fn migrate(config: &mut dyn crate::config::Config, to: &CredentialStoreKind) -> Result<Migration> {
+    let from = match config.get("", "credential_store") {
+        Ok(value) => CredentialStoreKind::from_str(&value).unwrap_or_default(),
+        Err(_) => CredentialStoreKind::default(),
+    };
+
+    // Read all the tokens out of the old store before we switch.
+    let mut tokens = Tokens {
+        hosts: Vec::new(),
+        accounts: Vec::new(),
+    };
+    for host in config.hosts()? {
+        for account in config.accounts(&host)? {
+            let (user, token) = config.get_account(&host, &account)?;
+            tokens.accounts.push((host.to_string(), account, user, token));
+        }
+
+        if let Ok((token, source)) = config.get_with_source(&host, "token") {
+            if token.is_empty() || source.starts_with("KITTYCAD_") {
+                continue;
+            }
+
+            tokens.hosts.push((host, token));
+        }
+    }
+
+    if from == *to {
+        config.set("", "credential_store", &to.to_string())?;
+        return Ok(Migration::default());
+    }
+
+    if let Err(err) = put(config, to, &tokens) {
+        // Put everything back where it was, and don't leave copies behind.
+        put(config, &from, &tokens)?;
+        if let Some(store) = to.store() {
+            for key in tokens.keys() {
+                let _ = store.delete(&key);
+            }
+        }
+
+        return Err(err);
+    }
+
+    Ok(Migration {
+        store: from.store(),
+        keys: tokens.keys(),
+    })
+}
+
+/// Switch the configuration to the given credential store, and write the tokens into it.
+fn put(config: &mut dyn crate::config::Config, kind: &CredentialStoreKind, tokens: &Tokens) -> Result<()> {
+    config.set("", "credential_store", &kind.to_string())?;
+
+    for (host, token) in &tokens.hosts {
+        // This will write the token into the new store.
+        config.set(host, "token", token)?;
+    }
+
+    for (host, account, user, token) in &tokens.accounts {
+        // This will write the token into the new store too.
+        config.add_account(host, account, user, token)?;
+    }
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod test {
+    use std::{cell::RefCell, collections::BTreeMap};
+
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+    use crate::config::Config;
+
+    thread_local! {
+        // Each test runs on its own thread, so gets its own keyring.
+        static KEYRING: RefCell<BTreeMap<String, String>> = RefCell::new(BTreeMap::new());
+        static BROKEN: RefCell<Vec<String>> = RefCell::new(Vec::new());
+    }
+
+    /// Stands in for the system keyring in tests, it refuses to store the keys in `BROKEN`.
+    pub struct MemoryCredentialStore {}
+
+    impl CredentialStore for MemoryCredentialStore {
+        fn get(&self, hostname: &str) -> Result<Option<String>> {
+            Ok(KEYRING.with(|k| k.borrow().get(hostname).cloned()))
+        }
+
+        fn set(&self, hostname: &str, token: &str) -> Result<()> {
+            if BROKEN.with(|b| b.borrow().iter().any(|key| key == hostname)) {
+                anyhow::bail!("failed to write token for {} to keyring", hostname);
+            }
+
+            KEYRING.with(|k| k.borrow_mut().insert(hostname.to_string(), token.to_string()));
+            Ok(())
+        }
+
+        fn delete(&self, hostname: &str) -> Result<()> {
+            KEYRING.with(|k| k.borrow_mut().remove(hostname));
+            Ok(())
+        }
+
+        fn source(&self) -> String {
+            "keyring".to_string()
+        }
+    }
+
+    fn keyring() -> BTreeMap<String, String> {
+        KEYRING.with(|k| k.borrow().clone())
+    }
+
+    #[test]
+    fn test_credential_store_kind() {
+        assert_eq!(CredentialStoreKind::default(), CredentialStoreKind::File);
+        assert_eq!(
+            CredentialStoreKind::from_str("keyring").unwrap(),
+            CredentialStoreKind::Keyring
+        );
+        assert!(CredentialStoreKind::from_str("vault").is_err());
+
+        assert!(CredentialStoreKind::File.store().is_none());
+        assert_eq!(CredentialStoreKind::Keyring.store().unwrap().source(), "keyring");
+    }
+
+    #[test]
+    fn test_migrate_to_file() {
+        let mut c = crate::config::new_blank_config().unwrap();
+        c.set("example.com", "token", "MY_TOKEN").unwrap();
+        c.add_account("example.com", "work", "me@work.com", "WORK_TOKEN")
+            .unwrap();
+
+        migrate(&mut c, &CredentialStoreKind::File).unwrap().finish().unwrap();
+
+        assert_eq!(c.get("", "credential_store").unwrap(), "file");
+        assert_eq!(c.get("example.com", "token").unwrap(), "MY_TOKEN");
+        assert!(c.hosts_to_string().unwrap().contains("token = \"MY_TOKEN\""));
+        assert_eq!(
+            c.get_account("example.com", "work").unwrap(),
+            ("me@work.com".to_string(), "WORK_TOKEN".to_string())
+        );
+    }
+
+    #[test]
+    fn test_migrate_to_keyring() {
+        let mut c = crate::config::new_blank_config().unwrap();
+        c.set("example.com", "token", "MY_TOKEN").unwrap();
+        c.add_account("example.com", "work", "me@work.com", "WORK_TOKEN")
+            .unwrap();
+
+        migrate(&mut c, &CredentialStoreKind::Keyring)
+            .unwrap()
+            .finish()
+            .unwrap();
+
+        assert_eq!(c.get("", "credential_store").unwrap(), "keyring");
+        assert_eq!(
+            c.get_with_source("example.com", "token").unwrap(),
+            ("MY_TOKEN".to_string(), "keyring".to_string())
+        );
+        assert_eq!(
+            c.get_account("example.com", "work").unwrap(),
+            ("me@work.com".to_string(), "WORK_TOKEN".to_string())
+        );
+        assert!(!c.hosts_to_string().unwrap().contains("TOKEN"));
+        assert_eq!(
+            keyring(),
+            BTreeMap::from([
+                ("example.com".to_string(), "MY_TOKEN".to_string()),
+                (
+                    crate::config_from_file::account_store_key("example.com", "work"),
+                    "WORK_TOKEN".to_string()
+                ),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_migrate_from_keyring() {
+        let mut c = crate::config::new_blank_config().unwrap();
+        c.set("", "credential_store", "keyring").unwrap();
+        c.set("example.com", "token", "MY_TOKEN").unwrap();
+        c.add_account("example.com", "work", "me@work.com", "WORK_TOKEN")
+            .unwrap();
+        assert!(!c.hosts_to_string().unwrap().contains("TOKEN"));
+
+        let migration = migrate(&mut c, &CredentialStoreKind::File).unwrap();
+
+        assert_eq!(c.get("", "credential_store").unwrap(), "file");
+        assert!(c.hosts_to_string().unwrap().contains("token = \"MY_TOKEN\""));
+        assert!(c.hosts_to_string().unwrap().contains("token = \"WORK_TOKEN\""));
+
+        // The keyring keeps the tokens until the new configuration is written.
+        assert_eq!(keyring().len(), 2);
+        migration.finish().unwrap();
+        assert!(keyring().is_empty());
+
+        assert_eq!(c.get("example.com", "token").unwrap(), "MY_TOKEN");
+        assert_eq!(
+            c.get_account("example.com", "work").unwrap(),
+            ("me@work.com".to_string(), "WORK_TOKEN".to_string())
+        );
+    }
+
+    #[test]
+    fn test_migrate_failed() {
+        let mut c = crate::config::new_blank_config().unwrap();
+        c.set("a.example.com", "token", "A_TOKEN").unwrap();
+        c.set("b.example.com", "token", "B_TOKEN").unwrap();
+        BROKEN.with(|b| b.borrow_mut().push("b.example.com".to_string()));
+
+        let err = migrate(&mut c, &CredentialStoreKind::Keyring).err().unwrap();
+
+        assert_eq!(err.to_string(), "failed to write token for b.example.com to keyring");
+        assert_eq!(c.get("", "credential_store").unwrap(), "file");
+        assert!(c.hosts_to_string().unwrap().contains("token = \"A_TOKEN\""));
+        assert!(c.hosts_to_string().unwrap().contains("token = \"B_TOKEN\""));
+        assert_eq!(c.get("a.example.com", "token").unwrap(), "A_TOKEN");
+        assert_eq!(c.get("b.example.com", "token").unwrap(), "B_TOKEN");
+        assert!(keyring().is_empty());
+    }
+}
@@ -0,0 +1,471 @@
+use anyhow::{anyhow, Result};
+
+/// The keys of a host that `kittycad auth` manages, besides the ones `kittycad config`
+/// knows about.
+const AUTH_HOST_KEYS: &[&str] = &["accounts"];
+
+/// A problem found in a configuration file by `kittycad config doctor`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Problem {
+    /// The file the problem is in.
+    pub file: String,
+    /// The path to the key the problem is with, e.g. `["api.kittycad.io", "token"]`, empty
+    /// for the whole file.
+    pub key: Vec<String>,
+    pub message: String,
+    /// How `--fix` fixes it, if it can.
+    pub fix: Option<Fix>,
+}
+
+impl Problem {
+    fn new(file: &str, key: &[&str], message: &str, fix: Option<Fix>) -> Problem {
+        Problem {
+            file: file.to_string(),
+            key: key.iter().map(|k| k.to_string()).collect(),
+            message: message.to_string(),
+            fix,
+        }
+    }
+}
+
+impl std::fmt::Display for Problem {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        if self.key.is_empty() {
+            write!(f, "{}: {}", self.file, self.message)
+        } else {
+            write!(f, "{}: {}: {}", self.file, self.key.join("."), self.message)
+        }
+    }
+}
+
+/// How a problem is fixed.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum Fix {
+    /// Remove the key.
+    Remove,
+    /// Set the key to a string.
+    Set(String),
+    /// Move the host's token out of the hosts file into the credential store.
+    MoveToken,
+    /// Make the file readable and writable only by us.
+    MakePrivate,
+}
+
+impl std::fmt::Display for Fix {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Fix::Remove => write!(f, "remove it"),
+            Fix::Set(value) => write!(f, "set it to {:?}", value),
+            Fix::MoveToken => write!(f, "move it to the credential store"),
+            Fix::MakePrivate => write!(f, "make it readable only by you"),
+        }
+    }
+}
+
+/// Parse a configuration file, an unparsable file is a problem of its own.
+pub fn parse(file: &str, content: &str) -> std::result::Result<toml_edit::Document, Problem> {
+    content
+        .parse::<toml_edit::Document>()
+        .map_err(|err| Problem::new(file, &[], &format!("invalid TOML: {}", err), None))
+}
+
+/// Check the settings and aliases in the config file.
+pub fn check_config(file: &str, doc: &toml_edit::Document) -> Vec<Problem> {
+    let mut problems = vec![];
+
+    for (key, item) in doc.iter() {
+        if key == "aliases" {
+            match item.as_table() {
+                Some(aliases) => {
+                    for (alias, expansion) in aliases.iter() {
+                        if expansion.as_str().is_none() {
+                            problems.push(Problem::new(
+                                file,
+                                &[key, alias],
+                                "the expansion of an alias must be a string",
+                                Some(Fix::Remove),
+                            ));
+                        }
+                    }
+                }
+                None => problems.push(Problem::new(file, &[key], "aliases must be a table", None)),
+            }
+            continue;
+        }
+
+        if crate::config::validate_key(key).is_err() {
+            problems.push(Problem::new(file, &[key], "unknown key", Some(Fix::Remove)));
+            continue;
+        }
+
+        let default_value = crate::config::config_options()
+            .into_iter()
+            .find(|o| o.key == key)
+            .map(|o| o.default_value);
+        let reset = match &default_value {
+            Some(default_value) => Fix::Set(default_value.to_string()),
+            None => Fix::Remove,
+        };
+        let value = match item.as_str() {
+            Some(value) => value,
+            None => {
+                problems.push(Problem::new(file, &[key], "expected a string", Some(reset)));
+                continue;
+            }
+        };
+        // A blank option is left at its default.
+        if value.is_empty() && default_value.is_some() {
+            continue;
+        }
+        if let Err(err) = crate::config::validate_value(key, value) {
+            problems.push(Problem::new(file, &[key], &err.to_string(), Some(reset)));
+        }
+    }
+
+    problems
+}
+
+/// Check the hosts in the hosts file: their keys and values, hosts that are listed twice,
+/// and tokens that are missing or left behind. Tokens are looked up in the credential
+/// store if one is used.
+pub fn check_hosts(
+    file: &str,
+    doc: &toml_edit::Document,
+    store: Option<&dyn crate::config_credentials::CredentialStore>,
+) -> Vec<Problem> {
+    let mut problems = vec![];
+    let mut seen: Vec<(String, String)> = vec![];
+    let mut defaults = vec![];
+
+    for (host, item) in doc.iter() {
+        let table = match item.as_table() {
+            Some(table) => table,
+            None => {
+                problems.push(Problem::new(file, &[host], "a host must be a table", Some(Fix::Remove)));
+                continue;
+            }
+        };
+
+        // `api.kittycad.io` and `https://api.kittycad.io/` are the same host.
+        let normalized = match crate::cmd_auth::parse_host(host) {
+            Ok(url) => format!(
+                "{}{}",
+                url.host_str().unwrap_or_default(),
+                url.port().map(|p| format!(":{}", p)).unwrap_or_default()
+            ),
+            Err(err) => {
+                problems.push(Problem::new(file, &[host], &format!("invalid host: {}", err), None));
+                continue;
+            }
+        };
+        match seen.iter().find(|(n, _)| *n == normalized) {
+            Some((_, other)) => problems.push(Problem::new(
+                file,
+                &[host],
+                &format!(
+                    "same host as {}, log out of one with `kittycad auth logout -H <host>`",
+                    other
+                ),
+                None,
+            )),
+            None => seen.push((normalized, host.to_string())),
+        }
+
+        for (key, value) in table.iter() {
+            let problem = match key {
+                "default" => match value.as_bool() {
+                    Some(true) => {
+                        defaults.push(host.to_string());
+                        None
+                    }
+                    Some(false) => None,
+                    None => Some(("expected true or false".to_string(), Some(Fix::Remove))),
+                },
+                "accounts" if !value.is_table() => Some(("accounts must be a table".to_string(), None)),
+                "accounts" => None,
+                "token" => match value.as_str() {
+                    Some("") => Some(("the token is empty".to_string(), Some(Fix::Remove))),
+                    Some(_) if store.is_some() => Some((
+                        format!(
+                            "a plaintext token is left in the hosts file, but tokens are kept in the {}",
+                            store.map(|s| s.source()).unwrap_or_default()
+                        ),
+                        Some(Fix::MoveToken),
+                    )),
+                    Some(_) => None,
+                    None => Some(("expected a string".to_string(), Some(Fix::Remove))),
+                },
+                _ if crate::cmd_config::HOST_KEYS.contains(&key)
+                    || AUTH_HOST_KEYS.contains(&key)
+                    || crate::config::validate_key(key).is_ok() =>
+                {
+                    match value.as_str() {
+                        Some(value) => crate::config::validate_value(key, value)
+                            .err()
+                            .map(|err| (err.to_string(), Some(Fix::Remove))),
+                        None => Some(("expected a string".to_string(), Some(Fix::Remove))),
+                    }
+                }
+                _ => Some(("unknown key".to_string(), Some(Fix::Remove))),
+            };
+            if let Some((message, fix)) = problem {
+                problems.push(Problem::new(file, &[host, key], &message, fix));
+            }
+        }
+
+        let has_token = table.get("token").and_then(|t| t.as_str()).is_some()
+            || store.map(|s| matches!(s.get(host), Ok(Some(_)))).unwrap_or(false);
+        let accounts = table.get("accounts").and_then(|a| a.as_table());
+        if !has_token && accounts.map(|a| a.is_empty()).unwrap_or(true) {
+            problems.push(Problem::new(
+                file,
+                &[host],
+                &format!("no token, log in with `kittycad auth login -H {}`", host),
+                None,
+            ));
+        }
+
+        for (account, stashed) in accounts.map(|a| a.iter().collect::<Vec<_>>()).unwrap_or_default() {
+            let has_token = match store {
+                Some(store) => matches!(
+                    store.get(&crate::config_from_file::account_store_key(host, account)),
+                    Ok(Some(_))
+                ),
+                None => stashed.get("token").and_then(|t| t.as_str()).is_some(),
+            };
+            if !has_token {
+                problems.push(Problem::new(
+                    file,
+                    &[host, "accounts", account],
+                    "the account has no token left to switch to",
+                    Some(Fix::Remove),
+                ));
+            }
+        }
+    }
+
+    if defaults.len() > 1 {
+        problems.push(Problem::new(
+            file,
+            &[],
+            &format!(
+                "{} are all set as the default host, only one can be",
+                defaults.join(", ")
+            ),
+            None,
+        ));
+    }
+
+    problems
+}
+
+/// Check that other users can't read the file if it holds secrets, or change it.
+#[cfg(unix)]
+pub fn check_permissions(file: &str, secret: bool) -> Option<Problem> {
+    use std::os::unix::fs::PermissionsExt;
+
+    let mode = std::fs::metadata(file).ok()?.permissions().mode();
+    let message = if secret && mode & 0o044 != 0 {
+        "other users can read it, and it has your tokens"
+    } else if mode & 0o022 != 0 {
+        "other users can change it"
+    } else {
+        return None;
+    };
+
+    Some(Problem::new(file, &[], message, Some(Fix::MakePrivate)))
+}
+
+/// Check that other users can't read the file if it holds secrets, or change it.
+#[cfg(not(unix))]
+pub fn check_permissions(_file: &str, _secret: bool) -> Option<Problem> {
+    None
+}
+
+/// Fix a problem in the parsed file, the file itself only for its permissions.
+pub fn fix(
+    doc: &mut toml_edit::Document,
+    problem: &Problem,
+    store: Option<&dyn crate::config_credentials::CredentialStore>,
+) -> Result<()> {
+    match &problem.fix {
+        None => Err(anyhow!("{} can't be fixed automatically", problem)),
+        Some(Fix::MakePrivate) => make_private(&problem.file),
+        Some(fix) => {
+            let (key, parents) = problem
+                .key
+                .split_last()
+                .ok_or_else(|| anyhow!("{} can't be fixed automatically", problem))?;
+            let mut table = doc.as_table_mut();
+            for parent in parents {
+                table = table
+                    .get_mut(parent)
+                    .and_then(|item| item.as_table_mut())
+                    .ok_or_else(|| anyhow!("{} is not a table", parent))?;
+            }
+
+            match fix {
+                Fix::Remove => {
+                    table.remove(key);
+                }
+                Fix::Set(value) => {
+                    // Replace the value in place, so the comments above it stay.
+                    table[key.as_str()] = toml_edit::value(value.to_string());
+                }
+                Fix::MoveToken => {
+                    let store = store.ok_or_else(|| anyhow!("no credential store to move the token to"))?;
+                    let token = table.get(key).and_then(|t| t.as_str()).unwrap_or_default();
+                    store.set(&parents.join("."), token)?;
+                    table.remove(key);
+                }
+                Fix::MakePrivate => unreachable!(),
+            }
+
+            Ok(())
+        }
+    }
+}
+
+/// Make a file only we can read.
+#[cfg(unix)]
+fn make_private(path: &str) -> Result<()> {
+    use std::os::unix::fs::PermissionsExt;
+
+    std::fs::set_permissions(path, std::fs::Permissions::from_mode(0o600))
+        .map_err(|err| anyhow!("failed to set the permissions of {}: {}", path, err))
+}
+
+/// Make a file only we can read.
+#[cfg(not(unix))]
+fn make_private(_path: &str) -> Result<()> {
+    Ok(())
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    fn messages(problems: &[Problem]) -> Vec<String> {
+        problems.iter().map(|p| p.to_string()).collect()
+    }
+
+    #[test]
+    fn test_check_config() {
+        let doc = parse(
+            "config.toml",
+            r#"prompt = "sometimes"
+pager = "less"
+retries = 3
+colour = "always"
+"defaults.file_convert.output_format" = "obj"
+"links.dashboard" = "ftp://example.com"
+telemetry = ""
+
+[aliases]
+cs = "config set"
+bad = 1
+"#,
+        )
+        .unwrap();
+
+        let problems = check_config("config.toml", &doc);
+        assert_eq!(
+            messages(&problems),
+            vec![
+                r#"config.toml: prompt: invalid values, valid values: ["enabled", "disabled"]"#,
+                "config.toml: retries: expected a string",
+                "config.toml: colour: unknown key",
+                "config.toml: links.dashboard: invalid link `ftp://example.com`, expected an http or https URL",
+                "config.toml: aliases.bad: the expansion of an alias must be a string",
+            ]
+        );
+        assert_eq!(problems[0].fix, Some(Fix::Set("enabled".to_string())));
+        assert_eq!(problems[2].fix, Some(Fix::Remove));
+        assert_eq!(problems[3].key, vec!["links.dashboard"]);
+    }
+
+    #[test]
+    fn test_check_hosts() {
+        let doc = parse(
+            "hosts.toml",
+            r#"["api.kittycad.io"]
+token = "abc"
+user = "me@example.com"
+default = true
+color = "red"
+
+["https://api.kittycad.io/"]
+token = "def"
+default = true
+
+["kittycad.internal"]
+default = "yes"
+
+["kittycad.internal".accounts.work]
+user = "work@example.com"
+"#,
+        )
+        .unwrap();
+
+        assert_eq!(
+            messages(&check_hosts("hosts.toml", &doc, None)),
+            vec![
+                "hosts.toml: api.kittycad.io.color: unknown key",
+                "hosts.toml: https://api.kittycad.io/: same host as api.kittycad.io, log out of one with `kittycad auth logout -H <host>`",
+                "hosts.toml: kittycad.internal.default: expected true or false",
+                "hosts.toml: kittycad.internal.accounts.work: the account has no token left to switch to",
+                "hosts.toml: api.kittycad.io, https://api.kittycad.io/ are all set as the default host, only one can be",
+            ]
+        );
+    }
+
+    #[test]
+    fn test_fix() {
+        let mut doc = parse(
+            "config.toml",
+            r#"# Keep your comments.
+prompt = "sometimes"
+colour = "always"
+
+[aliases]
+bad = 1
+"#,
+        )
+        .unwrap();
+
+        for problem in check_config("config.toml", &doc) {
+            fix(&mut doc, &problem, None).unwrap();
+        }
+        assert!(check_config("config.toml", &doc).is_empty());
+        assert_eq!(
+            doc.to_string(),
+            r#"# Keep your comments.
+prompt = "enabled"
+
+[aliases]
+"#
+        );
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_check_permissions() {
+        use std::os::unix::fs::PermissionsExt;
+
+        let dir = tempfile::tempdir().unwrap();
+        let file = dir.path().join("hosts.toml");
+        std::fs::write(&file, "").unwrap();
+        let file = file.to_str().unwrap();
+
+        std::fs::set_permissions(file, std::fs::Permissions::from_mode(0o644)).unwrap();
+        assert!(check_permissions(file, false).is_none());
+        let problem = check_permissions(file, true).unwrap();
+        assert_eq!(problem.message, "other users can read it, and it has your tokens");
+
+        let mut doc = toml_edit::Document::new();
+        fix(&mut doc, &problem, None).unwrap();
+        assert!(check_permissions(file, true).is_none());
+    }
+}
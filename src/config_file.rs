@@ -86,7 +86,6 @@ pub fn state_dir() -> Result<String> {
 // 2. XDG_DATA_HOME
 // 3. LocalCommandData (windows only)
 // 4. HOME
-#[allow(dead_code)]
 pub fn data_dir() -> Result<String> {
     let path: PathBuf;
 
@@ -148,7 +147,56 @@ pub fn state_file() -> Result<String> {
     }
 }
 
-pub fn parse_default_config() -> Result<impl crate::config::Config> {
+/// Returns the path of the file or directory with the given name in a directory.
+fn path_in(dir: &str, name: &str) -> Result<String> {
+    let path = Path::new(dir).join(name);
+
+    // Convert the path into a string slice
+    match path.to_str() {
+        None => Err(anyhow!("path is not a valid UTF-8 sequence")),
+        Some(s) => Ok(s.to_string()),
+    }
+}
+
+pub fn privacy_salt_file() -> Result<String> {
+    path_in(&state_dir()?, "privacy_salt")
+}
+
+pub fn history_file() -> Result<String> {
+    path_in(&state_dir()?, "history.toml")
+}
+
+pub fn deprecations_file() -> Result<String> {
+    path_in(&state_dir()?, "deprecations.toml")
+}
+
+pub fn telemetry_file() -> Result<String> {
+    path_in(&state_dir()?, "telemetry.json")
+}
+
+pub fn presets_dir() -> Result<String> {
+    path_in(&config_dir()?, "presets")
+}
+
+pub fn signing_key_file() -> Result<String> {
+    path_in(&config_dir()?, "signing.key")
+}
+
+pub fn failures_dir() -> Result<String> {
+    path_in(&state_dir()?, "failures")
+}
+
+pub fn cache_dir() -> Result<String> {
+    path_in(&data_dir()?, "cache")
+}
+
+pub fn sync_dir() -> Result<String> {
+    path_in(&data_dir()?, "sync")
+}
+
+/// Parse the config and hosts files. With `lenient`, a file that isn't valid TOML is read
+/// as if it didn't exist, so `kittycad config doctor` can still run and report it.
+pub fn parse_default_config(lenient: bool) -> Result<impl crate::config::Config> {
     let config_file_path = config_file()?;
 
     // If the config file does not exist, create it.
@@ -159,7 +207,11 @@ pub fn parse_default_config() -> Result<impl crate::config::Config> {
     } else {
         // Get the default config from the file.
         let contents = read_config_file(&config_file_path)?;
-        contents.parse::<toml_edit::Document>()?
+        match contents.parse::<toml_edit::Document>() {
+            Ok(doc) => doc,
+            Err(_) if lenient => crate::config::new_blank_root()?,
+            Err(err) => return Err(anyhow::anyhow!("failed to parse {}: {}", config_file_path, err)),
+        }
     };
 
     // Parse the hosts file.
@@ -167,9 +219,14 @@ pub fn parse_default_config() -> Result<impl crate::config::Config> {
     let path = Path::new(&hosts_file_path);
     if path.exists() {
         let contents = read_config_file(&hosts_file_path)?;
-        let doc = contents.parse::<toml_edit::Document>()?;
-        let hosts = doc.as_table().clone();
-        root.insert("hosts", toml_edit::Item::Table(hosts));
+        match contents.parse::<toml_edit::Document>() {
+            Ok(doc) => {
+                let hosts = doc.as_table().clone();
+                root.insert("hosts", toml_edit::Item::Table(hosts));
+            }
+            Err(_) if lenient => {}
+            Err(err) => return Err(anyhow::anyhow!("failed to parse {}: {}", hosts_file_path, err)),
+        }
     }
 
     Ok(crate::config::new_config(root))
@@ -189,9 +246,48 @@ pub fn write_config_file(filename: &str, data: &str) -> Result<()> {
         .with_context(|| format!("failed to write to {}", filename))
 }
 
-#[allow(dead_code)]
-fn backup_config_file(filename: String) -> Result<()> {
-    fs::rename(&filename, &format!("{}.bak", filename)).with_context(|| format!("failed to backup {}", filename))
+/// The number of backups of a config file we keep, older ones are removed.
+const MAX_BACKUPS: usize = 10;
+
+/// Copy a config file to a backup named after the time, e.g. `hosts.toml.20220701T120000.bak`,
+/// and return the path of the backup. Nothing is backed up if the file doesn't exist yet.
+pub fn backup_config_file(filename: &str) -> Result<Option<String>> {
+    if !Path::new(filename).exists() {
+        return Ok(None);
+    }
+
+    let backup = format!("{}.{}.bak", filename, chrono::Utc::now().format("%Y%m%dT%H%M%S"));
+    fs::copy(filename, &backup).with_context(|| format!("failed to backup {}", filename))?;
+    prune_backups(filename)?;
+
+    Ok(Some(backup))
+}
+
+/// Remove all but the newest backups of a config file.
+fn prune_backups(filename: &str) -> Result<()> {
+    let path = Path::new(filename);
+    let (dir, name) = match (path.parent(), path.file_name().and_then(|n| n.to_str())) {
+        (Some(dir), Some(name)) => (dir, name),
+        _ => return Ok(()),
+    };
+
+    let prefix = format!("{}.", name);
+    let mut backups: Vec<PathBuf> = fs::read_dir(dir)?
+        .filter_map(|entry| entry.ok().map(|e| e.path()))
+        .filter(|p| {
+            let file_name = p.file_name().and_then(|n| n.to_str()).unwrap_or_default();
+            file_name.starts_with(&prefix) && file_name.ends_with(".bak")
+        })
+        .collect();
+    // The names sort by the time they were made.
+    backups.sort();
+
+    let excess = backups.len().saturating_sub(MAX_BACKUPS);
+    for backup in &backups[..excess] {
+        fs::remove_file(backup).with_context(|| format!("failed to remove {}", backup.display()))?;
+    }
+
+    Ok(())
 }
 
 pub fn get_env_var(key: &str) -> String {
@@ -200,3 +296,33 @@ pub fn get_env_var(key: &str) -> String {
         Err(_) => "".to_string(),
     }
 }
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_backup_config_file() {
+        let dir = tempfile::tempdir().unwrap();
+        let hosts = dir.path().join("hosts.toml");
+        let hosts = hosts.to_str().unwrap();
+
+        assert!(backup_config_file(hosts).unwrap().is_none());
+
+        fs::write(hosts, "[example.org]\n").unwrap();
+        for i in 0..MAX_BACKUPS + 2 {
+            fs::write(format!("{}.20220701T1200{:02}.bak", hosts, i), "").unwrap();
+        }
+
+        let backup = backup_config_file(hosts).unwrap().unwrap();
+        assert_eq!(fs::read_to_string(&backup).unwrap(), "[example.org]\n");
+
+        let backups = fs::read_dir(dir.path())
+            .unwrap()
+            .filter(|e| e.as_ref().unwrap().path().to_str().unwrap().ends_with(".bak"))
+            .count();
+        assert_eq!(backups, MAX_BACKUPS);
+        assert!(!Path::new(&format!("{}.20220701T120000.bak", hosts)).exists());
+        assert!(Path::new(&backup).exists());
+    }
+}
@@ -18,6 +18,31 @@ impl EnvConfig<'_> {
     }
 }
 
+/// Returns the environment variable that overrides a key, e.g. `KITTYCAD_PROMPT` for
+/// `prompt`, or None if the key can't be set from the environment.
+pub fn env_var(key: &str) -> Option<String> {
+    if key == "token" {
+        return Some(KITTYCAD_TOKEN.to_string());
+    }
+
+    if key.starts_with("defaults.") || crate::config::config_options().iter().any(|o| o.key == key) {
+        return Some(format!("KITTYCAD_{}", heck::AsShoutySnakeCase(key)));
+    }
+
+    None
+}
+
+/// Returns the environment variable overriding a key and its value, if it is set.
+fn env_override(key: &str) -> Option<(String, String)> {
+    let var = env_var(key)?;
+    let val = get_env_var(&var);
+    if val.is_empty() {
+        return None;
+    }
+
+    Some((val, var))
+}
+
 #[derive(Error, Debug)]
 pub enum ReadOnlyEnvVarError {
     #[error("read-only value in: {0}")]
@@ -34,18 +59,8 @@ impl crate::config::Config for EnvConfig<'_> {
     }
 
     fn get_with_source(&self, hostname: &str, key: &str) -> Result<(String, String)> {
-        // If they are asking specifically for the token, return the value.
-        if key == "token" {
-            let token = get_env_var(KITTYCAD_TOKEN);
-            if !token.is_empty() {
-                return Ok((token, KITTYCAD_TOKEN.to_string()));
-            }
-        } else {
-            let var = format!("KITTYCAD_{}", heck::AsShoutySnakeCase(key));
-            let val = get_env_var(&var);
-            if !val.is_empty() {
-                return Ok((val, var));
-            }
+        if let Some(value) = env_override(key) {
+            return Ok(value);
         }
 
         self.config.get_with_source(hostname, key)
@@ -55,14 +70,54 @@ impl crate::config::Config for EnvConfig<'_> {
         self.config.set(hostname, key, value)
     }
 
+    fn unset(&mut self, hostname: &str, key: &str) -> Result<()> {
+        self.config.unset(hostname, key)
+    }
+
+    fn reset(&mut self) -> Result<()> {
+        self.config.reset()
+    }
+
     fn unset_host(&mut self, key: &str) -> Result<()> {
         self.config.unset_host(key)
     }
 
+    fn add_host(&mut self, hostname: &str) -> Result<()> {
+        self.config.add_host(hostname)
+    }
+
+    fn accounts(&self, hostname: &str) -> Result<Vec<String>> {
+        self.config.accounts(hostname)
+    }
+
+    fn stash_account(&mut self, hostname: &str) -> Result<()> {
+        self.config.stash_account(hostname)
+    }
+
+    fn switch_account(&mut self, hostname: &str, account: &str) -> Result<()> {
+        self.config.switch_account(hostname, account)
+    }
+
+    fn get_account(&self, hostname: &str, account: &str) -> Result<(String, String)> {
+        self.config.get_account(hostname, account)
+    }
+
+    fn add_account(&mut self, hostname: &str, account: &str, user: &str, token: &str) -> Result<()> {
+        self.config.add_account(hostname, account, user, token)
+    }
+
     fn hosts(&self) -> Result<Vec<String>> {
         self.config.hosts()
     }
 
+    fn links(&self) -> Result<Vec<(String, String)>> {
+        self.config.links()
+    }
+
+    fn command_defaults(&self) -> Result<Vec<(String, String)>> {
+        self.config.command_defaults()
+    }
+
     fn default_host(&self) -> Result<String> {
         let (host, _) = self.default_host_with_source()?;
         Ok(host)
@@ -89,12 +144,8 @@ impl crate::config::Config for EnvConfig<'_> {
     }
 
     fn check_writable(&self, hostname: &str, key: &str) -> Result<()> {
-        // If they are asking specifically for the token, return the value.
-        if key == "token" {
-            let token = get_env_var(KITTYCAD_TOKEN);
-            if !token.is_empty() {
-                return Err(ReadOnlyEnvVarError::Variable(KITTYCAD_TOKEN.to_string()).into());
-            }
+        if let Some((_, var)) = env_override(key) {
+            return Err(ReadOnlyEnvVarError::Variable(var).into());
         }
 
         self.config.check_writable(hostname, key)
@@ -112,3 +163,23 @@ impl crate::config::Config for EnvConfig<'_> {
         self.config.hosts_to_string()
     }
 }
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_env_var() {
+        assert_eq!(env_var("token"), Some("KITTYCAD_TOKEN".to_string()));
+        assert_eq!(env_var("prompt"), Some("KITTYCAD_PROMPT".to_string()));
+        assert_eq!(env_var("max_body_size"), Some("KITTYCAD_MAX_BODY_SIZE".to_string()));
+        assert_eq!(
+            env_var("defaults.file_convert.output_format"),
+            Some("KITTYCAD_DEFAULTS_FILE_CONVERT_OUTPUT_FORMAT".to_string())
+        );
+        assert_eq!(env_var("user"), None);
+        assert_eq!(env_var("nope"), None);
+    }
+}
@@ -1,6 +1,11 @@
+use std::str::FromStr;
+
 use anyhow::{anyhow, Result};
 
-use crate::config_alias::AliasConfig;
+use crate::{
+    config_alias::AliasConfig,
+    config_credentials::{CredentialStore, CredentialStoreKind},
+};
 
 // This type implements a Config interface and represents a config file on disk.
 #[derive(Debug, Clone)]
@@ -15,6 +20,16 @@ pub struct HostConfig {
 }
 
 impl FileConfig {
+    /// Returns the backend tokens are stored in, if they are not stored in the hosts file.
+    fn credential_store(&self) -> Option<Box<dyn CredentialStore>> {
+        let kind = match self.map.get_string_value("credential_store") {
+            Ok(value) => CredentialStoreKind::from_str(&value).unwrap_or_default(),
+            Err(_) => CredentialStoreKind::default(),
+        };
+
+        kind.store()
+    }
+
     fn get_hosts_table(&self) -> Result<toml_edit::Table> {
         match self.map.find_entry("hosts") {
             Ok(hosts) => match hosts.as_table() {
@@ -90,6 +105,18 @@ impl FileConfig {
         }
     }
 
+    fn save_host_config(&mut self, host_config: &HostConfig) -> Result<()> {
+        // Get our hosts table.
+        let mut hosts_table = self.get_hosts_table()?;
+
+        hosts_table.insert(&host_config.host, toml_edit::Item::Table(host_config.map.root.clone()));
+
+        // Reset the hosts.
+        self.map.root.insert("hosts", toml_edit::Item::Table(hosts_table));
+
+        Ok(())
+    }
+
     fn make_host_config(&self, hostname: &str) -> Result<HostConfig> {
         let host_config = HostConfig {
             map: crate::config_map::ConfigMap {
@@ -106,6 +133,129 @@ impl FileConfig {
     }
 }
 
+/// Returns the accounts put aside for a host.
+fn accounts_table(host_config: &HostConfig) -> toml_edit::Table {
+    match host_config.map.find_entry("accounts") {
+        Ok(toml_edit::Item::Table(accounts)) => accounts,
+        _ => toml_edit::Table::new(),
+    }
+}
+
+/// Returns the name of the account in use for a host, the user unless it was given a
+/// name when logging in.
+fn account_name(host_config: &HostConfig) -> String {
+    host_config
+        .map
+        .get_string_value("account")
+        .or_else(|_| host_config.map.get_string_value("user"))
+        .unwrap_or_else(|_| "default".to_string())
+}
+
+/// Returns the name we keep the token of an account that was put aside under, in the
+/// credential store.
+pub(crate) fn account_store_key(hostname: &str, account: &str) -> String {
+    format!("{}#{}", hostname, account)
+}
+
+/// Expand the alias in the second argument, e.g. `kittycad cs foo bar` into
+/// `kittycad config set foo bar` when `cs` is `config set`. The second return value is
+/// true if the alias is a shell expression.
+///
+/// Named placeholders like `$input` are filled with the value of the `--input` flag given
+/// after the alias, then positional placeholders like `$1` with the arguments left.
+fn expand_alias_once(args: Vec<String>, expansion: String) -> Result<(Vec<String>, bool)> {
+    let mut expansion = expansion;
+    let mut additional_args = args;
+    // The first argument is the command name, we want to add it back at the end.
+    let first = additional_args.remove(0);
+    additional_args.remove(0); // Remove the alias.
+
+    if expansion.starts_with('!') {
+        let mut expanded = vec![
+            "sh".to_string(),
+            "-c".to_string(),
+            expansion.trim_start_matches('!').to_string(),
+        ];
+
+        if !additional_args.is_empty() {
+            // Add the additional arguments.
+            expanded.push("--".to_string());
+            expanded.append(&mut additional_args);
+        }
+
+        return Ok((expanded, true));
+    }
+
+    // Find all the named placeholders before filling any in, so values that look like
+    // one are left alone.
+    let named = regex::Regex::new(r"\$([a-zA-Z_][a-zA-Z0-9_]*)")?;
+    let mut values = std::collections::HashMap::new();
+    let mut missing = vec![];
+    for captures in named.captures_iter(&expansion) {
+        let name = captures[1].to_string();
+        if values.contains_key(&name) {
+            continue;
+        }
+
+        let flag = format!("--{}", name.replace('_', "-"));
+        match take_flag(&mut additional_args, &flag) {
+            Some(value) => {
+                values.insert(name, value);
+            }
+            None if !missing.contains(&flag) => missing.push(flag),
+            None => {}
+        }
+    }
+    if !missing.is_empty() {
+        return Err(anyhow!("missing {} for alias: {}", missing.join(", "), expansion));
+    }
+    expansion = named
+        .replace_all(&expansion, |captures: &regex::Captures| {
+            shlex::quote(&values[&captures[1]]).to_string()
+        })
+        .to_string();
+
+    let mut extra_args: Vec<String> = vec![];
+    for (i, a) in additional_args.iter().enumerate() {
+        if !expansion.contains('$') {
+            extra_args.push(a.clone());
+        } else {
+            expansion = expansion.replace(&format!("${}", i + 1), a);
+        }
+    }
+
+    let lingering = regex::Regex::new(r"\$\d")?;
+    if lingering.is_match(&expansion) {
+        return Err(anyhow!("not enough arguments for alias: {}", expansion));
+    }
+
+    let mut new_args = vec![first];
+    new_args.append(&mut shlex::split(&expansion).unwrap());
+    new_args.append(&mut extra_args);
+
+    Ok((new_args, false))
+}
+
+/// Remove the flag and its value from the arguments, given as `--flag value` or
+/// `--flag=value`, and return the value.
+fn take_flag(args: &mut Vec<String>, flag: &str) -> Option<String> {
+    let prefix = format!("{}=", flag);
+    for i in 0..args.len() {
+        if let Some(value) = args[i].strip_prefix(&prefix) {
+            let value = value.to_string();
+            args.remove(i);
+            return Some(value);
+        }
+
+        if args[i] == flag && i + 1 < args.len() {
+            args.remove(i);
+            return Some(args.remove(i));
+        }
+    }
+
+    None
+}
+
 impl crate::config::Config for FileConfig {
     fn get(&self, hostname: &str, key: &str) -> Result<String> {
         let (val, _) = self.get_with_source(hostname, key)?;
@@ -120,6 +270,16 @@ impl crate::config::Config for FileConfig {
             return Ok((value, default_source));
         }
 
+        // Check the credential store first, tokens that have not been migrated yet will
+        // still be in the hosts file.
+        if key == "token" {
+            if let Some(store) = self.credential_store() {
+                if let Some(token) = store.get(hostname)? {
+                    return Ok((token, store.source()));
+                }
+            }
+        }
+
         let hosts_source = crate::config_file::hosts_file()?;
 
         let host_config = self.get_host_config(hostname)?;
@@ -142,7 +302,15 @@ impl crate::config::Config for FileConfig {
             }
         };
 
-        host_config.map.set_string_value(key, value)?;
+        match self.credential_store() {
+            Some(store) if key == "token" => {
+                store.set(hostname, value)?;
+
+                // Make sure we don't leave a plaintext copy behind.
+                host_config.map.remove_entry(key)?;
+            }
+            _ => host_config.map.set_string_value(key, value)?,
+        }
 
         // Get our hosts table.
         let mut hosts_table = self.get_hosts_table()?;
@@ -155,11 +323,69 @@ impl crate::config::Config for FileConfig {
         Ok(())
     }
 
+    fn unset(&mut self, hostname: &str, key: &str) -> Result<()> {
+        if hostname.is_empty() {
+            // Options are expected to always be there, so put the default back instead.
+            return match crate::config::config_options().into_iter().find(|o| o.key == key) {
+                Some(option) => self.map.set_string_value(key, &option.default_value),
+                None => self.map.remove_entry(key),
+            };
+        }
+
+        let mut host_config = self.get_host_config(hostname)?;
+
+        if key == "token" {
+            if let Some(store) = self.credential_store() {
+                store.delete(hostname)?;
+            }
+        }
+        host_config.map.remove_entry(key)?;
+
+        // Get our hosts table.
+        let mut hosts_table = self.get_hosts_table()?;
+
+        hosts_table.insert(hostname, toml_edit::Item::Table(host_config.map.root.clone()));
+
+        // Reset the hosts.
+        self.map.root.insert("hosts", toml_edit::Item::Table(hosts_table));
+
+        Ok(())
+    }
+
+    fn reset(&mut self) -> Result<()> {
+        let hosts_table = self.get_hosts_table()?;
+        // The tokens of the hosts are where this says, so it stays too.
+        let credential_store = self.map.get_string_value("credential_store");
+
+        let mut root = crate::config::new_blank_root()?.as_table().clone();
+        if !hosts_table.is_empty() {
+            root.insert("hosts", toml_edit::Item::Table(hosts_table));
+        }
+        self.map.root = root;
+        match credential_store {
+            Ok(credential_store)
+                if self.map.get_string_value("credential_store").ok() != Some(credential_store.clone()) =>
+            {
+                self.map.set_string_value("credential_store", &credential_store)?;
+            }
+            _ => {}
+        }
+
+        Ok(())
+    }
+
     fn unset_host(&mut self, hostname: &str) -> Result<()> {
         if hostname.is_empty() {
             return Ok(());
         }
 
+        if let Some(store) = self.credential_store() {
+            store.delete(hostname)?;
+            for account in self.accounts(hostname).unwrap_or_default() {
+                store.delete(&account_store_key(hostname, &account))?;
+            }
+        }
+
         let mut hosts_table = self.get_hosts_table()?;
 
         // Remove the host from the table.
@@ -171,6 +397,161 @@ impl crate::config::Config for FileConfig {
         Ok(())
     }
 
+    fn add_host(&mut self, hostname: &str) -> Result<()> {
+        if self.get_host_config(hostname).is_ok() {
+            return Ok(());
+        }
+
+        let host_config = self.make_host_config(hostname)?;
+        self.save_host_config(&host_config)
+    }
+
+    fn accounts(&self, hostname: &str) -> Result<Vec<String>> {
+        let host_config = match self.get_host_config(hostname) {
+            Ok(host_config) => host_config,
+            Err(_) => return Ok(vec![]),
+        };
+
+        Ok(accounts_table(&host_config)
+            .iter()
+            .map(|(account, _)| account.to_string())
+            .collect())
+    }
+
+    fn stash_account(&mut self, hostname: &str) -> Result<()> {
+        let mut host_config = match self.get_host_config(hostname) {
+            Ok(host_config) => host_config,
+            Err(_) => return Ok(()),
+        };
+
+        let token = self.get(hostname, "token").unwrap_or_default();
+        if token.is_empty() {
+            return Ok(());
+        }
+
+        let name = account_name(&host_config);
+        let mut account = toml_edit::Table::new();
+        account.insert(
+            "user",
+            toml_edit::value(host_config.map.get_string_value("user").unwrap_or_default()),
+        );
+        match self.credential_store() {
+            Some(store) => {
+                store.set(&account_store_key(hostname, &name), &token)?;
+                store.delete(hostname)?;
+            }
+            None => {
+                account.insert("token", toml_edit::value(token));
+            }
+        }
+
+        let mut accounts = accounts_table(&host_config);
+        accounts.insert(&name, toml_edit::Item::Table(account));
+        host_config
+            .map
+            .root
+            .insert("accounts", toml_edit::Item::Table(accounts));
+        for key in ["token", "user", "account"] {
+            host_config.map.remove_entry(key)?;
+        }
+
+        self.save_host_config(&host_config)
+    }
+
+    fn switch_account(&mut self, hostname: &str, account: &str) -> Result<()> {
+        let host_config = self.get_host_config(hostname)?;
+        if account_name(&host_config) == account {
+            return Ok(());
+        }
+
+        let accounts = accounts_table(&host_config);
+        let stashed = match accounts.get(account).and_then(|a| a.as_table()) {
+            Some(stashed) => crate::config_map::ConfigMap { root: stashed.clone() },
+            None => {
+                let names: Vec<&str> = accounts.iter().map(|(name, _)| name).collect();
+                return Err(anyhow!(
+                    "no account `{}` for {}, the accounts are: {}",
+                    account,
+                    hostname,
+                    names.join(", ")
+                ));
+            }
+        };
+
+        // Tokens are where the credential store was when the account was put aside.
+        let key = account_store_key(hostname, account);
+        let mut token = stashed.get_string_value("token").unwrap_or_default();
+        if let Some(store) = self.credential_store() {
+            if let Some(stored) = store.get(&key)? {
+                token = stored;
+            }
+            store.delete(&key)?;
+        }
+
+        self.stash_account(hostname)?;
+
+        let mut host_config = self.get_host_config(hostname)?;
+        let mut accounts = accounts_table(&host_config);
+        accounts.remove(account);
+        if accounts.is_empty() {
+            host_config.map.remove_entry("accounts")?;
+        } else {
+            host_config
+                .map
+                .root
+                .insert("accounts", toml_edit::Item::Table(accounts));
+        }
+        host_config
+            .map
+            .set_string_value("user", &stashed.get_string_value("user").unwrap_or_default())?;
+        host_config.map.set_string_value("account", account)?;
+        self.save_host_config(&host_config)?;
+
+        self.set(hostname, "token", &token)
+    }
+
+    fn get_account(&self, hostname: &str, account: &str) -> Result<(String, String)> {
+        let host_config = self.get_host_config(hostname)?;
+        let stashed = match accounts_table(&host_config).get(account).and_then(|a| a.as_table()) {
+            Some(stashed) => crate::config_map::ConfigMap { root: stashed.clone() },
+            None => return Err(anyhow!("no account `{}` for {}", account, hostname)),
+        };
+
+        let mut token = stashed.get_string_value("token").unwrap_or_default();
+        if let Some(store) = self.credential_store() {
+            if let Some(stored) = store.get(&account_store_key(hostname, account))? {
+                token = stored;
+            }
+        }
+
+        Ok((stashed.get_string_value("user").unwrap_or_default(), token))
+    }
+
+    fn add_account(&mut self, hostname: &str, account: &str, user: &str, token: &str) -> Result<()> {
+        self.add_host(hostname)?;
+        let mut host_config = self.get_host_config(hostname)?;
+
+        let mut stashed = toml_edit::Table::new();
+        stashed.insert("user", toml_edit::value(user));
+        if !token.is_empty() {
+            match self.credential_store() {
+                Some(store) => store.set(&account_store_key(hostname, account), token)?,
+                None => {
+                    stashed.insert("token", toml_edit::value(token));
+                }
+            }
+        }
+
+        let mut accounts = accounts_table(&host_config);
+        accounts.insert(account, toml_edit::Item::Table(stashed));
+        host_config
+            .map
+            .root
+            .insert("accounts", toml_edit::Item::Table(accounts));
+
+        self.save_host_config(&host_config)
+    }
+
     fn hosts(&self) -> Result<Vec<String>> {
         let mut hosts = Vec::new();
 
@@ -188,6 +569,28 @@ impl crate::config::Config for FileConfig {
         Ok(hosts)
     }
 
+    fn links(&self) -> Result<Vec<(String, String)>> {
+        let mut links = Vec::new();
+        for (key, _) in self.map.root.iter() {
+            if let Some(name) = key.strip_prefix("links.") {
+                links.push((name.to_string(), self.map.get_string_value(key)?));
+            }
+        }
+
+        Ok(links)
+    }
+
+    fn command_defaults(&self) -> Result<Vec<(String, String)>> {
+        let mut defaults = Vec::new();
+        for (key, _) in self.map.root.iter() {
+            if key.starts_with("defaults.") {
+                defaults.push((key.to_string(), self.map.get_string_value(key)?));
+            }
+        }
+
+        Ok(defaults)
+    }
+
     fn default_host(&self) -> Result<String> {
         let (host, _) = self.default_host_with_source()?;
         Ok(host)
@@ -214,7 +617,7 @@ impl crate::config::Config for FileConfig {
         }
 
         return Err(anyhow!(
-            "No host has been set as default. Try setting a default with `kittycad config set -H <host> default true`. Options for hosts are: {}", hosts.join(", ")
+            "No host has been set as default. Try setting a default with `kittycad host set-default <host>`. Options for hosts are: {}", hosts.join(", ")
         ));
     }
 
@@ -237,72 +640,42 @@ impl crate::config::Config for FileConfig {
     }
 
     fn expand_alias(&mut self, args: Vec<String>) -> Result<(Vec<String>, bool)> {
-        let mut is_shell = false;
-
         if args.len() < 2 {
             // The command is lacking a subcommand.
-            return Ok((Vec::new(), is_shell));
+            return Ok((Vec::new(), false));
         }
 
-        let mut expanded = args.clone();
-
-        // Save the first argument and remove it at the same time.
-        // The first argument is the command name, we want to add it back at the end.
-        let first = expanded.remove(0);
-
         // Get our aliases.
         let aliases = self.aliases()?;
 
-        // Expand the alias.
-        let (mut expansion, ok) = aliases.get(expanded.first().unwrap());
-        if !ok {
-            // Return the original args.
-            return Ok((args, is_shell));
-        }
-
-        // Get the additional arguments.
-        let mut additional_args = args;
-
-        additional_args.remove(0); // Remove the first argument.
-        additional_args.remove(0); // Remove the second argument.
-
-        if expansion.starts_with('!') {
-            is_shell = true;
-
-            expanded = vec![
-                "sh".to_string(),
-                "-c".to_string(),
-                expansion.trim_start_matches('!').to_string(),
-            ];
-
-            if !additional_args.is_empty() {
-                // Add the additional arguments.
-                expanded.push("--".to_string());
-                expanded.append(&mut additional_args);
+        // Aliases can expand to other aliases, keep going until we get to a command.
+        let mut expanded = args;
+        let mut seen: Vec<String> = vec![];
+        while expanded.len() > 1 {
+            let alias = expanded[1].to_string();
+            let (expansion, ok) = aliases.get(&alias);
+            if !ok {
+                break;
             }
 
-            return Ok((expanded, is_shell));
-        }
-
-        let mut extra_args: Vec<String> = vec![];
-        for (i, a) in additional_args.iter().enumerate() {
-            if !expansion.contains('$') {
-                extra_args.push(a.clone());
-            } else {
-                expansion = expansion.replace(&format!("${}", i + 1), a);
+            if seen.contains(&alias) {
+                return Err(anyhow!(
+                    "alias {} expands to itself: {} -> {}",
+                    alias,
+                    seen.join(" -> "),
+                    alias
+                ));
             }
-        }
+            seen.push(alias);
 
-        let lingering = regex::Regex::new(r"\$\d")?;
-        if lingering.is_match(&expansion) {
-            return Err(anyhow!("not enough arguments for alias: {}", expansion));
+            let (next, is_shell) = expand_alias_once(expanded, expansion)?;
+            if is_shell {
+                return Ok((next, is_shell));
+            }
+            expanded = next;
         }
 
-        let mut new_args = vec![first];
-        new_args.append(&mut shlex::split(&expansion).unwrap());
-        new_args.append(&mut extra_args);
-
-        Ok((new_args, is_shell))
+        Ok((expanded, false))
     }
 
     fn check_writable(&self, _hostname: &str, _key: &str) -> Result<()> {
@@ -0,0 +1,188 @@
+use anyhow::{anyhow, Context, Result};
+
+/// The file in the sync repo that holds the configuration, as `kittycad config export`
+/// writes it.
+pub const SYNC_FILE: &str = "kittycad.yaml";
+
+/// A local clone of the git repo the configuration is synced through. Its `HEAD` is
+/// the configuration as of the last sync, which is how we tell who changed what.
+pub struct SyncRepo {
+    dir: std::path::PathBuf,
+}
+
+impl SyncRepo {
+    /// Open the clone in the directory, cloning the repo at `url` first if there is
+    /// no clone yet or it is of another repo.
+    pub fn open(dir: &std::path::Path, url: Option<&str>) -> Result<SyncRepo> {
+        let repo = SyncRepo { dir: dir.to_path_buf() };
+
+        if dir.join(".git").exists() {
+            match url {
+                Some(url) if repo.url()? != url => {
+                    std::fs::remove_dir_all(dir).with_context(|| format!("failed to remove {}", dir.display()))?;
+                }
+                _ => return Ok(repo),
+            }
+        }
+
+        let url = match url {
+            Some(url) => url,
+            None => anyhow::bail!("no repo to sync with yet, pass one with `--repo`"),
+        };
+        if let Some(parent) = dir.parent() {
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("failed to create directory {}", parent.display()))?;
+        }
+        git(None, &["clone", "--quiet", "--", url, &dir.to_string_lossy()])?;
+
+        Ok(repo)
+    }
+
+    fn git(&self, args: &[&str]) -> Result<String> {
+        git(Some(&self.dir), args)
+    }
+
+    /// Returns the URL of the repo.
+    pub fn url(&self) -> Result<String> {
+        Ok(self.git(&["remote", "get-url", "origin"])?.trim().to_string())
+    }
+
+    /// Get the latest changes from the repo, without applying them.
+    pub fn fetch(&self) -> Result<()> {
+        self.git(&["fetch", "--quiet", "origin"]).map(|_| ())
+    }
+
+    /// Returns the configuration as of the last sync, if there was one.
+    pub fn synced(&self) -> Option<String> {
+        self.git(&["show", &format!("HEAD:{}", SYNC_FILE)]).ok()
+    }
+
+    /// Returns the configuration in the repo as of the last fetch, if there is any.
+    pub fn remote(&self) -> Option<String> {
+        self.git(&["show", &format!("@{{upstream}}:{}", SYNC_FILE)]).ok()
+    }
+
+    /// Commit the configuration and push it, over what is in the repo if `force` is set.
+    ///
+    /// If the push fails the commit is undone, since `HEAD` must stay what was synced.
+    pub fn push(&self, contents: &str, message: &str, force: bool) -> Result<()> {
+        let path = self.dir.join(SYNC_FILE);
+        std::fs::write(&path, contents).with_context(|| format!("failed to write file {}", path.display()))?;
+
+        self.git(&["add", SYNC_FILE])?;
+        self.git(&["commit", "--quiet", "-m", message])?;
+        let pushed = if force {
+            self.git(&["push", "--quiet", "--force", "-u", "origin", "HEAD"])
+        } else {
+            self.git(&["push", "--quiet", "-u", "origin", "HEAD"])
+        };
+
+        if let Err(err) = pushed {
+            // The first commit of the repo has no parent to go back to.
+            let undone = match self.git(&["rev-parse", "--verify", "--quiet", "HEAD~"]) {
+                Ok(_) => self.git(&["reset", "--quiet", "--soft", "HEAD~"]),
+                Err(_) => self.git(&["update-ref", "-d", "HEAD"]),
+            };
+            return match undone {
+                Ok(_) => Err(err),
+                Err(undo_err) => Err(anyhow!("{}, and the commit could not be undone: {}", err, undo_err)),
+            };
+        }
+
+        Ok(())
+    }
+
+    /// Move to the configuration in the repo as of the last fetch.
+    pub fn pull(&self) -> Result<()> {
+        self.git(&["reset", "--quiet", "--hard", "@{upstream}"]).map(|_| ())
+    }
+}
+
+/// Run git and return what it printed.
+fn git(dir: Option<&std::path::Path>, args: &[&str]) -> Result<String> {
+    let mut cmd = std::process::Command::new("git");
+    if let Some(dir) = dir {
+        cmd.current_dir(dir);
+    }
+    let output = cmd
+        .args(args)
+        .output()
+        .map_err(|err| anyhow!("failed to run git, is it installed? {}", err))?;
+
+    if !output.status.success() {
+        anyhow::bail!(
+            "`git {}` failed: {}",
+            args.join(" "),
+            String::from_utf8_lossy(&output.stderr).trim()
+        );
+    }
+
+    Ok(String::from_utf8_lossy(&output.stdout).to_string())
+}
+
+/// Returns true if the configuration changed both here and in the repo since the last
+/// sync, in different ways.
+pub fn is_conflict(synced: Option<&str>, local: &str, remote: Option<&str>) -> bool {
+    let local_changed = synced != Some(local);
+    let remote_changed = remote != synced;
+
+    local_changed && remote_changed && remote != Some(local)
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_is_conflict() {
+        assert!(!is_conflict(None, "a", None));
+        assert!(!is_conflict(Some("a"), "a", Some("a")));
+        assert!(!is_conflict(Some("a"), "b", Some("a")));
+        assert!(!is_conflict(Some("a"), "a", Some("b")));
+        assert!(!is_conflict(Some("a"), "b", Some("b")));
+        assert!(is_conflict(Some("a"), "b", Some("c")));
+        assert!(is_conflict(None, "b", Some("c")));
+    }
+
+    #[test]
+    fn test_sync_repo() {
+        let dir = tempfile::tempdir().unwrap();
+        let remote = dir.path().join("remote.git");
+        git(None, &["init", "--quiet", "--bare", &remote.to_string_lossy()]).unwrap();
+        let url = remote.to_string_lossy().to_string();
+
+        let set_identity = |repo: &SyncRepo| {
+            repo.git(&["config", "user.name", "Test"]).unwrap();
+            repo.git(&["config", "user.email", "test@example.com"]).unwrap();
+        };
+
+        let a = SyncRepo::open(&dir.path().join("a"), Some(&url)).unwrap();
+        set_identity(&a);
+        assert_eq!(a.url().unwrap(), url);
+        assert_eq!(a.synced(), None);
+        a.push("editor: vim\n", "Sync from a", false).unwrap();
+        assert_eq!(a.synced(), Some("editor: vim\n".to_string()));
+
+        let b = SyncRepo::open(&dir.path().join("b"), Some(&url)).unwrap();
+        set_identity(&b);
+        assert_eq!(b.synced(), Some("editor: vim\n".to_string()));
+        b.push("editor: nano\n", "Sync from b", false).unwrap();
+
+        a.fetch().unwrap();
+        assert_eq!(a.remote(), Some("editor: nano\n".to_string()));
+        a.pull().unwrap();
+        assert_eq!(a.synced(), Some("editor: nano\n".to_string()));
+
+        // A push that is rejected leaves what was synced as it was.
+        a.push("editor: emacs\n", "Sync from a", false).unwrap();
+        assert!(b.push("editor: code\n", "Sync from b", false).is_err());
+        assert_eq!(b.synced(), Some("editor: nano\n".to_string()));
+
+        // The clone is reused without a URL.
+        let a = SyncRepo::open(&dir.path().join("a"), None).unwrap();
+        assert_eq!(a.url().unwrap(), url);
+        assert!(SyncRepo::open(&dir.path().join("c"), None).is_err());
+    }
+}
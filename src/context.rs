@@ -4,16 +4,84 @@ use anyhow::{anyhow, Result};
 
 use crate::{config::Config, config_file::get_env_var, types::FormatOutput};
 
+/// How many idle connections to each host we keep open when `max_idle_connections` isn't
+/// set. Enough for a batch of conversions to reuse them instead of starting over.
+const DEFAULT_MAX_IDLE_CONNECTIONS: usize = 16;
+
+/// How long we keep an idle connection open when `idle_timeout` isn't set.
+const DEFAULT_IDLE_TIMEOUT: std::time::Duration = std::time::Duration::from_secs(90);
+
+/// How long a download from outside the API, like a release or a preset, may take when
+/// `timeout` isn't set.
+pub const DOWNLOAD_TIMEOUT: std::time::Duration = std::time::Duration::from_secs(10 * 60);
+
+/// Options for building an API client, see `Context::api_client_with_options`.
+#[derive(Debug, Default)]
+pub struct ClientOptions {
+    /// A suffix appended to the `kittycad/<version>` user agent, so requests from tools built
+    /// on top of the CLI can be told apart.
+    pub user_agent_suffix: String,
+    /// The HTTP client to use as the transport, e.g. one with custom timeouts, proxies or
+    /// certificates. The user agent is set on it for you.
+    pub http_client: Option<reqwest::ClientBuilder>,
+}
+
+impl ClientOptions {
+    /// Returns the user agent requests should be sent with.
+    pub fn user_agent(&self) -> String {
+        let user_agent = format!("kittycad/{}", clap::crate_version!());
+        if self.user_agent_suffix.is_empty() {
+            user_agent
+        } else {
+            format!("{} {}", user_agent, self.user_agent_suffix)
+        }
+    }
+
+    fn into_http_client(self) -> reqwest::ClientBuilder {
+        let user_agent = self.user_agent();
+        self.http_client
+            .unwrap_or_else(reqwest::Client::builder)
+            .user_agent(user_agent)
+    }
+}
+
 pub struct Context<'a> {
     pub config: &'a mut (dyn Config + Send + Sync + 'a),
     pub io: crate::iostreams::IoStreams,
     pub debug: bool,
+    /// How much of the HTTP traffic we print to `io.err_out`, passed with `--verbose` or
+    /// set with `KITTYCAD_DEBUG`.
+    pub verbosity: u8,
+    /// The number of retries passed with `--retry`, this takes precedence over the config.
+    pub retries: Option<u32>,
+    /// The timeout passed with `--timeout`, this takes precedence over the config.
+    pub timeout: Option<std::time::Duration>,
+    /// The transfer rate passed with `--limit-rate`, this takes precedence over the config.
+    pub limit_rate: Option<u64>,
+    /// The token passed with `--token-file`, this takes precedence over the config.
+    pub token: Option<String>,
+    /// The base URL of the endpoint of the default host passed with `--endpoint`, this
+    /// takes precedence over its `endpoints`.
+    pub endpoint: Option<String>,
+    /// The first healthy one of the `endpoints` of the default host, once we picked it.
+    pub picked_endpoint: std::sync::Mutex<Option<Option<String>>>,
+    /// The output format passed to the root command with `--format`, a command's own
+    /// `--format` takes precedence over it and it takes precedence over the config.
+    pub output_format: Option<FormatOutput>,
 }
 
 impl Context<'_> {
     pub fn new(config: &mut (dyn Config + Send + Sync)) -> Context {
-        // Let's get our IO streams.
-        let mut io = crate::iostreams::IoStreams::system();
+        Context::with_io(config, crate::iostreams::IoStreams::system())
+    }
+
+    /// Returns a context that reads and writes the given IO streams rather than the
+    /// process' own, set up with the prompt and pager from the config.
+    ///
+    /// There is no library target, so this is only for tests in this crate, e.g. to
+    /// capture the output of a command: build it, then call `Command::run` with this context.
+    pub fn with_io(config: &mut (dyn Config + Send + Sync), io: crate::iostreams::IoStreams) -> Context {
+        let mut io = io;
 
         // Set the prompt.
         let prompt = config.get("", "prompt").unwrap();
@@ -45,40 +113,147 @@ impl Context<'_> {
             config,
             io,
             debug: false,
+            verbosity: 0,
+            retries: None,
+            timeout: None,
+            limit_rate: None,
+            token: None,
+            endpoint: None,
+            picked_endpoint: Default::default(),
+            output_format: None,
         }
     }
 
     /// This function returns an API client for KittyCAD that is based on the configured
     /// user.
+    ///
+    /// The client sends every call once, it has no way to hook in retries or logging. Send
+    /// its calls through `crate::retry::call` with the `retry_policy` and `http_log`, or
+    /// `crate::retry::call_once` for the ones that aren't safe to repeat.
     pub fn api_client(&self, hostname: &str) -> Result<kittycad::Client> {
-        // Use the host passed in if it's set.
-        // Otherwise, use the default host.
+        self.api_client_with_options(hostname, ClientOptions::default())
+    }
+
+    /// This function returns an API client for KittyCAD that is based on the configured
+    /// user, built with the given options.
+    ///
+    /// This is what tools reusing the CLI should call rather than copying the host and
+    /// token resolution logic.
+    pub fn api_client_with_options(&self, hostname: &str, options: ClientOptions) -> Result<kittycad::Client> {
+        let (host, baseurl) = self.resolve_host(hostname)?;
+
+        // Make sure we are allowed to talk to this host before we send it anything.
+        crate::policy::check_host(&*self.config, &host)?;
+        crate::policy::check_host(&*self.config, &baseurl)?;
+
+        let token = self.token(&host)?;
+
+        // Ask for the API version the host is pinned to, if it is.
+        let mut options = options;
+        if let Some(media_type) = self.pinned_media_type(&host) {
+            let mut headers = reqwest::header::HeaderMap::new();
+            headers.insert(reqwest::header::ACCEPT, media_type.parse()?);
+            options.http_client = Some(
+                options
+                    .http_client
+                    .unwrap_or_else(reqwest::Client::builder)
+                    .default_headers(headers),
+            );
+        }
+
+        // Tune the connections the way the config says.
+        options.http_client = Some(self.transport(options.http_client.unwrap_or_else(reqwest::Client::builder))?);
+
+        // Create the client.
+        let mut client = kittycad::Client::new_from_reqwest(&token, options.into_http_client());
+
+        if baseurl != crate::DEFAULT_HOST {
+            client.set_base_url(&baseurl);
+        }
+
+        Ok(client)
+    }
+
+    /// Returns the media type of the API version the host is pinned to with `api_version`,
+    /// for self-hosted servers that don't speak the newest version.
+    pub fn pinned_media_type(&self, host: &str) -> Option<String> {
+        match self.config.get(host, "api_version") {
+            Ok(version) if !version.is_empty() => Some(crate::config::api_media_type(&version)),
+            _ => None,
+        }
+    }
+
+    /// Returns the log to send raw requests with, see `crate::http_log::send`.
+    pub fn http_log(&self) -> crate::http_log::HttpLog {
+        crate::http_log::HttpLog::new(self.verbosity, self.io.err_out.clone())
+    }
+
+    /// Returns the HTTP client to download from outside the API with, like releases and
+    /// presets, see `http_client`.
+    pub fn download_client(&self) -> Result<reqwest::Client> {
+        http_client(&*self.config, self.timeout()?.unwrap_or(DOWNLOAD_TIMEOUT))
+    }
+
+    /// Returns the token for the host, unless one was passed for this command.
+    pub(crate) fn token(&self, host: &str) -> Result<String> {
+        match &self.token {
+            Some(token) => Ok(token.to_string()),
+            None => self.config.get(host, "token"),
+        }
+    }
+
+    /// Returns what identifies who we talk to the API as, so responses we cache are never
+    /// shared between hosts or accounts: the base URL and a digest of the token.
+    pub fn cache_scope(&self, hostname: &str) -> Result<String> {
+        let (host, baseurl) = self.resolve_host(hostname)?;
+        let token = self.token(&host).unwrap_or_default();
+        let digest = ring::digest::digest(&ring::digest::SHA256, token.as_bytes());
+
+        Ok(format!(
+            "{} {}",
+            baseurl,
+            data_encoding::HEXLOWER.encode(digest.as_ref())
+        ))
+    }
+
+    /// Returns the host we should talk to and its base URL.
+    ///
+    /// The host passed in is used if it's set, otherwise the default host is used.
+    pub fn resolve_host(&self, hostname: &str) -> Result<(String, String)> {
         let host = if hostname.is_empty() {
             self.config.default_host()?
         } else {
             hostname.to_string()
         };
 
-        // Change the baseURL to the one we want.
-        let mut baseurl = host.to_string();
-        if !host.starts_with("http://") && !host.starts_with("https://") {
-            baseurl = format!("https://{}", host);
-            if host.starts_with("localhost") {
-                baseurl = format!("http://{}", host)
+        // Talk to the endpoint of the default host, if this is it and it has one.
+        let mut baseurl = crate::endpoints::base_url(&host);
+        if host == self.config.default_host().unwrap_or_default() {
+            if let Some(endpoint) = self.endpoint(&host)? {
+                baseurl = endpoint;
             }
         }
 
-        // Get the token for that host.
-        let token = self.config.get(&host, "token")?;
+        Ok((host, baseurl))
+    }
 
-        // Create the client.
-        let mut client = kittycad::Client::new(&token);
+    /// Returns the endpoint of the default host: the one passed with `--endpoint`, or the
+    /// first healthy one of its `endpoints`. We pick it the first time we need it, so
+    /// commands that never talk to the API never ping anything.
+    fn endpoint(&self, host: &str) -> Result<Option<String>> {
+        if self.endpoint.is_some() {
+            return Ok(self.endpoint.clone());
+        }
 
-        if baseurl != crate::DEFAULT_HOST {
-            client.set_base_url(&baseurl);
+        let mut picked = self
+            .picked_endpoint
+            .lock()
+            .map_err(|_| anyhow!("failed to pick an endpoint"))?;
+        if picked.is_none() {
+            *picked = Some(crate::endpoints::pick(&*self.config, host)?);
         }
 
-        Ok(client)
+        Ok(picked.clone().flatten())
     }
 
     /// This function opens a browser that is based on the configured
@@ -123,12 +298,120 @@ impl Context<'_> {
     pub fn format(&self, format: &Option<FormatOutput>) -> Result<FormatOutput> {
         if let Some(format) = format {
             Ok(format.clone())
+        } else if let Some(format) = &self.output_format {
+            Ok(format.clone())
         } else {
             let value = self.config.get("", "format")?;
             Ok(FormatOutput::from_str(&value).unwrap_or_default())
         }
     }
 
+    /// Return how we should retry API requests that failed for transient reasons.
+    pub fn retry_policy(&self) -> Result<crate::retry::RetryPolicy> {
+        if let Some(retries) = self.retries {
+            return Ok(crate::retry::RetryPolicy::new(retries));
+        }
+
+        let value = self.config.get("", "retries").unwrap_or_default();
+        if value.is_empty() {
+            return Ok(crate::retry::RetryPolicy::default());
+        }
+
+        let retries = value
+            .parse::<u32>()
+            .map_err(|_| anyhow!("invalid retries `{}`, expected a number", value))?;
+
+        Ok(crate::retry::RetryPolicy::new(retries))
+    }
+
+    /// Return how long a command may run before it is aborted, if there is a limit.
+    pub fn timeout(&self) -> Result<Option<std::time::Duration>> {
+        if self.timeout.is_some() {
+            return Ok(self.timeout);
+        }
+
+        let value = self.config.get("", "timeout").unwrap_or_default();
+        if value.is_empty() {
+            return Ok(None);
+        }
+
+        Ok(Some(crate::types::parse_duration(&value)?))
+    }
+
+    /// Return the maximum number of bytes per second to upload or download files at, if
+    /// there is a limit.
+    pub fn limit_rate(&self) -> Result<Option<u64>> {
+        if self.limit_rate.is_some() {
+            return Ok(self.limit_rate);
+        }
+
+        let value = self.config.get("", "limit_rate").unwrap_or_default();
+        if value.is_empty() {
+            return Ok(None);
+        }
+
+        Ok(Some(crate::types::parse_rate(&value)?))
+    }
+
+    /// Set up how the HTTP client connects, with the `max_idle_connections`, `idle_timeout`,
+    /// `http2`, `http_proxy`, `ca_bundle` and `insecure_skip_verify` settings.
+    pub fn transport(&self, builder: reqwest::ClientBuilder) -> Result<reqwest::ClientBuilder> {
+        let value = self.config.get("", "max_idle_connections").unwrap_or_default();
+        let max_idle_connections = if value.is_empty() {
+            DEFAULT_MAX_IDLE_CONNECTIONS
+        } else {
+            value.parse::<usize>().map_err(|_| {
+                anyhow::anyhow!(
+                    "invalid max_idle_connections `{}`, expected a number of connections",
+                    value
+                )
+            })?
+        };
+
+        let value = self.config.get("", "idle_timeout").unwrap_or_default();
+        let idle_timeout = if value.is_empty() {
+            DEFAULT_IDLE_TIMEOUT
+        } else {
+            crate::types::parse_duration(&value)?
+        };
+
+        let builder = builder
+            .pool_max_idle_per_host(max_idle_connections)
+            .pool_idle_timeout(idle_timeout)
+            // Grow the HTTP/2 window with the connection, big uploads are slow otherwise.
+            .http2_adaptive_window(true);
+
+        let builder = match self.config.get("", "http2").unwrap_or_default().as_str() {
+            "" | "auto" => builder,
+            "enabled" => builder.http2_prior_knowledge(),
+            "disabled" => builder.http1_only(),
+            value => {
+                return Err(anyhow::anyhow!(
+                    "invalid http2 `{}`, expected auto, enabled or disabled",
+                    value
+                ))
+            }
+        };
+
+        tls(&*self.config, builder)
+    }
+
+    /// Return the maximum size in bytes of an API response body we will read into memory.
+    ///
+    /// This only covers the responses we read ourselves, e.g. in `kittycad api`, listings,
+    /// file conversions and preset imports. The typed client reads the responses of its
+    /// calls whole.
+    pub fn max_body_size(&self) -> Result<u64> {
+        let value = self.config.get("", "max_body_size").unwrap_or_default();
+        if value.is_empty() {
+            return Ok(crate::http_body::DEFAULT_MAX_BODY_SIZE);
+        }
+
+        value
+            .parse::<u64>()
+            .map_err(|_| anyhow::anyhow!("invalid max_body_size `{}`, expected a number of bytes", value))
+    }
+
     /// Read the file at the given path and returns the contents.
     /// If "-" is given, read from stdin.
     pub fn read_file(&mut self, filename: &str) -> Result<Vec<u8>> {
@@ -153,6 +436,55 @@ impl Context<'_> {
     }
 }
 
+/// Set up the proxy and certificates of an HTTP client with the `http_proxy`, `ca_bundle`
+/// and `insecure_skip_verify` settings, for users behind a proxy that intercepts TLS.
+/// A warning is printed once per command if `insecure_skip_verify` is set.
+///
+/// Without `http_proxy`, reqwest already sends requests through the proxies of the
+/// `HTTP_PROXY`, `HTTPS_PROXY` and `NO_PROXY` environment variables.
+pub fn tls(config: &dyn Config, builder: reqwest::ClientBuilder) -> Result<reqwest::ClientBuilder> {
+    let mut builder = builder;
+
+    let value = config.get("", "http_proxy").unwrap_or_default();
+    if !value.is_empty() {
+        let proxy =
+            reqwest::Proxy::all(&value).map_err(|err| anyhow::anyhow!("invalid http_proxy `{}`: {}", value, err))?;
+        builder = builder.proxy(proxy);
+    }
+
+    let value = config.get("", "ca_bundle").unwrap_or_default();
+    if !value.is_empty() {
+        let pem =
+            std::fs::read(&value).map_err(|err| anyhow::anyhow!("could not read ca_bundle `{}`: {}", value, err))?;
+        let certificate = reqwest::Certificate::from_pem(&pem)
+            .map_err(|err| anyhow::anyhow!("invalid ca_bundle `{}`: {}", value, err))?;
+        builder = builder.add_root_certificate(certificate);
+    }
+
+    if config.get("", "insecure_skip_verify").unwrap_or_default() == "true" {
+        // Nobody should forget that anyone in the middle can read and change everything.
+        static WARNING: std::sync::Once = std::sync::Once::new();
+        WARNING.call_once(|| {
+            eprintln!(
+                "warning: insecure_skip_verify is set, the certificates of the servers we talk to are not checked"
+            )
+        });
+        builder = builder.danger_accept_invalid_certs(true);
+    }
+
+    Ok(builder)
+}
+
+/// Returns an HTTP client for downloads from outside the API, which goes through the same
+/// proxy and trusts the same certificates as the API client, and gives up after `timeout`.
+pub fn http_client(config: &dyn Config, timeout: std::time::Duration) -> Result<reqwest::Client> {
+    let builder = reqwest::Client::builder()
+        .user_agent(format!("kittycad/{}", clap::crate_version!()))
+        .timeout(timeout);
+
+    Ok(tls(config, builder)?.build()?)
+}
+
 #[cfg(test)]
 mod test {
     use pretty_assertions::assert_eq;
@@ -200,6 +532,99 @@ mod test {
         want_terminal_width_override: i32,
     }
 
+    #[test]
+    fn test_with_io() {
+        use std::io::Write;
+
+        let mut config = crate::config::new_blank_config().unwrap();
+        config.set("", "prompt", "disabled").unwrap();
+
+        let (io, stdout_path, _) = crate::iostreams::IoStreams::test();
+        let mut ctx = Context::with_io(&mut config, io);
+        assert!(ctx.io.get_never_prompt());
+
+        writeln!(ctx.io.out, "hello").unwrap();
+        assert_eq!(std::fs::read_to_string(&stdout_path).unwrap(), "hello\n");
+    }
+
+    #[test]
+    fn test_client_options_user_agent() {
+        let version = clap::crate_version!();
+
+        let options = ClientOptions::default();
+        assert_eq!(options.user_agent(), format!("kittycad/{}", version));
+
+        let options = ClientOptions {
+            user_agent_suffix: "my-tool/1.0".to_string(),
+            ..Default::default()
+        };
+        assert_eq!(options.user_agent(), format!("kittycad/{} my-tool/1.0", version));
+    }
+
+    #[test]
+    fn test_transport() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        let mut ctx = Context::new(&mut config);
+        assert!(ctx.transport(reqwest::Client::builder()).is_ok());
+
+        ctx.config.set("", "idle_timeout", "30s").unwrap();
+        ctx.config.set("", "http2", "disabled").unwrap();
+        assert!(ctx.transport(reqwest::Client::builder()).is_ok());
+        assert!(ctx.config.set("", "http2", "sometimes").is_err());
+
+        ctx.config.set("", "max_idle_connections", "lots").unwrap();
+        assert_eq!(
+            ctx.transport(reqwest::Client::builder()).unwrap_err().to_string(),
+            "invalid max_idle_connections `lots`, expected a number of connections"
+        );
+    }
+
+    #[test]
+    fn test_transport_tls() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        let mut ctx = Context::new(&mut config);
+
+        ctx.config
+            .set("", "http_proxy", "http://proxy.example.com:3128")
+            .unwrap();
+        ctx.config.set("", "insecure_skip_verify", "true").unwrap();
+        assert!(ctx.transport(reqwest::Client::builder()).is_ok());
+        assert!(ctx.config.set("", "insecure_skip_verify", "yes").is_err());
+
+        ctx.config.set("", "ca_bundle", "/nope/ca.pem").unwrap();
+        assert!(ctx
+            .transport(reqwest::Client::builder())
+            .unwrap_err()
+            .to_string()
+            .starts_with("could not read ca_bundle `/nope/ca.pem`: "));
+    }
+
+    #[test]
+    fn test_download_client() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        let mut ctx = Context::new(&mut config);
+        assert!(ctx.download_client().is_ok());
+
+        ctx.config.set("", "ca_bundle", "/nope/ca.pem").unwrap();
+        assert!(ctx
+            .download_client()
+            .unwrap_err()
+            .to_string()
+            .starts_with("could not read ca_bundle `/nope/ca.pem`: "));
+    }
+
+    #[test]
+    fn test_format() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        let mut ctx = Context::new(&mut config);
+
+        assert_eq!(ctx.format(&None).unwrap(), FormatOutput::Table);
+
+        ctx.output_format = Some(FormatOutput::Json);
+        assert_eq!(ctx.format(&None).unwrap(), FormatOutput::Json);
+        assert_eq!(ctx.format(&Some(FormatOutput::Yaml)).unwrap(), FormatOutput::Yaml);
+    }
+
     #[test_context(TContext)]
     #[test]
     #[serial_test::serial]
@@ -0,0 +1,265 @@
+use std::{collections::BTreeMap, fs, io::Write};
+
+use anyhow::{Context, Result};
+
+/// A flag that is going away.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Deprecation {
+    /// The command the flag belongs to, e.g. "file convert".
+    pub command: &'static str,
+    /// The flag, e.g. "--src-format".
+    pub flag: &'static str,
+    /// The version the flag was deprecated in.
+    pub since: &'static str,
+    /// The version the flag is removed in, from this version on using it is an error.
+    pub removed_in: &'static str,
+    /// What to use instead.
+    pub replacement: &'static str,
+}
+
+/// Every deprecated flag.
+///
+/// Deprecate a flag by adding it here rather than printing a warning by hand, so users
+/// get the same warning everywhere and it shows up in `kittycad help deprecations`.
+pub const DEPRECATIONS: &[Deprecation] = &[];
+
+/// Returns true if the deprecated flag was passed to its command.
+fn is_used(deprecation: &Deprecation, app: &clap::Command, matches: &clap::ArgMatches) -> bool {
+    let mut app = app;
+    let mut matches = matches;
+    for name in deprecation.command.split_whitespace() {
+        match (matches.subcommand(), app.find_subcommand(name)) {
+            (Some((used, sub_matches)), Some(sub)) if used == name => {
+                app = sub;
+                matches = sub_matches;
+            }
+            _ => return false,
+        }
+    }
+
+    app.get_arguments().any(|arg| {
+        arg.get_long() == deprecation.flag.strip_prefix("--")
+            && matches.value_source(arg.get_id()) == Some(clap::ValueSource::CommandLine)
+    })
+}
+
+/// Check the parsed command line for deprecated flags.
+///
+/// Flags that have been removed in `version` are an error. For the others we print a
+/// warning, at most once a day per flag so scripts don't get noisy. Without a state file
+/// to remember the warnings in, we print them every time.
+pub fn check(
+    ctx: &mut crate::context::Context,
+    app: &clap::Command,
+    matches: &clap::ArgMatches,
+    version: &str,
+    deprecations: &[Deprecation],
+    state_file: Option<&str>,
+) -> Result<()> {
+    let mut warned = state_file.map(load_state).unwrap_or_default();
+    let mut changed = false;
+
+    for deprecation in deprecations.iter().filter(|d| is_used(d, app, matches)) {
+        if !crate::update::version_greater_then(deprecation.removed_in, version)? {
+            anyhow::bail!(
+                "`{}` was removed from `kittycad {}` in v{}, use {} instead",
+                deprecation.flag,
+                deprecation.command,
+                deprecation.removed_in,
+                deprecation.replacement
+            );
+        }
+
+        let key = format!("{} {}", deprecation.command, deprecation.flag);
+        let now = chrono::Utc::now();
+        if let Some(last) = warned.get(&key) {
+            if now.signed_duration_since(*last) < chrono::Duration::days(1) {
+                continue;
+            }
+        }
+
+        let cs = ctx.io.color_scheme();
+        writeln!(
+            ctx.io.err_out,
+            "{} `{}` is deprecated and will be removed in v{}, use {} instead. See `kittycad help deprecations`.",
+            cs.warning_icon(),
+            deprecation.flag,
+            deprecation.removed_in,
+            deprecation.replacement
+        )?;
+
+        warned.insert(key, now);
+        changed = true;
+    }
+
+    if let (true, Some(state_file)) = (changed, state_file) {
+        // Failing to remember a warning only means we show it again, so don't fail the command.
+        if let Err(err) = save_state(state_file, &warned) {
+            log::debug!("failed to save deprecation state: {}", err);
+        }
+    }
+
+    Ok(())
+}
+
+/// Returns the `kittycad help deprecations` help topic.
+pub fn help_topic(deprecations: &[Deprecation]) -> Result<String> {
+    if deprecations.is_empty() {
+        return Ok("No flags are currently deprecated.\n".to_string());
+    }
+
+    let mut tw = tabwriter::TabWriter::new(vec![]);
+    writeln!(tw, "COMMAND\tFLAG\tDEPRECATED IN\tREMOVED IN\tUSE INSTEAD")?;
+    for d in deprecations {
+        writeln!(
+            tw,
+            "kittycad {}\t{}\tv{}\tv{}\t{}",
+            d.command, d.flag, d.since, d.removed_in, d.replacement
+        )?;
+    }
+    tw.flush()?;
+
+    Ok(format!(
+        "Deprecated flags and the version they will be removed in. Until then using one\nprints a warning, at most once a day, and after that it is an error.\n\n{}",
+        String::from_utf8(tw.into_inner()?)?
+    ))
+}
+
+/// Returns when we last warned about each flag.
+fn load_state(filepath: &str) -> BTreeMap<String, chrono::DateTime<chrono::Utc>> {
+    fs::read_to_string(filepath)
+        .ok()
+        .and_then(|content| toml::from_str(&content).ok())
+        .unwrap_or_default()
+}
+
+fn save_state(filepath: &str, warned: &BTreeMap<String, chrono::DateTime<chrono::Utc>>) -> Result<()> {
+    let content = toml::to_string(warned)?;
+
+    // Make sure we have a parent directory.
+    let path = std::path::Path::new(&filepath);
+    let parent = path.parent().unwrap();
+    fs::create_dir_all(parent).with_context(|| format!("failed to create directory {}", parent.display()))?;
+
+    fs::write(filepath, content).with_context(|| format!("failed to write file {}", filepath))?;
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    const TEST_DEPRECATIONS: &[Deprecation] = &[Deprecation {
+        command: "file convert",
+        flag: "--old",
+        since: "0.1.0",
+        removed_in: "0.3.0",
+        replacement: "`--new`",
+    }];
+
+    /// A command line with `kittycad file convert --old` in it.
+    fn app() -> clap::Command<'static> {
+        let file = |name| {
+            clap::Command::new(name)
+                .arg(clap::Arg::new("input").multiple_values(true))
+                .arg(clap::Arg::new("old").long("old"))
+                .arg(clap::Arg::new("older").long("older"))
+        };
+
+        clap::Command::new("kittycad")
+            .arg(clap::Arg::new("debug").long("debug").global(true))
+            .arg(clap::Arg::new("timeout").long("timeout").takes_value(true))
+            .subcommand(
+                clap::Command::new("file")
+                    .subcommand(file("convert"))
+                    .subcommand(file("volume")),
+            )
+    }
+
+    fn matches(args: &str) -> clap::ArgMatches {
+        app().get_matches_from(args.split_whitespace())
+    }
+
+    #[test]
+    fn test_is_used() {
+        let d = &TEST_DEPRECATIONS[0];
+
+        assert!(is_used(d, &app(), &matches("kittycad file convert a.obj b.step --old")));
+        assert!(is_used(
+            d,
+            &app(),
+            &matches("kittycad --debug file convert --old a.obj b.step")
+        ));
+        assert!(is_used(
+            d,
+            &app(),
+            &matches("kittycad --timeout 30s file convert a.obj --old")
+        ));
+        assert!(!is_used(
+            d,
+            &app(),
+            &matches("kittycad file convert a.obj b.step --older")
+        ));
+        assert!(!is_used(d, &app(), &matches("kittycad file volume a.obj --old")));
+        assert!(!is_used(d, &app(), &matches("kittycad file")));
+    }
+
+    #[test]
+    fn test_check() {
+        let dir = tempfile::tempdir().unwrap();
+        let state_file = dir.path().join("deprecations.toml");
+        let state_file = state_file.to_str().unwrap();
+
+        let mut config = crate::config::new_blank_config().unwrap();
+        let mut c = crate::config_from_env::EnvConfig::inherit_env(&mut config);
+        let (mut io, _stdout_path, stderr_path) = crate::iostreams::IoStreams::test();
+        io.set_color_enabled(false);
+        let mut ctx = crate::context::Context::with_io(&mut c, io);
+
+        let used = matches("kittycad file convert a.obj b.step --old");
+
+        // We warn once, then stay quiet for a day.
+        for _ in 0..2 {
+            check(&mut ctx, &app(), &used, "0.2.0", TEST_DEPRECATIONS, Some(state_file)).unwrap();
+        }
+        let stderr = std::fs::read_to_string(&stderr_path).unwrap();
+        assert_eq!(
+            stderr
+                .matches("`--old` is deprecated and will be removed in v0.3.0")
+                .count(),
+            1,
+            "{}",
+            stderr
+        );
+
+        // Without a state file, we warn every time.
+        for _ in 0..2 {
+            check(&mut ctx, &app(), &used, "0.2.0", TEST_DEPRECATIONS, None).unwrap();
+        }
+        let stderr = std::fs::read_to_string(&stderr_path).unwrap();
+        assert_eq!(stderr.matches("`--old` is deprecated").count(), 3, "{}", stderr);
+
+        // Once removed, it is an error.
+        assert_eq!(
+            check(&mut ctx, &app(), &used, "0.3.0", TEST_DEPRECATIONS, Some(state_file))
+                .unwrap_err()
+                .to_string(),
+            "`--old` was removed from `kittycad file convert` in v0.3.0, use `--new` instead"
+        );
+    }
+
+    #[test]
+    fn test_help_topic() {
+        assert_eq!(help_topic(&[]).unwrap(), "No flags are currently deprecated.\n");
+
+        let topic = help_topic(TEST_DEPRECATIONS).unwrap();
+        assert!(
+            topic.contains("kittycad file convert  --old  v0.1.0         v0.3.0      `--new`"),
+            "{}",
+            topic
+        );
+    }
+}
@@ -109,10 +109,6 @@ fn do_markdown(doc: &mut MarkdownDocument, app: &Command, title: &str) -> Result
                 desc.push_str("</code>");
             }
 
-            if arg.get_long().unwrap_or_default() == "shell" {
-                println!("{:?}", arg);
-            }
-
             let values = arg.get_default_values();
             if !values.is_empty() {
                 desc.push_str("<br/>Default value: <code>");
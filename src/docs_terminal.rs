@@ -0,0 +1,136 @@
+use anyhow::{anyhow, Result};
+use clap::Command;
+
+/// Returns the documentation of a command, the same page `kittycad generate markdown`
+/// writes for the website, rendered for the terminal.
+///
+/// Everything on the page comes from the command definitions, so this works offline.
+pub fn help_page(app: &Command, path: &[String], cs: &crate::colors::ColorScheme) -> Result<String> {
+    let mut cmd = app;
+    let mut title = app.get_name().to_string();
+    for name in path {
+        cmd = cmd
+            .find_subcommand(name)
+            .ok_or_else(|| anyhow!("unknown command `{} {}`", title, name))?;
+        title = format!("{} {}", title, cmd.get_name());
+    }
+
+    let markdown = crate::docs_markdown::app_to_markdown(cmd, &title)?;
+
+    Ok(format!("{}\n\n{}", cs.bold(&title), render(&markdown, cs)?))
+}
+
+/// Render markdown for the terminal: headings in bold, code indented and in gray, and
+/// the lists of options the markdown has as HTML as plain text.
+pub fn render(markdown: &str, cs: &crate::colors::ColorScheme) -> Result<String> {
+    use pulldown_cmark::{Event, Tag};
+
+    let mut s = String::new();
+    let mut heading = None;
+    let mut in_code_block = false;
+    for event in pulldown_cmark::Parser::new(markdown) {
+        match event {
+            Event::Start(Tag::Heading(..)) => heading = Some(String::new()),
+            Event::End(Tag::Heading(..)) => {
+                let text = heading.take().unwrap_or_default();
+                s.push_str(&format!("{}\n\n", cs.bold(&text.to_uppercase())));
+            }
+            Event::Start(Tag::CodeBlock(_)) => in_code_block = true,
+            Event::End(Tag::CodeBlock(_)) => {
+                in_code_block = false;
+                s.push('\n');
+            }
+            Event::Start(Tag::Item) => s.push_str("  • "),
+            Event::End(Tag::Item) => s.push('\n'),
+            Event::End(Tag::List(_)) => s.push('\n'),
+            Event::End(Tag::Paragraph) => s.push_str("\n\n"),
+            Event::Text(text) => match &mut heading {
+                Some(heading) => heading.push_str(&text),
+                None if in_code_block => {
+                    for line in text.lines() {
+                        s.push_str(&format!("    {}\n", cs.gray(line)));
+                    }
+                }
+                None => s.push_str(&text),
+            },
+            Event::Code(code) => s.push_str(&cs.cyan(&code)),
+            Event::Html(html) => s.push_str(&html_to_text(&html)?),
+            Event::SoftBreak | Event::HardBreak => s.push('\n'),
+            _ => {}
+        }
+    }
+
+    Ok(s.trim_end().to_string() + "\n")
+}
+
+/// Returns the text of the HTML the markdown has, which is only the list of options.
+fn html_to_text(html: &str) -> Result<String> {
+    let html = html
+        .trim_start()
+        .replace("<dt>", "  ")
+        .replace("</dt>", "")
+        .replace("<dd>", "      ")
+        .replace("</dd>", "\n")
+        .replace("<br/>", "\n      ");
+
+    let tags = regex::Regex::new(r"</?[a-z][^>]*>")?;
+    let text = tags.replace_all(&html, "");
+
+    Ok(text.trim_start_matches('\n').to_string())
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_render() {
+        let cs = crate::colors::ColorScheme::new(false, false, false);
+
+        let markdown = r#"Convert a file.
+
+### Options
+
+<dl class="flags">
+   <dt><code>-t/--output-format</code></dt>
+   <dd>A valid output file format.<br/>Possible values: <code>obj | stl</code></dd>
+</dl>
+
+### About
+
+Run `kittycad file convert` with:
+
+```
+$ kittycad file convert a.step a.obj
+```
+"#;
+        let text = render(markdown, &cs).unwrap();
+        assert!(text.starts_with("Convert a file.\n\nOPTIONS\n\n"), "{}", text);
+        assert!(
+            text.contains(
+                "  -t/--output-format\n      A valid output file format.\n      Possible values: obj | stl\n"
+            ),
+            "{}",
+            text
+        );
+        assert!(text.contains("ABOUT\n\nRun kittycad file convert with:\n"), "{}", text);
+        assert!(text.ends_with("    $ kittycad file convert a.step a.obj\n"), "{}", text);
+        assert!(!text.contains('<'), "{}", text);
+    }
+
+    #[test]
+    fn test_help_page() {
+        let cs = crate::colors::ColorScheme::new(false, false, false);
+        let app = crate::cmd_generate::test_app();
+
+        let page = help_page(&app, &["stash".to_string(), "push".to_string()], &cs).unwrap();
+        assert!(page.starts_with("git stash push\n\n"), "{}", page);
+
+        assert_eq!(
+            help_page(&app, &["nope".to_string()], &cs).unwrap_err().to_string(),
+            "unknown command `git nope`"
+        );
+    }
+}
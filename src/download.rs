@@ -0,0 +1,261 @@
+use anyhow::Result;
+
+/// Download and parse the JSON body of `GET uri`, keeping what has arrived in `part` so a
+/// download that is cut short can be picked up where it left off with a Range request.
+///
+/// The API doesn't promise to honor ranges, if it answers with the whole body rather
+/// than the rest of it we start over. We only ask for the rest with the ETag of the body
+/// we have, kept next to the part file, so if the body changed in between we get all of
+/// the new one rather than the end of it. The part file is removed once the body has
+/// been parsed.
+pub async fn resumable_json<T: serde::de::DeserializeOwned>(
+    ctx: &crate::context::Context<'_>,
+    uri: &str,
+    part: &std::path::Path,
+) -> Result<T> {
+    let etag = std::fs::read_to_string(etag_path(part)).ok();
+    let offset = match &etag {
+        Some(_) => std::fs::metadata(part).map(|m| m.len()).unwrap_or(0),
+        None => 0,
+    };
+
+    let client = ctx.api_client("")?;
+    let mut req = client.request_raw(http::Method::GET, uri, None).await?;
+    if let Some(etag) = etag.as_ref().filter(|_| offset > 0) {
+        req = req
+            .header(reqwest::header::RANGE, range(offset))
+            .header(reqwest::header::IF_RANGE, etag.as_str());
+    }
+    let resp = crate::http_log::send(&ctx.http_log(), req).await?;
+
+    let status = resp.status();
+    let append = match status {
+        http::StatusCode::PARTIAL_CONTENT => true,
+        // We already have all of it.
+        http::StatusCode::RANGE_NOT_SATISFIABLE if offset > 0 => return finish(part),
+        status if status.is_success() => false,
+        status => {
+            return Err(crate::cmd::ExitCodeError {
+                code: crate::exit_code::for_status(status),
+                message: format!(
+                    "{} {}: {}",
+                    status,
+                    status.canonical_reason().unwrap_or(""),
+                    resp.text().await.unwrap_or_default()
+                ),
+            }
+            .into())
+        }
+    };
+
+    let resp_etag = resp
+        .headers()
+        .get(reqwest::header::ETAG)
+        .and_then(|value| value.to_str().ok())
+        // A weak ETag can't be used to resume.
+        .filter(|value| !value.starts_with("W/"))
+        .map(|value| value.to_string());
+    if append && resp_etag != etag {
+        remove(part)?;
+        anyhow::bail!("the response changed while it was downloading, run the command again");
+    }
+    if !append {
+        // What we have is of another body, if any, so it goes.
+        match &resp_etag {
+            Some(resp_etag) => std::fs::write(etag_path(part), resp_etag)?,
+            None => remove_etag(part)?,
+        }
+    }
+
+    let mut file = std::fs::OpenOptions::new()
+        .create(true)
+        .write(true)
+        .append(append)
+        .truncate(!append)
+        .open(part)?;
+    let start = if append { offset } else { 0 };
+
+    let progress = ctx.io.progress_indicator_enabled().then(|| {
+        let mut progress = ctx
+            .io
+            .progress("Downloading", start + resp.content_length().unwrap_or(0));
+        progress.add(start as usize);
+        progress
+    });
+    if let Err(err) = crate::http_body::copy_to_with_progress(resp, &mut file, ctx.limit_rate()?, progress).await {
+        let got = std::fs::metadata(part).map(|m| m.len()).unwrap_or(0);
+        return Err(crate::cmd::ExitCodeError {
+            code: crate::exit_code::NETWORK,
+            message: format!(
+                "the download was cut short after {}, run the command again with `--resume` to pick it up where it left off: {}",
+                crate::types::format_bytes(got),
+                err
+            ),
+        }
+        .into());
+    }
+
+    finish(part)
+}
+
+/// Returns the value of a Range header asking for everything from `offset` on.
+fn range(offset: u64) -> String {
+    format!("bytes={}-", offset)
+}
+
+/// Returns where the ETag of the body being downloaded to a part file is kept.
+fn etag_path(part: &std::path::Path) -> std::path::PathBuf {
+    let mut path = part.as_os_str().to_owned();
+    path.push(".etag");
+    path.into()
+}
+
+fn remove_etag(part: &std::path::Path) -> Result<()> {
+    match std::fs::remove_file(etag_path(part)) {
+        Err(err) if err.kind() != std::io::ErrorKind::NotFound => Err(err.into()),
+        _ => Ok(()),
+    }
+}
+
+/// Remove a part file and its ETag.
+fn remove(part: &std::path::Path) -> Result<()> {
+    std::fs::remove_file(part)?;
+    remove_etag(part)
+}
+
+/// Parse a downloaded body and remove its part file.
+fn finish<T: serde::de::DeserializeOwned>(part: &std::path::Path) -> Result<T> {
+    let value = match serde_json::from_slice(&std::fs::read(part)?) {
+        Ok(value) => value,
+        Err(err) => {
+            // A body we can't parse can't be finished by resuming, so don't keep it.
+            remove(part)?;
+            anyhow::bail!("the downloaded body is not valid JSON, run the command again: {}", err);
+        }
+    };
+    remove(part)?;
+
+    Ok(value)
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+    use tokio::io::{AsyncReadExt, AsyncWriteExt};
+
+    /// The body the mock API serves, and its ETag.
+    const BODY: &str = r#"{"a": 1, "b": 2}"#;
+    const ETAG: &str = "\"v1\"";
+
+    /// Answer a request to the mock API, with the rest of the body if it asks for a range
+    /// of the body with our ETag, and all of it otherwise.
+    fn respond(request: &str) -> String {
+        let from = request
+            .lines()
+            .find_map(|line| line.to_lowercase().strip_prefix("range: bytes=").map(|r| r.to_string()))
+            .filter(|_| {
+                request
+                    .lines()
+                    .any(|line| line.to_lowercase() == format!("if-range: {}", ETAG))
+            });
+        let (status, body) = match from {
+            Some(from) => (
+                "206 Partial Content",
+                &BODY[from.trim_end_matches('-').parse::<usize>().unwrap()..],
+            ),
+            None => ("200 OK", BODY),
+        };
+
+        format!(
+            "HTTP/1.1 {}\r\netag: {}\r\ncontent-length: {}\r\nconnection: close\r\n\r\n{}",
+            status,
+            ETAG,
+            body.len(),
+            body
+        )
+    }
+
+    /// Start a mock API that answers every request with `respond`, returning its URL.
+    async fn serve() -> String {
+        let listener = tokio::net::TcpListener::bind("127.0.0.1:0").await.unwrap();
+        let url = format!("http://{}", listener.local_addr().unwrap());
+
+        tokio::spawn(async move {
+            loop {
+                let (mut socket, _) = listener.accept().await.unwrap();
+                let mut request = Vec::new();
+                let mut buf = [0; 1024];
+                while !request.windows(4).any(|w| w == b"\r\n\r\n") {
+                    let n = socket.read(&mut buf).await.unwrap();
+                    if n == 0 {
+                        break;
+                    }
+                    request.extend_from_slice(&buf[..n]);
+                }
+
+                let response = respond(&String::from_utf8_lossy(&request));
+                socket.write_all(response.as_bytes()).await.unwrap();
+                let _ = socket.shutdown().await;
+            }
+        });
+
+        url
+    }
+
+    #[tokio::test(flavor = "multi_thread")]
+    async fn test_resumable_json() {
+        use crate::config::Config;
+
+        let dir = tempfile::tempdir().unwrap();
+        let part = dir.path().join("call.part");
+        let etag = super::etag_path(&part);
+        let want = serde_json::json!({"a": 1, "b": 2});
+
+        let mut config = crate::config::new_blank_config().unwrap();
+        config.set("example.org", "user", "me").unwrap();
+        let (io, _, _) = crate::iostreams::IoStreams::test();
+        let mut ctx = crate::context::Context::with_io(&mut config, io);
+        ctx.token = Some("my-token".to_string());
+        ctx.endpoint = Some(serve().await);
+
+        // Picked up where it left off.
+        std::fs::write(&part, &BODY[..8]).unwrap();
+        std::fs::write(&etag, ETAG).unwrap();
+        let value: serde_json::Value = super::resumable_json(&ctx, "/call", &part).await.unwrap();
+        assert_eq!(value, want);
+        assert!(!part.exists());
+        assert!(!etag.exists());
+
+        // The body changed since, so we get all of the new one.
+        std::fs::write(&part, r#"{"old": "#).unwrap();
+        std::fs::write(&etag, "\"v0\"").unwrap();
+        let value: serde_json::Value = super::resumable_json(&ctx, "/call", &part).await.unwrap();
+        assert_eq!(value, want);
+
+        // Without an ETag we can't tell, so we start over too.
+        std::fs::write(&part, r#"{"old": "#).unwrap();
+        let value: serde_json::Value = super::resumable_json(&ctx, "/call", &part).await.unwrap();
+        assert_eq!(value, want);
+        assert!(!part.exists());
+    }
+
+    #[test]
+    fn test_range() {
+        assert_eq!(super::range(1024), "bytes=1024-");
+    }
+
+    #[test]
+    fn test_finish() {
+        let dir = tempfile::tempdir().unwrap();
+        let part = dir.path().join("call.part");
+
+        std::fs::write(&part, r#"{"a": 1}"#).unwrap();
+        let value: serde_json::Value = super::finish(&part).unwrap();
+        assert_eq!(value, serde_json::json!({"a": 1}));
+        assert!(!part.exists());
+
+        std::fs::write(&part, r#"{"a": "#).unwrap();
+        assert!(super::finish::<serde_json::Value>(&part).is_err());
+        assert!(!part.exists());
+    }
+}
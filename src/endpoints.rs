@@ -0,0 +1,149 @@
+use std::time::Duration;
+
+use anyhow::{anyhow, Result};
+
+/// How long we wait for an endpoint to answer a ping before trying the next one.
+const PING_TIMEOUT: Duration = Duration::from_secs(2);
+
+/// Returns the base URL of a host, e.g. "https://api.kittycad.io" for "api.kittycad.io".
+pub fn base_url(host: &str) -> String {
+    if host.starts_with("http://") || host.starts_with("https://") {
+        host.trim_end_matches('/').to_string()
+    } else if host.starts_with("localhost") {
+        format!("http://{}", host)
+    } else {
+        format!("https://{}", host)
+    }
+}
+
+/// Returns the base URLs of the endpoints set for the host with `endpoints`, in the order
+/// we try them.
+pub fn configured(config: &dyn crate::config::Config, host: &str) -> Vec<String> {
+    config
+        .get(host, "endpoints")
+        .unwrap_or_default()
+        .split(',')
+        .map(|endpoint| endpoint.trim())
+        .filter(|endpoint| !endpoint.is_empty())
+        .map(base_url)
+        .collect()
+}
+
+/// Returns true if the endpoint answers a ping in time.
+async fn is_healthy(client: &reqwest::Client, endpoint: &str) -> bool {
+    match client.get(format!("{}/ping", endpoint)).send().await {
+        Ok(resp) => resp.status().is_success(),
+        Err(err) => {
+            log::debug!("endpoint {} is not healthy: {}", endpoint, err);
+            false
+        }
+    }
+}
+
+/// Returns the first healthy endpoint of the host, if it has endpoints set. Endpoints
+/// the `allowed_hosts` policy forbids are never pinged.
+///
+/// If none of them are healthy we use the first one, so the command fails with the
+/// error from the API rather than ours.
+pub fn pick(config: &dyn crate::config::Config, host: &str) -> Result<Option<String>> {
+    if crate::policy::check_host(config, host).is_err() {
+        return Ok(None);
+    }
+    let endpoints: Vec<String> = configured(config, host)
+        .into_iter()
+        .filter(|endpoint| crate::policy::check_host(config, endpoint).is_ok())
+        .collect();
+    if endpoints.is_empty() {
+        return Ok(None);
+    }
+
+    // We pick while building a client, in code that is already running on the runtime,
+    // so the pings get a runtime of their own on another thread.
+    let builder = crate::context::tls(config, reqwest::Client::builder().timeout(PING_TIMEOUT))?;
+    let first = endpoints.first().cloned();
+    let healthy = std::thread::spawn(move || -> Result<Option<String>> {
+        let runtime = tokio::runtime::Builder::new_current_thread().enable_all().build()?;
+        let client = builder.build()?;
+        Ok(runtime.block_on(async {
+            for endpoint in endpoints {
+                if is_healthy(&client, &endpoint).await {
+                    return Some(endpoint);
+                }
+            }
+            None
+        }))
+    })
+    .join()
+    .map_err(|_| anyhow!("failed to check the endpoints"))??;
+
+    Ok(healthy.or(first))
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+    use crate::config::Config;
+
+    #[test]
+    fn test_base_url() {
+        assert_eq!(base_url("api.kittycad.io"), "https://api.kittycad.io");
+        assert_eq!(base_url("localhost:8888"), "http://localhost:8888");
+        assert_eq!(base_url("http://10.0.0.1:8080/"), "http://10.0.0.1:8080");
+    }
+
+    #[test]
+    fn test_configured() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        assert_eq!(configured(&config, "kittycad.internal"), Vec::<String>::new());
+
+        config
+            .set(
+                "kittycad.internal",
+                "endpoints",
+                "a.kittycad.internal, http://10.0.0.2:8080,",
+            )
+            .unwrap();
+        assert_eq!(
+            configured(&config, "kittycad.internal"),
+            vec!["https://a.kittycad.internal", "http://10.0.0.2:8080"]
+        );
+    }
+
+    #[tokio::test(flavor = "multi_thread")]
+    async fn test_is_healthy() {
+        let client = reqwest::Client::builder().timeout(PING_TIMEOUT).build().unwrap();
+        assert!(!is_healthy(&client, "http://127.0.0.1:1").await);
+    }
+
+    #[test]
+    fn test_pick() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        assert_eq!(pick(&config, "kittycad.internal").unwrap(), None);
+
+        // Nothing answers, so we use the first one.
+        config
+            .set(
+                "kittycad.internal",
+                "endpoints",
+                "http://127.0.0.1:1, http://127.0.0.1:2",
+            )
+            .unwrap();
+        assert_eq!(
+            pick(&config, "kittycad.internal").unwrap(),
+            Some("http://127.0.0.1:1".to_string())
+        );
+
+        // Endpoints the policy forbids are left out.
+        config
+            .set("", "allowed_hosts", "kittycad.internal, 127.0.0.1:2")
+            .unwrap();
+        assert_eq!(
+            pick(&config, "kittycad.internal").unwrap(),
+            Some("http://127.0.0.1:2".to_string())
+        );
+        config.set("", "allowed_hosts", "api.kittycad.io").unwrap();
+        assert_eq!(pick(&config, "kittycad.internal").unwrap(), None);
+    }
+}
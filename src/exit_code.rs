@@ -0,0 +1,130 @@
+// The codes `kittycad` exits with are a contract with scripts, a code must never change
+// meaning once released. New failures get a new code.
+
+/// Any error that doesn't have a code of its own.
+pub const ERROR: i32 = 1;
+/// The API call or file conversion failed on the server.
+pub const FAILED: i32 = 2;
+/// The API call or file conversion hasn't finished yet, e.g. with `--no-wait`.
+pub const PENDING: i32 = 3;
+/// Not authenticated, or not authorized to do this.
+pub const AUTH: i32 = 4;
+/// The command line or the request was invalid.
+pub const VALIDATION: i32 = 5;
+/// The API couldn't be reached.
+pub const NETWORK: i32 = 6;
+
+/// The codes and what they mean, in the order `kittycad help exit-codes` lists them. The
+/// descriptions are translated by `help_topic`, see `crate::i18n`.
+fn codes() -> Vec<(i32, &'static str)> {
+    vec![
+        (0, "Success."),
+        (ERROR, "Any error that doesn't have a code of its own."),
+        (
+            FAILED,
+            "The API call or file conversion failed on the server, e.g. the file couldn't be read.",
+        ),
+        (
+            PENDING,
+            "The API call or file conversion hasn't finished yet, with `--no-wait`. Wait for it with `kittycad api-call wait <id>`.",
+        ),
+        (
+            AUTH,
+            "Not authenticated, or not authorized to do this. Log in with `kittycad auth login`.",
+        ),
+        (
+            VALIDATION,
+            "The command line was invalid, or the API rejected the request as invalid (400 or 422).",
+        ),
+        (
+            NETWORK,
+            "The API couldn't be reached, e.g. no connection, a DNS failure or a dropped connection.",
+        ),
+        (crate::INTERRUPTED_EXIT_CODE, "Interrupted with Ctrl-C."),
+    ]
+}
+
+/// Returns the code for an error response from the API.
+pub fn for_status(status: http::StatusCode) -> i32 {
+    match status {
+        http::StatusCode::UNAUTHORIZED | http::StatusCode::FORBIDDEN => AUTH,
+        http::StatusCode::BAD_REQUEST | http::StatusCode::UNPROCESSABLE_ENTITY => VALIDATION,
+        _ => ERROR,
+    }
+}
+
+/// Returns the code to exit with for an error a command returned.
+pub fn for_error(err: &anyhow::Error) -> i32 {
+    if let Some(err) = err.downcast_ref::<crate::cmd::ExitCodeError>() {
+        return err.code;
+    }
+
+    if let Some(err) = err.downcast_ref::<kittycad::types::error::Error>() {
+        return match err.status() {
+            Some(status) => for_status(status),
+            // No response at all means we never got through to the API.
+            None => NETWORK,
+        };
+    }
+
+    if err.downcast_ref::<reqwest::Error>().is_some() {
+        return NETWORK;
+    }
+
+    ERROR
+}
+
+/// Returns the text of `kittycad help exit-codes`.
+pub fn help_topic() -> String {
+    let mut s = format!(
+        "{}\n\n",
+        crate::i18n::tr("kittycad exits with one of these codes, so scripts can tell failures apart:")
+    );
+    for (code, description) in codes() {
+        s.push_str(&format!("  {:>3}  {}\n", code, crate::i18n::tr(description)));
+    }
+
+    s
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_for_error() {
+        assert_eq!(for_error(&anyhow::anyhow!("something went wrong")), ERROR);
+        assert_eq!(
+            for_error(
+                &crate::cmd::ExitCodeError {
+                    code: PENDING,
+                    message: "File conversion is still queued".to_string(),
+                }
+                .into()
+            ),
+            PENDING
+        );
+    }
+
+    #[test]
+    fn test_for_status() {
+        assert_eq!(for_status(http::StatusCode::UNAUTHORIZED), AUTH);
+        assert_eq!(for_status(http::StatusCode::FORBIDDEN), AUTH);
+        assert_eq!(for_status(http::StatusCode::UNPROCESSABLE_ENTITY), VALIDATION);
+        assert_eq!(for_status(http::StatusCode::NOT_FOUND), ERROR);
+        assert_eq!(for_status(http::StatusCode::INTERNAL_SERVER_ERROR), ERROR);
+    }
+
+    #[test]
+    fn test_help_topic() {
+        let topic = help_topic();
+        assert!(
+            topic.contains("\n    3  The API call or file conversion hasn't finished yet"),
+            "{}",
+            topic
+        );
+        assert!(topic.contains("\n  130  Interrupted with Ctrl-C.\n"), "{}", topic);
+    }
+}
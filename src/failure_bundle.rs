@@ -0,0 +1,92 @@
+use anyhow::{Context, Result};
+use serde::Serialize;
+
+/// How much of the input we keep, enough to tell what kind of file it was without
+/// copying a giant model into the state directory.
+const INPUT_HEAD_SIZE: usize = 64 * 1024;
+
+/// What we know about a request that failed, saved so it can be attached when
+/// contacting support instead of re-running the job.
+#[derive(Serialize, Debug, Clone, PartialEq)]
+pub struct FailureBundle {
+    pub command: String,
+    pub cli_version: String,
+    pub method: String,
+    pub endpoint: String,
+    pub params: Vec<(String, String)>,
+    pub input: String,
+    pub input_size: usize,
+    pub started_at: chrono::DateTime<chrono::Utc>,
+    pub duration_secs: f64,
+    pub api_call_id: Option<String>,
+    pub error: String,
+}
+
+/// Returns the part of the input we keep in a bundle.
+pub fn input_head(input: &[u8]) -> Vec<u8> {
+    input[..input.len().min(INPUT_HEAD_SIZE)].to_vec()
+}
+
+/// Save the bundle and the head of the input into a new directory in `dir`, returns
+/// the directory.
+pub fn save(dir: &std::path::Path, bundle: &FailureBundle, input_head: &[u8]) -> Result<std::path::PathBuf> {
+    let name = format!(
+        "{}-{}",
+        bundle.started_at.format("%Y%m%dT%H%M%SZ"),
+        &uuid::Uuid::new_v4().simple().to_string()[..8]
+    );
+    let path = dir.join(name);
+    std::fs::create_dir_all(&path).with_context(|| format!("failed to create directory {}", path.display()))?;
+
+    let file = path.join("bundle.json");
+    std::fs::write(&file, serde_json::to_string_pretty(bundle)?)
+        .with_context(|| format!("failed to write file {}", file.display()))?;
+
+    let file = path.join("input.head");
+    std::fs::write(&file, input_head).with_context(|| format!("failed to write file {}", file.display()))?;
+
+    Ok(path)
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_save() {
+        let dir = tempfile::tempdir().unwrap();
+        let bundle = FailureBundle {
+            command: "file convert".to_string(),
+            cli_version: "0.1.4".to_string(),
+            method: "POST".to_string(),
+            endpoint: "/file/conversion/step/obj".to_string(),
+            params: vec![("a".to_string(), "b".to_string())],
+            input: "my-file.step".to_string(),
+            input_size: INPUT_HEAD_SIZE + 10,
+            started_at: "2022-07-01T10:00:00Z".parse().unwrap(),
+            duration_secs: 1.5,
+            api_call_id: None,
+            error: "500 Internal Server Error".to_string(),
+        };
+        let input = vec![b'x'; INPUT_HEAD_SIZE + 10];
+
+        let path = save(dir.path(), &bundle, &input_head(&input)).unwrap();
+
+        assert!(path.starts_with(dir.path()));
+        assert!(path
+            .file_name()
+            .unwrap()
+            .to_str()
+            .unwrap()
+            .starts_with("20220701T100000Z-"));
+
+        let saved: serde_json::Value =
+            serde_json::from_str(&std::fs::read_to_string(path.join("bundle.json")).unwrap()).unwrap();
+        assert_eq!(saved["error"], "500 Internal Server Error");
+        assert_eq!(saved["params"], serde_json::json!([["a", "b"]]));
+
+        assert_eq!(std::fs::read(path.join("input.head")).unwrap().len(), INPUT_HEAD_SIZE);
+    }
+}
@@ -0,0 +1,352 @@
+use std::str::FromStr;
+
+/// The CAD file formats we can tell apart by their contents.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Format {
+    Step,
+    /// An STL, `binary` if it isn't the ASCII kind.
+    Stl {
+        binary: bool,
+    },
+    Obj,
+    Dae,
+    Fbx,
+    Dxf,
+    Dwg,
+    Ply,
+    Gltf,
+    Glb,
+}
+
+impl std::fmt::Display for Format {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        let name = match self {
+            Format::Step => "step",
+            Format::Stl { .. } => "stl",
+            Format::Obj => "obj",
+            Format::Dae => "dae",
+            Format::Fbx => "fbx",
+            Format::Dxf => "dxf",
+            Format::Dwg => "dwg",
+            Format::Ply => "ply",
+            Format::Gltf => "gltf",
+            Format::Glb => "glb",
+        };
+        write!(f, "{}", name)
+    }
+}
+
+/// What we can tell about a CAD file without sending it to the API.
+#[derive(Debug, Clone, Default, PartialEq, Eq, serde::Serialize, tabled::Tabled)]
+pub struct FileInfo {
+    pub input: String,
+    pub format: String,
+    /// The size of the file in bytes.
+    pub size: usize,
+    /// The unit the file says its lengths are in, if it says.
+    pub units: String,
+    #[tabled(display_with = "display_count")]
+    pub solids: Option<usize>,
+    #[tabled(display_with = "display_count")]
+    pub triangles: Option<usize>,
+    #[tabled(display_with = "display_count")]
+    pub vertices: Option<usize>,
+    #[tabled(display_with = "display_count")]
+    pub faces: Option<usize>,
+}
+
+fn display_count(count: &Option<usize>) -> String {
+    count.map(|count| count.to_string()).unwrap_or_default()
+}
+
+/// The size of the header of a binary STL, before the number of triangles.
+const STL_HEADER_SIZE: usize = 80;
+
+/// The size of a triangle in a binary STL: its normal, 3 vertices and an attribute.
+const STL_TRIANGLE_SIZE: usize = 50;
+
+/// Returns the format of a file from its first bytes, or for text formats, its lines.
+pub fn sniff(data: &[u8]) -> Option<Format> {
+    // Binary STLs can start with `solid` too, but their size gives them away.
+    if let Some(triangles) = stl_binary_triangles(data) {
+        let size = triangles
+            .checked_mul(STL_TRIANGLE_SIZE)
+            .map(|size| size + STL_HEADER_SIZE + 4);
+        if size == Some(data.len()) {
+            return Some(Format::Stl { binary: true });
+        }
+    }
+
+    if data.starts_with(b"glTF") {
+        return Some(Format::Glb);
+    }
+    if data.starts_with(b"Kaydara FBX Binary") {
+        return Some(Format::Fbx);
+    }
+    if data.starts_with(b"AC10") {
+        return Some(Format::Dwg);
+    }
+
+    let head = String::from_utf8_lossy(&data[..data.len().min(4096)]);
+    let head = head.trim_start();
+    if head.starts_with("ISO-10303-21;") {
+        return Some(Format::Step);
+    }
+    if head.starts_with("ply") {
+        return Some(Format::Ply);
+    }
+    if head.starts_with("solid") && head.contains("facet") {
+        return Some(Format::Stl { binary: false });
+    }
+    if head.starts_with("; FBX") {
+        return Some(Format::Fbx);
+    }
+    if head.contains("<COLLADA") {
+        return Some(Format::Dae);
+    }
+    if head.starts_with('{') && head.contains("\"asset\"") {
+        return Some(Format::Gltf);
+    }
+
+    let mut lines = head.lines().map(|line| line.trim());
+    if lines.next() == Some("0") && lines.next() == Some("SECTION") {
+        return Some(Format::Dxf);
+    }
+
+    if head
+        .lines()
+        .any(|line| line.starts_with("v ") || line.starts_with("f "))
+    {
+        return Some(Format::Obj);
+    }
+
+    None
+}
+
+/// Returns the format the API knows the file as, from its contents.
+pub fn source_format(data: &[u8]) -> Option<kittycad::types::FileSourceFormat> {
+    sniff(data).and_then(|format| kittycad::types::FileSourceFormat::from_str(&format.to_string()).ok())
+}
+
+/// Returns what we can tell about a file from its contents.
+pub fn inspect(input: &str, data: &[u8]) -> anyhow::Result<FileInfo> {
+    let format = match sniff(data) {
+        Some(format) => format,
+        None => anyhow::bail!("can't tell what kind of CAD file {} is", input),
+    };
+
+    let mut info = FileInfo {
+        input: input.to_string(),
+        format: format.to_string(),
+        size: data.len(),
+        ..Default::default()
+    };
+
+    if format == (Format::Stl { binary: true }) {
+        info.triangles = stl_binary_triangles(data);
+        return Ok(info);
+    }
+
+    // The rest is read from the text of the file, binary formats have nothing more for us.
+    if matches!(format, Format::Fbx | Format::Dwg | Format::Glb) {
+        return Ok(info);
+    }
+    let text = String::from_utf8_lossy(data);
+
+    match format {
+        Format::Step => {
+            info.solids = Some(text.matches("MANIFOLD_SOLID_BREP(").count());
+            info.units = step_units(&text).to_string();
+        }
+        Format::Stl { .. } => {
+            info.triangles = Some(text.matches("facet normal").count());
+        }
+        Format::Obj => {
+            info.vertices = Some(text.lines().filter(|line| line.starts_with("v ")).count());
+            info.faces = Some(text.lines().filter(|line| line.starts_with("f ")).count());
+        }
+        Format::Ply => {
+            info.vertices = ply_element(&text, "vertex");
+            info.faces = ply_element(&text, "face");
+        }
+        Format::Dxf => {
+            info.units = dxf_units(&text).to_string();
+        }
+        Format::Dae => {
+            info.units = dae_units(&text);
+        }
+        Format::Gltf => {
+            // glTF is always in meters.
+            info.units = "m".to_string();
+        }
+        Format::Fbx | Format::Dwg | Format::Glb => {}
+    }
+
+    Ok(info)
+}
+
+/// Returns the number of triangles a binary STL says it has.
+fn stl_binary_triangles(data: &[u8]) -> Option<usize> {
+    let count = data.get(STL_HEADER_SIZE..STL_HEADER_SIZE + 4)?;
+    Some(u32::from_le_bytes([count[0], count[1], count[2], count[3]]) as usize)
+}
+
+/// Returns the length unit of a STEP file, from its first length unit.
+fn step_units(text: &str) -> &'static str {
+    for line in text.lines() {
+        if !line.contains("LENGTH_UNIT") {
+            continue;
+        }
+
+        if line.contains("'INCH'") {
+            return "in";
+        }
+        if line.contains("'FOOT'") {
+            return "ft";
+        }
+        if line.contains(".MILLI.,.METRE.") {
+            return "mm";
+        }
+        if line.contains(".CENTI.,.METRE.") {
+            return "cm";
+        }
+        if line.contains("$,.METRE.") {
+            return "m";
+        }
+    }
+
+    ""
+}
+
+/// Returns the length unit of a DXF file, from its `$INSUNITS` header variable.
+fn dxf_units(text: &str) -> &'static str {
+    let lines: Vec<&str> = text.lines().map(|line| line.trim()).collect();
+    let at = match lines.iter().position(|line| *line == "$INSUNITS") {
+        Some(at) => at,
+        None => return "",
+    };
+
+    match lines.get(at + 2) {
+        Some(&"1") => "in",
+        Some(&"2") => "ft",
+        Some(&"4") => "mm",
+        Some(&"5") => "cm",
+        Some(&"6") => "m",
+        _ => "",
+    }
+}
+
+/// Returns the length unit of a COLLADA file, from its `<unit>` element.
+fn dae_units(text: &str) -> String {
+    let unit = match text.find("<unit ") {
+        Some(at) => &text[at..],
+        None => return "".to_string(),
+    };
+    let unit = &unit[..unit.find('>').unwrap_or(unit.len())];
+
+    match unit.split("name=\"").nth(1).and_then(|name| name.split('"').next()) {
+        Some("meter") => "m".to_string(),
+        Some("centimeter") => "cm".to_string(),
+        Some("millimeter") => "mm".to_string(),
+        Some("inch") => "in".to_string(),
+        Some(name) => name.to_string(),
+        None => "".to_string(),
+    }
+}
+
+/// Returns the number of elements of a kind a PLY file says it has in its header.
+fn ply_element(text: &str, kind: &str) -> Option<usize> {
+    let prefix = format!("element {} ", kind);
+    text.lines()
+        .take_while(|line| line.trim() != "end_header")
+        .find_map(|line| line.trim().strip_prefix(&prefix))
+        .and_then(|count| count.trim().parse().ok())
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    fn binary_stl(triangles: u32) -> Vec<u8> {
+        let mut data = b"solid but really binary".to_vec();
+        data.resize(STL_HEADER_SIZE, 0);
+        data.extend_from_slice(&triangles.to_le_bytes());
+        data.resize(data.len() + triangles as usize * STL_TRIANGLE_SIZE, 0);
+        data
+    }
+
+    #[test]
+    fn test_sniff() {
+        let tests: Vec<(&[u8], Option<Format>)> = vec![
+            (&b"ISO-10303-21;\nHEADER;\n"[..], Some(Format::Step)),
+            (
+                &b"solid cube\n  facet normal 0 0 1\n"[..],
+                Some(Format::Stl { binary: false }),
+            ),
+            (&b"# cube\nv 0 0 0\nv 1 0 0\nf 1 2 3\n"[..], Some(Format::Obj)),
+            (&b"<?xml version=\"1.0\"?>\n<COLLADA>"[..], Some(Format::Dae)),
+            (&b"Kaydara FBX Binary  \x00"[..], Some(Format::Fbx)),
+            (&b"  0\nSECTION\n  2\nHEADER\n"[..], Some(Format::Dxf)),
+            (&b"AC1032\x00\x00"[..], Some(Format::Dwg)),
+            (&b"ply\nformat ascii 1.0\n"[..], Some(Format::Ply)),
+            (&b"{\"asset\": {\"version\": \"2.0\"}}"[..], Some(Format::Gltf)),
+            (&b"glTF\x02\x00\x00\x00"[..], Some(Format::Glb)),
+            (&b"hello"[..], None),
+        ];
+
+        for (data, want) in tests {
+            assert_eq!(sniff(data), want, "{}", String::from_utf8_lossy(data));
+        }
+
+        assert_eq!(sniff(&binary_stl(2)), Some(Format::Stl { binary: true }));
+    }
+
+    #[test]
+    fn test_inspect() {
+        let info = inspect("cube.stl", &binary_stl(12)).unwrap();
+        assert_eq!(info.format, "stl");
+        assert_eq!(info.triangles, Some(12));
+
+        let step = "ISO-10303-21;\n#1=MANIFOLD_SOLID_BREP('',#2);\n#3=MANIFOLD_SOLID_BREP('',#4);\n#5=(LENGTH_UNIT()NAMED_UNIT(*)SI_UNIT(.MILLI.,.METRE.));\n";
+        let info = inspect("part.step", step.as_bytes()).unwrap();
+        assert_eq!(info.solids, Some(2));
+        assert_eq!(info.units, "mm");
+
+        let obj = "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n";
+        let info = inspect("-", obj.as_bytes()).unwrap();
+        assert_eq!(
+            info,
+            FileInfo {
+                input: "-".to_string(),
+                format: "obj".to_string(),
+                size: obj.len(),
+                vertices: Some(3),
+                faces: Some(1),
+                ..Default::default()
+            }
+        );
+
+        let ply = "ply\nformat ascii 1.0\nelement vertex 8\nelement face 6\nend_header\n";
+        let info = inspect("box.ply", ply.as_bytes()).unwrap();
+        assert_eq!((info.vertices, info.faces), (Some(8), Some(6)));
+
+        let dxf = "  0\nSECTION\n  2\nHEADER\n  9\n$INSUNITS\n 70\n     1\n  0\nENDSEC\n";
+        assert_eq!(inspect("plan.dxf", dxf.as_bytes()).unwrap().units, "in");
+
+        assert_eq!(
+            inspect("notes.txt", b"hello").unwrap_err().to_string(),
+            "can't tell what kind of CAD file notes.txt is"
+        );
+    }
+
+    #[test]
+    fn test_source_format() {
+        assert_eq!(
+            source_format(b"ISO-10303-21;\n"),
+            Some(kittycad::types::FileSourceFormat::Step)
+        );
+        assert_eq!(source_format(b"ply\n"), None);
+    }
+}
@@ -0,0 +1,296 @@
+use anyhow::{anyhow, Result};
+
+/// A pattern for paths, like `parts/**/*.step`.
+///
+/// `*` matches any part of a file or directory name and `?` any one character of it,
+/// `[abc]` or `[a-z]` matches one of a set of characters and `[!abc]` one that is not
+/// in it. `**` on its own between slashes matches any number of directories.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Pattern {
+    parts: Vec<Part>,
+}
+
+/// A part of a pattern between slashes.
+#[derive(Debug, Clone, PartialEq)]
+enum Part {
+    /// `**`, any number of directories.
+    AnyDirs,
+    /// A file or directory name, which can have wildcards in it.
+    Name { raw: String, tokens: Vec<Token> },
+}
+
+#[derive(Debug, Clone, PartialEq)]
+enum Token {
+    Char(char),
+    /// `?`
+    AnyChar,
+    /// `*`
+    AnyChars,
+    /// `[...]`
+    Class {
+        negated: bool,
+        ranges: Vec<(char, char)>,
+    },
+}
+
+impl Pattern {
+    pub fn new(pattern: &str) -> Result<Pattern> {
+        let parts = split(pattern)
+            .into_iter()
+            .map(|part| {
+                if part == "**" {
+                    Ok(Part::AnyDirs)
+                } else {
+                    Ok(Part::Name {
+                        raw: part.to_string(),
+                        tokens: parse_name(part).map_err(|err| anyhow!("invalid pattern `{}`: {}", pattern, err))?,
+                    })
+                }
+            })
+            .collect::<Result<Vec<_>>>()?;
+
+        Ok(Pattern { parts })
+    }
+
+    /// Returns true if the whole path matches the pattern.
+    pub fn matches_path(&self, path: &std::path::Path) -> bool {
+        let path = path.to_string_lossy();
+        match_parts(&self.parts, &split(&path))
+    }
+
+    /// Returns the directory every match is in, the start of the pattern up to the first
+    /// part with a wildcard, e.g. `parts` for `parts/**/*.step`.
+    pub fn base(&self) -> std::path::PathBuf {
+        std::path::PathBuf::from(self.literal().join("/"))
+    }
+
+    /// Returns the parts at the start of the pattern without wildcards, leaving out the
+    /// last one since it is what matches.
+    fn literal(&self) -> Vec<&str> {
+        self.parts
+            .iter()
+            .take(self.parts.len().saturating_sub(1))
+            .map_while(|part| match part {
+                Part::Name { raw, tokens } if tokens.iter().all(|t| matches!(t, Token::Char(_))) => Some(raw.as_str()),
+                _ => None,
+            })
+            .collect()
+    }
+
+    /// Returns how many directories deep under the base a match can be, or none if there
+    /// is no limit.
+    fn depth(&self) -> Option<usize> {
+        if self.parts.contains(&Part::AnyDirs) {
+            return None;
+        }
+
+        Some(self.parts.len() - self.literal().len())
+    }
+}
+
+/// Returns the files and directories matching a pattern, sorted by path.
+pub fn glob(pattern: &str) -> Result<Vec<std::path::PathBuf>> {
+    let pattern = Pattern::new(pattern)?;
+    let base = pattern.base();
+
+    let mut paths = Vec::new();
+    walk(&base, &pattern, pattern.depth(), &mut paths)?;
+    paths.sort();
+
+    Ok(paths)
+}
+
+/// Add the paths under the directory that match the pattern, going at most `depth`
+/// directories deep.
+fn walk(
+    dir: &std::path::Path,
+    pattern: &Pattern,
+    depth: Option<usize>,
+    paths: &mut Vec<std::path::PathBuf>,
+) -> Result<()> {
+    if depth == Some(0) {
+        return Ok(());
+    }
+
+    let entries = match std::fs::read_dir(if dir.as_os_str().is_empty() {
+        std::path::Path::new(".")
+    } else {
+        dir
+    }) {
+        Ok(entries) => entries,
+        // Like a shell, a pattern under a directory that isn't there matches nothing.
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => return Ok(()),
+        Err(err) => return Err(anyhow!("failed to read directory {}: {}", dir.display(), err)),
+    };
+
+    for entry in entries {
+        let entry = entry?;
+        let path = dir.join(entry.file_name());
+        if pattern.matches_path(&path) {
+            paths.push(path.clone());
+        }
+        // Don't follow links to directories, they can loop.
+        if entry.file_type()?.is_dir() {
+            walk(&path, pattern, depth.map(|depth| depth - 1), paths)?;
+        }
+    }
+
+    Ok(())
+}
+
+/// Split a path or pattern into its parts, an absolute one starts with an empty part.
+fn split(path: &str) -> Vec<&str> {
+    path.split(std::path::is_separator)
+        .enumerate()
+        .filter(|(i, part)| (*i == 0 || !part.is_empty()) && *part != ".")
+        .map(|(_, part)| part)
+        .collect()
+}
+
+/// Parse the wildcards of a part of a pattern.
+fn parse_name(name: &str) -> Result<Vec<Token>> {
+    let mut tokens = Vec::new();
+    let mut chars = name.chars().peekable();
+    while let Some(c) = chars.next() {
+        let token = match c {
+            '?' => Token::AnyChar,
+            '*' => Token::AnyChars,
+            '[' => {
+                let negated = chars.next_if(|c| *c == '!' || *c == '^').is_some();
+                let mut ranges = Vec::new();
+                loop {
+                    let start = match chars.next() {
+                        // A `]` right after the `[` is part of the set.
+                        Some(']') if !ranges.is_empty() => break,
+                        Some(c) => c,
+                        None => anyhow::bail!("unclosed `[`"),
+                    };
+                    let end = match chars.peek() {
+                        Some('-') => {
+                            chars.next();
+                            match chars.next() {
+                                Some(']') => {
+                                    // A `-` at the end is part of the set.
+                                    ranges.push((start, start));
+                                    ranges.push(('-', '-'));
+                                    break;
+                                }
+                                Some(end) => end,
+                                None => anyhow::bail!("unclosed `[`"),
+                            }
+                        }
+                        _ => start,
+                    };
+                    ranges.push((start, end));
+                }
+                Token::Class { negated, ranges }
+            }
+            c => Token::Char(c),
+        };
+        tokens.push(token);
+    }
+
+    Ok(tokens)
+}
+
+fn match_parts(parts: &[Part], names: &[&str]) -> bool {
+    match parts.split_first() {
+        None => names.is_empty(),
+        Some((Part::AnyDirs, rest)) => (0..=names.len()).any(|i| match_parts(rest, &names[i..])),
+        Some((Part::Name { tokens, .. }, rest)) => match names.split_first() {
+            Some((name, names)) => match_name(tokens, &name.chars().collect::<Vec<_>>()) && match_parts(rest, names),
+            None => false,
+        },
+    }
+}
+
+fn match_name(tokens: &[Token], name: &[char]) -> bool {
+    match tokens.split_first() {
+        None => name.is_empty(),
+        Some((Token::AnyChars, rest)) => (0..=name.len()).any(|i| match_name(rest, &name[i..])),
+        Some((token, rest)) => match name.split_first() {
+            Some((c, name)) => {
+                let matches = match token {
+                    Token::Char(t) => t == c,
+                    Token::Class { negated, ranges } => {
+                        ranges.iter().any(|(start, end)| start <= c && c <= end) != *negated
+                    }
+                    _ => true,
+                };
+                matches && match_name(rest, name)
+            }
+            None => false,
+        },
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_matches_path() {
+        let matches =
+            |pattern: &str, path: &str| Pattern::new(pattern).unwrap().matches_path(std::path::Path::new(path));
+
+        assert!(matches("*.step", "a.step"));
+        assert!(!matches("*.step", "parts/a.step"));
+        assert!(matches("parts/*.st?", "parts/a.stp"));
+        assert!(matches("**/*.step", "a.step"));
+        assert!(matches("**/*.step", "parts/gears/a.step"));
+        assert!(matches("parts/**", "parts/gears/a.step"));
+        assert!(matches("**/old/**", "/home/me/parts/old/a.step"));
+        assert!(!matches("**/old/**", "/home/me/parts/older/a.step"));
+        assert!(matches("[ab]-[0-9].obj", "b-7.obj"));
+        assert!(!matches("[!ab]-[0-9].obj", "b-7.obj"));
+        assert!(matches("[]a].obj", "].obj"));
+        assert!(matches("./parts/*.step", "parts/a.step"));
+
+        assert_eq!(
+            Pattern::new("parts/[ab.step").unwrap_err().to_string(),
+            "invalid pattern `parts/[ab.step`: unclosed `[`"
+        );
+    }
+
+    #[test]
+    fn test_base() {
+        let base = |pattern: &str| Pattern::new(pattern).unwrap().base();
+
+        assert_eq!(base("parts/**/*.step"), std::path::PathBuf::from("parts"));
+        assert_eq!(base("*.step"), std::path::PathBuf::from(""));
+        assert_eq!(base("a/b/c.step"), std::path::PathBuf::from("a/b"));
+        assert_eq!(base("/tmp/parts/*.step"), std::path::PathBuf::from("/tmp/parts"));
+    }
+
+    #[test]
+    fn test_glob() {
+        let dir = tempfile::tempdir().unwrap();
+        for name in ["a.step", "b/c.step", "b/old/d.step", "b/e.obj"] {
+            let path = dir.path().join(name);
+            std::fs::create_dir_all(path.parent().unwrap()).unwrap();
+            std::fs::write(path, "").unwrap();
+        }
+
+        let glob = |pattern: &str| glob(&format!("{}/{}", dir.path().display(), pattern)).unwrap();
+        assert_eq!(
+            glob("**/*.step"),
+            vec![
+                dir.path().join("a.step"),
+                dir.path().join("b/c.step"),
+                dir.path().join("b/old/d.step"),
+            ]
+        );
+        assert_eq!(
+            glob("*/*"),
+            vec![
+                dir.path().join("b/c.step"),
+                dir.path().join("b/e.obj"),
+                dir.path().join("b/old")
+            ]
+        );
+        assert_eq!(glob("b/e.obj"), vec![dir.path().join("b/e.obj")]);
+        assert_eq!(glob("nope/*.step"), Vec::<std::path::PathBuf>::new());
+    }
+}
@@ -0,0 +1,565 @@
+use std::io::Write;
+
+use anyhow::{anyhow, Result};
+
+/// The flags in the header of a gzip file, see RFC 1952.
+const FHCRC: u8 = 0x02;
+const FEXTRA: u8 = 0x04;
+const FNAME: u8 = 0x08;
+const FCOMMENT: u8 = 0x10;
+
+/// How far back deflate can refer to earlier data.
+const WINDOW: usize = 32 * 1024;
+/// How much input we gather before compressing it into a block.
+const BLOCK: usize = 64 * 1024;
+/// How many earlier places we try to match the data at, more finds longer matches but
+/// takes longer.
+const MAX_CHAIN: usize = 128;
+/// The shortest and longest matches deflate can encode.
+const MIN_MATCH: usize = 3;
+const MAX_MATCH: usize = 258;
+/// How many bytes of compressed output we gather before writing them out.
+const OUT_BUFFER: usize = 16 * 1024;
+
+/// The lengths and distances deflate encodes, each code is followed by the given number
+/// of extra bits added to its base, see RFC 1951.
+const LENGTH_BASE: [u16; 29] = [
+    3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258,
+];
+const LENGTH_EXTRA: [u8; 29] = [
+    0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0,
+];
+const DISTANCE_BASE: [u16; 30] = [
+    1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145,
+    8193, 12289, 16385, 24577,
+];
+const DISTANCE_EXTRA: [u8; 30] = [
+    0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13,
+];
+
+/// The order the lengths of the code length code come in, in a dynamic block.
+const CODE_LENGTH_ORDER: [usize; 19] = [16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15];
+
+/// Compresses what is written to it into the gzip format, block by block, and writes it
+/// to the writer underneath. Call `finish` when done, to write the end of the file.
+pub struct Encoder<W: Write> {
+    out: W,
+    /// Compressed output that hasn't been written out yet.
+    bytes: Vec<u8>,
+    /// Bits of compressed output that don't make up a whole byte yet.
+    bits: u64,
+    bit_count: u32,
+    /// The data compressed so far that later data can refer to, followed by the data
+    /// that hasn't been compressed yet from `start`.
+    window: Vec<u8>,
+    start: usize,
+    crc: u32,
+    len: u32,
+}
+
+impl<W: Write> Encoder<W> {
+    pub fn new(out: W) -> Encoder<W> {
+        Encoder {
+            out,
+            // The magic number, deflate, no flags, no time, default level and an unknown OS.
+            bytes: vec![0x1f, 0x8b, 0x08, 0, 0, 0, 0, 0, 0, 0xff],
+            bits: 0,
+            bit_count: 0,
+            window: Vec::new(),
+            start: 0,
+            crc: 0,
+            len: 0,
+        }
+    }
+
+    /// Compress what is left, write the end of the file and return the writer.
+    pub fn finish(mut self) -> std::io::Result<W> {
+        self.compress(true)?;
+
+        // Pad to a whole byte, then the checksum and the length of the data.
+        if self.bit_count > 0 {
+            self.put_bits(0, 8 - self.bit_count);
+        }
+        self.bytes.extend(self.crc.to_le_bytes());
+        self.bytes.extend(self.len.to_le_bytes());
+        self.out.write_all(&self.bytes)?;
+        self.out.flush()?;
+
+        Ok(self.out)
+    }
+
+    /// Compress the data that hasn't been yet into a block, with codes fixed by deflate.
+    fn compress(&mut self, last: bool) -> std::io::Result<()> {
+        self.put_bits(last as u32, 1);
+        self.put_bits(1, 2);
+
+        // The places each run of three bytes was seen at, newest first.
+        let mut head = vec![usize::MAX; 1 << 15];
+        let mut prev = vec![usize::MAX; self.window.len()];
+        for at in 0..self.start {
+            insert(&self.window, &mut head, &mut prev, at);
+        }
+
+        let end = self.window.len();
+        let mut at = self.start;
+        while at < end {
+            let (length, distance) = self.longest_match(&head, &prev, at);
+            if length >= MIN_MATCH {
+                self.put_match(length, distance);
+                for i in at..at + length {
+                    insert(&self.window, &mut head, &mut prev, i);
+                }
+                at += length;
+            } else {
+                self.put_symbol(self.window[at] as u16);
+                insert(&self.window, &mut head, &mut prev, at);
+                at += 1;
+            }
+
+            if self.bytes.len() >= OUT_BUFFER {
+                self.out.write_all(&self.bytes)?;
+                self.bytes.clear();
+            }
+        }
+        self.put_symbol(256);
+
+        // Only keep what later data can refer to.
+        if end > WINDOW {
+            self.window.drain(..end - WINDOW);
+        }
+        self.start = self.window.len();
+
+        Ok(())
+    }
+
+    /// Returns the length and distance of the longest earlier match of the data at the
+    /// given place, the length is zero if there is none.
+    fn longest_match(&self, head: &[usize], prev: &[usize], at: usize) -> (usize, usize) {
+        let window = &self.window;
+        let longest = MAX_MATCH.min(window.len() - at);
+        if longest < MIN_MATCH {
+            return (0, 0);
+        }
+
+        let mut best = (0, 0);
+        let mut candidate = head[hash(window, at)];
+        let mut tries = 0;
+        while candidate != usize::MAX && at - candidate <= WINDOW && tries < MAX_CHAIN {
+            let length = window[candidate..]
+                .iter()
+                .zip(&window[at..at + longest])
+                .take_while(|(a, b)| a == b)
+                .count();
+            if length > best.0 {
+                best = (length, at - candidate);
+                if length == longest {
+                    break;
+                }
+            }
+            candidate = prev[candidate];
+            tries += 1;
+        }
+
+        best
+    }
+
+    /// Write a literal byte, or the end of block, with its fixed code.
+    fn put_symbol(&mut self, symbol: u16) {
+        let symbol = symbol as u32;
+        let (code, len) = match symbol {
+            0..=143 => (0x30 + symbol, 8),
+            144..=255 => (0x190 + symbol - 144, 9),
+            256..=279 => (symbol - 256, 7),
+            _ => (0xc0 + symbol - 280, 8),
+        };
+        self.put_code(code, len);
+    }
+
+    /// Write a match of the given length at the given distance back.
+    fn put_match(&mut self, length: usize, distance: usize) {
+        let index = LENGTH_BASE.iter().rposition(|base| *base as usize <= length).unwrap();
+        self.put_symbol(257 + index as u16);
+        self.put_bits(
+            (length - LENGTH_BASE[index] as usize) as u32,
+            LENGTH_EXTRA[index] as u32,
+        );
+
+        let index = DISTANCE_BASE
+            .iter()
+            .rposition(|base| *base as usize <= distance)
+            .unwrap();
+        self.put_code(index as u32, 5);
+        self.put_bits(
+            (distance - DISTANCE_BASE[index] as usize) as u32,
+            DISTANCE_EXTRA[index] as u32,
+        );
+    }
+
+    /// Huffman codes are packed starting from their most significant bit.
+    fn put_code(&mut self, code: u32, len: u32) {
+        self.put_bits(code.reverse_bits() >> (32 - len), len);
+    }
+
+    /// Everything else is packed starting from the least significant bit.
+    fn put_bits(&mut self, value: u32, len: u32) {
+        self.bits |= (value as u64) << self.bit_count;
+        self.bit_count += len;
+        while self.bit_count >= 8 {
+            self.bytes.push(self.bits as u8);
+            self.bits >>= 8;
+            self.bit_count -= 8;
+        }
+    }
+}
+
+/// Returns the hash of the three bytes at the given place.
+fn hash(window: &[u8], at: usize) -> usize {
+    ((window[at] as usize) << 10 ^ (window[at + 1] as usize) << 5 ^ window[at + 2] as usize) & 0x7fff
+}
+
+/// Add the given place to the places its three bytes were seen at.
+fn insert(window: &[u8], head: &mut [usize], prev: &mut [usize], at: usize) {
+    if at + MIN_MATCH <= window.len() {
+        let h = hash(window, at);
+        prev[at] = head[h];
+        head[h] = at;
+    }
+}
+
+impl<W: Write> Write for Encoder<W> {
+    fn write(&mut self, buf: &[u8]) -> std::io::Result<usize> {
+        let n = buf.len().min(BLOCK - (self.window.len() - self.start));
+        self.window.extend_from_slice(&buf[..n]);
+        self.crc = crc32_update(self.crc, &buf[..n]);
+        self.len = self.len.wrapping_add(n as u32);
+
+        if self.window.len() - self.start == BLOCK {
+            self.compress(false)?;
+        }
+
+        Ok(n)
+    }
+
+    /// Writes out the blocks compressed so far, the data of the one being gathered is
+    /// only written by the next block or `finish`.
+    fn flush(&mut self) -> std::io::Result<()> {
+        self.out.write_all(&self.bytes)?;
+        self.bytes.clear();
+        self.out.flush()
+    }
+}
+
+/// Returns the data compressed into the gzip format.
+pub fn compress(data: &[u8]) -> Vec<u8> {
+    let mut encoder = Encoder::new(Vec::new());
+    // Writing to memory can't fail.
+    encoder.write_all(data).unwrap();
+    encoder.finish().unwrap()
+}
+
+/// Returns the data in a gzip file.
+pub fn decompress(gz: &[u8]) -> Result<Vec<u8>> {
+    if gz.len() < 18 || gz[0..3] != [0x1f, 0x8b, 0x08] {
+        anyhow::bail!("not a gzip file");
+    }
+
+    // Skip the header and the optional fields after it.
+    let flags = gz[3];
+    let mut start = 10;
+    if flags & FEXTRA != 0 {
+        let len = u16::from_le_bytes([gz[start], gz[start + 1]]) as usize;
+        start += 2 + len;
+    }
+    for flag in [FNAME, FCOMMENT] {
+        if flags & flag != 0 {
+            let end = gz[start.min(gz.len())..]
+                .iter()
+                .position(|b| *b == 0)
+                .ok_or_else(|| anyhow!("the gzip header is cut short"))?;
+            start += end + 1;
+        }
+    }
+    if flags & FHCRC != 0 {
+        start += 2;
+    }
+    if start > gz.len() - 8 {
+        anyhow::bail!("the gzip header is cut short");
+    }
+
+    let data = inflate(&gz[start..gz.len() - 8])?;
+
+    let trailer = &gz[gz.len() - 8..];
+    if u32::from_le_bytes([trailer[0], trailer[1], trailer[2], trailer[3]]) != crc32_update(0, &data) {
+        anyhow::bail!("the gzip data is corrupt, its checksum doesn't match");
+    }
+
+    Ok(data)
+}
+
+/// Reads deflate data a bit at a time.
+struct Bits<'a> {
+    data: &'a [u8],
+    at: usize,
+    bits: u32,
+    bit_count: u32,
+}
+
+impl Bits<'_> {
+    fn get(&mut self, len: u32) -> Result<u32> {
+        while self.bit_count < len {
+            let byte = self
+                .data
+                .get(self.at)
+                .ok_or_else(|| anyhow!("the gzip data is cut short"))?;
+            self.bits |= (*byte as u32) << self.bit_count;
+            self.at += 1;
+            self.bit_count += 8;
+        }
+
+        let value = self.bits & ((1u64 << len) - 1) as u32;
+        self.bits >>= len;
+        self.bit_count -= len;
+        Ok(value)
+    }
+}
+
+/// A canonical Huffman code, the number of codes of each length and the symbols in the
+/// order of their codes.
+struct Huffman {
+    counts: [u16; 16],
+    symbols: Vec<u16>,
+}
+
+impl Huffman {
+    fn new(lengths: &[u8]) -> Huffman {
+        let mut counts = [0u16; 16];
+        for len in lengths {
+            counts[*len as usize] += 1;
+        }
+        counts[0] = 0;
+
+        let mut symbols: Vec<u16> = (0..lengths.len() as u16)
+            .filter(|s| lengths[*s as usize] != 0)
+            .collect();
+        symbols.sort_by_key(|s| lengths[*s as usize]);
+
+        Huffman { counts, symbols }
+    }
+
+    fn decode(&self, bits: &mut Bits) -> Result<u16> {
+        let (mut code, mut first, mut index) = (0i32, 0i32, 0i32);
+        for len in 1..16 {
+            code |= bits.get(1)? as i32;
+            let count = self.counts[len] as i32;
+            if code - first < count {
+                return Ok(self.symbols[(index + code - first) as usize]);
+            }
+            index += count;
+            first = (first + count) << 1;
+            code <<= 1;
+        }
+
+        anyhow::bail!("the gzip data is corrupt, it has an unknown code")
+    }
+}
+
+/// Returns the data compressed in deflate blocks.
+fn inflate(deflated: &[u8]) -> Result<Vec<u8>> {
+    let corrupt = || anyhow!("the gzip data is corrupt");
+    let mut bits = Bits {
+        data: deflated,
+        at: 0,
+        bits: 0,
+        bit_count: 0,
+    };
+    let mut data = Vec::new();
+
+    loop {
+        let last = bits.get(1)? == 1;
+        match bits.get(2)? {
+            0 => {
+                // Stored, from the next whole byte.
+                bits.bits = 0;
+                bits.bit_count = 0;
+                let len = bits.get(16)?;
+                if bits.get(16)? != !len & 0xffff {
+                    return Err(corrupt());
+                }
+                let stored = deflated.get(bits.at..bits.at + len as usize).ok_or_else(corrupt)?;
+                data.extend_from_slice(stored);
+                bits.at += len as usize;
+            }
+            1 => {
+                let mut lengths = [8u8; 288];
+                lengths[144..256].fill(9);
+                lengths[256..280].fill(7);
+                inflate_block(&mut bits, &mut data, &Huffman::new(&lengths), &Huffman::new(&[5; 30]))?;
+            }
+            2 => {
+                let (literals, distances) = dynamic_codes(&mut bits)?;
+                inflate_block(&mut bits, &mut data, &literals, &distances)?;
+            }
+            _ => return Err(corrupt()),
+        }
+
+        if last {
+            return Ok(data);
+        }
+    }
+}
+
+/// Read the codes a dynamic block was compressed with.
+fn dynamic_codes(bits: &mut Bits) -> Result<(Huffman, Huffman)> {
+    let literal_count = bits.get(5)? as usize + 257;
+    let distance_count = bits.get(5)? as usize + 1;
+    let code_length_count = bits.get(4)? as usize + 4;
+
+    let mut code_lengths = [0u8; 19];
+    for i in CODE_LENGTH_ORDER.iter().take(code_length_count) {
+        code_lengths[*i] = bits.get(3)? as u8;
+    }
+    let code_lengths = Huffman::new(&code_lengths);
+
+    let mut lengths = Vec::with_capacity(literal_count + distance_count);
+    while lengths.len() < literal_count + distance_count {
+        let (len, repeat) = match code_lengths.decode(bits)? {
+            symbol @ 0..=15 => (symbol as u8, 1),
+            16 => match lengths.last() {
+                Some(len) => (*len, 3 + bits.get(2)?),
+                None => anyhow::bail!("the gzip data is corrupt, it repeats a length before the first"),
+            },
+            17 => (0, 3 + bits.get(3)?),
+            _ => (0, 11 + bits.get(7)?),
+        };
+        lengths.extend(std::iter::repeat(len).take(repeat as usize));
+    }
+    if lengths.len() > literal_count + distance_count {
+        anyhow::bail!("the gzip data is corrupt, it has too many code lengths");
+    }
+
+    Ok((
+        Huffman::new(&lengths[..literal_count]),
+        Huffman::new(&lengths[literal_count..]),
+    ))
+}
+
+/// Decode a compressed block onto the end of the data.
+fn inflate_block(bits: &mut Bits, data: &mut Vec<u8>, literals: &Huffman, distances: &Huffman) -> Result<()> {
+    let corrupt = || anyhow!("the gzip data is corrupt");
+    loop {
+        let symbol = literals.decode(bits)? as usize;
+        match symbol {
+            0..=255 => data.push(symbol as u8),
+            256 => return Ok(()),
+            _ => {
+                let index = symbol - 257;
+                let length = *LENGTH_BASE.get(index).ok_or_else(corrupt)? as usize
+                    + bits.get(LENGTH_EXTRA[index] as u32)? as usize;
+
+                let index = distances.decode(bits)? as usize;
+                let distance = *DISTANCE_BASE.get(index).ok_or_else(corrupt)? as usize
+                    + bits.get(DISTANCE_EXTRA[index] as u32)? as usize;
+                if distance > data.len() {
+                    return Err(corrupt());
+                }
+
+                // The match can overlap what it adds, so copy a byte at a time.
+                let from = data.len() - distance;
+                for i in 0..length {
+                    data.push(data[from + i]);
+                }
+            }
+        }
+    }
+}
+
+/// The CRC-32 of each byte, as used by gzip.
+const CRC_TABLE: [u32; 256] = crc_table();
+
+const fn crc_table() -> [u32; 256] {
+    let mut table = [0u32; 256];
+    let mut i = 0;
+    while i < 256 {
+        let mut crc = i as u32;
+        let mut bit = 0;
+        while bit < 8 {
+            crc = if crc & 1 != 0 {
+                (crc >> 1) ^ 0xedb8_8320
+            } else {
+                crc >> 1
+            };
+            bit += 1;
+        }
+        table[i] = crc;
+        i += 1;
+    }
+
+    table
+}
+
+/// Returns the CRC-32 of data that follows data with the given CRC-32, start from zero.
+fn crc32_update(crc: u32, data: &[u8]) -> u32 {
+    let mut crc = !crc;
+    for byte in data {
+        crc = CRC_TABLE[((crc ^ *byte as u32) & 0xff) as usize] ^ (crc >> 8);
+    }
+
+    !crc
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_crc32() {
+        assert_eq!(crc32_update(0, b""), 0);
+        assert_eq!(crc32_update(0, b"123456789"), 0xcbf4_3926);
+        assert_eq!(crc32_update(crc32_update(0, b"1234"), b"56789"), 0xcbf4_3926);
+    }
+
+    #[test]
+    fn test_compress() {
+        let data = b"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n".repeat(100);
+        let gz = compress(&data);
+        assert!(gz.len() < data.len());
+        assert_eq!(decompress(&gz).unwrap(), data);
+
+        let mut corrupt = gz.clone();
+        let len = corrupt.len();
+        corrupt[len - 5] ^= 0xff;
+        assert!(decompress(&corrupt).is_err());
+        assert_eq!(decompress(b"v 0 0 0\n").unwrap_err().to_string(), "not a gzip file");
+
+        assert_eq!(decompress(&compress(b"")).unwrap(), b"".to_vec());
+    }
+
+    #[test]
+    fn test_encoder() {
+        // More than a few blocks, with matches that reach back into the ones before.
+        let data: Vec<u8> = (0..30_000u32)
+            .flat_map(|i| format!("v {} {} 0\n", i % 1000, (i * 7) % 13).into_bytes())
+            .collect();
+
+        let mut encoder = Encoder::new(Vec::new());
+        for chunk in data.chunks(10_000) {
+            encoder.write_all(chunk).unwrap();
+        }
+        let gz = encoder.finish().unwrap();
+
+        assert!(gz.len() < data.len() / 2);
+        assert_eq!(decompress(&gz).unwrap(), data);
+    }
+
+    #[test]
+    fn test_decompress_gzip() {
+        // `v 0 0 0\n` gzipped with the file name `model.obj` in the header, like `gzip` does.
+        let gz = [
+            0x1f, 0x8b, 0x08, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x2e, 0x6f, 0x62,
+            0x6a, 0x00, 0x2b, 0x53, 0x30, 0x00, 0x41, 0x2e, 0x00, 0xe7, 0x37, 0xee, 0xf2, 0x08, 0x00, 0x00, 0x00,
+        ];
+        assert_eq!(decompress(&gz).unwrap(), b"v 0 0 0\n".to_vec());
+    }
+}
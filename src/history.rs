@@ -0,0 +1,201 @@
+use std::fs;
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+
+/// The number of operations we remember.
+const MAX_ENTRIES: usize = 100;
+
+/// An API call that was started from this machine, so it can be picked later without
+/// copying its ID around.
+#[derive(Serialize, Deserialize, Clone, Debug, PartialEq, Eq, tabled::Tabled)]
+pub struct HistoryEntry {
+    pub id: String,
+    pub operation: String,
+    pub input: String,
+    /// The size of the input in bytes.
+    #[serde(default)]
+    #[tabled(skip)]
+    pub input_size: usize,
+    /// The status of the API call when it was started.
+    #[serde(default)]
+    pub status: String,
+    /// The arguments the command was run with, so it can be run again.
+    #[serde(default)]
+    #[tabled(skip)]
+    pub args: Vec<String>,
+    pub created_at: chrono::DateTime<chrono::Utc>,
+}
+
+impl std::fmt::Display for HistoryEntry {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(
+            f,
+            "{}  {}  {}  {}",
+            self.id,
+            self.created_at.format("%Y-%m-%d %H:%M"),
+            self.operation,
+            self.input
+        )
+    }
+}
+
+/// The history file, newest entries first.
+#[derive(Serialize, Deserialize, Clone, Debug, Default, PartialEq, Eq)]
+struct History {
+    #[serde(default)]
+    operations: Vec<HistoryEntry>,
+}
+
+/// Returns the operations in the history file, newest first.
+pub fn load(filepath: &str) -> Result<Vec<HistoryEntry>> {
+    if !std::path::Path::new(filepath).exists() {
+        return Ok(vec![]);
+    }
+
+    let file_content = fs::read_to_string(filepath)?;
+    let history: History = toml::from_str(&file_content)?;
+
+    Ok(history.operations)
+}
+
+/// Add an operation to the history file, forgetting the oldest ones.
+pub fn record(filepath: &str, entry: HistoryEntry) -> Result<()> {
+    let mut operations = load(filepath).unwrap_or_default();
+    operations.retain(|e| e.id != entry.id);
+    operations.insert(0, entry);
+    operations.truncate(MAX_ENTRIES);
+
+    save(filepath, operations)
+}
+
+/// Remove the operations that match `remove` from the history file, returns the ones
+/// that were removed.
+pub fn purge<F>(filepath: &str, remove: F) -> Result<Vec<HistoryEntry>>
+where
+    F: Fn(&HistoryEntry) -> bool,
+{
+    let (removed, kept): (Vec<HistoryEntry>, Vec<HistoryEntry>) = load(filepath)?.into_iter().partition(remove);
+    if !removed.is_empty() {
+        save(filepath, kept)?;
+    }
+
+    Ok(removed)
+}
+
+fn save(filepath: &str, operations: Vec<HistoryEntry>) -> Result<()> {
+    let content = toml::to_string(&History { operations })?;
+
+    // Make sure we have a parent directory.
+    let path = std::path::Path::new(&filepath);
+    let parent = path.parent().unwrap();
+    fs::create_dir_all(parent).with_context(|| format!("failed to create directory {}", parent.display()))?;
+
+    fs::write(filepath, content).with_context(|| format!("failed to write file {}", filepath))?;
+
+    Ok(())
+}
+
+/// Returns the operation with the given ID, or at the given position with 1 being the
+/// newest.
+pub fn find<'a>(operations: &'a [HistoryEntry], id_or_position: &str) -> Option<&'a HistoryEntry> {
+    if let Some(entry) = operations.iter().find(|e| e.id == id_or_position) {
+        return Some(entry);
+    }
+
+    match id_or_position.parse::<usize>() {
+        Ok(position) if position > 0 => operations.get(position - 1),
+        _ => None,
+    }
+}
+
+/// Remember an operation we started, this never fails the command since the history is
+/// only a convenience.
+pub fn remember(id: &str, operation: &str, input: &std::path::Path, input_size: usize, status: &str) {
+    let result = crate::config_file::history_file().and_then(|filepath| {
+        record(
+            &filepath,
+            HistoryEntry {
+                id: id.to_string(),
+                operation: operation.to_string(),
+                input: input.display().to_string(),
+                input_size,
+                status: status.to_string(),
+                args: std::env::args().skip(1).collect(),
+                created_at: chrono::Utc::now(),
+            },
+        )
+    });
+
+    if let Err(err) = result {
+        log::debug!("failed to save history: {}", err);
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    fn entry(id: &str) -> HistoryEntry {
+        HistoryEntry {
+            id: id.to_string(),
+            operation: "file convert".to_string(),
+            input: "my-file.step".to_string(),
+            input_size: 1024,
+            status: "Queued".to_string(),
+            args: vec!["file".to_string(), "convert".to_string(), "my-file.step".to_string()],
+            created_at: "2022-07-01T10:00:00Z".parse().unwrap(),
+        }
+    }
+
+    #[test]
+    fn test_record() {
+        let dir = tempfile::tempdir().unwrap();
+        let filepath = dir.path().join("state").join("history.toml");
+        let filepath = filepath.to_str().unwrap();
+
+        assert_eq!(load(filepath).unwrap(), vec![]);
+
+        record(filepath, entry("a")).unwrap();
+        record(filepath, entry("b")).unwrap();
+        record(filepath, entry("a")).unwrap();
+        assert_eq!(load(filepath).unwrap(), vec![entry("a"), entry("b")]);
+
+        for i in 0..MAX_ENTRIES {
+            record(filepath, entry(&i.to_string())).unwrap();
+        }
+        let operations = load(filepath).unwrap();
+        assert_eq!(operations.len(), MAX_ENTRIES);
+        assert_eq!(operations[0], entry(&(MAX_ENTRIES - 1).to_string()));
+    }
+
+    #[test]
+    fn test_purge() {
+        let dir = tempfile::tempdir().unwrap();
+        let filepath = dir.path().join("history.toml");
+        let filepath = filepath.to_str().unwrap();
+
+        assert_eq!(purge(filepath, |_| true).unwrap(), vec![]);
+
+        for id in ["a", "b", "c"] {
+            record(filepath, entry(id)).unwrap();
+        }
+
+        assert_eq!(purge(filepath, |e| e.id == "b").unwrap(), vec![entry("b")]);
+        assert_eq!(load(filepath).unwrap(), vec![entry("c"), entry("a")]);
+    }
+
+    #[test]
+    fn test_find() {
+        let operations = vec![entry("a"), entry("b")];
+
+        assert_eq!(find(&operations, "b"), Some(&entry("b")));
+        assert_eq!(find(&operations, "1"), Some(&entry("a")));
+        assert_eq!(find(&operations, "2"), Some(&entry("b")));
+        assert_eq!(find(&operations, "0"), None);
+        assert_eq!(find(&operations, "3"), None);
+        assert_eq!(find(&operations, "c"), None);
+    }
+}
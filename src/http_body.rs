@@ -0,0 +1,465 @@
+use std::io::Write;
+
+use anyhow::Result;
+
+/// The default maximum size of a response body we will read into memory, 32 MiB.
+pub const DEFAULT_MAX_BODY_SIZE: u64 = 32 * 1024 * 1024;
+
+/// Read the full body of a response into memory, failing if it is larger than `limit` bytes.
+///
+/// The body is read chunk by chunk so we stop as soon as we go over the limit rather
+/// than after buffering the whole thing.
+pub async fn read_limited(resp: reqwest::Response, limit: u64) -> Result<Vec<u8>> {
+    read_limited_at_rate(resp, limit, None, None).await
+}
+
+/// Like `read_limited`, but reads at most `rate` bytes per second if a rate is given, and
+/// shows the progress if asked to.
+pub async fn read_limited_at_rate(
+    mut resp: reqwest::Response,
+    limit: u64,
+    rate: Option<u64>,
+    mut progress: Option<Progress>,
+) -> Result<Vec<u8>> {
+    if let Some(length) = resp.content_length() {
+        if length > limit {
+            anyhow::bail!(
+                "response body is {} bytes, which is larger than the maximum of {} bytes",
+                length,
+                limit
+            );
+        }
+    }
+
+    if let Some(progress) = &mut progress {
+        progress.total = resp.content_length().unwrap_or_default();
+    }
+
+    let mut bucket = rate.map(TokenBucket::new);
+    let mut body: Vec<u8> = Vec::new();
+    while let Some(chunk) = resp.chunk().await? {
+        if (body.len() + chunk.len()) as u64 > limit {
+            anyhow::bail!("response body is larger than the maximum of {} bytes", limit);
+        }
+
+        if let Some(bucket) = &mut bucket {
+            bucket.take(chunk.len()).await;
+        }
+        if let Some(progress) = &mut progress {
+            progress.add(chunk.len());
+        }
+        body.extend_from_slice(&chunk);
+    }
+
+    if let Some(progress) = &progress {
+        progress.finish();
+    }
+
+    Ok(body)
+}
+
+/// Parse a JSON response, failing if the body is larger than `limit` bytes.
+pub async fn read_json<T: serde::de::DeserializeOwned>(resp: reqwest::Response, limit: u64) -> Result<T> {
+    read_json_at_rate(resp, limit, None, None).await
+}
+
+/// Like `read_json`, but reads at most `rate` bytes per second if a rate is given, and
+/// shows the progress if asked to.
+pub async fn read_json_at_rate<T: serde::de::DeserializeOwned>(
+    resp: reqwest::Response,
+    limit: u64,
+    rate: Option<u64>,
+    progress: Option<Progress>,
+) -> Result<T> {
+    let body = read_limited_at_rate(resp, limit, rate, progress).await?;
+
+    Ok(serde_json::from_slice(&body)?)
+}
+
+/// Stream the body of a response into a writer without holding it in memory, at most
+/// `rate` bytes per second if a rate is given.
+/// Returns the number of bytes written.
+pub async fn copy_to<W: Write>(resp: reqwest::Response, w: &mut W, rate: Option<u64>) -> Result<u64> {
+    copy_to_with_progress(resp, w, rate, None).await
+}
+
+/// Like `copy_to`, but fails as soon as the body is larger than `limit` bytes, so a
+/// download can't fill up the disk.
+pub async fn copy_to_limited<W: Write>(
+    resp: reqwest::Response,
+    w: &mut W,
+    limit: u64,
+    rate: Option<u64>,
+) -> Result<u64> {
+    if let Some(length) = resp.content_length() {
+        if length > limit {
+            anyhow::bail!(
+                "response body is {} bytes, which is larger than the maximum of {} bytes",
+                length,
+                limit
+            );
+        }
+    }
+
+    let mut w = LimitedWriter {
+        inner: w,
+        limit,
+        written: 0,
+    };
+    copy_to(resp, &mut w, rate).await
+}
+
+/// A writer that fails instead of writing more than `limit` bytes.
+struct LimitedWriter<'a, W: Write> {
+    inner: &'a mut W,
+    limit: u64,
+    written: u64,
+}
+
+impl<W: Write> Write for LimitedWriter<'_, W> {
+    fn write(&mut self, buf: &[u8]) -> std::io::Result<usize> {
+        if self.written + buf.len() as u64 > self.limit {
+            return Err(std::io::Error::new(
+                std::io::ErrorKind::Other,
+                format!("response body is larger than the maximum of {} bytes", self.limit),
+            ));
+        }
+
+        let n = self.inner.write(buf)?;
+        self.written += n as u64;
+        Ok(n)
+    }
+
+    fn flush(&mut self) -> std::io::Result<()> {
+        self.inner.flush()
+    }
+}
+
+/// Like `copy_to`, but shows the progress if asked to. Every chunk is written as soon as
+/// it arrives, so whatever got through is in the writer if the transfer fails.
+pub async fn copy_to_with_progress<W: Write>(
+    mut resp: reqwest::Response,
+    w: &mut W,
+    rate: Option<u64>,
+    mut progress: Option<Progress>,
+) -> Result<u64> {
+    let mut bucket = rate.map(TokenBucket::new);
+    let mut written: u64 = 0;
+    while let Some(chunk) = resp.chunk().await? {
+        if let Some(bucket) = &mut bucket {
+            bucket.take(chunk.len()).await;
+        }
+        if let Some(progress) = &mut progress {
+            progress.add(chunk.len());
+        }
+        w.write_all(&chunk)?;
+        written += chunk.len() as u64;
+    }
+
+    w.flush()?;
+    if let Some(progress) = &progress {
+        progress.finish();
+    }
+
+    Ok(written)
+}
+
+/// Returns a request body that is streamed in chunks, at most `rate` bytes per second if
+/// a rate is given, showing the progress if asked to.
+///
+/// Progress is counted as the HTTP client takes each chunk to send it, so it follows the
+/// bytes going out rather than how fast we can read them from memory.
+pub fn body(data: Vec<u8>, rate: Option<u64>, progress: Option<Progress>) -> reqwest::Body {
+    // Send small chunks so the rate and progress are smooth, rather than a burst and a
+    // long pause.
+    let chunk_size = rate.map(|rate| rate as usize).unwrap_or(usize::MAX).clamp(1, 64 * 1024);
+
+    let stream = futures::stream::unfold(
+        (bytes::Bytes::from(data), rate.map(TokenBucket::new), progress),
+        move |(mut data, mut bucket, mut progress)| async move {
+            if data.is_empty() {
+                if let Some(progress) = &progress {
+                    progress.finish();
+                }
+                return None;
+            }
+
+            let chunk = data.split_to(chunk_size.min(data.len()));
+            if let Some(bucket) = &mut bucket {
+                bucket.take(chunk.len()).await;
+            }
+            if let Some(progress) = &mut progress {
+                progress.add(chunk.len());
+            }
+
+            Some((Ok::<_, std::io::Error>(chunk), (data, bucket, progress)))
+        },
+    );
+
+    reqwest::Body::wrap_stream(stream)
+}
+
+/// How often we redraw the progress of a transfer.
+const PROGRESS_REDRAW_INTERVAL: std::time::Duration = std::time::Duration::from_millis(100);
+
+/// How often we print a line with the progress of a transfer in plain mode, rarely enough
+/// for a screen reader to keep up.
+const PROGRESS_PLAIN_INTERVAL: std::time::Duration = std::time::Duration::from_secs(5);
+
+/// Shows how far along a transfer is on a single line of stderr, which is redrawn as
+/// bytes go through. Only use this when stderr is a terminal, get one with
+/// `crate::iostreams::IoStreams::progress`.
+///
+/// In plain mode, for screen readers, a new line is printed every few seconds instead,
+/// with no escape sequences.
+#[derive(Debug)]
+pub struct Progress {
+    /// Where we draw the progress, stderr.
+    out: crate::iostreams::SharedWriter,
+    label: String,
+    /// The size of the transfer in bytes, zero if we don't know.
+    total: u64,
+    done: u64,
+    plain: bool,
+    last_drawn: Option<std::time::Instant>,
+    /// How many bytes were done when we last drew the progress.
+    last_drawn_done: u64,
+}
+
+impl Progress {
+    pub fn new(label: &str, total: u64, out: crate::iostreams::SharedWriter) -> Progress {
+        Progress {
+            out,
+            label: label.to_string(),
+            total,
+            done: 0,
+            plain: false,
+            last_drawn: None,
+            last_drawn_done: 0,
+        }
+    }
+
+    /// Print plain lines rather than redrawing a line in place.
+    pub fn plain(mut self, plain: bool) -> Progress {
+        self.plain = plain;
+        self
+    }
+
+    /// Count `n` more bytes as transferred.
+    pub fn add(&mut self, n: usize) {
+        self.done += n as u64;
+
+        let interval = if self.plain {
+            PROGRESS_PLAIN_INTERVAL
+        } else {
+            PROGRESS_REDRAW_INTERVAL
+        };
+        let due = self.last_drawn.map(|last| last.elapsed() >= interval).unwrap_or(true);
+        if due || self.done == self.total {
+            self.draw();
+        }
+    }
+
+    /// Clear the progress line, once the transfer is done. In plain mode, print where the
+    /// transfer ended up if the last line didn't say.
+    ///
+    /// Failing to draw the progress doesn't fail the transfer, so errors are ignored.
+    pub fn finish(&self) {
+        let mut out = self.out.clone();
+        if self.plain {
+            if self.last_drawn.is_some() && self.last_drawn_done != self.done {
+                let _ = writeln!(out, "{}", self.line());
+            }
+            return;
+        }
+
+        if self.last_drawn.is_some() {
+            let _ = write!(out, "\r\x1b[2K");
+            let _ = out.flush();
+        }
+    }
+
+    fn draw(&mut self) {
+        let line = self.line();
+        if self.plain {
+            let _ = writeln!(self.out, "{}", line);
+        } else {
+            let _ = write!(self.out, "\r\x1b[2K{}", line);
+        }
+        let _ = self.out.flush();
+        self.last_drawn = Some(std::time::Instant::now());
+        self.last_drawn_done = self.done;
+    }
+
+    fn line(&self) -> String {
+        if self.total == 0 {
+            return format!("{} {}", self.label, crate::types::format_bytes(self.done));
+        }
+
+        format!(
+            "{} {} of {} ({}%)",
+            self.label,
+            crate::types::format_bytes(self.done),
+            crate::types::format_bytes(self.total),
+            self.done * 100 / self.total
+        )
+    }
+}
+
+/// A token bucket that limits the number of bytes per second we transfer.
+///
+/// The bucket holds up to a second worth of bytes, so a transfer can burst for a moment
+/// but never goes over the rate on average.
+#[derive(Debug)]
+pub struct TokenBucket {
+    rate: u64,
+    tokens: f64,
+    last: tokio::time::Instant,
+}
+
+impl TokenBucket {
+    pub fn new(rate: u64) -> TokenBucket {
+        TokenBucket {
+            rate,
+            tokens: rate as f64,
+            last: tokio::time::Instant::now(),
+        }
+    }
+
+    /// Wait until we are allowed to transfer `n` more bytes.
+    pub async fn take(&mut self, n: usize) {
+        self.refill();
+
+        // Going into debt is fine, we just wait until it has been paid back.
+        self.tokens -= n as f64;
+        if self.tokens < 0.0 {
+            let wait = std::time::Duration::from_secs_f64(-self.tokens / self.rate as f64);
+            tokio::time::sleep(wait).await;
+        }
+    }
+
+    fn refill(&mut self) {
+        let now = tokio::time::Instant::now();
+        let elapsed = now.duration_since(self.last).as_secs_f64();
+        self.tokens = (self.tokens + elapsed * self.rate as f64).min(self.rate as f64);
+        self.last = now;
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    fn response(body: &str) -> reqwest::Response {
+        http::Response::builder().body(body.to_string()).unwrap().into()
+    }
+
+    #[tokio::test(flavor = "multi_thread")]
+    async fn test_read_limited() {
+        let body = read_limited(response("hello"), 5).await.unwrap();
+        assert_eq!(body, b"hello".to_vec());
+
+        let err = read_limited(response("hello world"), 5).await.unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "response body is 11 bytes, which is larger than the maximum of 5 bytes"
+        );
+    }
+
+    #[tokio::test(flavor = "multi_thread")]
+    async fn test_read_json() {
+        let value: serde_json::Value = read_json(response(r#"{"a": 1}"#), DEFAULT_MAX_BODY_SIZE).await.unwrap();
+        assert_eq!(value, serde_json::json!({"a": 1}));
+    }
+
+    #[tokio::test(flavor = "multi_thread")]
+    async fn test_copy_to() {
+        let mut buf: Vec<u8> = Vec::new();
+        let written = copy_to(response("some bytes"), &mut buf, None).await.unwrap();
+        assert_eq!(written, 10);
+        assert_eq!(buf, b"some bytes".to_vec());
+    }
+
+    #[tokio::test(flavor = "multi_thread")]
+    async fn test_copy_to_limited() {
+        let mut buf: Vec<u8> = Vec::new();
+        assert_eq!(
+            copy_to_limited(response("some bytes"), &mut buf, 10, None)
+                .await
+                .unwrap(),
+            10
+        );
+        assert_eq!(buf, b"some bytes".to_vec());
+
+        let err = copy_to_limited(response("some bytes"), &mut Vec::new(), 5, None)
+            .await
+            .unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "response body is 10 bytes, which is larger than the maximum of 5 bytes"
+        );
+
+        let mut w = LimitedWriter {
+            inner: &mut Vec::new(),
+            limit: 5,
+            written: 0,
+        };
+        assert!(w.write_all(b"some").is_ok());
+        assert_eq!(
+            w.write_all(b" bytes").unwrap_err().to_string(),
+            "response body is larger than the maximum of 5 bytes"
+        );
+    }
+
+    #[test]
+    fn test_progress_line() {
+        let out = crate::iostreams::SharedWriter::new(std::io::sink());
+        let mut progress = Progress::new("Uploading", 4 * 1024 * 1024, out.clone());
+        progress.done = 1536 * 1024;
+        assert_eq!(progress.line(), "Uploading 1.5 MiB of 4.0 MiB (37%)");
+
+        let mut progress = Progress::new("Downloading", 0, out);
+        progress.done = 10;
+        assert_eq!(progress.line(), "Downloading 10 B");
+    }
+
+    #[test]
+    fn test_progress_draws_on_err_out() {
+        let (io, stdout_path, stderr_path) = crate::iostreams::IoStreams::test();
+        let mut progress = io.progress("Uploading", 10);
+        progress.add(10);
+        progress.finish();
+
+        assert_eq!(std::fs::read_to_string(&stdout_path).unwrap(), "");
+        assert_eq!(
+            std::fs::read_to_string(&stderr_path).unwrap(),
+            "\r\x1b[2KUploading 10 B of 10 B (100%)\r\x1b[2K"
+        );
+    }
+
+    #[tokio::test(flavor = "current_thread", start_paused = true)]
+    async fn test_token_bucket() {
+        let mut bucket = TokenBucket::new(100);
+        let start = tokio::time::Instant::now();
+
+        // The first second worth of bytes goes straight through.
+        bucket.take(100).await;
+        assert_eq!(start.elapsed(), std::time::Duration::ZERO);
+
+        // After that we are held to the rate.
+        bucket.take(50).await;
+        bucket.take(150).await;
+        assert!(
+            start.elapsed() >= std::time::Duration::from_secs(2),
+            "{:?}",
+            start.elapsed()
+        );
+        assert!(
+            start.elapsed() < std::time::Duration::from_secs(3),
+            "{:?}",
+            start.elapsed()
+        );
+    }
+}
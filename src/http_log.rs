@@ -0,0 +1,331 @@
+use std::{io::Write, time::Instant};
+
+use anyhow::Result;
+
+/// Print the method, URL and headers of requests, and the status, timing, size and
+/// headers of responses.
+pub const HEADERS: u8 = 1;
+/// Print the bodies of requests and responses too.
+pub const BODIES: u8 = 2;
+
+/// Headers that carry credentials, we never print their values.
+const REDACTED_HEADERS: &[&str] = &["authorization", "proxy-authorization", "cookie", "set-cookie"];
+
+/// Fields of JSON bodies that carry credentials, e.g. a new API token, we never print
+/// their values either.
+const REDACTED_FIELDS: &[&str] = &["token", "access_token", "refresh_token", "client_secret"];
+
+/// How much of the HTTP traffic we print and where, see `Context::http_log`.
+#[derive(Clone, Debug)]
+pub struct HttpLog {
+    verbosity: u8,
+    out: crate::iostreams::SharedWriter,
+}
+
+impl HttpLog {
+    /// Returns a log printing to `out`, with a verbosity of 0 it prints nothing.
+    pub fn new(verbosity: u8, out: crate::iostreams::SharedWriter) -> HttpLog {
+        HttpLog { verbosity, out }
+    }
+
+    /// Print to the log, it is only for debugging so we don't fail if we can't.
+    fn print(&self, s: &str) {
+        let mut out = self.out.clone();
+        let _ = out.write_all(s.as_bytes());
+        let _ = out.flush();
+    }
+
+    /// Make a call with the typed API client, printing what it is, e.g. `GET /user`, and
+    /// how it went, with the value it returned if we print bodies.
+    ///
+    /// The client doesn't let us see its HTTP traffic, so this is as close as we get.
+    pub async fn call<T, Fut>(&self, what: &str, call: Fut) -> Result<T, kittycad::types::error::Error>
+    where
+        T: serde::Serialize,
+        Fut: std::future::Future<Output = Result<T, kittycad::types::error::Error>>,
+    {
+        if self.verbosity == 0 {
+            return call.await;
+        }
+
+        self.print(&format!("> {}\n", what));
+        let start = Instant::now();
+        let result = call.await;
+        match &result {
+            Ok(value) => {
+                self.print(&format!("< OK in {}ms\n", start.elapsed().as_millis()));
+                if self.verbosity >= BODIES {
+                    self.print(&format_body("<", &serde_json::to_vec(value).unwrap_or_default()));
+                }
+            }
+            Err(err) => self.print(&format!("< error after {}ms: {}\n", start.elapsed().as_millis(), err)),
+        }
+
+        result
+    }
+}
+
+/// Parse the value of `KITTYCAD_DEBUG`, a level like `--verbose` takes, any other
+/// non-empty value means 1.
+pub fn parse_verbosity(value: &str) -> u8 {
+    let value = value.trim();
+    if value.is_empty() {
+        return 0;
+    }
+
+    value.parse::<u8>().unwrap_or(HEADERS).min(BODIES)
+}
+
+/// Returns the verbosity passed with `--verbose`, falling back to `KITTYCAD_DEBUG`.
+pub fn verbosity_from(flag: Option<u8>) -> Result<u8> {
+    match flag {
+        Some(verbosity) if verbosity > BODIES => {
+            anyhow::bail!("--verbose must be 1 or {}, got {}", BODIES, verbosity)
+        }
+        Some(verbosity) => Ok(verbosity),
+        None => Ok(parse_verbosity(&crate::config_file::get_env_var("KITTYCAD_DEBUG"))),
+    }
+}
+
+/// Send a request, printing it and its response if we were asked to.
+pub async fn send(log: &HttpLog, req: reqwest::RequestBuilder) -> reqwest::Result<reqwest::Response> {
+    let verbosity = log.verbosity;
+    if verbosity == 0 {
+        return req.send().await;
+    }
+
+    // A request with a streamed body, like a file upload, can't be cloned so we only
+    // print its response.
+    if let Some(Ok(request)) = req.try_clone().map(|r| r.build()) {
+        log.print(&format_request(&request, verbosity));
+    }
+
+    let start = Instant::now();
+    match req.send().await {
+        Ok(resp) => {
+            log.print(&format_response(&resp, start));
+            if verbosity < BODIES {
+                return Ok(resp);
+            }
+
+            let (resp, body) = read_body(resp).await?;
+            log.print(&format_body("<", &body));
+            Ok(resp)
+        }
+        Err(err) => {
+            log.print(&format!("< error after {}ms: {}\n", start.elapsed().as_millis(), err));
+            Err(err)
+        }
+    }
+}
+
+/// Returns the value of a header as we print it, hiding credentials.
+fn header_value(name: &str, value: &reqwest::header::HeaderValue) -> String {
+    if REDACTED_HEADERS.contains(&name.to_lowercase().as_str()) {
+        return "[redacted]".to_string();
+    }
+
+    String::from_utf8_lossy(value.as_bytes()).to_string()
+}
+
+fn format_headers(prefix: &str, headers: &reqwest::header::HeaderMap) -> String {
+    headers
+        .iter()
+        .map(|(name, value)| format!("{} {}: {}\n", prefix, name, header_value(name.as_str(), value)))
+        .collect()
+}
+
+fn format_body(prefix: &str, body: &[u8]) -> String {
+    if body.is_empty() {
+        return String::new();
+    }
+
+    if let Ok(mut value) = serde_json::from_slice::<serde_json::Value>(body) {
+        if redact(&mut value) {
+            return format!("{}\n{}\n", prefix, value);
+        }
+    }
+
+    match std::str::from_utf8(body) {
+        Ok(text) => format!("{}\n{}\n", prefix, text),
+        Err(_) => format!(
+            "{} [{} of binary data]\n",
+            prefix,
+            crate::types::format_bytes(body.len() as u64)
+        ),
+    }
+}
+
+/// Hide the values of the fields that carry credentials, returns true if there were any.
+fn redact(value: &mut serde_json::Value) -> bool {
+    match value {
+        serde_json::Value::Object(fields) => {
+            let mut redacted = false;
+            for (name, value) in fields.iter_mut() {
+                if REDACTED_FIELDS.contains(&name.as_str()) && !value.is_null() {
+                    *value = serde_json::Value::String("[redacted]".to_string());
+                    redacted = true;
+                } else {
+                    redacted |= redact(value);
+                }
+            }
+            redacted
+        }
+        serde_json::Value::Array(values) => values
+            .iter_mut()
+            .fold(false, |redacted, value| redact(value) || redacted),
+        _ => false,
+    }
+}
+
+fn format_request(request: &reqwest::Request, verbosity: u8) -> String {
+    let mut s = format!("> {} {}\n", request.method(), request.url());
+    s.push_str(&format_headers(">", request.headers()));
+
+    if verbosity >= BODIES {
+        if let Some(body) = request.body().and_then(|body| body.as_bytes()) {
+            s.push_str(&format_body(">", body));
+        }
+    }
+
+    s
+}
+
+fn format_response(resp: &reqwest::Response, start: Instant) -> String {
+    let size = match resp.content_length() {
+        Some(size) => crate::types::format_bytes(size),
+        None => "unknown size".to_string(),
+    };
+
+    let mut s = format!("< {} in {}ms, {}\n", resp.status(), start.elapsed().as_millis(), size);
+    s.push_str(&format_headers("<", resp.headers()));
+
+    s
+}
+
+/// Read the whole body of a response, returning a response with the same body for the
+/// caller to read.
+async fn read_body(resp: reqwest::Response) -> reqwest::Result<(reqwest::Response, bytes::Bytes)> {
+    let status = resp.status();
+    let version = resp.version();
+    let headers = resp.headers().clone();
+    let body = resp.bytes().await?;
+
+    let mut copy = http::Response::new(body.clone());
+    *copy.status_mut() = status;
+    *copy.version_mut() = version;
+    *copy.headers_mut() = headers;
+
+    Ok((copy.into(), body))
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_parse_verbosity() {
+        assert_eq!(parse_verbosity(""), 0);
+        assert_eq!(parse_verbosity("0"), 0);
+        assert_eq!(parse_verbosity("1"), HEADERS);
+        assert_eq!(parse_verbosity("2"), BODIES);
+        assert_eq!(parse_verbosity("9"), BODIES);
+        assert_eq!(parse_verbosity("true"), HEADERS);
+    }
+
+    #[test]
+    fn test_format_request() {
+        let request = reqwest::Client::new()
+            .post("https://api.kittycad.io/file/volume")
+            .bearer_auth("my-secret-token")
+            .header("content-type", "application/json")
+            .body(r#"{"a":1}"#)
+            .build()
+            .unwrap();
+
+        assert_eq!(
+            format_request(&request, HEADERS),
+            r#"> POST https://api.kittycad.io/file/volume
+> authorization: [redacted]
+> content-type: application/json
+"#
+        );
+        assert_eq!(
+            format_request(&request, BODIES),
+            r#"> POST https://api.kittycad.io/file/volume
+> authorization: [redacted]
+> content-type: application/json
+>
+{"a":1}
+"#
+        );
+    }
+
+    #[test]
+    fn test_format_body() {
+        assert_eq!(format_body("<", b""), "");
+        assert_eq!(format_body("<", &[0xff, 0xfe]), "< [2 B of binary data]\n");
+        assert_eq!(format_body("<", b"{\"a\": 1}"), "<\n{\"a\": 1}\n");
+        assert_eq!(
+            format_body(
+                "<",
+                br#"{"id":"1","token":"my-secret-token","items":[{"refresh_token":"r"}],"next_page":null}"#
+            ),
+            "<\n{\"id\":\"1\",\"items\":[{\"refresh_token\":\"[redacted]\"}],\"next_page\":null,\"token\":\"[redacted]\"}\n"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_call() {
+        let (io, _, stderr_path) = crate::iostreams::IoStreams::test();
+        let log = HttpLog::new(BODIES, io.err_out.clone());
+
+        let token = log
+            .call("POST /user/api-tokens", async {
+                Ok(serde_json::json!({"token": "my-secret-token"}))
+            })
+            .await
+            .unwrap();
+        assert_eq!(token["token"], "my-secret-token");
+
+        let stderr = std::fs::read_to_string(&stderr_path).unwrap();
+        assert!(stderr.starts_with("> POST /user/api-tokens\n< OK in "), "{}", stderr);
+        assert!(stderr.ends_with("<\n{\"token\":\"[redacted]\"}\n"), "{}", stderr);
+    }
+
+    #[tokio::test(flavor = "multi_thread")]
+    async fn test_send_logs_to_err_out() {
+        let (io, stdout_path, stderr_path) = crate::iostreams::IoStreams::test();
+        let req = reqwest::Client::new().get("http://127.0.0.1:1/ping");
+
+        let log = HttpLog::new(HEADERS, io.err_out.clone());
+        assert!(send(&log, req).await.is_err());
+
+        assert_eq!(std::fs::read_to_string(&stdout_path).unwrap(), "");
+        let stderr = std::fs::read_to_string(&stderr_path).unwrap();
+        assert!(
+            stderr.starts_with("> GET http://127.0.0.1:1/ping\n< error after "),
+            "{}",
+            stderr
+        );
+
+        let (io, _, stderr_path) = crate::iostreams::IoStreams::test();
+        let req = reqwest::Client::new().get("http://127.0.0.1:1/ping");
+        assert!(send(&HttpLog::new(0, io.err_out.clone()), req).await.is_err());
+        assert_eq!(std::fs::read_to_string(&stderr_path).unwrap(), "");
+    }
+
+    #[tokio::test(flavor = "multi_thread")]
+    async fn test_read_body() {
+        let mut resp = http::Response::new("pong");
+        *resp.status_mut() = http::StatusCode::CREATED;
+        let resp: reqwest::Response = resp.into();
+
+        let (resp, body) = read_body(resp).await.unwrap();
+        assert_eq!(body, "pong");
+        assert_eq!(resp.status(), http::StatusCode::CREATED);
+        assert_eq!(resp.text().await.unwrap(), "pong");
+    }
+}
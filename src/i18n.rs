@@ -0,0 +1,169 @@
+use std::sync::atomic::{AtomicUsize, Ordering};
+
+use anyhow::Result;
+
+/// The languages we have translations for, with their catalogs.
+///
+/// A catalog maps an English message to its translation, so messages read as English in
+/// the code and anything not translated yet falls back to it. Placeholders are `{}`, in
+/// the same order as in the English message.
+const CATALOGS: &[(&str, &str)] = &[
+    ("de", include_str!("../locales/de.toml")),
+    ("es", include_str!("../locales/es.toml")),
+];
+
+/// The index of the language of messages in `CATALOGS` plus one, 0 for English.
+static LANG: AtomicUsize = AtomicUsize::new(0);
+
+/// Use the language from `LC_ALL`, `LC_MESSAGES` or `LANG`, whichever is set first.
+/// Languages we have no translations for are English.
+pub fn init_from_env() {
+    let lang = ["LC_ALL", "LC_MESSAGES", "LANG"]
+        .iter()
+        .filter_map(|name| std::env::var(name).ok())
+        .find(|value| !value.is_empty())
+        .unwrap_or_default();
+
+    LANG.store(catalog_index(&parse_locale(&lang)).unwrap_or(0), Ordering::Relaxed);
+}
+
+/// Use a language given with `--lang`, failing if we have no translations for it.
+pub fn set_lang(lang: &str) -> Result<()> {
+    let lang = parse_locale(lang);
+    if lang == "en" {
+        LANG.store(0, Ordering::Relaxed);
+        return Ok(());
+    }
+
+    match catalog_index(&lang) {
+        Some(index) => {
+            LANG.store(index, Ordering::Relaxed);
+            Ok(())
+        }
+        None => anyhow::bail!(
+            "no translations for `{}`, the languages are: en, {}",
+            lang,
+            CATALOGS.iter().map(|(lang, _)| *lang).collect::<Vec<_>>().join(", ")
+        ),
+    }
+}
+
+/// Returns the message in the language of messages.
+pub fn tr(msg: &'static str) -> &'static str {
+    match LANG.load(Ordering::Relaxed) {
+        0 => msg,
+        index => translate(index - 1, msg),
+    }
+}
+
+/// Returns the message in the language of messages, with its `{}` placeholders filled
+/// in with `args` in order.
+pub fn trf(msg: &'static str, args: &[&dyn std::fmt::Display]) -> String {
+    let mut args = args.iter();
+    let mut s = String::new();
+    let mut parts = tr(msg).split("{}").peekable();
+    while let Some(part) = parts.next() {
+        s.push_str(part);
+        if parts.peek().is_some() {
+            if let Some(arg) = args.next() {
+                s.push_str(&arg.to_string());
+            }
+        }
+    }
+
+    s
+}
+
+/// Returns the translation of a message from a catalog, or the message if it has none.
+fn translate(index: usize, msg: &'static str) -> &'static str {
+    static PARSED: std::sync::OnceLock<Vec<std::collections::HashMap<String, String>>> = std::sync::OnceLock::new();
+
+    let catalogs = PARSED.get_or_init(|| {
+        CATALOGS
+            .iter()
+            // The catalogs are checked by the tests, a broken one is English.
+            .map(|(_, catalog)| toml::from_str(catalog).unwrap_or_default())
+            .collect()
+    });
+
+    catalogs
+        .get(index)
+        .and_then(|catalog| catalog.get(msg))
+        .map(|translation| translation.as_str())
+        .unwrap_or(msg)
+}
+
+/// Returns the language of a locale, e.g. `de` for `de_DE.UTF-8`. The `C` and `POSIX`
+/// locales are English.
+fn parse_locale(locale: &str) -> String {
+    let lang = locale
+        .split(|c| c == '_' || c == '-' || c == '.' || c == '@')
+        .next()
+        .unwrap_or_default()
+        .to_lowercase();
+
+    match lang.as_str() {
+        "" | "c" | "posix" => "en".to_string(),
+        _ => lang,
+    }
+}
+
+/// Returns the index of a language in `CATALOGS` plus one.
+fn catalog_index(lang: &str) -> Option<usize> {
+    CATALOGS.iter().position(|(l, _)| *l == lang).map(|index| index + 1)
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_parse_locale() {
+        assert_eq!(parse_locale("de_DE.UTF-8"), "de");
+        assert_eq!(parse_locale("es"), "es");
+        assert_eq!(parse_locale("pt-BR"), "pt");
+        assert_eq!(parse_locale("C.UTF-8"), "en");
+        assert_eq!(parse_locale(""), "en");
+    }
+
+    #[test]
+    fn test_translate() {
+        assert_eq!(translate(0, "Success."), "Erfolg.");
+        assert_eq!(translate(1, "Success."), "Éxito.");
+        assert_eq!(translate(0, "not in the catalog"), "not in the catalog");
+    }
+
+    #[test]
+    fn test_trf() {
+        assert_eq!(trf("{} Removed {} of {}", &[&"✔", &2, &"3"]), "✔ Removed 2 of 3");
+        assert_eq!(trf("no placeholders", &[&1]), "no placeholders");
+    }
+
+    #[test]
+    fn test_set_lang() {
+        assert_eq!(
+            set_lang("xx_XX.UTF-8").unwrap_err().to_string(),
+            "no translations for `xx`, the languages are: en, de, es"
+        );
+    }
+
+    #[test]
+    fn test_catalogs() {
+        for (lang, catalog) in CATALOGS {
+            let catalog: std::collections::HashMap<String, String> = toml::from_str(catalog)
+                .unwrap_or_else(|err| panic!("the `{}` catalog is not valid TOML: {}", lang, err));
+
+            for (msg, translation) in catalog {
+                assert_eq!(
+                    translation.matches("{}").count(),
+                    msg.matches("{}").count(),
+                    "the `{}` translation of {:?} has other placeholders",
+                    lang,
+                    msg
+                );
+            }
+        }
+    }
+}
@@ -0,0 +1,144 @@
+use anyhow::{anyhow, Result};
+
+/// The files listing paths we leave out when we look for files to convert, in gitignore
+/// syntax. Later files win, so `.kittycadignore` can bring back a file `.gitignore` hides.
+const IGNORE_FILES: &[&str] = &[".gitignore", ".kittycadignore"];
+
+/// The paths to leave out of a directory, from the ignore files in it.
+pub struct Ignored {
+    root: std::path::PathBuf,
+    rules: Vec<Rule>,
+}
+
+/// A line of an ignore file.
+struct Rule {
+    /// The pattern, relative to the directory of the ignore file.
+    pattern: crate::glob::Pattern,
+    /// The line starts with `!`, so it brings back what an earlier line left out.
+    negated: bool,
+    /// The line ends with `/`, so it only matches directories.
+    dir_only: bool,
+}
+
+impl Ignored {
+    /// Read the ignore files in the directory, if it has any.
+    pub fn load(dir: &std::path::Path) -> Result<Ignored> {
+        let root = if dir.is_absolute() {
+            dir.to_path_buf()
+        } else {
+            std::env::current_dir()?.join(dir)
+        };
+
+        let mut rules = Vec::new();
+        for name in IGNORE_FILES {
+            let path = root.join(name);
+            let contents = match std::fs::read_to_string(&path) {
+                Ok(contents) => contents,
+                Err(err) if err.kind() == std::io::ErrorKind::NotFound => continue,
+                Err(err) => return Err(anyhow!("failed to read {}: {}", path.display(), err)),
+            };
+
+            for line in contents.lines() {
+                if let Some(rule) =
+                    parse_rule(line).map_err(|err| anyhow!("failed to parse {}: {}", path.display(), err))?
+                {
+                    rules.push(rule);
+                }
+            }
+        }
+
+        Ok(Ignored { root, rules })
+    }
+
+    /// Returns true if the file, or a directory it is in, is ignored. Relative paths are
+    /// relative to the current directory, files outside the directory are never ignored.
+    pub fn is_ignored(&self, path: &std::path::Path) -> bool {
+        let path = if path.is_absolute() {
+            path.to_path_buf()
+        } else {
+            match std::env::current_dir() {
+                Ok(dir) => dir.join(path),
+                Err(_) => return false,
+            }
+        };
+
+        let relative = match path.strip_prefix(&self.root) {
+            Ok(relative) => relative,
+            Err(_) => return false,
+        };
+
+        // The closest match wins, a file can be brought back in an ignored directory.
+        for (i, path) in relative.ancestors().enumerate() {
+            if path.as_os_str().is_empty() {
+                break;
+            }
+
+            // Only the path itself can be a file, the rest are the directories it is in.
+            let is_dir = i > 0 || self.root.join(path).is_dir();
+            if let Some(rule) = self
+                .rules
+                .iter()
+                .rev()
+                .find(|rule| (is_dir || !rule.dir_only) && rule.pattern.matches_path(path))
+            {
+                return !rule.negated;
+            }
+        }
+
+        false
+    }
+}
+
+/// Parse a line of an ignore file, blank lines and comments have no rule.
+fn parse_rule(line: &str) -> Result<Option<Rule>> {
+    let line = line.trim_end();
+    if line.is_empty() || line.starts_with('#') {
+        return Ok(None);
+    }
+
+    let (negated, line) = match line.strip_prefix('!') {
+        Some(line) => (true, line),
+        None => (false, line.strip_prefix('\\').unwrap_or(line)),
+    };
+    let (dir_only, line) = match line.strip_suffix('/') {
+        Some(line) => (true, line),
+        None => (false, line),
+    };
+
+    // A pattern with a slash in it is relative to the directory of the ignore file, one
+    // without matches a name in any directory.
+    let pattern = match line.strip_prefix('/') {
+        Some(line) => line.to_string(),
+        None if line.contains('/') => line.to_string(),
+        None => format!("**/{}", line),
+    };
+
+    Ok(Some(Rule {
+        pattern: crate::glob::Pattern::new(&pattern)?,
+        negated,
+        dir_only,
+    }))
+}
+
+#[cfg(test)]
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_is_ignored() {
+        let dir = tempfile::tempdir().unwrap();
+        std::fs::write(dir.path().join(".gitignore"), "out/\n*.tmp.step\n").unwrap();
+        std::fs::write(dir.path().join(".kittycadignore"), "old/\n!keep.tmp.step\n").unwrap();
+
+        let ignored = Ignored::load(dir.path()).unwrap();
+        assert!(ignored.is_ignored(&dir.path().join("out/a.obj")));
+        assert!(ignored.is_ignored(&dir.path().join("parts/old/b.step")));
+        assert!(ignored.is_ignored(&dir.path().join("c.tmp.step")));
+        assert!(!ignored.is_ignored(&dir.path().join("keep.tmp.step")));
+        assert!(!ignored.is_ignored(&dir.path().join("parts/d.step")));
+        assert!(!ignored.is_ignored(std::path::Path::new("/elsewhere/out/a.obj")));
+
+        let none = Ignored::load(tempfile::tempdir().unwrap().path()).unwrap();
+        assert!(!none.is_ignored(&dir.path().join("out/a.obj")));
+    }
+}
@@ -7,10 +7,47 @@ use crate::config_file::get_env_var;
 
 const DEFAULT_WIDTH: i32 = 80;
 
+/// Terminals narrower than this get key: value lines instead of tables, since tables
+/// wrap into an unreadable mess.
+const NARROW_WIDTH: i32 = 60;
+
+/// A writer that can be shared, e.g. with a progress indicator that is moved into the
+/// body of a request. Its clones all write to the same place.
+#[derive(Clone)]
+pub struct SharedWriter(std::sync::Arc<std::sync::Mutex<Box<dyn std::io::Write + Send + Sync>>>);
+
+impl SharedWriter {
+    pub fn new(w: impl std::io::Write + Send + Sync + 'static) -> SharedWriter {
+        SharedWriter(std::sync::Arc::new(std::sync::Mutex::new(Box::new(w))))
+    }
+}
+
+impl std::io::Write for SharedWriter {
+    fn write(&mut self, buf: &[u8]) -> std::io::Result<usize> {
+        match self.0.lock() {
+            Ok(mut w) => w.write(buf),
+            Err(_) => Err(std::io::Error::new(std::io::ErrorKind::Other, "the writer is poisoned")),
+        }
+    }
+
+    fn flush(&mut self) -> std::io::Result<()> {
+        match self.0.lock() {
+            Ok(mut w) => w.flush(),
+            Err(_) => Err(std::io::Error::new(std::io::ErrorKind::Other, "the writer is poisoned")),
+        }
+    }
+}
+
+impl std::fmt::Debug for SharedWriter {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str("SharedWriter")
+    }
+}
+
 pub struct IoStreams {
     pub stdin: Box<dyn std::io::Read + Send + Sync>,
     pub out: Box<dyn std::io::Write + Send + Sync>,
-    pub err_out: Box<dyn std::io::Write + Send + Sync>,
+    pub err_out: SharedWriter,
 
     color_enabled: bool,
     is_256_enabled: bool,
@@ -18,6 +55,8 @@ pub struct IoStreams {
     terminal_theme: String,
 
     progress_indicator_enabled: bool,
+    /// Plain output for screen readers, see `set_accessible`.
+    accessible: bool,
 
     stdin_tty_override: bool,
     stdin_is_tty: bool,
@@ -34,6 +73,16 @@ pub struct IoStreams {
 
     never_prompt: bool,
 
+    json_fields: Vec<String>,
+
+    /// The salt of the stand-ins for the values that identify the user, while they are hidden.
+    identity_salt: Option<String>,
+    hyperlinks_enabled: bool,
+    /// The values that identify the user in what we are printing, while they are hidden.
+    identities: Vec<String>,
+    /// The renderer output is passed to and the command it is for, see `crate::renderer`.
+    renderer: Option<(String, String)>,
+
     pub tmp_file_override: Option<std::fs::File>,
 }
 
@@ -90,7 +139,7 @@ impl IoStreams {
 
     #[allow(dead_code)]
     pub fn set_color_enabled(&mut self, color_enabled: bool) {
-        self.color_enabled = color_enabled;
+        self.color_enabled = color_enabled && !self.accessible;
     }
 
     #[allow(dead_code)]
@@ -220,18 +269,51 @@ impl IoStreams {
         self.never_prompt = never_prompt;
     }
 
+    /// Returns true if we can show progress, stdout and stderr are both terminals.
+    pub fn progress_indicator_enabled(&self) -> bool {
+        self.progress_indicator_enabled
+    }
+
     #[allow(dead_code)]
     /// This returns a handle to a spinner. To stop the spinner, call `.stop()` on it.
     pub fn start_process_indicator(&mut self) -> Option<terminal_spinners::SpinnerHandle> {
         self.start_process_indicator_with_label("")
     }
 
+    /// Make the output plain for screen readers: no color, no hyperlinks, no spinners and
+    /// no progress redrawn in place, but plain lines instead.
+    pub fn set_accessible(&mut self, accessible: bool) {
+        self.accessible = accessible;
+        if accessible {
+            self.color_enabled = false;
+            self.hyperlinks_enabled = false;
+        }
+    }
+
+    pub fn accessible(&self) -> bool {
+        self.accessible
+    }
+
+    /// Returns a progress indicator for a transfer, drawn on `err_out` and plain if the
+    /// output is accessible. Only use it when `progress_indicator_enabled` is true.
+    pub fn progress(&self, label: &str, total: u64) -> crate::http_body::Progress {
+        crate::http_body::Progress::new(label, total, self.err_out.clone()).plain(self.accessible)
+    }
+
     /// This returns a handle to a spinner. To stop the spinner, call `.stop()` on it.
+    ///
+    /// When the output is accessible, the label is printed as a line instead and there is
+    /// no spinner to stop.
     pub fn start_process_indicator_with_label(&mut self, label: &str) -> Option<terminal_spinners::SpinnerHandle> {
         if !self.progress_indicator_enabled {
             return None;
         }
 
+        if self.accessible {
+            let _ = writeln!(self.err_out, "{}...", label.trim());
+            return None;
+        }
+
         let pi = terminal_spinners::SpinnerBuilder::new()
             .spinner(&terminal_spinners::DOTS11)
             .text(label.to_string());
@@ -239,7 +321,6 @@ impl IoStreams {
         Some(pi.start())
     }
 
-    #[allow(dead_code)]
     pub fn terminal_width(&self) -> i32 {
         if self.terminal_width_override > 0 {
             return self.terminal_width_override;
@@ -250,7 +331,7 @@ impl IoStreams {
     }
 
     pub fn force_terminal(&mut self, spec: &str) {
-        self.color_enabled = !crate::colors::env_color_disabled();
+        self.color_enabled = !crate::colors::env_color_disabled() && !self.accessible;
         self.set_stdout_tty(true);
 
         if let Ok(i) = spec.parse::<i32>() {
@@ -274,6 +355,7 @@ impl IoStreams {
 
     pub fn color_scheme(&self) -> crate::colors::ColorScheme {
         crate::colors::ColorScheme::new(self.color_enabled(), self.color_support_256(), self.has_true_color())
+            .with_hyperlinks(self.hyperlinks_enabled)
     }
 
     #[allow(dead_code)]
@@ -282,6 +364,14 @@ impl IoStreams {
         format: &crate::types::FormatOutput,
         value: impl IntoIterator<Item = T> + serde::Serialize,
     ) -> Result<()> {
+        if self.identity_hidden() {
+            self.identities = crate::privacy::identities(&serde_json::to_value(&value)?);
+        }
+
+        if self.renderer.is_some() {
+            return self.write_output_rendered(&serde_json::to_value(&value)?);
+        }
+
         match format {
             crate::types::FormatOutput::Json => self.write_output_json(&serde_json::to_value(value)?),
             crate::types::FormatOutput::Table => self.write_output_table_for_vec(value),
@@ -294,6 +384,14 @@ impl IoStreams {
         format: &crate::types::FormatOutput,
         value: &T,
     ) -> Result<()> {
+        if self.identity_hidden() {
+            self.identities = crate::privacy::identities(&serde_json::to_value(value)?);
+        }
+
+        if self.renderer.is_some() {
+            return self.write_output_rendered(&serde_json::to_value(value)?);
+        }
+
         match format {
             crate::types::FormatOutput::Json => self.write_output_json(&serde_json::to_value(value)?),
             crate::types::FormatOutput::Table => self.write_output_table(value),
@@ -301,7 +399,79 @@ impl IoStreams {
         }
     }
 
+    /// Pass output to a renderer instead of printing it, see `crate::renderer`.
+    pub fn set_renderer(&mut self, name: &str, command: &str) {
+        self.renderer = Some((name.to_string(), command.to_string()));
+    }
+
+    /// Print what the renderer makes of the JSON.
+    fn write_output_rendered(&mut self, json: &serde_json::Value) -> Result<()> {
+        let (name, command) = match &self.renderer {
+            Some(renderer) => renderer.clone(),
+            None => return self.write_output_json(json),
+        };
+
+        let redacted;
+        let json = if let Some(salt) = &self.identity_salt {
+            redacted = crate::privacy::redact_json(json, salt);
+            &redacted
+        } else {
+            json
+        };
+
+        let rendered = crate::renderer::render(&name, &command, json)?;
+        self.out.write_all(&rendered)?;
+
+        Ok(())
+    }
+
+    /// Only print these fields of objects in JSON output, in this order.
+    pub fn set_json_fields(&mut self, fields: Vec<String>) {
+        self.json_fields = fields;
+    }
+
+    /// Print URLs as clickable links, see `ColorScheme::hyperlink`. They never are when
+    /// the output is accessible.
+    pub fn set_hyperlinks_enabled(&mut self, hyperlinks_enabled: bool) {
+        self.hyperlinks_enabled = hyperlinks_enabled && !self.accessible;
+    }
+
+    /// Hide the emails and IDs that identify the user in output behind stand-ins made
+    /// with the salt of this install, see `crate::privacy`.
+    pub fn set_identity_hidden(&mut self, salt: Option<String>) {
+        self.identity_salt = salt;
+    }
+
+    pub fn identity_hidden(&self) -> bool {
+        self.identity_salt.is_some()
+    }
+
+    /// Returns a value that identifies the user as we print it: its stand-in while they
+    /// are hidden.
+    pub fn redact(&self, value: &str) -> String {
+        match &self.identity_salt {
+            Some(salt) => crate::privacy::redact(salt, value),
+            None => value.to_string(),
+        }
+    }
+
     pub fn write_output_json(&mut self, json: &serde_json::Value) -> Result<()> {
+        let redacted;
+        let json = if let Some(salt) = &self.identity_salt {
+            redacted = crate::privacy::redact_json(json, salt);
+            &redacted
+        } else {
+            json
+        };
+
+        let projected;
+        let json = if self.json_fields.is_empty() {
+            json
+        } else {
+            projected = project_json(json, &self.json_fields);
+            &projected
+        };
+
         if self.color_enabled() {
             // Print the response body.
             writeln!(self.out, "{}", colored_json::to_colored_json_auto(json)?)?;
@@ -314,6 +484,12 @@ impl IoStreams {
     }
 
     pub fn write_output_yaml<Y: serde::Serialize>(&mut self, yaml: &Y) -> Result<()> {
+        if let Some(salt) = &self.identity_salt {
+            let redacted = crate::privacy::redact_json(&serde_json::to_value(yaml)?, salt);
+            writeln!(self.out, "{}", serde_yaml::to_string(&redacted)?)?;
+            return Ok(());
+        }
+
         // Print the response body.
         writeln!(self.out, "{}", serde_yaml::to_string(yaml)?)?;
 
@@ -322,7 +498,17 @@ impl IoStreams {
 
     #[allow(dead_code)]
     pub fn write_output_table_for_vec<T: tabled::Tabled>(&mut self, value: impl IntoIterator<Item = T>) -> Result<()> {
-        let table = tabled::Table::new(value).with(tabled::Style::psql()).to_string();
+        if self.is_narrow_terminal() {
+            return self.write_output_stacked(value);
+        }
+
+        let salt = self.identity_salt.as_deref().unwrap_or_default();
+        let records = value.into_iter().map(|record| crate::privacy::Redacted {
+            record,
+            identities: &self.identities,
+            salt,
+        });
+        let table = tabled::Table::new(records).with(tabled::Style::psql()).to_string();
 
         writeln!(self.out, "{}", table)?;
 
@@ -330,7 +516,16 @@ impl IoStreams {
     }
 
     pub fn write_output_table<T: tabled::Tabled>(&mut self, value: &T) -> Result<()> {
-        let table = tabled::Table::new(vec![value])
+        if self.is_narrow_terminal() {
+            return self.write_output_stacked(vec![value]);
+        }
+
+        let record = crate::privacy::Redacted {
+            record: value,
+            identities: &self.identities,
+            salt: self.identity_salt.as_deref().unwrap_or_default(),
+        };
+        let table = tabled::Table::new(vec![record])
             .with(tabled::Rotate::Left)
             .with(
                 tabled::Modify::new(tabled::object::Segment::all())
@@ -345,6 +540,36 @@ impl IoStreams {
         Ok(())
     }
 
+    fn is_narrow_terminal(&self) -> bool {
+        self.is_stdout_tty() && self.terminal_width() < NARROW_WIDTH
+    }
+
+    /// Write each record as `key: value` lines, truncating values that would wrap.
+    fn write_output_stacked<T: tabled::Tabled>(&mut self, value: impl IntoIterator<Item = T>) -> Result<()> {
+        let headers = T::headers();
+        let width = self.terminal_width().max(0) as usize;
+
+        for (i, record) in value.into_iter().enumerate() {
+            if i > 0 {
+                writeln!(self.out)?;
+            }
+
+            for (header, field) in headers.iter().zip(record.fields()) {
+                let salt = self.identity_salt.as_deref().unwrap_or_default();
+                let field = crate::privacy::redact_text(&field, &self.identities, salt);
+                let available = width.saturating_sub(header.chars().count() + 2);
+                writeln!(
+                    self.out,
+                    "{}: {}",
+                    header,
+                    truncate(&field.replace('\n', " "), available)
+                )?;
+            }
+        }
+
+        Ok(())
+    }
+
     pub fn system() -> Self {
         let stdout_is_tty = atty::is(atty::Stream::Stdout);
         let stderr_is_tty = atty::is(atty::Stream::Stderr);
@@ -371,7 +596,7 @@ impl IoStreams {
         let mut io = IoStreams {
             stdin: Box::new(std::io::stdin()),
             out: Box::new(std::io::stdout()),
-            err_out: Box::new(std::io::stderr()),
+            err_out: SharedWriter::new(std::io::stderr()),
             color_enabled: crate::colors::env_color_forced() || (!crate::colors::env_color_disabled() && stdout_is_tty),
             is_256_enabled: assume_true_color || crate::colors::is_256_color_supported(),
             has_true_color: assume_true_color || crate::colors::is_true_color_supported(),
@@ -379,6 +604,7 @@ impl IoStreams {
             terminal_theme: "".to_string(),
 
             progress_indicator_enabled: false,
+            accessible: false,
 
             stdin_tty_override: false,
             stdin_is_tty: atty::is(atty::Stream::Stdin),
@@ -394,6 +620,11 @@ impl IoStreams {
 
             pager_process: None,
             never_prompt: false,
+            json_fields: vec![],
+            identity_salt: None,
+            hyperlinks_enabled: false,
+            identities: vec![],
+            renderer: None,
             tmp_file_override: None,
         };
 
@@ -416,7 +647,7 @@ impl IoStreams {
         let (stderr, stderr_path) = tempfile::NamedTempFile::new().unwrap().keep().unwrap();
 
         io.out = Box::new(stdout);
-        io.err_out = Box::new(stderr);
+        io.err_out = SharedWriter::new(stderr);
 
         io.tty_size = test_tty_size;
 
@@ -428,11 +659,46 @@ impl IoStreams {
     }
 }
 
+/// Returns the JSON with only the given fields of each object, objects in arrays
+/// included. Anything that isn't an object is left alone.
+fn project_json(json: &serde_json::Value, fields: &[String]) -> serde_json::Value {
+    match json {
+        serde_json::Value::Object(object) => {
+            let mut projected = serde_json::Map::new();
+            for field in fields {
+                if let Some(value) = object.get(field) {
+                    projected.insert(field.to_string(), value.clone());
+                }
+            }
+            serde_json::Value::Object(projected)
+        }
+        serde_json::Value::Array(values) => {
+            serde_json::Value::Array(values.iter().map(|value| project_json(value, fields)).collect())
+        }
+        _ => json.clone(),
+    }
+}
+
 #[cfg(test)]
 fn test_tty_size() -> Result<(i32, i32)> {
     Err(anyhow::anyhow!("tty_size not implemented in tests"))
 }
 
+/// Shorten a string to at most `width` characters, ending it with an ellipsis if it was cut.
+fn truncate(s: &str, width: usize) -> String {
+    if s.chars().count() <= width {
+        return s.to_string();
+    }
+
+    if width == 0 {
+        return String::new();
+    }
+
+    let mut truncated: String = s.chars().take(width - 1).collect();
+    truncated.push('…');
+    truncated
+}
+
 // tty_size measures the size of the controlling terminal for the current process.
 fn tty_size() -> Result<(i32, i32)> {
     let size = terminal_size();
@@ -516,4 +782,125 @@ mod test {
             assert_eq!(width, t.want_width, "test {}", t.name);
         }
     }
+
+    #[test]
+    fn test_truncate() {
+        assert_eq!(truncate("hello", 10), "hello");
+        assert_eq!(truncate("hello", 5), "hello");
+        assert_eq!(truncate("hello world", 5), "hell…");
+        assert_eq!(truncate("hello", 0), "");
+    }
+
+    #[derive(tabled::Tabled)]
+    struct Record {
+        name: String,
+        description: String,
+    }
+
+    #[test]
+    fn test_write_output_table_narrow() {
+        let (mut io, stdout_path, _) = IoStreams::test();
+        io.force_terminal("30");
+        io.set_color_enabled(false);
+
+        io.write_output_table_for_vec(vec![
+            Record {
+                name: "first".to_string(),
+                description: "a description that is far too long to fit".to_string(),
+            },
+            Record {
+                name: "second".to_string(),
+                description: "short".to_string(),
+            },
+        ])
+        .unwrap();
+
+        let stdout = std::fs::read_to_string(&stdout_path).unwrap();
+        assert_eq!(
+            stdout,
+            "name: first\ndescription: a description th…\n\nname: second\ndescription: short\n"
+        );
+    }
+
+    #[test]
+    fn test_write_output_json_fields() {
+        let (mut io, stdout_path, _) = IoStreams::test();
+        io.set_color_enabled(false);
+        io.set_json_fields(vec!["status".to_string(), "id".to_string()]);
+
+        io.write_output_json(&serde_json::json!([
+            {"id": "a", "status": "Completed", "output": "big"},
+            {"id": "b"},
+        ]))
+        .unwrap();
+
+        let stdout = std::fs::read_to_string(&stdout_path).unwrap();
+        let json: serde_json::Value = serde_json::from_str(&stdout).unwrap();
+        assert_eq!(
+            json,
+            serde_json::json!([{"id": "a", "status": "Completed"}, {"id": "b"}])
+        );
+    }
+
+    #[test]
+    fn test_write_output_identity_hidden() {
+        #[derive(serde::Serialize, tabled::Tabled)]
+        struct User {
+            id: String,
+            email: String,
+            company: String,
+        }
+
+        let (mut io, stdout_path, _) = IoStreams::test();
+        io.set_color_enabled(false);
+        io.set_identity_hidden(Some("salt".to_string()));
+
+        let user = User {
+            id: "1234".to_string(),
+            email: "a@b.c".to_string(),
+            company: "KittyCAD".to_string(),
+        };
+        io.write_output(&crate::types::FormatOutput::Table, &user).unwrap();
+
+        // The table is laid out around the stand-ins, so every line is as wide.
+        let table = std::fs::read_to_string(&stdout_path).unwrap();
+        let widths: Vec<usize> = table.trim_end().lines().map(|line| line.chars().count()).collect();
+        assert!(widths.iter().all(|width| *width == widths[0]), "{}", table);
+
+        io.write_output(&crate::types::FormatOutput::Json, &user).unwrap();
+
+        let stdout = std::fs::read_to_string(&stdout_path).unwrap();
+        assert!(!stdout.contains("a@b.c"), "{}", stdout);
+        assert!(!stdout.contains("1234"), "{}", stdout);
+        assert!(stdout.contains(&crate::privacy::redact("salt", "a@b.c")), "{}", stdout);
+        assert!(stdout.contains("KittyCAD"), "{}", stdout);
+    }
+
+    #[test]
+    fn test_set_accessible() {
+        let (mut io, _, stderr_path) = IoStreams::test();
+        io.set_color_enabled(true);
+        io.set_hyperlinks_enabled(true);
+        io.progress_indicator_enabled = true;
+        io.set_accessible(true);
+
+        assert!(!io.color_enabled());
+        assert_eq!(
+            io.color_scheme().hyperlink("https://kittycad.io"),
+            "https://kittycad.io"
+        );
+        io.set_hyperlinks_enabled(true);
+        assert_eq!(
+            io.color_scheme().hyperlink("https://kittycad.io"),
+            "https://kittycad.io"
+        );
+        // No spinner, the label is printed as a plain line instead.
+        assert!(io
+            .start_process_indicator_with_label(" Checking https://api.kittycad.io/")
+            .is_none());
+        assert_eq!(
+            std::fs::read_to_string(&stderr_path).unwrap(),
+            "Checking https://api.kittycad.io/...\n"
+        );
+    }
 }
@@ -0,0 +1,216 @@
+use std::io::Write;
+
+use anyhow::{anyhow, Result};
+
+/// Returns the secret stored in the system keyring for the account of the service, or
+/// none if there isn't one.
+pub fn get(service: &str, account: &str) -> Result<Option<String>> {
+    let (command, stdin) = get_command(service, account)?;
+    let output = run(command, &stdin)?;
+    if output.status.success() {
+        let secret = String::from_utf8(output.stdout)?;
+        return Ok(Some(secret.trim_end_matches(&['\r', '\n'][..]).to_string()));
+    }
+    if is_not_found(&output) {
+        return Ok(None);
+    }
+
+    Err(failed(&output))
+}
+
+/// Store a secret in the system keyring for the account of the service, replacing the
+/// one there.
+pub fn set(service: &str, account: &str, secret: &str) -> Result<()> {
+    let (command, stdin) = set_command(service, account, secret)?;
+    let output = run(command, &stdin)?;
+    if !output.status.success() {
+        return Err(failed(&output));
+    }
+
+    Ok(())
+}
+
+/// Remove the secret stored in the system keyring for the account of the service, it is
+/// not an error if there isn't one.
+pub fn delete(service: &str, account: &str) -> Result<()> {
+    let (command, stdin) = delete_command(service, account)?;
+    let output = run(command, &stdin)?;
+    if !output.status.success() && !is_not_found(&output) {
+        return Err(failed(&output));
+    }
+
+    Ok(())
+}
+
+/// Run a keyring command with the given input. Secrets go through stdin so they don't
+/// show up in the list of processes.
+fn run(mut command: std::process::Command, stdin: &str) -> Result<std::process::Output> {
+    let program = command.get_program().to_string_lossy().to_string();
+    let mut child = match command
+        .stdin(std::process::Stdio::piped())
+        .stdout(std::process::Stdio::piped())
+        .stderr(std::process::Stdio::piped())
+        .spawn()
+    {
+        Ok(child) => child,
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => anyhow::bail!(
+            "`{}` not found, it is needed to use the system keyring, install it or set `credential_store` to `file`",
+            program
+        ),
+        Err(err) => return Err(anyhow!("failed to run `{}`: {}", program, err)),
+    };
+
+    // Write from a thread, so a command that prints a lot before reading can't block us.
+    let input = child.stdin.take();
+    let stdin = stdin.to_string();
+    let writer = std::thread::spawn(move || -> std::io::Result<()> {
+        match input {
+            Some(mut input) => input.write_all(stdin.as_bytes()),
+            None => Ok(()),
+        }
+    });
+    let output = child.wait_with_output()?;
+    writer
+        .join()
+        .map_err(|_| anyhow!("failed to write to `{}`", program))??;
+
+    Ok(output)
+}
+
+fn failed(output: &std::process::Output) -> anyhow::Error {
+    anyhow!(
+        "the system keyring failed with {}: {}",
+        output.status,
+        String::from_utf8_lossy(&output.stderr).trim()
+    )
+}
+
+/// Returns a name quoted for the interactive mode of `security`.
+#[cfg(target_os = "macos")]
+fn quote(name: &str) -> Result<String> {
+    if name.contains(|c| c == '"' || c == '\\' || c == '\n') {
+        anyhow::bail!("`{}` can't be stored in the keychain", name);
+    }
+
+    Ok(format!("\"{}\"", name))
+}
+
+#[cfg(target_os = "macos")]
+fn get_command(service: &str, account: &str) -> Result<(std::process::Command, String)> {
+    let mut command = std::process::Command::new("/usr/bin/security");
+    command.args(["find-generic-password", "-s", service, "-a", account, "-w"]);
+    Ok((command, String::new()))
+}
+
+#[cfg(target_os = "macos")]
+fn set_command(service: &str, account: &str, secret: &str) -> Result<(std::process::Command, String)> {
+    // In interactive mode the secret is read from stdin, hex encoded so it needs no quoting.
+    let mut command = std::process::Command::new("/usr/bin/security");
+    command.arg("-i");
+    let stdin = format!(
+        "add-generic-password -U -s {} -a {} -X {}\n",
+        quote(service)?,
+        quote(account)?,
+        data_encoding::HEXLOWER.encode(secret.as_bytes())
+    );
+    Ok((command, stdin))
+}
+
+#[cfg(target_os = "macos")]
+fn delete_command(service: &str, account: &str) -> Result<(std::process::Command, String)> {
+    let mut command = std::process::Command::new("/usr/bin/security");
+    command.args(["delete-generic-password", "-s", service, "-a", account]);
+    Ok((command, String::new()))
+}
+
+/// `security` exits with 44 when the item isn't in the keychain.
+#[cfg(target_os = "macos")]
+fn is_not_found(output: &std::process::Output) -> bool {
+    output.status.code() == Some(44)
+}
+
+#[cfg(windows)]
+fn powershell(script: &str) -> std::process::Command {
+    let mut command = std::process::Command::new("powershell");
+    command.args(["-NoProfile", "-NonInteractive", "-Command", script]);
+    command
+}
+
+/// Loads the Windows Credential Manager vault in PowerShell, the names are read from
+/// stdin so they need no quoting.
+#[cfg(windows)]
+const VAULT: &str =
+    "[void][Windows.Security.Credentials.PasswordVault,Windows.Security.Credentials,ContentType=WindowsRuntime]; \
+    $vault = New-Object Windows.Security.Credentials.PasswordVault; \
+    $service = [Console]::In.ReadLine(); $account = [Console]::In.ReadLine(); ";
+
+/// The exit code of our PowerShell scripts when the credential isn't in the vault.
+#[cfg(windows)]
+const NOT_FOUND: i32 = 44;
+
+#[cfg(windows)]
+fn get_command(service: &str, account: &str) -> Result<(std::process::Command, String)> {
+    let command = powershell(&format!(
+        "{}try {{ $c = $vault.Retrieve($service, $account) }} catch {{ exit {} }}; $c.RetrievePassword(); [Console]::Out.Write($c.Password)",
+        VAULT, NOT_FOUND
+    ));
+    Ok((command, format!("{}\n{}\n", service, account)))
+}
+
+#[cfg(windows)]
+fn set_command(service: &str, account: &str, secret: &str) -> Result<(std::process::Command, String)> {
+    let command = powershell(&format!(
+        "{}$secret = [Console]::In.ReadLine(); $vault.Add((New-Object Windows.Security.Credentials.PasswordCredential($service, $account, $secret)))",
+        VAULT
+    ));
+    Ok((command, format!("{}\n{}\n{}\n", service, account, secret)))
+}
+
+#[cfg(windows)]
+fn delete_command(service: &str, account: &str) -> Result<(std::process::Command, String)> {
+    let command = powershell(&format!(
+        "{}try {{ $c = $vault.Retrieve($service, $account) }} catch {{ exit {} }}; $vault.Remove($c)",
+        VAULT, NOT_FOUND
+    ));
+    Ok((command, format!("{}\n{}\n", service, account)))
+}
+
+#[cfg(windows)]
+fn is_not_found(output: &std::process::Output) -> bool {
+    output.status.code() == Some(NOT_FOUND)
+}
+
+/// Elsewhere we use the Secret Service, through libsecret's `secret-tool`.
+#[cfg(not(any(target_os = "macos", windows)))]
+fn get_command(service: &str, account: &str) -> Result<(std::process::Command, String)> {
+    let mut command = std::process::Command::new("secret-tool");
+    command.args(["lookup", "service", service, "username", account]);
+    Ok((command, String::new()))
+}
+
+#[cfg(not(any(target_os = "macos", windows)))]
+fn set_command(service: &str, account: &str, secret: &str) -> Result<(std::process::Command, String)> {
+    let mut command = std::process::Command::new("secret-tool");
+    command.args([
+        "store",
+        &format!("--label={} token for {}", service, account),
+        "service",
+        service,
+        "username",
+        account,
+    ]);
+    Ok((command, secret.to_string()))
+}
+
+#[cfg(not(any(target_os = "macos", windows)))]
+fn delete_command(service: &str, account: &str) -> Result<(std::process::Command, String)> {
+    let mut command = std::process::Command::new("secret-tool");
+    command.args(["clear", "service", service, "username", account]);
+    Ok((command, String::new()))
+}
+
+/// `secret-tool` exits with 1 and says nothing when there is no such secret.
+#[cfg(not(any(target_os = "macos", windows)))]
+fn is_not_found(output: &std::process::Output) -> bool {
+    output.status.code() == Some(1) && output.stderr.is_empty()
+}
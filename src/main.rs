@@ -11,20 +11,38 @@ pub mod cmd_alias;
 pub mod cmd_api;
 /// The api call command.
 pub mod cmd_api_call;
+/// The api token command.
+pub mod cmd_api_token;
 /// The auth command.
 pub mod cmd_auth;
+/// The backup command.
+pub mod cmd_backup;
+/// The billing command.
+pub mod cmd_billing;
 /// The completion command.
 pub mod cmd_completion;
 /// The config command.
 pub mod cmd_config;
+/// The digest command.
+pub mod cmd_digest;
 /// The drake command.
 pub mod cmd_drake;
 /// The file command.
 pub mod cmd_file;
 /// The generate command.
 pub mod cmd_generate;
+/// The history command.
+pub mod cmd_history;
+/// The host command.
+pub mod cmd_host;
 /// The open command.
 pub mod cmd_open;
+/// The preset command.
+pub mod cmd_preset;
+/// The status command.
+pub mod cmd_status;
+/// The telemetry command.
+pub mod cmd_telemetry;
 /// The update command.
 pub mod cmd_update;
 /// The user command.
@@ -38,29 +56,65 @@ mod built_info {
     include!(concat!(env!("OUT_DIR"), "/built.rs"));
 }
 
+mod batch_manifest;
+mod cache;
 mod colors;
+mod command_defaults;
+mod command_tree;
 mod config;
 mod config_alias;
+mod config_credentials;
+mod config_doctor;
 mod config_file;
 mod config_from_env;
 mod config_from_file;
 mod config_map;
+mod config_sync;
 mod context;
+mod deprecation;
 mod docs_man;
 mod docs_markdown;
+mod docs_terminal;
+mod download;
+mod endpoints;
+mod exit_code;
+mod failure_bundle;
+mod file_info;
+mod glob;
+mod gzip;
+mod history;
+mod http_body;
+mod http_log;
+mod i18n;
+mod ignore_files;
 mod iostreams;
+mod keyring;
+mod output_file;
+mod pagination;
+mod picker;
+mod policy;
+mod preset;
+mod privacy;
 mod prompt_ext;
+mod quota;
+mod renderer;
+mod retry;
+mod scaffold;
+mod signing;
+mod tarball;
+mod telemetry;
 mod types;
 
 #[cfg(test)]
 mod tests;
 
 mod update;
+mod update_verify;
 
 use std::io::{Read, Write};
 
 use anyhow::Result;
-use clap::Parser;
+use clap::{CommandFactory, FromArgMatches, Parser};
 use slog::Drain;
 
 /// The default host for the KittyCAD API.
@@ -70,6 +124,20 @@ pub const DEFAULT_HOST: &str = "https://api.kittycad.io";
 ///
 /// You've never CAD it so good.
 ///
+/// Output from `kittycad` follows a simple contract, so it is safe to use in scripts:
+/// the data a command produces (JSON, YAML, tables, file contents) is written to
+/// standard output, and everything meant for humans (progress, prompts, notices,
+/// success messages and errors) is written to standard error.
+///
+/// Run `kittycad help deprecations` to see which flags are deprecated and when they
+/// will be removed.
+///
+/// Run `kittycad help exit-codes` to see the codes `kittycad` exits with, so scripts can
+/// tell an authentication failure from a failed conversion or a network error.
+///
+/// Run `kittycad help --offline <command>` to read the full documentation of a command,
+/// the same page as on the website, in the terminal. It doesn't need a connection.
+///
 /// Environment variables that can be used with `kittycad`.
 ///
 /// KITTYCAD_TOKEN: an authentication token for KittyCAD API requests. Setting this
@@ -84,9 +152,20 @@ pub const DEFAULT_HOST: &str = "https://api.kittycad.io";
 ///
 /// DEBUG: set to any value to enable verbose output to standard error.
 ///
+/// KITTYCAD_DEBUG: set to 1 to print the HTTP requests and responses to standard error,
+/// or 2 to include their bodies, like `--verbose`. The values of authorization and cookie
+/// headers, and of token fields in JSON bodies, are replaced with "[redacted]".
+///
 /// KITTYCAD_PAGER, PAGER (in order of precedence): a terminal paging program to send
 /// standard output to, e.g. "less".
 ///
+/// LC_ALL, LC_MESSAGES, LANG (in order of precedence): the language of messages, e.g.
+/// "de_DE.UTF-8", `--lang` wins over them. Only some messages are translated so far, the
+/// rest are in English.
+///
+/// KITTYCAD_ACCESSIBLE: set to "1" for plain output that screen readers can follow, like
+/// the `accessible_output` setting.
+///
 /// NO_COLOR: set to any value to avoid printing ANSI escape sequences for color output.
 ///
 /// CLICOLOR: set to "0" to disable printing ANSI colors in output.
@@ -112,6 +191,59 @@ struct Opts {
     #[clap(short, long, global = true, env)]
     debug: bool,
 
+    /// Print the HTTP requests and responses to standard error, `--verbose=2` includes
+    /// their bodies
+    #[clap(
+        long,
+        global = true,
+        min_values = 0,
+        require_equals = true,
+        default_missing_value = "1"
+    )]
+    verbose: Option<u8>,
+
+    /// Number of times to retry API requests that fail because of rate limits, server or
+    /// network errors
+    #[clap(long, global = true)]
+    retry: Option<u32>,
+
+    /// Abort the command if it takes longer than this, e.g. "30s" or "2m"
+    #[clap(long, global = true, parse(try_from_str = crate::types::parse_duration))]
+    timeout: Option<std::time::Duration>,
+
+    /// Limit file uploads and downloads to this many bytes per second, e.g. "500k" or "2M"
+    #[clap(long, global = true, parse(try_from_str = crate::types::parse_rate))]
+    limit_rate: Option<u64>,
+
+    /// Read the API token for this command from a file instead of the config, use "-" for
+    /// standard input
+    #[clap(long, global = true)]
+    token_file: Option<String>,
+
+    /// Send requests to this endpoint of the default host, rather than the first healthy
+    /// one of its `endpoints`
+    #[clap(long, global = true)]
+    endpoint: Option<String>,
+
+    /// Print the output of the command with a renderer, the `kittycad-renderer-<name>`
+    /// program on your PATH, which gets it as JSON
+    #[clap(long, global = true)]
+    renderer: Option<String>,
+
+    /// The output format of the command, for scripts that want every command's output as
+    /// JSON or YAML. A command's own `--format` wins over this
+    #[clap(long, arg_enum)]
+    format: Option<crate::types::FormatOutput>,
+
+    /// Use the flags of this preset, see `kittycad preset`. Flags given on the command line
+    /// win over it
+    #[clap(long, global = true)]
+    preset: Option<String>,
+
+    /// The language of messages, e.g. `de`, rather than the one of your locale
+    #[clap(long, global = true)]
+    lang: Option<String>,
+
     #[clap(subcommand)]
     subcmd: SubCommand,
 }
@@ -122,14 +254,23 @@ enum SubCommand {
     Alias(cmd_alias::CmdAlias),
     Api(cmd_api::CmdApi),
     ApiCall(cmd_api_call::CmdApiCall),
+    ApiToken(cmd_api_token::CmdApiToken),
     Auth(cmd_auth::CmdAuth),
+    Backup(cmd_backup::CmdBackup),
+    Billing(cmd_billing::CmdBilling),
     Completion(cmd_completion::CmdCompletion),
     Config(cmd_config::CmdConfig),
+    Digest(cmd_digest::CmdDigest),
     Drake(cmd_drake::CmdDrake),
     File(cmd_file::CmdFile),
     Generate(cmd_generate::CmdGenerate),
+    History(cmd_history::CmdHistory),
+    Host(cmd_host::CmdHost),
     #[clap(alias = "open")]
     Open(cmd_open::CmdOpen),
+    Preset(cmd_preset::CmdPreset),
+    Status(cmd_status::CmdStatus),
+    Telemetry(cmd_telemetry::CmdTelemetry),
     Update(cmd_update::CmdUpdate),
     User(cmd_user::CmdUser),
     Version(cmd_version::CmdVersion),
@@ -138,32 +279,62 @@ enum SubCommand {
 #[tokio::main]
 async fn main() -> Result<(), ()> {
     let build_version = clap::crate_version!();
+
+    // Let's get our configuration. `kittycad config doctor` has to run even if it is
+    // broken, to tell you what is wrong with it.
+    let doctor = std::env::args()
+        .collect::<Vec<String>>()
+        .windows(2)
+        .any(|w| w[0] == "config" && w[1] == "doctor");
+    let mut c = match crate::config_file::parse_default_config(doctor) {
+        Ok(c) => c,
+        Err(err) => {
+            eprintln!("{}, run `kittycad config doctor` to see what is wrong", err);
+            std::process::exit(crate::exit_code::ERROR);
+        }
+    };
+
     // Check for updates to the cli.
-    // We don't await here since we don't want to block the main thread.
+    // We spawn this since we don't want to block the main thread.
     // We'll check again before we exit.
-    let update = crate::update::check_for_update(build_version, false);
+    let channel = crate::update::update_channel(&c);
+    let client = crate::context::http_client(&c, crate::context::DOWNLOAD_TIMEOUT);
+    let update =
+        tokio::spawn(async move { crate::update::check_for_update(&client?, build_version, channel, false).await });
 
-    // Let's get our configuration.
-    let mut c = crate::config_file::parse_default_config().unwrap();
     let mut config = crate::config_from_env::EnvConfig::inherit_env(&mut c);
     let mut ctx = crate::context::Context::new(&mut config);
+    crate::i18n::init_from_env();
 
     // Let's grab all our args.
     let args: Vec<String> = std::env::args().collect();
     let result = do_main(args, &mut ctx).await;
 
     // If we have an update, let's print it.
-    handle_update(&mut ctx, update.await.unwrap_or_default(), build_version).unwrap();
+    // Don't hold up the exit for it, and don't bother if the user hit Ctrl-C.
+    if result.as_ref().ok() == Some(&INTERRUPTED_EXIT_CODE) {
+        update.abort();
+    } else if let Ok(Ok(update)) = tokio::time::timeout(UPDATE_CHECK_TIMEOUT, update).await {
+        handle_update(&mut ctx, update.unwrap_or_default(), build_version).unwrap();
+    }
 
     if let Err(err) = result {
         eprintln!("{}", err);
-        std::process::exit(1);
+        std::process::exit(crate::exit_code::for_error(&err));
     }
 
     std::process::exit(result.unwrap_or(0));
 }
 
 async fn do_main(mut args: Vec<String>, ctx: &mut crate::context::Context<'_>) -> Result<i32> {
+    // Set up how we print before we print anything, e.g. warnings about deprecations.
+    let hyperlinks = ctx.config.get("", "hyperlinks").unwrap_or_default();
+    let is_tty = ctx.io.is_stderr_tty();
+    ctx.io
+        .set_hyperlinks_enabled(crate::colors::hyperlinks_enabled(&hyperlinks, is_tty));
+    let accessible = ctx.config.get("", "accessible_output").unwrap_or_default();
+    ctx.io.set_accessible(crate::colors::accessible_output(&accessible));
+
     let original_args = args.clone();
 
     // Remove the first argument, which is the program name, and can change depending on how
@@ -214,11 +385,123 @@ async fn do_main(mut args: Vec<String>, ctx: &mut crate::context::Context<'_>) -
         args = original_args;
     }
 
+    // Help topics that aren't a command.
+    let help = help_args(&Opts::command(), &args).unwrap_or_default();
+    if help == ["deprecations"] {
+        write!(
+            ctx.io.out,
+            "{}",
+            crate::deprecation::help_topic(crate::deprecation::DEPRECATIONS)?
+        )?;
+        return Ok(0);
+    }
+    if help == ["exit-codes"] {
+        write!(ctx.io.out, "{}", crate::exit_code::help_topic())?;
+        return Ok(0);
+    }
+    if help.iter().any(|arg| arg == "--offline") {
+        let path: Vec<String> = help.into_iter().filter(|arg| arg != "--offline").collect();
+        let mut app = Opts::command();
+        app._build_all();
+        let page = crate::docs_terminal::help_page(&app, &path, &ctx.io.color_scheme())?;
+
+        ctx.io.start_pager()?;
+        write!(ctx.io.out, "{}", page)?;
+        ctx.io.stop_pager()?;
+        return Ok(0);
+    }
+
     // Parse the command line arguments.
-    let opts: Opts = Opts::parse_from(args);
+    let matches = match Opts::command().try_get_matches_from(&args) {
+        Ok(matches) => matches,
+        // Clap exits with 2 for a mistake on the command line, which is our code for a
+        // failed API call.
+        Err(err) if err.use_stderr() => {
+            write!(ctx.io.err_out, "{}", err)?;
+            return Ok(crate::exit_code::VALIDATION);
+        }
+        Err(err) => err.exit(),
+    };
+
+    // Add the user's default flags for this command, and parse again with them.
+    let command = command_path(&matches);
+    let preset = match matches.value_of("preset") {
+        Some(name) => {
+            let preset = crate::preset::load(std::path::Path::new(&crate::config_file::presets_dir()?), name)?;
+            if preset.command_path() != command {
+                anyhow::bail!(
+                    "the preset `{}` is for `kittycad {}`, not `kittycad {}`",
+                    name,
+                    preset.command,
+                    command.replace('_', " ")
+                );
+            }
+            Some(preset)
+        }
+        None => None,
+    };
+    let args = crate::command_defaults::apply(&Opts::command(), &matches, &args, &*ctx.config, preset.as_ref());
+    let matches = match Opts::command().try_get_matches_from(&args) {
+        Ok(matches) => matches,
+        // The same code as a mistake on the command line, since that is what it is.
+        Err(err) => {
+            return Err(crate::cmd::ExitCodeError {
+                code: crate::exit_code::VALIDATION,
+                message: format!(
+                    "invalid defaults in your config (`defaults.{}.*`): {}",
+                    command,
+                    err.to_string()
+                        .lines()
+                        .next()
+                        .unwrap_or_default()
+                        .trim_start_matches("error: ")
+                ),
+            }
+            .into())
+        }
+    };
+    let opts = Opts::from_arg_matches(&matches).unwrap_or_else(|err| err.exit());
+
+    // Without a state directory we can still warn about deprecations, only every time.
+    let deprecations_file = crate::config_file::deprecations_file().ok();
+    crate::deprecation::check(
+        ctx,
+        &Opts::command(),
+        &matches,
+        clap::crate_version!(),
+        crate::deprecation::DEPRECATIONS,
+        deprecations_file.as_deref(),
+    )?;
+
+    if let Some(lang) = &opts.lang {
+        crate::i18n::set_lang(lang)?;
+    }
 
     // Set our debug flag.
     ctx.debug = opts.debug;
+    ctx.verbosity = crate::http_log::verbosity_from(opts.verbose)?;
+    ctx.retries = opts.retry;
+    ctx.timeout = opts.timeout;
+    ctx.limit_rate = opts.limit_rate;
+    ctx.output_format = opts.format.clone();
+    if let Some(token_file) = &opts.token_file {
+        ctx.token = Some(read_token(ctx, token_file)?);
+    }
+    ctx.endpoint = opts.endpoint.as_deref().map(crate::endpoints::base_url);
+
+    if crate::privacy::is_strict(&*ctx.config) {
+        let salt = crate::privacy::load_or_create_salt(&crate::config_file::privacy_salt_file()?)?;
+        ctx.io.set_identity_hidden(Some(salt));
+    }
+
+    if let Some(renderer) = &opts.renderer {
+        ctx.io.set_renderer(renderer, &command);
+    }
+
+    // Apply the user's defaults for this command.
+    if let Ok(fields) = ctx.config.get("", &crate::config::command_key(&command, "fields")) {
+        ctx.io.set_json_fields(parse_fields(&fields));
+    }
 
     // Setup our logger. This is mainly for debug purposes.
     // And getting debug logs from other libraries we consume, like even KittyCAD.
@@ -235,29 +518,135 @@ async fn do_main(mut args: Vec<String>, ctx: &mut crate::context::Context<'_>) -
         slog_stdlog::init_with_level(log::Level::Debug).unwrap();
     }
 
+    // Warn before spending credit there isn't much of left.
+    crate::quota::warn_if_low(ctx, &command).await?;
+
     let result = match opts.subcmd {
-        SubCommand::Alias(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::Api(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::ApiCall(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::Auth(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::Completion(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::Config(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::Drake(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::File(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::Generate(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::Open(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::Update(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::User(cmd) => run_cmd(&cmd, ctx).await,
-        SubCommand::Version(cmd) => run_cmd(&cmd, ctx).await,
+        SubCommand::Alias(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Api(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::ApiCall(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::ApiToken(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Auth(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Backup(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Billing(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Completion(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Config(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Digest(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Drake(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::File(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Generate(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::History(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Host(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Open(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Preset(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Status(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Telemetry(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Update(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::User(cmd) => run_cmd(&cmd, ctx, &command).await,
+        SubCommand::Version(cmd) => run_cmd(&cmd, ctx, &command).await,
     };
 
     result
 }
 
-async fn run_cmd(cmd: &impl crate::cmd::Command, ctx: &mut context::Context<'_>) -> Result<i32> {
+/// Returns the arguments after `help` if that is the command, e.g. `deprecations` for
+/// `kittycad --timeout 30s help deprecations`, skipping the global flags before it.
+fn help_args(app: &clap::Command, args: &[String]) -> Option<Vec<String>> {
+    let mut rest = args.iter().skip(1);
+    while let Some(arg) = rest.next() {
+        if arg == "help" {
+            return Some(rest.cloned().collect());
+        }
+        if !arg.starts_with('-') {
+            return None;
+        }
+
+        // Skip the value of a flag, unless it came with it, e.g. `--timeout=30s`.
+        let takes_value = app.get_arguments().any(|a| {
+            a.is_takes_value_set()
+                && !a.is_require_equals_set()
+                && (arg.strip_prefix("--") == a.get_long()
+                    || a.get_short().map(|short| format!("-{}", short)).as_ref() == Some(arg))
+        });
+        if takes_value {
+            rest.next();
+        }
+    }
+
+    None
+}
+
+/// Returns the subcommands that were run joined with underscores, e.g. `api_call_status`
+/// for `kittycad api-call status`.
+fn command_path(matches: &clap::ArgMatches) -> String {
+    let mut names = vec![];
+    let mut matches = matches;
+    while let Some((name, sub_matches)) = matches.subcommand() {
+        names.push(name.replace('-', "_"));
+        matches = sub_matches;
+    }
+
+    names.join("_")
+}
+
+/// Parse a comma separated list of fields.
+fn parse_fields(fields: &str) -> Vec<String> {
+    fields
+        .split(',')
+        .map(|field| field.trim().to_string())
+        .filter(|field| !field.is_empty())
+        .collect()
+}
+
+/// Read the token passed with `--token-file`, from standard input if the path is "-".
+fn read_token(ctx: &mut context::Context, path: &str) -> Result<String> {
+    let mut token = String::new();
+    if path == "-" {
+        ctx.io.stdin.read_to_string(&mut token)?;
+    } else {
+        token = std::fs::read_to_string(path).map_err(|err| anyhow::anyhow!("failed to read {}: {}", path, err))?;
+    }
+
+    let token = token.trim();
+    if token.is_empty() {
+        anyhow::bail!(
+            "no token found in {}",
+            if path == "-" { "standard input" } else { path }
+        );
+    }
+
+    Ok(token.to_string())
+}
+
+/// The exit code when the user interrupts a command with Ctrl-C.
+const INTERRUPTED_EXIT_CODE: i32 = 130;
+
+/// How long a command has to stop after Ctrl-C before we exit without it.
+const INTERRUPT_GRACE_PERIOD: std::time::Duration = std::time::Duration::from_millis(500);
+
+/// How long we wait for the update check once the command is done.
+const UPDATE_CHECK_TIMEOUT: std::time::Duration = std::time::Duration::from_secs(2);
+
+async fn run_cmd(cmd: &impl crate::cmd::Command, ctx: &mut context::Context<'_>, command: &str) -> Result<i32> {
     let cs = ctx.io.color_scheme();
 
-    if let Err(err) = cmd.run(ctx).await {
+    let timeout = ctx.timeout()?;
+    let start = std::time::Instant::now();
+    let result = run_until(cmd.run(ctx), timeout, interrupted()).await;
+
+    // Count the run if the user opted into telemetry, only the kind of error is kept.
+    let error = result.as_ref().err().map(crate::telemetry::error_category);
+    crate::telemetry::record(&*ctx.config, command, error, start.elapsed());
+
+    if let Err(err) = result {
+        // If the command asked for a specific exit code, use it.
+        if let Some(err) = err.downcast_ref::<crate::cmd::ExitCodeError>() {
+            if !err.message.is_empty() {
+                writeln!(ctx.io.err_out, "{}", err.message)?;
+            }
+            return Ok(err.code);
+        }
+
         // If the error was from the API, let's handle it better for each type of error.
         match err.downcast_ref::<kittycad::types::error::Error>() {
             Some(err) => {
@@ -279,12 +668,67 @@ async fn run_cmd(cmd: &impl crate::cmd::Command, ctx: &mut context::Context<'_>)
                 writeln!(ctx.io.err_out, "{}", err)?;
             }
         }
-        return Ok(1);
+        return Ok(crate::exit_code::for_error(&err));
     }
 
     Ok(0)
 }
 
+/// Run a command until it is done, it times out or `cancel` completes.
+///
+/// The command is cancelled by dropping it, which aborts any request it has in flight
+/// instead of leaving it running in the background.
+async fn run_until<F, C>(run: F, timeout: Option<std::time::Duration>, cancel: C) -> Result<()>
+where
+    F: std::future::Future<Output = Result<()>>,
+    C: std::future::Future<Output = ()>,
+{
+    let run = async {
+        match timeout {
+            Some(timeout) => match tokio::time::timeout(timeout, run).await {
+                Ok(result) => result,
+                Err(_) => Err(anyhow::anyhow!(
+                    "command timed out after {:?}, you can raise the limit with `--timeout` or the `timeout` config",
+                    timeout
+                )),
+            },
+            None => run.await,
+        }
+    };
+
+    tokio::select! {
+        result = run => result,
+        _ = cancel => Err(crate::cmd::ExitCodeError {
+            code: INTERRUPTED_EXIT_CODE,
+            message: "Interrupted".to_string(),
+        }
+        .into()),
+    }
+}
+
+/// Completes when the user hits Ctrl-C.
+///
+/// Listening for Ctrl-C stops it from killing us, and a command blocked reading from the
+/// terminal, e.g. in a prompt, can't be cancelled. So we listen on a task of its own, and
+/// if the command hasn't let us exit shortly after, we exit without it.
+async fn interrupted() {
+    let (tx, rx) = tokio::sync::oneshot::channel();
+    tokio::spawn(async move {
+        if tokio::signal::ctrl_c().await.is_err() {
+            // We can't listen for the signal, so it kills us the usual way.
+            return;
+        }
+
+        let _ = tx.send(());
+        tokio::time::sleep(INTERRUPT_GRACE_PERIOD).await;
+        std::process::exit(INTERRUPTED_EXIT_CODE);
+    });
+
+    if rx.await.is_err() {
+        std::future::pending::<()>().await;
+    }
+}
+
 fn handle_update(
     ctx: &mut crate::context::Context,
     update: Option<crate::update::ReleaseInfo>,
@@ -314,7 +758,7 @@ fn handle_update(
                 writeln!(ctx.io.err_out, "To upgrade, run: `kittycad update`")?;
             }
 
-            writeln!(ctx.io.err_out, "{}\n\n", cs.yellow(&latest_release.url))?;
+            writeln!(ctx.io.err_out, "{}\n\n", cs.yellow(&cs.hyperlink(&latest_release.url)))?;
         }
     }
 
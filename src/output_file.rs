@@ -0,0 +1,134 @@
+use std::io::Write;
+
+use anyhow::{Context, Result};
+
+/// Write the output of a command to a file, gzipping it on the way if `gzip` is set.
+///
+/// Returns the path that was written, which gets a `.gz` extension when gzipping.
+pub fn write(path: &std::path::Path, data: &[u8], gzip: bool) -> Result<std::path::PathBuf> {
+    if !gzip {
+        std::fs::write(path, data).with_context(|| format!("failed to write file {}", path.display()))?;
+        return Ok(path.to_path_buf());
+    }
+
+    let path = gzip_path(path);
+    std::fs::File::create(&path)
+        .and_then(|file| write_gzip(file, data))
+        .with_context(|| format!("failed to write file {}", path.display()))?;
+
+    Ok(path)
+}
+
+/// Compress the data into the writer a block at a time, so we never hold a compressed
+/// copy of it.
+fn write_gzip<W: Write>(out: W, data: &[u8]) -> std::io::Result<()> {
+    let mut encoder = crate::gzip::Encoder::new(std::io::BufWriter::new(out));
+    encoder.write_all(data)?;
+    encoder.finish()?;
+    Ok(())
+}
+
+/// The output path that means standard output, e.g. `--output -`.
+pub const STDOUT: &str = "-";
+
+/// Returns true if the output path means standard output rather than a file.
+pub fn is_stdout(path: &std::path::Path) -> bool {
+    path == std::path::Path::new(STDOUT)
+}
+
+/// Write the output of a command to standard output and nothing else, so it can be piped
+/// to another command, gzipping it on the way if `gzip` is set.
+///
+/// Binary output is refused when standard output is a terminal, it would only garble it.
+pub fn write_stdout(io: &mut crate::iostreams::IoStreams, data: &[u8], gzip: bool) -> Result<()> {
+    if io.is_stdout_tty() && (gzip || is_binary(data)) {
+        anyhow::bail!(
+            "refusing to write binary output to a terminal, pipe it to another command or redirect it to a file, e.g. `> model.stl`"
+        );
+    }
+
+    if !gzip {
+        io.out.write_all(data)?;
+        return Ok(io.out.flush()?);
+    }
+
+    Ok(write_gzip(&mut io.out, data)?)
+}
+
+/// Returns true if the data isn't text, e.g. a binary STL.
+fn is_binary(data: &[u8]) -> bool {
+    data.contains(&0) || std::str::from_utf8(data).is_err()
+}
+
+/// Returns the path with a `.gz` extension added, unless it already has one.
+pub fn gzip_path(path: &std::path::Path) -> std::path::PathBuf {
+    if path.extension().map(|ext| ext == "gz").unwrap_or(false) {
+        return path.to_path_buf();
+    }
+
+    let mut path = path.as_os_str().to_owned();
+    path.push(".gz");
+    path.into()
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_gzip_path() {
+        assert_eq!(
+            gzip_path(std::path::Path::new("model.obj")),
+            std::path::PathBuf::from("model.obj.gz")
+        );
+        assert_eq!(
+            gzip_path(std::path::Path::new("model.obj.gz")),
+            std::path::PathBuf::from("model.obj.gz")
+        );
+    }
+
+    #[test]
+    fn test_write() {
+        let dir = tempfile::tempdir().unwrap();
+
+        let path = write(&dir.path().join("model.obj"), b"v 0 0 0\n", false).unwrap();
+        assert_eq!(path, dir.path().join("model.obj"));
+        assert_eq!(std::fs::read(&path).unwrap(), b"v 0 0 0\n".to_vec());
+
+        let path = write(&dir.path().join("model.obj"), b"v 0 0 0\n", true).unwrap();
+        assert_eq!(path, dir.path().join("model.obj.gz"));
+
+        assert_eq!(
+            crate::gzip::decompress(&std::fs::read(&path).unwrap()).unwrap(),
+            b"v 0 0 0\n".to_vec()
+        );
+    }
+
+    #[test]
+    fn test_write_stdout() {
+        let (mut io, stdout_path, _) = crate::iostreams::IoStreams::test();
+        io.set_stdout_tty(false);
+        write_stdout(&mut io, b"solid\0\x01", false).unwrap();
+        assert_eq!(std::fs::read(&stdout_path).unwrap(), b"solid\0\x01".to_vec());
+
+        let (mut io, stdout_path, _) = crate::iostreams::IoStreams::test();
+        io.set_stdout_tty(true);
+        write_stdout(&mut io, b"v 0 0 0\n", false).unwrap();
+        assert_eq!(std::fs::read(&stdout_path).unwrap(), b"v 0 0 0\n".to_vec());
+
+        assert!(write_stdout(&mut io, b"solid\0\x01", false)
+            .unwrap_err()
+            .to_string()
+            .starts_with("refusing to write binary output to a terminal"));
+        assert!(write_stdout(&mut io, b"v 0 0 0\n", true).is_err());
+    }
+
+    #[test]
+    fn test_is_stdout() {
+        assert!(is_stdout(std::path::Path::new("-")));
+        assert!(!is_stdout(std::path::Path::new("./-")));
+        assert!(!is_stdout(std::path::Path::new("model.obj")));
+    }
+}
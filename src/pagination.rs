@@ -0,0 +1,92 @@
+use anyhow::Result;
+use serde::Deserialize;
+
+/// A single page of results from a list endpoint.
+#[derive(Debug, Clone, Deserialize)]
+struct ResultsPage<T> {
+    items: Vec<T>,
+    next_page: Option<String>,
+}
+
+/// Fetch up to `limit` of the most recent items from a paginated list endpoint that match
+/// `keep`, following the page tokens as needed. The endpoint can have its own query, e.g.
+/// to filter what the API returns.
+pub async fn list_pages<T, F>(
+    ctx: &crate::context::Context<'_>,
+    endpoint: &str,
+    limit: usize,
+    keep: F,
+) -> Result<Vec<T>>
+where
+    T: serde::de::DeserializeOwned,
+    F: Fn(&T) -> bool,
+{
+    list_pages_until(ctx, endpoint, limit, keep, |_| false).await
+}
+
+/// Like `list_pages`, but stop at the first item that is `done`. The items come most
+/// recent first, so this can stop at the first one older than a point in time.
+pub async fn list_pages_until<T, F, D>(
+    ctx: &crate::context::Context<'_>,
+    endpoint: &str,
+    limit: usize,
+    keep: F,
+    done: D,
+) -> Result<Vec<T>>
+where
+    T: serde::de::DeserializeOwned,
+    F: Fn(&T) -> bool,
+    D: Fn(&T) -> bool,
+{
+    let client = ctx.api_client("")?;
+    let retry_policy = ctx.retry_policy()?;
+    let http_log = ctx.http_log();
+    let max_body_size = ctx.max_body_size()?;
+
+    let client = &client;
+    let mut items: Vec<T> = Vec::new();
+    let mut page_token: Option<String> = None;
+    loop {
+        let mut query = url::form_urlencoded::Serializer::new(String::new());
+        query.append_pair("limit", &(limit - items.len()).min(100).to_string());
+        query.append_pair("sort_by", "created-at-descending");
+        if let Some(page_token) = &page_token {
+            query.append_pair("page_token", page_token);
+        }
+        let separator = if endpoint.contains('?') { '&' } else { '?' };
+        let uri = format!("{}{}{}", endpoint, separator, query.finish());
+
+        let resp = crate::retry::send(&retry_policy, &http_log, &http::Method::GET, || {
+            let uri = uri.clone();
+            async move { Ok(client.request_raw(http::Method::GET, &uri, None).await?) }
+        })
+        .await?;
+
+        if !resp.status().is_success() {
+            anyhow::bail!("{} {}", resp.status(), resp.status().canonical_reason().unwrap_or(""));
+        }
+
+        let page: ResultsPage<T> = crate::http_body::read_json(resp, max_body_size).await?;
+        let mut finished = false;
+        for item in page.items {
+            if done(&item) {
+                finished = true;
+                break;
+            }
+            if keep(&item) {
+                items.push(item);
+            }
+        }
+
+        match page.next_page {
+            Some(next_page) if !next_page.is_empty() && !finished && items.len() < limit => {
+                page_token = Some(next_page)
+            }
+            _ => break,
+        }
+    }
+
+    items.truncate(limit);
+
+    Ok(items)
+}
@@ -0,0 +1,127 @@
+use anyhow::Result;
+
+/// Lists with more items than this are filtered before picking, a short one fits on the
+/// screen as it is.
+const FILTER_OVER: usize = 10;
+
+/// Returns true if we can ask the user to pick something instead of requiring an argument.
+pub fn enabled(ctx: &crate::context::Context, no_picker: bool) -> bool {
+    !no_picker && ctx.io.can_prompt()
+}
+
+/// Let the user fuzzy search the items and pick one, returns the index of the item.
+pub fn pick<T: ToString>(prompt: &str, items: &[T]) -> Result<usize> {
+    if items.is_empty() {
+        anyhow::bail!("nothing to pick from");
+    }
+
+    let theme = dialoguer::theme::ColorfulTheme::default();
+    let items: Vec<String> = items.iter().map(|item| item.to_string()).collect();
+
+    let mut matches: Vec<usize> = (0..items.len()).collect();
+    let mut filter_prompt = "Type to filter, or press enter to see them all".to_string();
+    while items.len() > FILTER_OVER {
+        let query = match dialoguer::Input::<String>::with_theme(&theme)
+            .with_prompt(&filter_prompt)
+            .allow_empty(true)
+            .interact_text()
+        {
+            Ok(query) => query,
+            Err(err) => return Err(anyhow::anyhow!("prompt failed: {}", err)),
+        };
+
+        matches = fuzzy_matches(query.trim(), &items);
+        if !matches.is_empty() {
+            break;
+        }
+        filter_prompt = format!("Nothing matches `{}`, try again", query.trim());
+    }
+
+    let labels: Vec<&str> = matches.iter().map(|i| items[*i].as_str()).collect();
+    match dialoguer::Select::with_theme(&theme)
+        .with_prompt(prompt)
+        .items(&labels)
+        .default(0)
+        .interact()
+    {
+        Ok(index) => Ok(matches[index]),
+        Err(err) => Err(anyhow::anyhow!("prompt failed: {}", err)),
+    }
+}
+
+/// Let the user pick an API call they started from this machine.
+pub fn pick_from_history() -> Result<uuid::Uuid> {
+    let operations = crate::history::load(&crate::config_file::history_file()?)?;
+    if operations.is_empty() {
+        anyhow::bail!("there are no API calls in your history, pass the ID of the API call instead");
+    }
+
+    let index = pick("Which API call?", &operations)?;
+
+    Ok(uuid::Uuid::parse_str(&operations[index].id)?)
+}
+
+/// Returns the indexes of the items matching the query, best match first.
+///
+/// An item matches if it has every character of the query in the same order, ignoring
+/// case, like fzf. The closer together the characters are, the better the match.
+fn fuzzy_matches(query: &str, items: &[String]) -> Vec<usize> {
+    let query: Vec<char> = query.to_lowercase().chars().collect();
+
+    let mut matches: Vec<(usize, usize)> = items
+        .iter()
+        .enumerate()
+        .filter_map(|(index, item)| fuzzy_span(&query, &item.to_lowercase()).map(|span| (span, index)))
+        .collect();
+    // Ties keep the order of the items.
+    matches.sort();
+
+    matches.into_iter().map(|(_, index)| index).collect()
+}
+
+/// Returns the length of the shortest part of the item that has every character of the
+/// query in order, or none if the item doesn't match.
+fn fuzzy_span(query: &[char], item: &str) -> Option<usize> {
+    let item: Vec<char> = item.chars().collect();
+    if query.is_empty() {
+        return Some(0);
+    }
+
+    (0..item.len())
+        .filter(|start| item[*start] == query[0])
+        .filter_map(|start| {
+            let mut q = 0;
+            for (i, c) in item[start..].iter().enumerate() {
+                if *c == query[q] {
+                    q += 1;
+                    if q == query.len() {
+                        return Some(i + 1);
+                    }
+                }
+            }
+            None
+        })
+        .min()
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_fuzzy_matches() {
+        let items: Vec<String> = ["parts/gear.step", "parts/arm.obj", "Gearbox.STEP", "readme.md"]
+            .iter()
+            .map(|item| item.to_string())
+            .collect();
+
+        assert_eq!(fuzzy_matches("", &items), vec![0, 1, 2, 3]);
+        assert_eq!(fuzzy_matches("gear", &items), vec![0, 2]);
+        assert_eq!(fuzzy_matches("gstep", &items), vec![0, 2]);
+        assert_eq!(fuzzy_matches("gbx", &items), vec![2]);
+        assert_eq!(fuzzy_matches("pao", &items), vec![1]);
+        assert_eq!(fuzzy_matches("zzz", &items), Vec::<usize>::new());
+    }
+}
@@ -0,0 +1,163 @@
+use anyhow::Result;
+use serde::Deserialize;
+use thiserror::Error;
+
+/// Where administrators can put a policy that applies to every user on the machine. It
+/// can't be moved, so users can't point it somewhere without a policy.
+#[cfg(not(windows))]
+const SYSTEM_POLICY_FILE: &str = "/etc/kittycad/policy.yml";
+#[cfg(windows)]
+const SYSTEM_POLICY_FILE: &str = "C:\\ProgramData\\KittyCAD\\policy.yml";
+
+/// A system-wide policy, set by an administrator, that users cannot override.
+#[derive(Debug, Default, Clone, PartialEq, Eq, Deserialize)]
+pub struct Policy {
+    /// The only hosts kittycad may talk to. If empty, any host is allowed.
+    #[serde(default)]
+    pub allowed_hosts: Vec<String>,
+}
+
+#[derive(Error, Debug)]
+pub enum PolicyError {
+    #[error("policy error: {host} is not an allowed host, allowed hosts are: {}", allowed.join(", "))]
+    HostNotAllowed { host: String, allowed: Vec<String> },
+}
+
+/// Load the policy from the given path, a missing file means there is no policy.
+pub fn load(path: &str) -> Result<Policy> {
+    match std::fs::read_to_string(path) {
+        Ok(contents) => serde_yaml::from_str(&contents)
+            .map_err(|err| anyhow::anyhow!("failed to parse policy file {}: {}", path, err)),
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => Ok(Policy::default()),
+        Err(err) => Err(anyhow::anyhow!("failed to read policy file {}: {}", path, err)),
+    }
+}
+
+/// Returns the hosts we are allowed to talk to, if restricted.
+///
+/// The system policy wins over the user's `allowed_hosts` config, so users can't widen it.
+fn allowed_hosts(policy: &Policy, config: &dyn crate::config::Config) -> Vec<String> {
+    if !policy.allowed_hosts.is_empty() {
+        return policy.allowed_hosts.clone();
+    }
+
+    let value = config.get("", "allowed_hosts").unwrap_or_default();
+
+    value
+        .split(',')
+        .map(|host| host.trim().to_string())
+        .filter(|host| !host.is_empty())
+        .collect()
+}
+
+/// Returns an error if the system policy or config does not allow talking to the host.
+pub fn check_host(config: &dyn crate::config::Config, host: &str) -> Result<()> {
+    check(&load(SYSTEM_POLICY_FILE)?, config, host)
+}
+
+/// Returns an error if the policy or config does not allow talking to the host.
+fn check(policy: &Policy, config: &dyn crate::config::Config, host: &str) -> Result<()> {
+    let allowed = allowed_hosts(policy, config);
+    if allowed.is_empty() || is_host_allowed(&allowed, host) {
+        return Ok(());
+    }
+
+    Err(PolicyError::HostNotAllowed {
+        host: normalize_host(host),
+        allowed,
+    }
+    .into())
+}
+
+/// Returns true if the host matches one of the allowed hosts.
+/// An allowed host of `*.example.com` matches any subdomain of example.com.
+fn is_host_allowed(allowed: &[String], host: &str) -> bool {
+    let host = normalize_host(host);
+
+    allowed.iter().any(|pattern| {
+        let pattern = normalize_host(pattern);
+        match pattern.strip_prefix("*.") {
+            Some(domain) => host.ends_with(&format!(".{}", domain)),
+            None => host == pattern,
+        }
+    })
+}
+
+/// Reduce a host or URL to a lowercase `host[:port]`, so "https://api.kittycad.io/" and
+/// "api.kittycad.io" are the same host.
+fn normalize_host(host: &str) -> String {
+    let with_scheme = if host.contains("://") {
+        host.to_string()
+    } else {
+        format!("https://{}", host)
+    };
+
+    let normalized = match url::Url::parse(&with_scheme) {
+        Ok(url) => match (url.host_str(), url.port()) {
+            (Some(h), Some(port)) => format!("{}:{}", h, port),
+            (Some(h), None) => h.to_string(),
+            _ => host.trim_end_matches('/').to_string(),
+        },
+        Err(_) => host.trim_end_matches('/').to_string(),
+    };
+
+    normalized.to_lowercase()
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+    use crate::config::Config;
+
+    #[test]
+    fn test_is_host_allowed() {
+        let allowed = vec!["api.kittycad.io".to_string(), "*.corp.example.com".to_string()];
+
+        assert!(is_host_allowed(&allowed, "api.kittycad.io"));
+        assert!(is_host_allowed(&allowed, "https://API.kittycad.io/"));
+        assert!(is_host_allowed(&allowed, "cad.corp.example.com"));
+        assert!(!is_host_allowed(&allowed, "corp.example.com"));
+        assert!(!is_host_allowed(&allowed, "api.kittycad.io.evil.com"));
+        assert!(!is_host_allowed(&allowed, "http://localhost:8080"));
+    }
+
+    #[test]
+    fn test_load_policy() {
+        let dir = tempfile::tempdir().unwrap();
+
+        let path = dir.path().join("policy.yml");
+        assert_eq!(load(path.to_str().unwrap()).unwrap(), Policy::default());
+
+        std::fs::write(&path, "allowed_hosts:\n  - api.kittycad.io\n").unwrap();
+        assert_eq!(
+            load(path.to_str().unwrap()).unwrap(),
+            Policy {
+                allowed_hosts: vec!["api.kittycad.io".to_string()]
+            }
+        );
+    }
+
+    #[test]
+    fn test_check_host() {
+        let policy = Policy::default();
+        let mut c = crate::config::new_blank_config().unwrap();
+        assert!(check(&policy, &c, "anything.com").is_ok());
+
+        c.set("", "allowed_hosts", "api.kittycad.io, localhost:8080").unwrap();
+        assert!(check(&policy, &c, "https://api.kittycad.io/").is_ok());
+        assert!(check(&policy, &c, "http://localhost:8080").is_ok());
+        assert_eq!(
+            check(&policy, &c, "other.example.com").unwrap_err().to_string(),
+            "policy error: other.example.com is not an allowed host, allowed hosts are: api.kittycad.io, localhost:8080"
+        );
+
+        // The config can't widen the policy.
+        let policy = Policy {
+            allowed_hosts: vec!["api.kittycad.io".to_string()],
+        };
+        assert!(check(&policy, &c, "api.kittycad.io").is_ok());
+        assert!(check(&policy, &c, "http://localhost:8080").is_err());
+    }
+}
@@ -0,0 +1,262 @@
+use std::collections::BTreeMap;
+
+use anyhow::{anyhow, Context, Result};
+use serde::{Deserialize, Serialize};
+
+/// A named set of flags for a command, like the ones in `defaults.<command>.*` but only
+/// used when asked for with `--preset <name>`, so teams can publish the settings to use.
+///
+/// ```yaml
+/// description: Binary STL in millimeters, for the print shop
+/// command: file convert
+/// flags:
+///   output_format: stl
+///   output_unit: mm
+///   option: stl.storage=binary
+/// ```
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Preset {
+    /// The name to save the preset as when it is imported, if none is given.
+    #[serde(default, skip_serializing_if = "String::is_empty")]
+    pub name: String,
+    /// What the preset is for.
+    #[serde(default, skip_serializing_if = "String::is_empty")]
+    pub description: String,
+    /// The command the preset is for, e.g. `file convert`.
+    pub command: String,
+    /// The flags by their long name with underscores, e.g. `output_format`, as in
+    /// `defaults.<command>.*`. A switch like `gzip_output` is set with "true".
+    #[serde(default)]
+    pub flags: BTreeMap<String, String>,
+    /// Where the preset was imported from.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub source: Option<String>,
+    /// The SHA256 hash of the preset as it was imported.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub sha256: Option<String>,
+}
+
+impl Preset {
+    /// Returns the command the preset is for as a command path, e.g. `file_convert`.
+    pub fn command_path(&self) -> String {
+        self.command
+            .split_whitespace()
+            .collect::<Vec<&str>>()
+            .join("_")
+            .replace('-', "_")
+    }
+}
+
+/// Parse a preset and check that its command and flags exist.
+pub fn parse(content: &str) -> Result<Preset> {
+    let preset: Preset = serde_yaml::from_str(content).map_err(|err| anyhow!("invalid preset: {}", err))?;
+
+    let command = preset.command_path();
+    if command.is_empty() {
+        anyhow::bail!("invalid preset: the command is empty");
+    }
+    for flag in preset.flags.keys() {
+        if !crate::command_defaults::is_flag(&command, flag) {
+            anyhow::bail!(
+                "invalid preset: `{}` is not a flag of `kittycad {}`",
+                flag,
+                preset.command
+            );
+        }
+    }
+
+    Ok(preset)
+}
+
+/// Returns an error if the name can't be used for a preset, it is used as a file name.
+pub fn validate_name(name: &str) -> Result<()> {
+    if name.is_empty() || !name.chars().all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_') {
+        anyhow::bail!("invalid preset name `{}`, use letters, digits, `-` and `_`", name);
+    }
+
+    Ok(())
+}
+
+/// Returns the path of the preset with the name in the directory.
+pub fn path(dir: &std::path::Path, name: &str) -> std::path::PathBuf {
+    dir.join(format!("{}.yml", name))
+}
+
+/// Load the preset with the name from the directory.
+pub fn load(dir: &std::path::Path, name: &str) -> Result<Preset> {
+    validate_name(name)?;
+
+    let path = path(dir, name);
+    let content = match std::fs::read_to_string(&path) {
+        Ok(content) => content,
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => {
+            anyhow::bail!("no preset named `{}`, see `kittycad preset list`", name)
+        }
+        Err(err) => return Err(err).with_context(|| format!("failed to read {}", path.display())),
+    };
+
+    parse(&content).with_context(|| format!("failed to load {}", path.display()))
+}
+
+/// Returns the presets in the directory by name.
+pub fn list(dir: &std::path::Path) -> Result<BTreeMap<String, Preset>> {
+    let mut presets = BTreeMap::new();
+
+    let entries = match std::fs::read_dir(dir) {
+        Ok(entries) => entries,
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => return Ok(presets),
+        Err(err) => return Err(err).with_context(|| format!("failed to read {}", dir.display())),
+    };
+    for entry in entries {
+        let path = entry?.path();
+        if path.extension().map(|ext| ext != "yml").unwrap_or(true) {
+            continue;
+        }
+        if let Some(name) = path.file_stem().and_then(|s| s.to_str()) {
+            presets.insert(name.to_string(), load(dir, name)?);
+        }
+    }
+
+    Ok(presets)
+}
+
+/// Save the preset with the name in the directory.
+pub fn save(dir: &std::path::Path, name: &str, preset: &Preset) -> Result<std::path::PathBuf> {
+    validate_name(name)?;
+
+    std::fs::create_dir_all(dir).with_context(|| format!("failed to create directory {}", dir.display()))?;
+    let path = path(dir, name);
+    std::fs::write(&path, serde_yaml::to_string(preset)?)
+        .with_context(|| format!("failed to write {}", path.display()))?;
+
+    Ok(path)
+}
+
+/// Returns the URL to download a preset from: a gist page becomes the raw contents of
+/// its file, and only HTTPS is allowed.
+pub fn download_url(source: &str) -> Result<String> {
+    let url = url::Url::parse(source).map_err(|err| anyhow!("invalid URL `{}`: {}", source, err))?;
+    if url.scheme() != "https" {
+        anyhow::bail!("presets can only be imported over HTTPS, got `{}`", source);
+    }
+
+    if url.host_str() == Some("gist.github.com") {
+        let path = url.path().trim_end_matches('/');
+        return Ok(format!("https://gist.githubusercontent.com{}/raw", path));
+    }
+
+    Ok(url.to_string())
+}
+
+/// Returns the name a preset downloaded from the URL is saved as when it doesn't have
+/// one, the file name without its extension.
+pub fn name_from_url(url: &str) -> Option<String> {
+    let url = url::Url::parse(url).ok()?;
+    let file = url.path_segments()?.filter(|s| !s.is_empty()).last()?;
+    let name = file.trim_end_matches(".yml").trim_end_matches(".yaml");
+
+    validate_name(name).ok().map(|_| name.to_string())
+}
+
+/// Check a downloaded preset against the SHA256 hash it should have and, if one is
+/// given, a public key and the signature made with it. Returns its hash.
+pub fn verify(data: &[u8], sha256: Option<&str>, signature: Option<(&str, &str)>) -> Result<String> {
+    let hash = crate::update_verify::sha256_hex(data);
+    if let Some(expected) = sha256 {
+        if hash != expected.trim().to_lowercase() {
+            anyhow::bail!(
+                "SHA256 hash mismatch: the preset is {}, expected {}",
+                hash,
+                expected.trim()
+            );
+        }
+    }
+
+    if let Some((public_key, signature)) = signature {
+        crate::signing::verify(public_key, data, signature)?;
+    }
+
+    Ok(hash)
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    const PRESET: &str = r#"description: Binary STL in millimeters, for the print shop
+command: file convert
+flags:
+  output_format: stl
+  output_unit: mm
+  option: stl.storage=binary
+"#;
+
+    #[test]
+    fn test_parse() {
+        let preset = parse(PRESET).unwrap();
+        assert_eq!(preset.command_path(), "file_convert");
+        assert_eq!(preset.flags["output_unit"], "mm");
+
+        assert_eq!(
+            parse("command: file convert\nflags:\n  nope: true\n")
+                .unwrap_err()
+                .to_string(),
+            "invalid preset: `nope` is not a flag of `kittycad file convert`"
+        );
+        assert!(parse("flags: {}\n").is_err());
+    }
+
+    #[test]
+    fn test_save_load_list() {
+        let dir = tempfile::tempdir().unwrap();
+        let dir = dir.path().join("presets");
+        assert!(list(&dir).unwrap().is_empty());
+
+        let preset = parse(PRESET).unwrap();
+        save(&dir, "print-shop", &preset).unwrap();
+        assert_eq!(load(&dir, "print-shop").unwrap(), preset);
+        assert_eq!(list(&dir).unwrap().keys().collect::<Vec<_>>(), vec!["print-shop"]);
+
+        assert_eq!(
+            load(&dir, "nope").unwrap_err().to_string(),
+            "no preset named `nope`, see `kittycad preset list`"
+        );
+        assert!(load(&dir, "../config").is_err());
+    }
+
+    #[test]
+    fn test_download_url() {
+        assert_eq!(
+            download_url("https://gist.github.com/someone/0123abcd").unwrap(),
+            "https://gist.githubusercontent.com/someone/0123abcd/raw"
+        );
+        assert_eq!(
+            download_url("https://example.com/presets/print-shop.yml").unwrap(),
+            "https://example.com/presets/print-shop.yml"
+        );
+        assert!(download_url("http://example.com/print-shop.yml").is_err());
+
+        assert_eq!(
+            name_from_url("https://example.com/presets/print-shop.yml"),
+            Some("print-shop".to_string())
+        );
+    }
+
+    #[test]
+    fn test_verify() {
+        let data = PRESET.as_bytes();
+        let hash = crate::update_verify::sha256_hex(data);
+
+        assert_eq!(verify(data, Some(&hash), None).unwrap(), hash);
+        assert!(verify(data, Some(&"0".repeat(64)), None).is_err());
+
+        let dir = tempfile::tempdir().unwrap();
+        let (key, _) = crate::signing::load_or_create_key(dir.path().join("team.key").to_str().unwrap()).unwrap();
+        let public_key = crate::signing::public_key(&key);
+        let signature = crate::signing::sign(&key, data);
+        assert!(verify(data, None, Some((&public_key, &signature))).is_ok());
+        assert!(verify(b"tampered", None, Some((&public_key, &signature))).is_err());
+    }
+}
@@ -0,0 +1,198 @@
+use anyhow::{anyhow, Context, Result};
+
+/// Fields that identify you, hidden from output when `privacy` is `strict`.
+const IDENTITY_FIELDS: &[&str] = &["email", "user_id"];
+
+/// Returns true if the user asked us to hide who they are, e.g. while screen sharing.
+pub fn is_strict(config: &dyn crate::config::Config) -> bool {
+    config
+        .get("", "privacy")
+        .map(|value| value == "strict")
+        .unwrap_or(false)
+}
+
+/// Returns the salt of the stand-ins of this install, creating it the first time.
+/// Without it, a stand-in can't be matched to an email by hashing a list of them.
+pub fn load_or_create_salt(path: &str) -> Result<String> {
+    match std::fs::read_to_string(path) {
+        Ok(salt) => Ok(salt.trim().to_string()),
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => {
+            let mut salt = [0u8; 16];
+            ring::rand::SecureRandom::fill(&ring::rand::SystemRandom::new(), &mut salt)
+                .map_err(|_| anyhow!("failed to generate a salt"))?;
+            let salt = data_encoding::HEXLOWER.encode(&salt);
+
+            let parent = std::path::Path::new(path).parent().unwrap();
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("failed to create directory {}", parent.display()))?;
+            crate::signing::write_secret(path, salt.as_bytes())?;
+
+            Ok(salt)
+        }
+        Err(err) => Err(anyhow!("failed to read {}: {}", path, err)),
+    }
+}
+
+/// Returns a stand-in for a value that identifies you. The same value always gets the
+/// same stand-in with the same salt, so you can still tell them apart.
+pub fn redact(salt: &str, value: &str) -> String {
+    let key = ring::hmac::Key::new(ring::hmac::HMAC_SHA256, salt.as_bytes());
+    let tag = ring::hmac::sign(&key, value.as_bytes());
+    format!("hidden-{}", &data_encoding::HEXLOWER.encode(tag.as_ref())[..8])
+}
+
+/// Returns true if the field of the object identifies you. The ID of a user does too,
+/// we tell users apart from other objects by their email.
+fn is_identity(object: &serde_json::Map<String, serde_json::Value>, field: &str) -> bool {
+    IDENTITY_FIELDS.contains(&field) || (field == "id" && object.contains_key("email"))
+}
+
+/// Returns the values in the JSON that identify you.
+pub fn identities(json: &serde_json::Value) -> Vec<String> {
+    let mut found = vec![];
+    match json {
+        serde_json::Value::Object(object) => {
+            for (field, value) in object {
+                match value {
+                    serde_json::Value::String(s) if !s.is_empty() && is_identity(object, field) => {
+                        found.push(s.to_string())
+                    }
+                    _ => found.extend(identities(value)),
+                }
+            }
+        }
+        serde_json::Value::Array(values) => {
+            for value in values {
+                found.extend(identities(value));
+            }
+        }
+        _ => {}
+    }
+
+    found
+}
+
+/// Returns the JSON with the values that identify you replaced by their stand-ins.
+pub fn redact_json(json: &serde_json::Value, salt: &str) -> serde_json::Value {
+    match json {
+        serde_json::Value::Object(object) => serde_json::Value::Object(
+            object
+                .iter()
+                .map(|(field, value)| {
+                    let value = match value {
+                        serde_json::Value::String(s) if !s.is_empty() && is_identity(object, field) => {
+                            serde_json::Value::String(redact(salt, s))
+                        }
+                        _ => redact_json(value, salt),
+                    };
+                    (field.to_string(), value)
+                })
+                .collect(),
+        ),
+        serde_json::Value::Array(values) => {
+            serde_json::Value::Array(values.iter().map(|value| redact_json(value, salt)).collect())
+        }
+        _ => json.clone(),
+    }
+}
+
+/// Returns the text with the given values replaced by their stand-ins.
+pub fn redact_text(text: &str, identities: &[String], salt: &str) -> String {
+    let mut text = text.to_string();
+    for identity in identities {
+        text = text.replace(identity, &redact(salt, identity));
+    }
+
+    text
+}
+
+/// A record of a table with the given values replaced by their stand-ins. The table is
+/// laid out around the stand-ins, so its columns still line up.
+pub struct Redacted<'a, T> {
+    pub record: T,
+    pub identities: &'a [String],
+    pub salt: &'a str,
+}
+
+impl<T: tabled::Tabled> tabled::Tabled for Redacted<'_, T> {
+    const LENGTH: usize = T::LENGTH;
+
+    fn fields(&self) -> Vec<String> {
+        self.record
+            .fields()
+            .iter()
+            .map(|field| redact_text(field, self.identities, self.salt))
+            .collect()
+    }
+
+    fn headers() -> Vec<String> {
+        T::headers()
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_redact() {
+        assert_eq!(redact("salt", "a@b.c"), redact("salt", "a@b.c"));
+        assert_ne!(redact("salt", "a@b.c"), redact("salt", "d@e.f"));
+        assert_ne!(redact("salt", "a@b.c"), redact("pepper", "a@b.c"));
+        assert!(redact("salt", "a@b.c").starts_with("hidden-"));
+        assert_eq!(redact("salt", "a@b.c").len(), "hidden-".len() + 8);
+    }
+
+    #[test]
+    fn test_load_or_create_salt() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("state").join("privacy_salt");
+        let path = path.to_str().unwrap();
+
+        let salt = load_or_create_salt(path).unwrap();
+        assert_eq!(salt.len(), 32);
+        assert_eq!(load_or_create_salt(path).unwrap(), salt);
+
+        let other = tempfile::tempdir().unwrap();
+        let other = other.path().join("privacy_salt");
+        assert_ne!(load_or_create_salt(other.to_str().unwrap()).unwrap(), salt);
+    }
+
+    #[test]
+    fn test_redact_json() {
+        let json = serde_json::json!({
+            "id": "1234",
+            "email": "a@b.c",
+            "company": "KittyCAD",
+            "tokens": [{"id": "5678", "user_id": "1234"}],
+        });
+
+        let mut found = identities(&json);
+        found.sort();
+        assert_eq!(found, vec!["1234", "1234", "a@b.c"]);
+        assert_eq!(
+            redact_json(&json, "salt"),
+            serde_json::json!({
+                "id": redact("salt", "1234"),
+                "email": redact("salt", "a@b.c"),
+                "company": "KittyCAD",
+                "tokens": [{"id": "5678", "user_id": redact("salt", "1234")}],
+            })
+        );
+    }
+
+    #[test]
+    fn test_redact_text() {
+        let text = "| email | a@b.c |\n| id    | 1234  |";
+        assert_eq!(
+            redact_text(text, &["a@b.c".to_string(), "1234".to_string()], "salt"),
+            format!(
+                "| email | {} |\n| id    | {}  |",
+                redact("salt", "a@b.c"),
+                redact("salt", "1234")
+            )
+        );
+    }
+}
@@ -0,0 +1,129 @@
+use anyhow::{anyhow, Result};
+
+/// How long a balance is trusted for the warning before commands, so they don't wait on
+/// the billing API every time.
+const MAX_AGE: std::time::Duration = std::time::Duration::from_secs(10 * 60);
+
+/// Returns the `quota_warning` setting, the amount of credit in US dollars below which
+/// commands that spend credit warn, if it is set.
+pub fn threshold(config: &dyn crate::config::Config) -> Result<Option<f64>> {
+    let value = config.get("", "quota_warning").unwrap_or_default();
+    let value = value.trim().trim_start_matches('$');
+    if value.is_empty() {
+        return Ok(None);
+    }
+
+    match value.parse::<f64>() {
+        Ok(threshold) if threshold >= 0.0 => Ok(Some(threshold)),
+        _ => Err(anyhow!(
+            "invalid quota_warning `{}`, expected an amount in US dollars, e.g. 5.00",
+            value
+        )),
+    }
+}
+
+/// The commands that spend credit, those are the ones the API does the work of.
+const SPENDS_CREDIT: &[&str] = &[
+    "file_convert",
+    "file_volume",
+    "file_mass",
+    "file_density",
+    "file_validate",
+];
+
+/// Returns true if the command spends credit, e.g. `file_convert`.
+pub fn spends_credit(command: &str) -> bool {
+    SPENDS_CREDIT.contains(&command)
+}
+
+/// Returns the warning to print before a command that spends credit, if what is left is
+/// below the threshold.
+pub fn warning(remaining: f64, threshold: f64, cs: &crate::colors::ColorScheme) -> Option<String> {
+    if remaining >= threshold {
+        return None;
+    }
+
+    Some(format!(
+        "{} {}",
+        cs.warning_icon(),
+        cs.yellow(&format!(
+            "You have {} of credit left, below your quota_warning of {}. See `kittycad billing info`.",
+            crate::cmd_billing::display_money(&remaining),
+            crate::cmd_billing::display_money(&threshold)
+        ))
+    ))
+}
+
+/// Print a warning if the command spends credit and there is less left than the
+/// `quota_warning` setting. Only an invalid setting fails the command, not being able
+/// to get the balance doesn't.
+pub async fn warn_if_low(ctx: &mut crate::context::Context<'_>, command: &str) -> Result<()> {
+    if !spends_credit(command) {
+        return Ok(());
+    }
+    let threshold = match threshold(&*ctx.config)? {
+        Some(threshold) => threshold,
+        None => return Ok(()),
+    };
+
+    let balance = match crate::cmd_billing::balance(ctx, "", Some(MAX_AGE)).await {
+        Ok(balance) => balance,
+        Err(err) => {
+            log::debug!("not checking the quota: {}", err);
+            return Ok(());
+        }
+    };
+
+    if let Some(warning) = warning(
+        crate::cmd_billing::remaining(&balance),
+        threshold,
+        &ctx.io.color_scheme(),
+    ) {
+        writeln!(ctx.io.err_out, "{}", warning)?;
+    }
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_threshold() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        assert_eq!(threshold(&config).unwrap(), None);
+
+        config.set("", "quota_warning", "$5").unwrap();
+        assert_eq!(threshold(&config).unwrap(), Some(5.0));
+
+        config.set("", "quota_warning", "lots").unwrap();
+        assert!(threshold(&config).is_err());
+    }
+
+    #[test]
+    fn test_spends_credit() {
+        assert!(spends_credit("file_convert"));
+        assert!(spends_credit("file_mass"));
+        assert!(spends_credit("file_validate"));
+        assert!(!spends_credit("file_sign"));
+        assert!(!spends_credit("file_info"));
+        assert!(!spends_credit("billing_info"));
+    }
+
+    #[test]
+    fn test_warning() {
+        let cs = crate::colors::ColorScheme::new(false, false, false);
+
+        assert_eq!(warning(10.0, 5.0, &cs), None);
+        assert_eq!(
+            warning(1.2, 5.0, &cs),
+            Some(
+                "! You have $1.20 of credit left, below your quota_warning of $5.00. See `kittycad billing info`."
+                    .to_string()
+            )
+        );
+    }
+}
@@ -0,0 +1,100 @@
+use std::io::Write;
+
+use anyhow::{anyhow, Result};
+
+/// The prefix of the programs that render output, a renderer named `report` is the
+/// `kittycad-renderer-report` program on the PATH.
+const PROGRAM_PREFIX: &str = "kittycad-renderer-";
+
+/// Returns the program of the renderer with the given name.
+pub fn program(name: &str) -> String {
+    format!("{}{}", PROGRAM_PREFIX, name)
+}
+
+/// Render the JSON output of a command with a renderer, returns what it printed.
+///
+/// The renderer gets the JSON on stdin and the command, e.g. `file_mass`, in the
+/// `KITTYCAD_COMMAND` environment variable. It should print the rendered output to
+/// stdout and exit with 0.
+pub fn render(name: &str, command: &str, json: &serde_json::Value) -> Result<Vec<u8>> {
+    run(name, &program(name), command, json)
+}
+
+/// Run the program of a renderer, see `render`.
+fn run(name: &str, program: &str, command: &str, json: &serde_json::Value) -> Result<Vec<u8>> {
+    let mut child = match std::process::Command::new(program)
+        .env("KITTYCAD_COMMAND", command)
+        .stdin(std::process::Stdio::piped())
+        .stdout(std::process::Stdio::piped())
+        .stderr(std::process::Stdio::piped())
+        .spawn()
+    {
+        Ok(child) => child,
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => {
+            return Err(anyhow!(
+                "renderer `{}` not found, install a `{}` program on your PATH",
+                name,
+                program
+            ))
+        }
+        Err(err) => return Err(anyhow!("failed to run renderer `{}`: {}", name, err)),
+    };
+
+    // Write from a thread, so a renderer that prints a lot before it has read it all
+    // can't block us.
+    let input = child.stdin.take();
+    let json = serde_json::to_string(json)?;
+    let writer = std::thread::spawn(move || -> std::io::Result<()> {
+        match input {
+            Some(mut input) => input.write_all(json.as_bytes()),
+            None => Ok(()),
+        }
+    });
+    let output = child.wait_with_output()?;
+    let written = writer
+        .join()
+        .map_err(|_| anyhow!("failed to write to renderer `{}`", name))?;
+    if !output.status.success() {
+        return Err(anyhow!(
+            "renderer `{}` failed with {}: {}",
+            name,
+            output.status,
+            String::from_utf8_lossy(&output.stderr).trim()
+        ));
+    }
+    written?;
+
+    Ok(output.stdout)
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_render_not_found() {
+        assert_eq!(
+            render("nope", "file_mass", &serde_json::json!({}))
+                .unwrap_err()
+                .to_string(),
+            "renderer `nope` not found, install a `kittycad-renderer-nope` program on your PATH"
+        );
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_render_round_trip() {
+        // More than fits in a pipe, `cat` prints it as it reads it.
+        let json = serde_json::json!({ "mass": 1.5, "output": "x".repeat(1024 * 1024) });
+
+        let rendered = run("cat", "cat", "file_mass", &json).unwrap();
+        assert_eq!(serde_json::from_slice::<serde_json::Value>(&rendered).unwrap(), json);
+
+        assert!(run("false", "false", "file_mass", &json)
+            .unwrap_err()
+            .to_string()
+            .starts_with("renderer `false` failed with exit status: 1"));
+    }
+}
@@ -0,0 +1,228 @@
+use std::{future::Future, time::Duration};
+
+use anyhow::Result;
+
+/// The number of times we retry a request if it is not configured.
+pub const DEFAULT_RETRIES: u32 = 2;
+
+/// How we retry requests that failed for reasons that might go away on their own, like
+/// rate limiting, server errors, or a flaky network.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RetryPolicy {
+    /// The maximum number of times a request is retried, zero disables retries.
+    pub max_retries: u32,
+    /// The delay before the first retry, this doubles with every attempt.
+    pub base_delay: Duration,
+    /// The longest we will ever wait between two attempts.
+    pub max_delay: Duration,
+}
+
+impl Default for RetryPolicy {
+    fn default() -> RetryPolicy {
+        RetryPolicy::new(DEFAULT_RETRIES)
+    }
+}
+
+impl RetryPolicy {
+    pub fn new(max_retries: u32) -> RetryPolicy {
+        RetryPolicy {
+            max_retries,
+            base_delay: Duration::from_millis(500),
+            max_delay: Duration::from_secs(30),
+        }
+    }
+
+    /// Returns the exponential backoff for the given attempt (starting at zero), with full
+    /// jitter so a bunch of clients don't all retry at the same moment.
+    pub fn backoff(&self, attempt: u32) -> Duration {
+        let ceiling = self
+            .base_delay
+            .saturating_mul(2u32.saturating_pow(attempt))
+            .min(self.max_delay);
+
+        // Without random bytes, waiting for the whole ceiling is still safe.
+        let mut random = [0u8; 8];
+        if ring::rand::SecureRandom::fill(&ring::rand::SystemRandom::new(), &mut random).is_err() {
+            return ceiling;
+        }
+
+        let millis = (ceiling.as_millis() as u64).saturating_add(1);
+        Duration::from_millis(u64::from_le_bytes(random) % millis)
+    }
+
+    /// Returns how long to wait before the given attempt, preferring what the server asked
+    /// for if it sent a `Retry-After` header.
+    fn delay(&self, attempt: u32, retry_after: Option<Duration>) -> Duration {
+        match retry_after {
+            Some(retry_after) => retry_after.min(self.max_delay),
+            None => self.backoff(attempt),
+        }
+    }
+}
+
+/// Returns true if a request with the given method can safely be sent more than once.
+pub fn is_idempotent(method: &http::Method) -> bool {
+    matches!(
+        *method,
+        http::Method::GET | http::Method::HEAD | http::Method::OPTIONS | http::Method::PUT | http::Method::DELETE
+    )
+}
+
+/// Returns true if a response with the given status is worth retrying.
+pub fn is_retryable_status(status: http::StatusCode) -> bool {
+    status == http::StatusCode::TOO_MANY_REQUESTS || status.is_server_error()
+}
+
+/// Parse the `Retry-After` header, which is either a number of seconds or an HTTP date.
+pub fn retry_after(headers: &reqwest::header::HeaderMap) -> Option<Duration> {
+    let value = headers.get(reqwest::header::RETRY_AFTER)?.to_str().ok()?.trim();
+
+    if let Ok(seconds) = value.parse::<u64>() {
+        return Some(Duration::from_secs(seconds));
+    }
+
+    let date = chrono::DateTime::parse_from_rfc2822(value).ok()?;
+    let wait = date.signed_duration_since(chrono::Utc::now());
+    Some(wait.to_std().unwrap_or_default())
+}
+
+/// Send a raw request, retrying it on rate limits, server errors and network errors if
+/// the method is idempotent.
+///
+/// The request is built again for every attempt, since a request body can only be sent once.
+pub async fn send<F, Fut>(
+    policy: &RetryPolicy,
+    log: &crate::http_log::HttpLog,
+    method: &http::Method,
+    mut build: F,
+) -> Result<reqwest::Response>
+where
+    F: FnMut() -> Fut,
+    Fut: Future<Output = Result<reqwest::RequestBuilder>>,
+{
+    let mut attempt = 0;
+    loop {
+        let result = crate::http_log::send(log, build().await?).await;
+
+        let can_retry = attempt < policy.max_retries && is_idempotent(method);
+        let delay = match &result {
+            Ok(resp) if can_retry && is_retryable_status(resp.status()) => {
+                policy.delay(attempt, retry_after(resp.headers()))
+            }
+            Err(err) if can_retry && (err.is_connect() || err.is_timeout()) => policy.delay(attempt, None),
+            _ => return Ok(result?),
+        };
+
+        log::debug!("retrying {} request in {:?} (attempt {})", method, delay, attempt + 1);
+        tokio::time::sleep(delay).await;
+        attempt += 1;
+    }
+}
+
+/// Call the API client, retrying if the API returned a rate limit or server error.
+///
+/// Only use this for calls that are safe to repeat. Every attempt is printed to the `log`
+/// as `what`, e.g. `GET /user`.
+pub async fn call<T, F, Fut>(policy: &RetryPolicy, log: &crate::http_log::HttpLog, what: &str, f: F) -> Result<T>
+where
+    T: serde::Serialize,
+    F: FnMut() -> Fut,
+    Fut: Future<Output = Result<T, kittycad::types::error::Error>>,
+{
+    call_retrying(policy, log, what, f, is_retryable_status).await
+}
+
+/// Call the API client for a request that isn't safe to repeat, like one that is billed.
+/// It is only retried if the API turned it away with a rate limit, since then nothing
+/// was done.
+pub async fn call_once<T, F, Fut>(policy: &RetryPolicy, log: &crate::http_log::HttpLog, what: &str, f: F) -> Result<T>
+where
+    T: serde::Serialize,
+    F: FnMut() -> Fut,
+    Fut: Future<Output = Result<T, kittycad::types::error::Error>>,
+{
+    call_retrying(policy, log, what, f, |status| {
+        status == http::StatusCode::TOO_MANY_REQUESTS
+    })
+    .await
+}
+
+async fn call_retrying<T, F, Fut>(
+    policy: &RetryPolicy,
+    log: &crate::http_log::HttpLog,
+    what: &str,
+    mut f: F,
+    retryable: fn(http::StatusCode) -> bool,
+) -> Result<T>
+where
+    T: serde::Serialize,
+    F: FnMut() -> Fut,
+    Fut: Future<Output = Result<T, kittycad::types::error::Error>>,
+{
+    let mut attempt = 0;
+    loop {
+        match log.call(what, f()).await {
+            Ok(value) => return Ok(value),
+            Err(err) => {
+                if !err.status().map(retryable).unwrap_or(false) || attempt >= policy.max_retries {
+                    return Err(err.into());
+                }
+
+                let delay = policy.backoff(attempt);
+                log::debug!("retrying API call in {:?} (attempt {}): {}", delay, attempt + 1, err);
+                tokio::time::sleep(delay).await;
+                attempt += 1;
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_backoff() {
+        let policy = RetryPolicy::new(5);
+
+        for attempt in 0..10 {
+            let ceiling = policy
+                .base_delay
+                .saturating_mul(2u32.saturating_pow(attempt))
+                .min(policy.max_delay);
+            assert!(policy.backoff(attempt) <= ceiling, "attempt {}", attempt);
+        }
+
+        assert!(policy.backoff(20) <= policy.max_delay);
+    }
+
+    #[test]
+    fn test_retry_after() {
+        let mut headers = reqwest::header::HeaderMap::new();
+        assert_eq!(retry_after(&headers), None);
+
+        headers.insert(reqwest::header::RETRY_AFTER, "7".parse().unwrap());
+        assert_eq!(retry_after(&headers), Some(Duration::from_secs(7)));
+
+        headers.insert(
+            reqwest::header::RETRY_AFTER,
+            "Wed, 21 Oct 2015 07:28:00 GMT".parse().unwrap(),
+        );
+        assert_eq!(retry_after(&headers), Some(Duration::ZERO));
+
+        headers.insert(reqwest::header::RETRY_AFTER, "soon".parse().unwrap());
+        assert_eq!(retry_after(&headers), None);
+    }
+
+    #[test]
+    fn test_is_retryable() {
+        assert!(is_retryable_status(http::StatusCode::TOO_MANY_REQUESTS));
+        assert!(is_retryable_status(http::StatusCode::BAD_GATEWAY));
+        assert!(!is_retryable_status(http::StatusCode::NOT_FOUND));
+
+        assert!(is_idempotent(&http::Method::GET));
+        assert!(!is_idempotent(&http::Method::POST));
+    }
+}
@@ -0,0 +1,384 @@
+use anyhow::Result;
+use heck::{ToKebabCase, ToSnakeCase, ToUpperCamelCase};
+
+/// The parts of an API operation we need to scaffold a command for it.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Operation {
+    pub method: http::Method,
+    pub path: String,
+    pub summary: String,
+    pub description: String,
+    pub path_params: Vec<Param>,
+    pub query_params: Vec<Param>,
+    pub has_body: bool,
+}
+
+/// A path or query parameter of an operation.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Param {
+    pub name: String,
+    pub description: String,
+    pub required: bool,
+}
+
+/// Find the operation with the given ID in an OpenAPI spec.
+pub fn find_operation(spec: &serde_json::Value, operation_id: &str) -> Result<Operation> {
+    let paths = spec["paths"]
+        .as_object()
+        .ok_or_else(|| anyhow::anyhow!("the spec has no paths"))?;
+
+    for (path, item) in paths {
+        let item = match item.as_object() {
+            Some(item) => item,
+            None => continue,
+        };
+
+        for (method, op) in item {
+            if op["operationId"].as_str() != Some(operation_id) {
+                continue;
+            }
+
+            let mut path_params = vec![];
+            let mut query_params = vec![];
+            for param in op["parameters"].as_array().cloned().unwrap_or_default() {
+                let p = Param {
+                    name: param["name"].as_str().unwrap_or_default().to_string(),
+                    description: param["description"].as_str().unwrap_or_default().to_string(),
+                    required: param["required"].as_bool().unwrap_or_default(),
+                };
+                match param["in"].as_str() {
+                    Some("path") => path_params.push(Param { required: true, ..p }),
+                    Some("query") => query_params.push(p),
+                    _ => {}
+                }
+            }
+
+            return Ok(Operation {
+                method: method.to_uppercase().parse()?,
+                path: path.to_string(),
+                summary: op["summary"].as_str().unwrap_or_default().to_string(),
+                description: op["description"].as_str().unwrap_or_default().to_string(),
+                path_params,
+                query_params,
+                has_body: !op["requestBody"].is_null(),
+            });
+        }
+    }
+
+    anyhow::bail!("no operation with ID `{}` in the spec", operation_id)
+}
+
+/// Returns the file name of the command module, relative to `src`.
+pub fn file_name(name: &str) -> String {
+    format!("cmd_{}.rs", name.to_snake_case())
+}
+
+/// Returns the lines to add to `src/main.rs` to register the command.
+pub fn registration(name: &str) -> String {
+    let module = format!("cmd_{}", name.to_snake_case());
+    let variant = name.to_upper_camel_case();
+
+    format!(
+        r#"/// The {} command.
+pub mod {};
+
+{}({}::Cmd{}),
+
+SubCommand::{}(cmd) => run_cmd(&cmd, ctx, &command).await,"#,
+        name.to_kebab_case(),
+        module,
+        variant,
+        module,
+        variant,
+        variant
+    )
+}
+
+/// Returns the source of a command module that calls the operation.
+///
+/// Path parameters become positional arguments and query parameters become flags, so
+/// the command looks like the rest once it is filled in.
+pub fn command_module(name: &str, op: &Operation) -> String {
+    let command = name.to_kebab_case();
+    let struct_name = format!("Cmd{}", name.to_upper_camel_case());
+
+    let mut src = String::new();
+    src.push_str("use anyhow::Result;\nuse clap::Parser;\n\n");
+
+    // The docs, with an example.
+    src.push_str(&doc_comment(&op.summary, ""));
+    if !op.description.is_empty() {
+        src.push_str("///\n");
+        src.push_str(&doc_comment(&op.description, ""));
+    }
+    src.push_str("///\n");
+    src.push_str(&format!(
+        "///     # {}\n",
+        op.summary.trim_end_matches('.').to_lowercase()
+    ));
+    src.push_str(&format!("///     $ {}\n", example(&command, op).join(" ")));
+
+    // The arguments.
+    src.push_str("#[derive(Parser, Debug, Clone)]\n#[clap(verbatim_doc_comment)]\n");
+    src.push_str(&format!("pub struct {} {{\n", struct_name));
+    let mut fields = vec![];
+    for p in &op.path_params {
+        fields.push(format!(
+            "{}    #[clap(name = \"{}\", required = true)]\n    pub {}: String,\n",
+            doc_comment(&p.description, "    "),
+            p.name.to_snake_case(),
+            p.name.to_snake_case()
+        ));
+    }
+    if op.has_body {
+        fields.push(
+            "    /// The path to the request body, or \"-\" to read it from stdin.\n    #[clap(name = \"input\", required = true)]\n    pub input: String,\n"
+                .to_string(),
+        );
+    }
+    for p in &op.query_params {
+        if p.required {
+            fields.push(format!(
+                "{}    #[clap(long, required = true)]\n    pub {}: String,\n",
+                doc_comment(&p.description, "    "),
+                p.name.to_snake_case()
+            ));
+        } else {
+            fields.push(format!(
+                "{}    #[clap(long)]\n    pub {}: Option<String>,\n",
+                doc_comment(&p.description, "    "),
+                p.name.to_snake_case()
+            ));
+        }
+    }
+    src.push_str(&fields.join("\n"));
+    src.push_str("}\n\n");
+
+    // The run function.
+    src.push_str(&format!(
+        "#[async_trait::async_trait]\nimpl crate::cmd::Command for {} {{\n",
+        struct_name
+    ));
+    src.push_str("    async fn run(&self, ctx: &mut crate::context::Context) -> Result<()> {\n");
+    src.push_str("        let client = ctx.api_client(\"\")?;\n");
+    src.push_str("        let retry_policy = ctx.retry_policy()?;\n");
+    src.push_str("        let http_log = ctx.http_log();\n");
+    src.push_str("        let max_body_size = ctx.max_body_size()?;\n");
+    if op.has_body {
+        src.push_str("        let body = ctx.read_file(&self.input)?;\n");
+    }
+    src.push('\n');
+
+    let binding = if op.query_params.is_empty() { "let" } else { "let mut" };
+    if op.path_params.is_empty() {
+        src.push_str(&format!("        {} uri = \"{}\".to_string();\n", binding, op.path));
+    } else {
+        let mut path = op.path.clone();
+        let mut args = vec![];
+        for p in &op.path_params {
+            path = path.replace(&format!("{{{}}}", p.name), "{}");
+            args.push(format!("self.{}", p.name.to_snake_case()));
+        }
+        src.push_str(&format!(
+            "        {} uri = format!(\"{}\", {});\n",
+            binding,
+            path,
+            args.join(", ")
+        ));
+    }
+
+    if !op.query_params.is_empty() {
+        src.push_str("        let mut query = url::form_urlencoded::Serializer::new(String::new());\n");
+        for p in &op.query_params {
+            let field = p.name.to_snake_case();
+            if p.required {
+                src.push_str(&format!(
+                    "        query.append_pair(\"{}\", &self.{});\n",
+                    p.name, field
+                ));
+            } else {
+                src.push_str(&format!(
+                    "        if let Some({}) = &self.{} {{\n            query.append_pair(\"{}\", {});\n        }}\n",
+                    field, field, p.name, field
+                ));
+            }
+        }
+        src.push_str("        let query = query.finish();\n");
+        src.push_str("        if !query.is_empty() {\n            uri = format!(\"{}?{}\", uri, query);\n        }\n");
+    }
+    src.push('\n');
+
+    let method = format!("http::Method::{}", op.method);
+    let (clone_body, body) = if op.has_body {
+        ("            let body = body.clone();\n", "Some(body.into())")
+    } else {
+        ("", "None")
+    };
+    src.push_str("        let client = &client;\n");
+    src.push_str(&format!(
+        "        let resp = crate::retry::send(&retry_policy, &http_log, &{}, || {{\n            let uri = uri.clone();\n{}            async move {{ Ok(client.request_raw({}, &uri, {}).await?) }}\n        }})\n        .await?;\n",
+        method, clone_body, method, body
+    ));
+    src.push_str("        if !resp.status().is_success() {\n            anyhow::bail!(\"{} {}\", resp.status(), resp.status().canonical_reason().unwrap_or(\"\"));\n        }\n\n");
+    src.push_str(
+        "        // TODO: deserialize into a type that derives `Serialize` and `tabled::Tabled`, then add a\n",
+    );
+    src.push_str("        // `--format` flag and use `ctx.io.write_output`.\n");
+    src.push_str("        let value: serde_json::Value = crate::http_body::read_json(resp, max_body_size).await?;\n");
+    src.push_str("        ctx.io.write_output_json(&value)?;\n\n");
+    src.push_str("        Ok(())\n    }\n}\n\n");
+
+    // A test that the flags parse.
+    src.push_str("#[cfg(test)]\nmod test {\n");
+    if !op.path_params.is_empty() || !op.query_params.is_empty() || op.has_body {
+        src.push_str("    use pretty_assertions::assert_eq;\n\n");
+    }
+    src.push_str("    use super::*;\n\n");
+    src.push_str("    #[test]\n    fn test_parse_args() {\n");
+    let args: Vec<String> = example(&command, op)
+        .iter()
+        .skip(1)
+        .map(|arg| format!("\"{}\"", arg))
+        .collect();
+    src.push_str(&format!(
+        "        let cmd = {}::try_parse_from(&[{}]).unwrap();\n",
+        struct_name,
+        args.join(", ")
+    ));
+    for p in &op.path_params {
+        src.push_str(&format!(
+            "        assert_eq!(cmd.{}, \"<{}>\");\n",
+            p.name.to_snake_case(),
+            p.name.to_snake_case()
+        ));
+    }
+    if op.has_body {
+        src.push_str("        assert_eq!(cmd.input, \"<input>\");\n");
+    }
+    for p in &op.query_params {
+        if p.required {
+            src.push_str(&format!(
+                "        assert_eq!(cmd.{}, \"<{}>\");\n",
+                p.name.to_snake_case(),
+                p.name.to_snake_case()
+            ));
+        } else {
+            src.push_str(&format!("        assert_eq!(cmd.{}, None);\n", p.name.to_snake_case()));
+        }
+    }
+    src.push_str("    }\n}\n");
+
+    src
+}
+
+/// Returns the words of an example invocation with only the required arguments.
+fn example(command: &str, op: &Operation) -> Vec<String> {
+    let mut words = vec!["kittycad".to_string(), command.to_string()];
+    for p in &op.path_params {
+        words.push(format!("<{}>", p.name.to_snake_case()));
+    }
+    if op.has_body {
+        words.push("<input>".to_string());
+    }
+    for p in op.query_params.iter().filter(|p| p.required) {
+        words.push(format!("--{}", p.name.to_snake_case().to_kebab_case()));
+        words.push(format!("<{}>", p.name.to_snake_case()));
+    }
+    words
+}
+
+fn doc_comment(text: &str, indent: &str) -> String {
+    text.trim()
+        .lines()
+        .map(|line| {
+            if line.trim().is_empty() {
+                format!("{}///\n", indent)
+            } else {
+                format!("{}/// {}\n", indent, line.trim_end())
+            }
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    fn spec() -> serde_json::Value {
+        serde_json::json!({
+            "paths": {
+                "/widgets/{id}": {
+                    "get": {
+                        "operationId": "get_widget",
+                        "summary": "Get a widget.",
+                        "parameters": [
+                            {"in": "path", "name": "id", "description": "The widget ID.", "required": true},
+                            {"in": "query", "name": "sort_by", "description": "How to sort."}
+                        ]
+                    }
+                }
+            }
+        })
+    }
+
+    #[test]
+    fn test_find_operation() {
+        let op = find_operation(&spec(), "get_widget").unwrap();
+        assert_eq!(op.method, http::Method::GET);
+        assert_eq!(op.path, "/widgets/{id}");
+        assert_eq!(
+            op.path_params,
+            vec![Param {
+                name: "id".to_string(),
+                description: "The widget ID.".to_string(),
+                required: true,
+            }]
+        );
+        assert_eq!(op.query_params.len(), 1);
+        assert!(!op.has_body);
+
+        assert_eq!(
+            find_operation(&spec(), "nope").unwrap_err().to_string(),
+            "no operation with ID `nope` in the spec"
+        );
+    }
+
+    #[test]
+    fn test_command_module() {
+        let op = find_operation(&spec(), "get_widget").unwrap();
+        let src = command_module("widget", &op);
+
+        assert!(src.contains("///     $ kittycad widget <id>\n"), "{}", src);
+        assert!(src.contains("pub struct CmdWidget {\n"), "{}", src);
+        assert!(
+            src.contains("    /// How to sort.\n    #[clap(long)]\n    pub sort_by: Option<String>,\n"),
+            "{}",
+            src
+        );
+        assert!(
+            src.contains("let mut uri = format!(\"/widgets/{}\", self.id);"),
+            "{}",
+            src
+        );
+        assert!(
+            src.contains("CmdWidget::try_parse_from(&[\"widget\", \"<id>\"])"),
+            "{}",
+            src
+        );
+    }
+
+    #[test]
+    fn test_registration() {
+        assert_eq!(
+            registration("api-widget"),
+            r#"/// The api-widget command.
+pub mod cmd_api_widget;
+
+ApiWidget(cmd_api_widget::CmdApiWidget),
+
+SubCommand::ApiWidget(cmd) => run_cmd(&cmd, ctx, &command).await,"#
+        );
+    }
+}
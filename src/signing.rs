@@ -0,0 +1,142 @@
+use anyhow::{anyhow, Context, Result};
+use ring::signature::{Ed25519KeyPair, KeyPair};
+
+/// The first line of a signature file, it is not covered by the signature.
+const COMMENT_PREFIX: &str = "untrusted comment: ";
+
+/// Returns the path of the signature of a file, the file with a `.sig` extension added.
+pub fn signature_path(path: &std::path::Path) -> std::path::PathBuf {
+    let mut path = path.as_os_str().to_owned();
+    path.push(".sig");
+    path.into()
+}
+
+/// Load the signing key from the file, creating it if it doesn't exist yet.
+///
+/// Returns the key and whether it was just created.
+pub fn load_or_create_key(path: &str) -> Result<(Ed25519KeyPair, bool)> {
+    match std::fs::read_to_string(path) {
+        Ok(contents) => {
+            let pkcs8 = data_encoding::BASE64
+                .decode(contents.trim().as_bytes())
+                .map_err(|err| anyhow!("failed to parse signing key {}: {}", path, err))?;
+            let key = Ed25519KeyPair::from_pkcs8(&pkcs8)
+                .map_err(|err| anyhow!("failed to parse signing key {}: {}", path, err))?;
+            Ok((key, false))
+        }
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => {
+            let rng = ring::rand::SystemRandom::new();
+            let pkcs8 =
+                Ed25519KeyPair::generate_pkcs8(&rng).map_err(|_| anyhow!("failed to generate a signing key"))?;
+            let key =
+                Ed25519KeyPair::from_pkcs8(pkcs8.as_ref()).map_err(|_| anyhow!("failed to generate a signing key"))?;
+
+            let parent = std::path::Path::new(path).parent().unwrap();
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("failed to create directory {}", parent.display()))?;
+            write_secret(path, data_encoding::BASE64.encode(pkcs8.as_ref()).as_bytes())?;
+
+            Ok((key, true))
+        }
+        Err(err) => Err(anyhow!("failed to read signing key {}: {}", path, err)),
+    }
+}
+
+/// Write a new file only we can read, it fails if the file is already there.
+#[cfg(unix)]
+pub(crate) fn write_secret(path: &str, contents: &[u8]) -> Result<()> {
+    use std::{io::Write, os::unix::fs::OpenOptionsExt};
+
+    let mut file = std::fs::OpenOptions::new()
+        .write(true)
+        .create_new(true)
+        .mode(0o600)
+        .open(path)
+        .with_context(|| format!("failed to create file {}", path))?;
+    file.write_all(contents)?;
+
+    Ok(())
+}
+
+/// Write a new file only we can read, it fails if the file is already there.
+#[cfg(not(unix))]
+pub(crate) fn write_secret(path: &str, contents: &[u8]) -> Result<()> {
+    std::fs::write(path, contents).with_context(|| format!("failed to write file {}", path))
+}
+
+/// Returns the public key of a signing key, which is what others verify signatures with.
+pub fn public_key(key: &Ed25519KeyPair) -> String {
+    data_encoding::BASE64.encode(key.public_key().as_ref())
+}
+
+/// Returns the contents of the signature file for the data.
+pub fn sign(key: &Ed25519KeyPair, data: &[u8]) -> String {
+    format!(
+        "{}signed by kittycad with key {}\n{}\n",
+        COMMENT_PREFIX,
+        public_key(key),
+        data_encoding::BASE64.encode(key.sign(data).as_ref())
+    )
+}
+
+/// Returns an error unless the signature file is a signature of the data by the public key.
+pub fn verify(public_key: &str, data: &[u8], signature: &str) -> Result<()> {
+    let public_key = data_encoding::BASE64
+        .decode(public_key.trim().as_bytes())
+        .map_err(|err| anyhow!("invalid public key: {}", err))?;
+
+    let signature = signature
+        .lines()
+        .map(|line| line.trim())
+        .find(|line| !line.is_empty() && !line.starts_with(COMMENT_PREFIX))
+        .ok_or_else(|| anyhow!("the signature file is empty"))?;
+    let signature = data_encoding::BASE64
+        .decode(signature.as_bytes())
+        .map_err(|err| anyhow!("invalid signature: {}", err))?;
+
+    ring::signature::UnparsedPublicKey::new(&ring::signature::ED25519, &public_key)
+        .verify(data, &signature)
+        .map_err(|_| anyhow!("the signature does not match, the file was changed or signed with another key"))
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_sign_verify() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("config").join("signing.key");
+        let path = path.to_str().unwrap();
+
+        let (key, created) = load_or_create_key(path).unwrap();
+        assert!(created);
+        let (same_key, created) = load_or_create_key(path).unwrap();
+        assert!(!created);
+        assert_eq!(public_key(&key), public_key(&same_key));
+
+        let signature = sign(&key, b"solid cube");
+        assert!(signature.starts_with(COMMENT_PREFIX));
+        verify(&public_key(&key), b"solid cube", &signature).unwrap();
+
+        assert_eq!(
+            verify(&public_key(&key), b"solid sphere", &signature)
+                .unwrap_err()
+                .to_string(),
+            "the signature does not match, the file was changed or signed with another key"
+        );
+
+        let (other_key, _) = load_or_create_key(dir.path().join("other.key").to_str().unwrap()).unwrap();
+        assert!(verify(&public_key(&other_key), b"solid cube", &signature).is_err());
+    }
+
+    #[test]
+    fn test_signature_path() {
+        assert_eq!(
+            signature_path(std::path::Path::new("out/my-file.stl.gz")),
+            std::path::PathBuf::from("out/my-file.stl.gz.sig")
+        );
+    }
+}
@@ -0,0 +1,144 @@
+use anyhow::{anyhow, Result};
+
+/// The size of a block of a tarball, headers and file contents are padded to it.
+const BLOCK: usize = 512;
+
+/// The longest file name that fits in a header.
+const MAX_NAME: usize = 100;
+
+/// Add a file to a tarball, in the ustar format every `tar` reads.
+pub fn append(tarball: &mut Vec<u8>, name: &str, contents: &[u8], mode: u32, mtime: i64) -> Result<()> {
+    if name.len() > MAX_NAME {
+        anyhow::bail!("the name {} is too long for a tarball", name);
+    }
+
+    let mut header = [0u8; BLOCK];
+    header[..name.len()].copy_from_slice(name.as_bytes());
+    write_octal(&mut header[100..108], mode as u64);
+    write_octal(&mut header[108..116], 0);
+    write_octal(&mut header[116..124], 0);
+    write_octal(&mut header[124..136], contents.len() as u64);
+    write_octal(&mut header[136..148], mtime.max(0) as u64);
+    // A regular file.
+    header[156] = b'0';
+    header[257..263].copy_from_slice(b"ustar\0");
+    header[263..265].copy_from_slice(b"00");
+
+    // The checksum is taken with its own field as spaces.
+    header[148..156].copy_from_slice(b"        ");
+    let checksum: u32 = header.iter().map(|b| *b as u32).sum();
+    write_octal(&mut header[148..155], checksum as u64);
+    header[155] = b' ';
+
+    tarball.extend_from_slice(&header);
+    tarball.extend_from_slice(contents);
+    tarball.resize(tarball.len() + padding(contents.len()), 0);
+
+    Ok(())
+}
+
+/// End a tarball, after the last file.
+pub fn finish(tarball: &mut Vec<u8>) {
+    tarball.resize(tarball.len() + 2 * BLOCK, 0);
+}
+
+/// Returns the names and contents of the files in a tarball. Directories, links and
+/// the other kinds of entries are left out.
+pub fn files(tarball: &[u8]) -> Result<Vec<(String, Vec<u8>)>> {
+    let mut files = Vec::new();
+    let mut offset = 0;
+    while offset + BLOCK <= tarball.len() {
+        let header = &tarball[offset..offset + BLOCK];
+        // The end of the tarball.
+        if header.iter().all(|b| *b == 0) {
+            break;
+        }
+
+        let checksum: u32 = header[..148]
+            .iter()
+            .chain(&[b' '; 8])
+            .chain(&header[156..])
+            .map(|b| *b as u32)
+            .sum();
+        if read_octal(&header[148..156])? != checksum as u64 {
+            anyhow::bail!("not a tarball, or it is corrupt");
+        }
+
+        let size = read_octal(&header[124..136])? as usize;
+        let start = offset + BLOCK;
+        if start + size > tarball.len() {
+            anyhow::bail!("the tarball is cut short");
+        }
+
+        if header[156] == b'0' || header[156] == 0 {
+            let mut name = read_str(&header[..100]);
+            // The ustar prefix of long names.
+            if &header[257..262] == b"ustar" && header[345] != 0 {
+                name = format!("{}/{}", read_str(&header[345..500]), name);
+            }
+            files.push((name, tarball[start..start + size].to_vec()));
+        }
+
+        offset = start + size + padding(size);
+    }
+
+    Ok(files)
+}
+
+/// Returns the number of zeros after contents of the given size to fill up its last block.
+fn padding(size: usize) -> usize {
+    (BLOCK - size % BLOCK) % BLOCK
+}
+
+/// Write a number to a header field as octal, ending with a NUL.
+fn write_octal(field: &mut [u8], n: u64) {
+    let s = format!("{:0width$o}\0", n, width = field.len() - 1);
+    field.copy_from_slice(&s.as_bytes()[s.len() - field.len()..]);
+}
+
+/// Read an octal number from a header field.
+fn read_octal(field: &[u8]) -> Result<u64> {
+    let s = read_str(field);
+    let s = s.trim_matches(|c: char| c == ' ' || c == '\0');
+    if s.is_empty() {
+        return Ok(0);
+    }
+
+    u64::from_str_radix(s, 8).map_err(|_| anyhow!("not a tarball, or it is corrupt"))
+}
+
+/// Read a string from a header field, which ends at the first NUL if it is shorter.
+fn read_str(field: &[u8]) -> String {
+    let end = field.iter().position(|b| *b == 0).unwrap_or(field.len());
+    String::from_utf8_lossy(&field[..end]).to_string()
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_tarball() {
+        let mut tarball = Vec::new();
+        append(&mut tarball, "config.toml", b"editor = \"vim\"\n", 0o600, 1656676800).unwrap();
+        append(&mut tarball, "empty", b"", 0o600, 1656676800).unwrap();
+        finish(&mut tarball);
+        assert_eq!(tarball.len() % BLOCK, 0);
+
+        assert_eq!(
+            files(&tarball).unwrap(),
+            vec![
+                ("config.toml".to_string(), b"editor = \"vim\"\n".to_vec()),
+                ("empty".to_string(), vec![]),
+            ]
+        );
+
+        assert!(append(&mut tarball, &"a".repeat(101), b"", 0o600, 0).is_err());
+        assert_eq!(
+            files(&[1; 1024]).unwrap_err().to_string(),
+            "not a tarball, or it is corrupt"
+        );
+    }
+}
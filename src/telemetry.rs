@@ -0,0 +1,198 @@
+use std::collections::BTreeMap;
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+
+/// What telemetry has recorded on this machine, only counts and never the arguments of a
+/// command, its output or error messages, which can have paths, IDs or hosts in them.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Metrics {
+    /// When recording started.
+    pub since: Option<chrono::DateTime<chrono::Utc>>,
+    /// The version of `kittycad` that recorded last.
+    #[serde(default)]
+    pub cli_version: String,
+    #[serde(default)]
+    pub os: String,
+    /// The counts of each command, by its subcommands joined with underscores, e.g.
+    /// `file_convert`.
+    #[serde(default)]
+    pub commands: BTreeMap<String, CommandMetrics>,
+}
+
+/// The counts of a command.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct CommandMetrics {
+    pub runs: u64,
+    /// How many runs failed, by the kind of error, see `error_category`.
+    #[serde(default)]
+    pub errors: BTreeMap<String, u64>,
+    /// How long the runs took together, in milliseconds.
+    #[serde(default)]
+    pub total_ms: u64,
+}
+
+impl Metrics {
+    /// Count a run of a command, with the kind of error it failed with if it did.
+    pub fn add(&mut self, command: &str, error: Option<&str>, duration: std::time::Duration) {
+        self.since.get_or_insert_with(chrono::Utc::now);
+        self.cli_version = clap::crate_version!().to_string();
+        self.os = std::env::consts::OS.to_string();
+
+        let metrics = self.commands.entry(command.to_string()).or_default();
+        metrics.runs += 1;
+        metrics.total_ms += duration.as_millis() as u64;
+        if let Some(error) = error {
+            *metrics.errors.entry(error.to_string()).or_default() += 1;
+        }
+    }
+}
+
+/// Returns true if the user opted into telemetry with `kittycad telemetry enable`.
+pub fn is_enabled(config: &dyn crate::config::Config) -> bool {
+    config.get("", "telemetry").unwrap_or_default() == "enabled"
+}
+
+/// Returns the kind of an error, which is all telemetry records about it.
+pub fn error_category(err: &anyhow::Error) -> &'static str {
+    if let Some(err) = err.downcast_ref::<crate::cmd::ExitCodeError>() {
+        return match err.code {
+            crate::exit_code::FAILED => "failed",
+            crate::exit_code::PENDING => "pending",
+            crate::exit_code::AUTH => "auth",
+            crate::exit_code::VALIDATION => "validation",
+            crate::exit_code::NETWORK => "network",
+            crate::INTERRUPTED_EXIT_CODE => "interrupted",
+            _ => "exit_code",
+        };
+    }
+
+    if let Some(err) = err.downcast_ref::<kittycad::types::error::Error>() {
+        return match err.status() {
+            Some(http::StatusCode::UNAUTHORIZED) | Some(http::StatusCode::FORBIDDEN) => "auth",
+            Some(status) if status.is_client_error() => "api_client",
+            Some(_) => "api_server",
+            None => "network",
+        };
+    }
+
+    if err.downcast_ref::<reqwest::Error>().is_some() {
+        return "network";
+    }
+    if err.downcast_ref::<std::io::Error>().is_some() {
+        return "io";
+    }
+
+    "other"
+}
+
+/// Returns the metrics recorded in the file.
+pub fn load(filepath: &str) -> Result<Metrics> {
+    if !std::path::Path::new(filepath).exists() {
+        return Ok(Metrics::default());
+    }
+
+    let content = std::fs::read_to_string(filepath)?;
+    Ok(serde_json::from_str(&content)?)
+}
+
+fn save(filepath: &str, metrics: &Metrics) -> Result<()> {
+    // Make sure we have a parent directory.
+    let path = std::path::Path::new(filepath);
+    let parent = path.parent().unwrap();
+    std::fs::create_dir_all(parent).with_context(|| format!("failed to create directory {}", parent.display()))?;
+
+    std::fs::write(filepath, serde_json::to_string_pretty(metrics)?)
+        .with_context(|| format!("failed to write file {}", filepath))
+}
+
+/// Forget everything recorded.
+pub fn clear(filepath: &str) -> Result<()> {
+    match std::fs::remove_file(filepath) {
+        Err(err) if err.kind() != std::io::ErrorKind::NotFound => {
+            Err(err).with_context(|| format!("failed to remove {}", filepath))
+        }
+        _ => Ok(()),
+    }
+}
+
+/// Count a run of a command if the user opted in, this never fails the command since
+/// the metrics are only for us.
+pub fn record(config: &dyn crate::config::Config, command: &str, error: Option<&str>, duration: std::time::Duration) {
+    if !is_enabled(config) || command.is_empty() {
+        return;
+    }
+
+    let result = crate::config_file::telemetry_file().and_then(|filepath| {
+        let mut metrics = load(&filepath).unwrap_or_default();
+        metrics.add(command, error, duration);
+        save(&filepath, &metrics)
+    });
+    if let Err(err) = result {
+        log::debug!("failed to record telemetry: {}", err);
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_metrics() {
+        let dir = tempfile::tempdir().unwrap();
+        let filepath = dir.path().join("state").join("telemetry.json");
+        let filepath = filepath.to_str().unwrap();
+
+        let mut metrics = load(filepath).unwrap();
+        assert_eq!(metrics, Metrics::default());
+
+        metrics.add("file_convert", None, std::time::Duration::from_millis(1500));
+        metrics.add("file_convert", Some("network"), std::time::Duration::from_millis(500));
+        save(filepath, &metrics).unwrap();
+
+        let metrics = load(filepath).unwrap();
+        assert!(metrics.since.is_some());
+        assert_eq!(
+            metrics.commands["file_convert"],
+            CommandMetrics {
+                runs: 2,
+                errors: [("network".to_string(), 1)].into_iter().collect(),
+                total_ms: 2000,
+            }
+        );
+
+        clear(filepath).unwrap();
+        clear(filepath).unwrap();
+        assert_eq!(load(filepath).unwrap(), Metrics::default());
+    }
+
+    #[test]
+    fn test_error_category() {
+        assert_eq!(error_category(&anyhow::anyhow!("no such file")), "other");
+        assert_eq!(
+            error_category(&std::io::Error::new(std::io::ErrorKind::NotFound, "my-part.step").into()),
+            "io"
+        );
+        assert_eq!(
+            error_category(
+                &crate::cmd::ExitCodeError {
+                    code: crate::INTERRUPTED_EXIT_CODE,
+                    message: "Interrupted".to_string(),
+                }
+                .into()
+            ),
+            "interrupted"
+        );
+    }
+
+    #[test]
+    fn test_is_enabled() {
+        let mut config = crate::config::new_blank_config().unwrap();
+        assert!(!is_enabled(&config));
+
+        config.set("", "telemetry", "enabled").unwrap();
+        assert!(is_enabled(&config));
+    }
+}
@@ -79,8 +79,8 @@ async fn test_main(ctx: &mut MainContext) {
                 "foo".to_string(),
                 "completion -s zsh".to_string(),
             ],
-            want_out: "- Adding alias for foo: completion -s zsh\n✔ Added alias.".to_string(),
-            want_err: "".to_string(),
+            want_out: "".to_string(),
+            want_err: "- Adding alias for foo: completion -s zsh\n✔ Added alias.".to_string(),
             want_code: 0,
             ..Default::default()
         },
@@ -94,8 +94,8 @@ async fn test_main(ctx: &mut MainContext) {
                 "bar".to_string(),
                 "which bash".to_string(),
             ],
-            want_out: "- Adding alias for bar: !which bash\n✔ Added alias.".to_string(),
-            want_err: "".to_string(),
+            want_out: "".to_string(),
+            want_err: "- Adding alias for bar: !which bash\n✔ Added alias.".to_string(),
             want_code: 0,
             ..Default::default()
         },
@@ -155,8 +155,8 @@ async fn test_main(ctx: &mut MainContext) {
                 "--with-token".to_string(),
             ],
             stdin: Some(ctx.test_token.clone()),
-            want_out: "✔ Logged in as ".to_string(),
-            want_err: "".to_string(),
+            want_out: "".to_string(),
+            want_err: "✔ Logged in as ".to_string(),
             want_code: 0,
         },
         TestItem {
@@ -243,6 +243,50 @@ access-control-allow-credentials:  """#
             want_code: 1,
             ..Default::default()
         },
+        TestItem {
+            name: "help deprecations".to_string(),
+            args: vec!["kittycad".to_string(), "help".to_string(), "deprecations".to_string()],
+            want_out: "No flags are currently deprecated.".to_string(),
+            want_err: "".to_string(),
+            want_code: 0,
+            ..Default::default()
+        },
+        TestItem {
+            name: "help deprecations after global flags".to_string(),
+            args: vec![
+                "kittycad".to_string(),
+                "--debug".to_string(),
+                "--timeout".to_string(),
+                "30s".to_string(),
+                "help".to_string(),
+                "deprecations".to_string(),
+            ],
+            want_out: "No flags are currently deprecated.".to_string(),
+            want_err: "".to_string(),
+            want_code: 0,
+            ..Default::default()
+        },
+        TestItem {
+            name: "help exit-codes".to_string(),
+            args: vec!["kittycad".to_string(), "help".to_string(), "exit-codes".to_string()],
+            want_out: "    4  Not authenticated, or not authorized to do this.".to_string(),
+            want_err: "".to_string(),
+            want_code: 0,
+            ..Default::default()
+        },
+        TestItem {
+            name: "unknown flag".to_string(),
+            args: vec![
+                "kittycad".to_string(),
+                "user".to_string(),
+                "view".to_string(),
+                "--nope".to_string(),
+            ],
+            want_out: "".to_string(),
+            want_err: "Found argument '--nope' which wasn't expected".to_string(),
+            want_code: 5,
+            ..Default::default()
+        },
         TestItem {
             name: "get your user".to_string(),
             args: vec!["kittycad".to_string(), "user".to_string(), "view".to_string()],
@@ -251,6 +295,14 @@ access-control-allow-credentials:  """#
             want_code: 0,
             ..Default::default()
         },
+        TestItem {
+            name: "show your user".to_string(),
+            args: vec!["kittycad".to_string(), "user".to_string(), "show".to_string()],
+            want_out: "email          |".to_string(),
+            want_err: "".to_string(),
+            want_code: 0,
+            ..Default::default()
+        },
         TestItem {
             name: "get your user as json".to_string(),
             args: vec![
@@ -339,8 +391,8 @@ access-control-allow-credentials:  """#
                 "status".to_string(),
                 "23a9759f-ee9b-47de-9a55-deb1ed035793".to_string(),
             ],
-            want_out: r#"Saved file conversion output to"#.to_string(),
-            want_err: "".to_string(),
+            want_out: r#""id": "23a9759f-ee9b-47de-9a55-deb1ed035793""#.to_string(),
+            want_err: r#"Saved file conversion output to"#.to_string(),
             want_code: 0,
             ..Default::default()
         },
@@ -369,11 +421,7 @@ access-control-allow-credentials:  """#
         if let Some(stdin) = t.stdin {
             io.stdin = Box::new(std::io::Cursor::new(stdin));
         }
-        let mut ctx = crate::context::Context {
-            config: &mut c,
-            io,
-            debug: false,
-        };
+        let mut ctx = crate::context::Context::with_io(&mut c, io);
 
         let result = crate::do_main(t.args, &mut ctx).await;
 
@@ -432,3 +480,119 @@ access-control-allow-credentials:  """#
         }
     }
 }
+
+#[test]
+fn test_help_args() {
+    use clap::CommandFactory;
+
+    let args = |s: &str| s.split_whitespace().map(|s| s.to_string()).collect::<Vec<String>>();
+    let app = crate::Opts::command();
+
+    assert_eq!(
+        crate::help_args(&app, &args("kittycad help deprecations")),
+        Some(args("deprecations"))
+    );
+    assert_eq!(
+        crate::help_args(
+            &app,
+            &args("kittycad --debug --timeout 30s help file convert --offline")
+        ),
+        Some(args("file convert --offline"))
+    );
+    assert_eq!(
+        crate::help_args(&app, &args("kittycad --timeout=30s help")),
+        Some(vec![])
+    );
+    assert_eq!(crate::help_args(&app, &args("kittycad --verbose help")), Some(vec![]));
+    assert_eq!(crate::help_args(&app, &args("kittycad --timeout help")), None);
+    assert_eq!(crate::help_args(&app, &args("kittycad file help")), None);
+}
+
+#[tokio::test]
+async fn test_run_until_interrupted() {
+    let run = async {
+        // Stands in for a request that never finishes.
+        std::future::pending::<()>().await;
+        Ok(())
+    };
+
+    let err = crate::run_until(run, None, async {}).await.unwrap_err();
+    let err = err.downcast_ref::<crate::cmd::ExitCodeError>().unwrap();
+    assert_eq!(err.code, crate::INTERRUPTED_EXIT_CODE);
+    assert_eq!(err.message, "Interrupted");
+}
+
+#[tokio::test(start_paused = true)]
+async fn test_run_until_timeout() {
+    let run = async {
+        tokio::time::sleep(std::time::Duration::from_secs(60)).await;
+        Ok(())
+    };
+
+    let err = crate::run_until(
+        run,
+        Some(std::time::Duration::from_secs(1)),
+        std::future::pending::<()>(),
+    )
+    .await
+    .unwrap_err();
+    assert_eq!(
+        err.to_string(),
+        "command timed out after 1s, you can raise the limit with `--timeout` or the `timeout` config"
+    );
+}
+
+#[tokio::test]
+async fn test_run_until_done() {
+    crate::run_until(async { Ok(()) }, None, std::future::pending::<()>())
+        .await
+        .unwrap();
+}
+
+#[test]
+fn test_command_path() {
+    use clap::CommandFactory;
+
+    let matches = crate::Opts::command().get_matches_from(["kittycad", "--debug", "api-call", "status", "--no-picker"]);
+    assert_eq!(crate::command_path(&matches), "api_call_status");
+}
+
+#[test]
+fn test_parse_fields() {
+    assert_eq!(
+        crate::parse_fields("id, status,,completed_at"),
+        vec!["id".to_string(), "status".to_string(), "completed_at".to_string()]
+    );
+}
+
+#[test]
+fn test_read_token() {
+    use crate::config::Config;
+
+    let dir = tempfile::tempdir().unwrap();
+    let path = |name: &str| dir.path().join(name).to_str().unwrap().to_string();
+    std::fs::write(path("empty"), "\n  \n").unwrap();
+    std::fs::write(path("token"), "file-token\n").unwrap();
+
+    let mut config = crate::config::new_blank_config().unwrap();
+    config.set("example.org", "token", "config-token").unwrap();
+    let (io, _, _) = crate::iostreams::IoStreams::test();
+    let mut ctx = crate::context::Context::with_io(&mut config, io);
+
+    let err = crate::read_token(&mut ctx, &path("missing")).unwrap_err();
+    assert!(
+        err.to_string()
+            .starts_with(&format!("failed to read {}: ", path("missing"))),
+        "{}",
+        err
+    );
+    assert_eq!(
+        crate::read_token(&mut ctx, &path("empty")).unwrap_err().to_string(),
+        format!("no token found in {}", path("empty"))
+    );
+
+    // The trailing newline is trimmed, and the token wins over the one in the config.
+    assert_eq!(ctx.token("example.org").unwrap(), "config-token");
+    ctx.token = Some(crate::read_token(&mut ctx, &path("token")).unwrap());
+    assert_eq!(ctx.token("example.org").unwrap(), "file-token");
+}
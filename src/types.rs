@@ -1,3 +1,4 @@
+use anyhow::Result;
 use parse_display::{Display, FromStr};
 
 #[derive(Debug, Clone, PartialEq, Eq, FromStr, Display, clap::ValueEnum)]
@@ -5,6 +6,8 @@ use parse_display::{Display, FromStr};
 pub enum FormatOutput {
     Json,
     Yaml,
+    /// Output for humans, `text` is accepted too.
+    #[clap(alias = "text")]
     Table,
 }
 
@@ -19,3 +22,183 @@ impl FormatOutput {
         vec!["table".to_string(), "json".to_string(), "yaml".to_string()]
     }
 }
+
+/// A unit of length, for formats like OBJ and STL that don't say what unit they are in.
+#[derive(Debug, Clone, PartialEq, Eq, FromStr, Display, clap::ValueEnum)]
+#[display(style = "lowercase")]
+pub enum LengthUnit {
+    Mm,
+    Cm,
+    M,
+    In,
+    Ft,
+    Yd,
+}
+
+/// Parse a duration like "90", "30s", "2m", "1h30m" or "30d". A bare number is a number of seconds.
+pub fn parse_duration(s: &str) -> Result<std::time::Duration> {
+    let s = s.trim();
+    if let Ok(seconds) = s.parse::<u64>() {
+        return Ok(std::time::Duration::from_secs(seconds));
+    }
+
+    let mut total: u64 = 0;
+    let mut number = String::new();
+    for c in s.chars() {
+        if c.is_ascii_digit() {
+            number.push(c);
+            continue;
+        }
+
+        let multiplier = match c {
+            's' => 1,
+            'm' => 60,
+            'h' => 60 * 60,
+            'd' => 24 * 60 * 60,
+            _ => anyhow::bail!("invalid duration `{}`, expected something like 30s, 2m or 1h", s),
+        };
+        let value = number
+            .parse::<u64>()
+            .map_err(|_| anyhow::anyhow!("invalid duration `{}`, expected something like 30s, 2m or 1h", s))?;
+
+        total = value
+            .checked_mul(multiplier)
+            .and_then(|seconds| total.checked_add(seconds))
+            .ok_or_else(|| anyhow::anyhow!("invalid duration `{}`, it is too long", s))?;
+        number.clear();
+    }
+
+    if s.is_empty() || !number.is_empty() {
+        anyhow::bail!("invalid duration `{}`, expected something like 30s, 2m or 1h", s);
+    }
+
+    Ok(std::time::Duration::from_secs(total))
+}
+
+/// Parse how long to wait between polls, e.g. "10s". It must be at least a second, so we
+/// don't hammer the API.
+pub fn parse_interval(s: &str) -> Result<std::time::Duration> {
+    let interval = parse_duration(s)?;
+    if interval < std::time::Duration::from_secs(1) {
+        anyhow::bail!("invalid interval `{}`, it must be at least 1s", s.trim());
+    }
+
+    Ok(interval)
+}
+
+/// Parse a transfer rate in bytes per second, like curl's `--limit-rate`, e.g. "500k" or "2M".
+/// The k, m and g suffixes (in any case) are multiples of 1024.
+pub fn parse_rate(s: &str) -> Result<u64> {
+    let s = s.trim();
+    let (number, multiplier) = match s.chars().last().map(|c| c.to_ascii_lowercase()) {
+        Some('k') => (&s[..s.len() - 1], 1024),
+        Some('m') => (&s[..s.len() - 1], 1024 * 1024),
+        Some('g') => (&s[..s.len() - 1], 1024 * 1024 * 1024),
+        _ => (s, 1),
+    };
+
+    match number.parse::<u64>() {
+        Ok(value) if value > 0 => match value.checked_mul(multiplier) {
+            Some(rate) => Ok(rate),
+            None => anyhow::bail!("rate `{}` is too high, the most is {} bytes per second", s, u64::MAX),
+        },
+        _ => anyhow::bail!(
+            "invalid rate `{}`, expected a number of bytes per second like 500k or 2M",
+            s
+        ),
+    }
+}
+
+/// Format a number of bytes with a binary unit, e.g. "1.5 MiB".
+pub fn format_bytes(bytes: u64) -> String {
+    let units = ["KiB", "MiB", "GiB", "TiB"];
+    if bytes < 1024 {
+        return format!("{} B", bytes);
+    }
+
+    let mut value = bytes as f64;
+    let mut unit = "";
+    for u in units {
+        if value < 1024.0 {
+            break;
+        }
+        value /= 1024.0;
+        unit = u;
+    }
+
+    format!("{:.1} {}", value, unit)
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_parse_duration() {
+        assert_eq!(parse_duration("90").unwrap(), std::time::Duration::from_secs(90));
+        assert_eq!(parse_duration("30s").unwrap(), std::time::Duration::from_secs(30));
+        assert_eq!(parse_duration("2m").unwrap(), std::time::Duration::from_secs(120));
+        assert_eq!(parse_duration("1h30m").unwrap(), std::time::Duration::from_secs(5400));
+        assert_eq!(
+            parse_duration("30d").unwrap(),
+            std::time::Duration::from_secs(30 * 86400)
+        );
+
+        for bad in ["", "m", "2x", "2m30"] {
+            assert_eq!(
+                parse_duration(bad).unwrap_err().to_string(),
+                format!("invalid duration `{}`, expected something like 30s, 2m or 1h", bad)
+            );
+        }
+
+        for long in ["18446744073709551615m", "213503982334602d", "18446744073709551615s1s"] {
+            assert_eq!(
+                parse_duration(long).unwrap_err().to_string(),
+                format!("invalid duration `{}`, it is too long", long)
+            );
+        }
+    }
+
+    #[test]
+    fn test_parse_interval() {
+        assert_eq!(parse_interval("10s").unwrap(), std::time::Duration::from_secs(10));
+        for bad in ["0", "0s", "0m0s"] {
+            assert_eq!(
+                parse_interval(bad).unwrap_err().to_string(),
+                format!("invalid interval `{}`, it must be at least 1s", bad)
+            );
+        }
+    }
+
+    #[test]
+    fn test_parse_rate() {
+        assert_eq!(parse_rate("1000").unwrap(), 1000);
+        assert_eq!(parse_rate("500k").unwrap(), 500 * 1024);
+        assert_eq!(parse_rate("2M").unwrap(), 2 * 1024 * 1024);
+        assert_eq!(parse_rate("1g").unwrap(), 1024 * 1024 * 1024);
+
+        for bad in ["", "k", "0", "2x", "1.5M"] {
+            assert_eq!(
+                parse_rate(bad).unwrap_err().to_string(),
+                format!(
+                    "invalid rate `{}`, expected a number of bytes per second like 500k or 2M",
+                    bad
+                )
+            );
+        }
+
+        assert_eq!(
+            parse_rate("18014398509481984k").unwrap_err().to_string(),
+            "rate `18014398509481984k` is too high, the most is 18446744073709551615 bytes per second"
+        );
+    }
+
+    #[test]
+    fn test_format_bytes() {
+        assert_eq!(format_bytes(10), "10 B");
+        assert_eq!(format_bytes(1536), "1.5 KiB");
+        assert_eq!(format_bytes(3 * 1024 * 1024 * 1024), "3.0 GiB");
+    }
+}
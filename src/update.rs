@@ -1,8 +1,9 @@
+use std::fs;
 #[cfg(target_family = "unix")]
 use std::os::unix::fs::PermissionsExt;
-use std::{fs, io::Write};
 
 use anyhow::{anyhow, Context, Result};
+use parse_display::{Display, FromStr};
 use serde::{Deserialize, Serialize};
 
 use crate::config_file::get_env_var;
@@ -14,8 +15,53 @@ pub struct ReleaseInfo {
     pub version: String,
     pub url: String,
     pub published_at: chrono::DateTime<chrono::Utc>,
+    /// If GitHub marks the release as a prerelease.
+    #[serde(default)]
+    pub prerelease: bool,
+    #[serde(default)]
+    pub draft: bool,
 }
 
+/// Which releases to update to, set with `update_channel`. Each channel gets the releases
+/// of the channels before it too, so `nightly` gets everything.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, FromStr, Display)]
+#[display(style = "lowercase")]
+pub enum UpdateChannel {
+    Stable,
+    Prerelease,
+    Nightly,
+}
+
+impl UpdateChannel {
+    pub fn variants() -> Vec<String> {
+        vec!["stable".to_string(), "prerelease".to_string(), "nightly".to_string()]
+    }
+
+    /// Returns the channel a release is published in, nightly builds have `nightly` in
+    /// their tag.
+    fn of(release: &ReleaseInfo) -> UpdateChannel {
+        if release.version.contains("nightly") {
+            UpdateChannel::Nightly
+        } else if release.prerelease {
+            UpdateChannel::Prerelease
+        } else {
+            UpdateChannel::Stable
+        }
+    }
+}
+
+/// Returns the channel the config says to update from, stable if it doesn't say.
+pub fn update_channel(config: &dyn crate::config::Config) -> UpdateChannel {
+    config
+        .get("", "update_channel")
+        .ok()
+        .and_then(|channel| channel.parse().ok())
+        .unwrap_or(UpdateChannel::Stable)
+}
+
+/// The largest release binary we download, well over the size of ours.
+const MAX_BINARY_SIZE: u64 = 512 * 1024 * 1024;
+
 /// StateEntry stores information about a state.
 #[derive(Serialize, Deserialize, Clone, Debug)]
 pub struct StateEntry {
@@ -25,9 +71,14 @@ pub struct StateEntry {
 
 /// Check for updates to the cli.
 ///
-/// Returns the latest version of the cli, or none if there is not a new
+/// Returns the latest version of the cli in the channel, or none if there is not a new
 /// update or we shouldn't update.
-pub async fn check_for_update(current_version: &str, force: bool) -> Result<Option<ReleaseInfo>> {
+pub async fn check_for_update(
+    client: &reqwest::Client,
+    current_version: &str,
+    channel: UpdateChannel,
+    force: bool,
+) -> Result<Option<ReleaseInfo>> {
     if !should_check_for_update() && !force {
         return Ok(None);
     }
@@ -49,7 +100,7 @@ pub async fn check_for_update(current_version: &str, force: bool) -> Result<Opti
     }
 
     // Get the latest release.
-    let latest_release = get_latest_release_info().await?;
+    let latest_release = get_latest_release_info(client, channel).await?;
 
     // Update our state.
     set_state_entry(&state_file, chrono::Utc::now(), latest_release.clone())?;
@@ -77,39 +128,55 @@ fn is_ci() -> bool {
 		!get_env_var("RUN_ID").is_empty() // TaskCluster, dsari
 }
 
-/// Get the information about the latest version of the cli.
-pub async fn get_latest_release_info() -> Result<ReleaseInfo> {
+/// Get the information about the latest version of the cli in the channel.
+pub async fn get_latest_release_info(client: &reqwest::Client, channel: UpdateChannel) -> Result<ReleaseInfo> {
+    if channel == UpdateChannel::Stable {
+        // GitHub leaves out prereleases from the latest release for us.
+        return get_github(client, "https://api.github.com/repos/KittyCAD/cli/releases/latest").await;
+    }
+
+    let releases: Vec<ReleaseInfo> = get_github(client, "https://api.github.com/repos/KittyCAD/cli/releases").await?;
+    latest_in_channel(releases, channel).ok_or_else(|| anyhow!("there are no releases in the {} channel", channel))
+}
+
+/// Returns the newest of the releases in the channel.
+fn latest_in_channel(releases: Vec<ReleaseInfo>, channel: UpdateChannel) -> Option<ReleaseInfo> {
+    releases
+        .into_iter()
+        .filter(|release| !release.draft && UpdateChannel::of(release) <= channel)
+        .reduce(|latest, release| {
+            if version_greater_then(&release.version, &latest.version).unwrap_or_default() {
+                release
+            } else {
+                latest
+            }
+        })
+}
+
+/// Get a response from the GitHub API.
+async fn get_github<T: serde::de::DeserializeOwned>(client: &reqwest::Client, url: &str) -> Result<T> {
     // If the user has a GITHUB_TOKEN environment variable, use it to get the latest release.
     // This allows us to test this while the repo is still private.
     // We might want to remove this in the future.
     let github_token = crate::config_file::get_env_var("GITHUB_TOKEN");
 
-    let url = "https://api.github.com/repos/KittyCAD/cli/releases/latest";
-
-    let mut req = reqwest::Client::new().get(url);
-
-    // Set the user agent.
-    req = req.header("User-Agent", format!("kittycad/{}", clap::crate_version!()));
-
+    let mut req = client.get(url);
     if !github_token.is_empty() {
         req = req.bearer_auth(github_token);
     }
 
     let resp = req.send().await?;
-    let text = resp.text().await?;
-
-    let latest_release: ReleaseInfo = match serde_json::from_str(&text) {
-        Ok(release_info) => release_info,
-        Err(err) => {
-            return Err(anyhow!(
-                "Failed to parse response from GitHub: {}\ntext:\n{}",
-                err.to_string(),
-                text
-            ));
-        }
-    };
-
-    Ok(latest_release)
+    let body = crate::http_body::read_limited(resp, crate::http_body::DEFAULT_MAX_BODY_SIZE).await?;
+    let text = String::from_utf8_lossy(&body);
+
+    match serde_json::from_str(&text) {
+        Ok(value) => Ok(value),
+        Err(err) => Err(anyhow!(
+            "Failed to parse response from GitHub: {}\ntext:\n{}",
+            err.to_string(),
+            text
+        )),
+    }
 }
 
 /// Get an entry in the state file.
@@ -170,7 +237,7 @@ pub fn is_under_homebrew() -> Result<bool> {
 }
 
 /// Takes a version string and returns the URL to download the latest release.
-fn get_exe_download_url(version: &str) -> String {
+pub fn get_exe_download_url(version: &str) -> String {
     // Make sure the version starts with a v.
     let version = if !version.starts_with('v') {
         format!("v{}", version)
@@ -185,38 +252,32 @@ fn get_exe_download_url(version: &str) -> String {
     )
 }
 
-/// Takes a version string and downloads the latest binary to a temp file.
-/// This also checks the SHA256 hash of the file.
-pub async fn download_binary_to_temp_file(version: &str) -> Result<String> {
+/// Takes a version string and downloads the latest binary to a temp file, at most
+/// `rate` bytes per second if a rate is given.
+/// This also checks the SHA256 hash of the file, and its signature if there is a public
+/// key to check it with.
+pub async fn download_binary_to_temp_file(
+    client: &reqwest::Client,
+    version: &str,
+    rate: Option<u64>,
+    public_key: Option<&str>,
+) -> Result<(String, crate::update_verify::Verification)> {
     let temp_dir = std::env::temp_dir();
     let temp_file = temp_dir.join("kittycad");
 
     let url = get_exe_download_url(version);
 
-    // Get the contents of the binary.
-    let resp = reqwest::get(&url).await?;
-    let bin_body = resp.bytes().await?;
-
-    // Get the contents of the sha256sum.
-    let resp = reqwest::get(&format!("{}.sha256", url)).await?;
-    let sha256_body = resp.text().await?;
-    let sha256_parts = sha256_body.split(' ').collect::<Vec<&str>>();
-    let sha256_hash = sha256_parts[0];
-
-    // Verify the sha256 hash of the binary.
-    let bin_hash = sha256_digest(bin_body.as_ref())?;
-    if bin_hash != sha256_hash {
-        anyhow::bail!("SHA256 hash mismatch: local ({}) != remote ({})", bin_hash, sha256_hash);
-    }
-
-    // Write the body to the file.
+    // Stream the binary straight to the file, so we never hold it all in memory.
+    let resp = client.get(&url).send().await?.error_for_status()?;
     let mut f = std::fs::OpenOptions::new()
         .write(true)
         .truncate(true)
         .create(true)
         .open(&temp_file)?;
-    f.write_all(&bin_body)?;
-    f.flush()?;
+    crate::http_body::copy_to_limited(resp, &mut f, MAX_BINARY_SIZE, rate).await?;
+
+    // Verify the binary against what was published with it.
+    let verification = crate::update_verify::verify_download(client, &temp_file, &url, public_key).await?;
 
     let temp_file_path = temp_file
         .to_str()
@@ -227,25 +288,7 @@ pub async fn download_binary_to_temp_file(version: &str) -> Result<String> {
     #[cfg(target_family = "unix")]
     std::fs::set_permissions(&temp_file_path, std::fs::Permissions::from_mode(0o755))?;
 
-    Ok(temp_file_path.to_string())
-}
-
-/// Calculates the SHA256 hash of a reader.
-fn sha256_digest<R: std::io::Read>(mut reader: R) -> Result<String> {
-    let mut context = ring::digest::Context::new(&ring::digest::SHA256);
-    let mut buffer = [0; 1024];
-
-    loop {
-        let count = reader.read(&mut buffer)?;
-        if count == 0 {
-            break;
-        }
-        context.update(&buffer[..count]);
-    }
-
-    let digest = context.finish();
-
-    Ok(data_encoding::HEXLOWER.encode(digest.as_ref()))
+    Ok((temp_file_path.to_string(), verification))
 }
 
 #[cfg(test)]
@@ -258,7 +301,14 @@ mod test {
             return;
         }
 
-        let file = super::download_binary_to_temp_file("v0.1.0").await.unwrap();
+        let client = crate::context::http_client(
+            &crate::config::new_blank_config().unwrap(),
+            std::time::Duration::from_secs(60),
+        )
+        .unwrap();
+        let (file, _) = super::download_binary_to_temp_file(&client, "v0.1.0", None, None)
+            .await
+            .unwrap();
 
         assert_eq!(
             file,
@@ -293,16 +343,52 @@ mod test {
     #[tokio::test]
     #[serial_test::serial]
     async fn test_check_for_update() {
-        let result = super::check_for_update("0.0.1", true).await.unwrap();
+        let client = crate::context::http_client(
+            &crate::config::new_blank_config().unwrap(),
+            std::time::Duration::from_secs(60),
+        )
+        .unwrap();
+        let result = super::check_for_update(&client, "0.0.1", super::UpdateChannel::Stable, true)
+            .await
+            .unwrap();
         assert_eq!(result.is_some(), true);
 
         let latest_release = result.unwrap();
 
-        let gh_latest_release = super::get_latest_release_info().await.unwrap();
+        let gh_latest_release = super::get_latest_release_info(&client, super::UpdateChannel::Stable)
+            .await
+            .unwrap();
 
         assert_eq!(latest_release.version, gh_latest_release.version);
     }
 
+    #[test]
+    fn test_latest_in_channel() {
+        let release = |version: &str, prerelease: bool| super::ReleaseInfo {
+            version: version.to_string(),
+            url: String::new(),
+            published_at: chrono::Utc::now(),
+            prerelease,
+            draft: false,
+        };
+        let releases = vec![
+            release("v0.1.9", false),
+            release("v0.2.0-nightly.20220801", true),
+            release("v0.1.11-rc.1", true),
+            release("v0.1.10", false),
+        ];
+        let latest = |channel| {
+            super::latest_in_channel(releases.clone(), channel)
+                .map(|release| release.version)
+                .unwrap_or_default()
+        };
+
+        assert_eq!(latest(super::UpdateChannel::Stable), "v0.1.10");
+        assert_eq!(latest(super::UpdateChannel::Prerelease), "v0.1.11-rc.1");
+        assert_eq!(latest(super::UpdateChannel::Nightly), "v0.2.0-nightly.20220801");
+        assert!(super::latest_in_channel(vec![], super::UpdateChannel::Stable).is_none());
+    }
+
     pub struct TestItem {
         name: String,
         current_version: String,
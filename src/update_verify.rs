@@ -0,0 +1,138 @@
+use anyhow::{anyhow, Result};
+
+/// The largest published checksum or signature we read, they are a line or two.
+const MAX_SIGNATURE_SIZE: u64 = 64 * 1024;
+
+/// What was checked about a release binary.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Verification {
+    /// The SHA256 hash of the binary, which matches the published checksum.
+    pub sha256: String,
+    /// The public key the binary is signed with, if a signature was checked.
+    pub signed_by: Option<String>,
+}
+
+/// Returns the public key release binaries must be signed with, if `release_public_key`
+/// is set.
+pub fn public_key(config: &dyn crate::config::Config) -> Option<String> {
+    match config.get("", "release_public_key") {
+        Ok(key) if !key.trim().is_empty() => Some(key.trim().to_string()),
+        _ => None,
+    }
+}
+
+/// Download the published checksum and signature of the binary at the URL and check the
+/// file against them. The signature is only required and checked if there is a public key.
+pub async fn verify_download(
+    client: &reqwest::Client,
+    path: &std::path::Path,
+    url: &str,
+    public_key: Option<&str>,
+) -> Result<Verification> {
+    let checksum = fetch(client, &format!("{}.sha256", url), MAX_SIGNATURE_SIZE)
+        .await?
+        .ok_or_else(|| anyhow!("no checksum is published at {}.sha256", url))?;
+
+    let signature = match public_key {
+        Some(_) => Some(
+            fetch(client, &format!("{}.sig", url), MAX_SIGNATURE_SIZE)
+                .await?
+                .ok_or_else(|| anyhow!("no signature is published at {}.sig", url))?,
+        ),
+        None => None,
+    };
+
+    let data = std::fs::read(path).map_err(|err| anyhow!("failed to read {}: {}", path.display(), err))?;
+    verify(&data, &checksum, public_key.zip(signature.as_deref()))
+}
+
+/// Check the data against the contents of a `.sha256` file and, if one is given, a public
+/// key and the contents of the `.sig` file made with it.
+pub fn verify(data: &[u8], checksum: &str, signature: Option<(&str, &str)>) -> Result<Verification> {
+    let expected = parse_checksum(checksum)?;
+    let sha256 = sha256_hex(data);
+    if sha256 != expected {
+        anyhow::bail!("SHA256 hash mismatch: local ({}) != remote ({})", sha256, expected);
+    }
+
+    let signed_by = match signature {
+        Some((public_key, signature)) => {
+            crate::signing::verify(public_key, data, signature)?;
+            Some(public_key.to_string())
+        }
+        None => None,
+    };
+
+    Ok(Verification { sha256, signed_by })
+}
+
+/// Returns the hash in a `.sha256` file, which is the hash optionally followed by the
+/// file name, like `sha256sum` prints it.
+fn parse_checksum(checksum: &str) -> Result<String> {
+    let hash = checksum.split_whitespace().next().unwrap_or_default().to_lowercase();
+    if hash.len() != 64 || !hash.chars().all(|c| c.is_ascii_hexdigit()) {
+        anyhow::bail!("the published checksum `{}` is not a SHA256 hash", checksum.trim());
+    }
+
+    Ok(hash)
+}
+
+/// Returns the SHA256 hash of the data in hex.
+pub fn sha256_hex(data: &[u8]) -> String {
+    let digest = ring::digest::digest(&ring::digest::SHA256, data);
+    data_encoding::HEXLOWER.encode(digest.as_ref())
+}
+
+/// Returns the body at the URL, or none if there is nothing there. It fails if the body
+/// is larger than `limit` bytes.
+pub async fn fetch(client: &reqwest::Client, url: &str, limit: u64) -> Result<Option<String>> {
+    let resp = client.get(url).send().await?;
+    if resp.status() == reqwest::StatusCode::NOT_FOUND {
+        return Ok(None);
+    }
+    if !resp.status().is_success() {
+        anyhow::bail!("failed to download {}: {}", url, resp.status());
+    }
+
+    let body = crate::http_body::read_limited(resp, limit).await?;
+    Ok(Some(String::from_utf8_lossy(&body).to_string()))
+}
+
+#[cfg(test)]
+mod test {
+    use pretty_assertions::assert_eq;
+
+    use super::*;
+
+    #[test]
+    fn test_verify() {
+        let data = b"kittycad binary";
+        let checksum = format!("{}  kittycad-x86_64-unknown-linux-musl\n", sha256_hex(data));
+
+        let verification = verify(data, &checksum, None).unwrap();
+        assert_eq!(verification.sha256, sha256_hex(data));
+        assert_eq!(verification.signed_by, None);
+
+        assert!(verify(b"something else", &checksum, None)
+            .unwrap_err()
+            .to_string()
+            .starts_with("SHA256 hash mismatch"));
+        assert_eq!(
+            verify(data, "<html>not found</html>", None).unwrap_err().to_string(),
+            "the published checksum `<html>not found</html>` is not a SHA256 hash"
+        );
+
+        let dir = tempfile::tempdir().unwrap();
+        let (key, _) = crate::signing::load_or_create_key(dir.path().join("release.key").to_str().unwrap()).unwrap();
+        let public_key = crate::signing::public_key(&key);
+        let signature = crate::signing::sign(&key, data);
+
+        let verification = verify(data, &checksum, Some((&public_key, &signature))).unwrap();
+        assert_eq!(verification.signed_by, Some(public_key.clone()));
+
+        let (other_key, _) =
+            crate::signing::load_or_create_key(dir.path().join("other.key").to_str().unwrap()).unwrap();
+        let signature = crate::signing::sign(&other_key, data);
+        assert!(verify(data, &checksum, Some((&public_key, &signature))).is_err());
+    }
+}